@@ -0,0 +1,780 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 环境变量前缀，例如 QAQMALL_DATABASE_DSN
+const EnvPrefix = "QAQMALL_"
+
+// Config 应用配置
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Log       LogConfig       `yaml:"log"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Health    HealthConfig    `yaml:"health"`
+	Database  DatabaseConfig  `yaml:"database"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	Account   AccountConfig   `yaml:"account"`
+	Login     LoginConfig     `yaml:"login"`
+	MFA       MFAConfig       `yaml:"mfa"`
+	RBAC      RBACConfig      `yaml:"rbac"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Mail      MailConfig      `yaml:"mail"`
+	Alipay    AlipayConfig    `yaml:"alipay"`
+	Wechat    WechatConfig    `yaml:"wechat"`
+	OpenAI    OpenAIConfig    `yaml:"openai"`
+	Search    SearchConfig    `yaml:"search"`
+	Product   ProductConfig   `yaml:"product"`
+	Media     MediaConfig     `yaml:"media"`
+}
+
+// ServerConfig HTTP 服务配置
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	DrainDelay      time.Duration `yaml:"drain_delay"` // 收到关闭信号后 /readyz 先返回 503，等待该时长再停止接收请求
+	// TrustedProxies 可信的反向代理 IP 或 CIDR，只有来自这些地址的请求才按 X-Forwarded-For 取客户端 IP，默认不信任任何代理
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug、info、warn 或 error
+	Format string `yaml:"format"` // json 或 text
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+	Token   string `yaml:"token"` // 不为空时抓取指标需要带上 Authorization: Bearer <token>
+}
+
+// TracingConfig OpenTelemetry 链路追踪配置
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`     // none、otlp 或 stdout，none 时只透传请求中的 traceparent
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP 接收端地址，如 localhost:4318
+	Insecure    bool    `yaml:"insecure"`     // 使用 HTTP 而不是 HTTPS 连接 OTLP 接收端
+	ServiceName string  `yaml:"service_name"` // 上报的 service.name
+	SampleRatio float64 `yaml:"sample_ratio"` // 没有上游采样决定时的采样比例，0~1
+}
+
+// HealthConfig /readyz 就绪检查配置
+type HealthConfig struct {
+	Timeout           time.Duration `yaml:"timeout"`             // 每项检查的超时
+	PoolSaturation    float64       `yaml:"pool_saturation"`     // 使用中的连接数达到最大连接数的该比例时视为未就绪，0~1
+	PaymentGatewayURL string        `yaml:"payment_gateway_url"` // 不为空时检查支付网关是否可达，不影响就绪状态
+	CheckLLM          bool          `yaml:"check_llm"`           // 检查 openai.api_url 是否可达，不影响就绪状态
+}
+
+// DatabaseConfig 数据库配置
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver"` // mysql、postgres 或 sqlite
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// JWTConfig 身份令牌配置
+type JWTConfig struct {
+	Algorithm     string        `yaml:"algorithm"`      // 签名算法：RS256 或 EdDSA
+	Expire        time.Duration `yaml:"expire"`         // access token 有效期
+	RefreshExpire time.Duration `yaml:"refresh_expire"` // refresh token 有效期
+	KeyRotation   time.Duration `yaml:"key_rotation"`   // 签名密钥轮换周期
+}
+
+// AccountConfig 邮箱验证和找回密码配置
+type AccountConfig struct {
+	CodeSecret       string        `yaml:"code_secret"`        // 验证码签名密钥，至少32个字符
+	VerifyCodeExpire time.Duration `yaml:"verify_code_expire"` // 邮箱验证码有效期
+	ResetCodeExpire  time.Duration `yaml:"reset_code_expire"`  // 重置密码验证码有效期
+}
+
+// LoginConfig 登录防暴力破解配置
+type LoginConfig struct {
+	MaxFailures     int           `yaml:"max_failures"`     // 同一用户名连续失败多少次后锁定
+	IPMaxFailures   int           `yaml:"ip_max_failures"`  // 同一 IP 连续失败多少次后锁定
+	LockoutDuration time.Duration `yaml:"lockout_duration"` // 锁定时长
+	BaseDelay       time.Duration `yaml:"base_delay"`       // 失败后需要等待的初始时长，每多失败一次翻倍
+	FailureWindow   time.Duration `yaml:"failure_window"`   // 超过这么久没有失败时失败次数清零
+}
+
+// RBACConfig 权限策略配置
+type RBACConfig struct {
+	// PolicyReloadInterval 定期从数据库重新加载权限策略的间隔，多实例部署时使其他实例上的修改生效，0 表示不重新加载
+	PolicyReloadInterval time.Duration `yaml:"policy_reload_interval"`
+}
+
+// RateLimitConfig 接口限流配置，登录后按用户ID计数，未登录按 IP 计数
+type RateLimitConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Store    string        `yaml:"store"`    // memory 或 redis，多实例部署时使用 redis 共享计数
+	Auth     RateLimitRule `yaml:"auth"`     // 注册、登录、找回密码等未登录接口
+	AI       RateLimitRule `yaml:"ai"`       // AI 查询
+	Products RateLimitRule `yaml:"products"` // 商品列表
+	Default  RateLimitRule `yaml:"default"`  // 其他需要登录的接口
+}
+
+// RateLimitRule 令牌桶规则：每 Period 补充 Requests 个令牌，最多积攒 Burst 个，Requests 为 0 表示不限流
+type RateLimitRule struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"` // 为 0 时等于 Requests
+}
+
+// Capacity 令牌桶容量，即允许的最大突发请求数
+func (r RateLimitRule) Capacity() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Requests
+}
+
+// RedisConfig Redis 连接配置
+type RedisConfig struct {
+	Addr     string        `yaml:"addr"`
+	Password string        `yaml:"password"`
+	DB       int           `yaml:"db"`
+	MaxIdle  int           `yaml:"max_idle"` // 连接池最大空闲连接数
+	Timeout  time.Duration `yaml:"timeout"`  // 连接、读写超时时间
+}
+
+// MFAConfig 两步验证配置
+type MFAConfig struct {
+	Issuer          string        `yaml:"issuer"`            // 身份验证器 App 中显示的服务名称
+	ChallengeExpire time.Duration `yaml:"challenge_expire"`  // 密码验证通过后提交动态码的有效期
+	RequireForAdmin bool          `yaml:"require_for_admin"` // 权限策略允许访问管理接口的角色只接受通过两步验证登录的 token
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver   string `yaml:"driver"` // smtp、file 或 log
+	From     string `yaml:"from"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // 465 使用 TLS 直连，其他端口在服务器支持时使用 STARTTLS
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Dir      string `yaml:"dir"` // file 驱动保存邮件的目录
+}
+
+// AlipayConfig 支付宝配置
+type AlipayConfig struct {
+	AppID        string `yaml:"app_id"`
+	PrivateKey   string `yaml:"private_key"`
+	PublicKey    string `yaml:"public_key"`
+	IsProduction bool   `yaml:"is_production"`
+	NotifyURL    string `yaml:"notify_url"`
+	ReturnURL    string `yaml:"return_url"`
+}
+
+// WechatConfig 微信支付和微信登录配置
+// MchID 为空时不启用微信支付，AppSecret 为空时不启用网页授权登录，MiniAppID 为空时不启用小程序登录
+type WechatConfig struct {
+	AppID       string `yaml:"app_id"`
+	MchID       string `yaml:"mch_id"`
+	ApiV3Key    string `yaml:"api_v3_key"`
+	APIKey      string `yaml:"api_key"` // V2 API 密钥，用于校验支付结果通知的签名，为空时不处理支付结果通知
+	MchSerialNo string `yaml:"mch_serial_no"`
+	PrivateKey  string `yaml:"private_key"`
+	PublicKey   string `yaml:"public_key"`
+	NotifyURL   string `yaml:"notify_url"`
+	RefundURL   string `yaml:"refund_url"`
+
+	AppSecret     string        `yaml:"app_secret"`      // 公众号 AppSecret，用于网页授权登录
+	MiniAppID     string        `yaml:"mini_app_id"`     // 小程序 AppID
+	MiniAppSecret string        `yaml:"mini_app_secret"` // 小程序 AppSecret
+	APIBaseURL    string        `yaml:"api_base_url"`    // 微信登录接口地址，测试时可以指向本地服务
+	Timeout       time.Duration `yaml:"timeout"`         // 调用微信登录接口的超时时间
+}
+
+// OpenAIConfig AI 查询服务配置
+type OpenAIConfig struct {
+	APIKey  string        `yaml:"api_key"`
+	APIURL  string        `yaml:"api_url"`
+	Model   string        `yaml:"model"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SearchConfig 商品搜索配置
+type SearchConfig struct {
+	Backend         string        `yaml:"backend"`          // sql 或 index，index 为进程内的倒排索引，不依赖外部搜索服务
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // index 后端定期全量重建索引的间隔，使库存、销量等变化生效，0 表示不定期重建
+	PriceBuckets    []float64     `yaml:"price_buckets"`    // 价格分面的分界点，从小到大
+}
+
+// ProductConfig 商品详情配置
+type ProductConfig struct {
+	ViewFlushInterval time.Duration `yaml:"view_flush_interval"` // 浏览次数在内存中累加，每隔该时长写入数据库
+	LowStockThreshold int           `yaml:"low_stock_threshold"` // 库存不超过该值时库存状态为 low_stock
+	RelatedLimit      int           `yaml:"related_limit"`       // 商品详情中相关商品的最大数量
+}
+
+// MediaConfig 商品图片存储配置
+type MediaConfig struct {
+	Driver string `yaml:"driver"` // local 或 s3
+	Dir    string `yaml:"dir"`    // local 驱动保存图片的目录
+	// BaseURL 图片访问地址的前缀；local 驱动时为以 / 开头的路径则由本服务提供静态文件，
+	// s3 驱动时为空表示使用 endpoint/bucket
+	BaseURL       string `yaml:"base_url"`
+	Endpoint      string `yaml:"endpoint"` // s3 驱动的服务地址，如 https://s3.us-east-1.amazonaws.com 或 MinIO 地址，按 path-style 访问
+	Region        string `yaml:"region"`
+	Bucket        string `yaml:"bucket"`
+	AccessKey     string `yaml:"access_key"`
+	SecretKey     string `yaml:"secret_key"`
+	MaxSize       int    `yaml:"max_size"`       // 单张图片的最大字节数
+	MaxImages     int    `yaml:"max_images"`     // 每个商品最多的图片数量
+	ThumbnailSize int    `yaml:"thumbnail_size"` // 缩略图的最大边长（像素）
+}
+
+// Default 返回带默认值的配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8888",
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Health: HealthConfig{
+			Timeout:        2 * time.Second,
+			PoolSaturation: 1,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			ServiceName: "qaqmall",
+			SampleRatio: 1,
+		},
+		Database: DatabaseConfig{
+			Driver:          "mysql",
+			MaxOpenConns:    50,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+		},
+		JWT: JWTConfig{
+			Algorithm:     "RS256",
+			Expire:        15 * time.Minute,
+			RefreshExpire: 7 * 24 * time.Hour,
+			KeyRotation:   30 * 24 * time.Hour,
+		},
+		Account: AccountConfig{
+			VerifyCodeExpire: 24 * time.Hour,
+			ResetCodeExpire:  30 * time.Minute,
+		},
+		Login: LoginConfig{
+			MaxFailures:     5,
+			IPMaxFailures:   50,
+			LockoutDuration: 15 * time.Minute,
+			BaseDelay:       time.Second,
+			FailureWindow:   time.Hour,
+		},
+		MFA: MFAConfig{
+			Issuer:          "qaqmall",
+			ChallengeExpire: 5 * time.Minute,
+		},
+		RBAC: RBACConfig{
+			PolicyReloadInterval: 30 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:  true,
+			Store:    "memory",
+			Auth:     RateLimitRule{Requests: 10, Period: time.Minute, Burst: 5},
+			AI:       RateLimitRule{Requests: 20, Period: time.Minute, Burst: 5},
+			Products: RateLimitRule{Requests: 600, Period: time.Minute, Burst: 100},
+			Default:  RateLimitRule{Requests: 300, Period: time.Minute, Burst: 60},
+		},
+		Redis: RedisConfig{
+			Addr:    "127.0.0.1:6379",
+			MaxIdle: 10,
+			Timeout: 3 * time.Second,
+		},
+		Mail: MailConfig{
+			Driver: "log",
+			From:   "qaqmall <noreply@localhost>",
+			Port:   587,
+			Dir:    "mail",
+		},
+		Wechat: WechatConfig{
+			APIBaseURL: "https://api.weixin.qq.com",
+			Timeout:    10 * time.Second,
+		},
+		OpenAI: OpenAIConfig{
+			APIURL:  "https://api.openai.com/v1/chat/completions",
+			Model:   "gpt-3.5-turbo",
+			Timeout: 30 * time.Second,
+		},
+		Search: SearchConfig{
+			Backend:         "sql",
+			RefreshInterval: 5 * time.Minute,
+			PriceBuckets:    []float64{100, 500, 1000, 5000},
+		},
+		Product: ProductConfig{
+			ViewFlushInterval: 30 * time.Second,
+			LowStockThreshold: 10,
+			RelatedLimit:      8,
+		},
+		Media: MediaConfig{
+			Driver:        "local",
+			Dir:           "uploads",
+			BaseURL:       "/uploads",
+			Region:        "us-east-1",
+			MaxSize:       5 << 20,
+			MaxImages:     10,
+			ThumbnailSize: 320,
+		},
+	}
+}
+
+// Load 加载配置并校验所有必填项
+func Load(args []string) (*Config, error) {
+	cfg, err := Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse 按 默认值 -> 配置文件 -> 环境变量 -> 命令行参数 的顺序逐层加载配置，不做校验
+// 供只需要部分配置的子命令（如 migrate）使用
+func Parse(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("qaqmall", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "配置文件路径（.yaml/.yml/.toml）")
+	addr := fs.String("addr", "", "HTTP 监听地址")
+	driver := fs.String("db-driver", "", "数据库驱动（mysql/postgres/sqlite）")
+	dsn := fs.String("dsn", "", "数据库连接串")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// 配置文件
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// 环境变量
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	// 命令行参数，只覆盖显式指定的参数
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Server.Addr = *addr
+		case "db-driver":
+			cfg.Database.Driver = *driver
+		case "dsn":
+			cfg.Database.DSN = *dsn
+		}
+	})
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		// go-toml 不支持把 "24h" 这类字符串解析为 time.Duration，
+		// 先解析为通用结构再交给 yaml 解码，两种格式的字段规则保持一致
+		var raw map[string]interface{}
+		if err = toml.Unmarshal(data, &raw); err == nil {
+			if data, err = yaml.Marshal(raw); err == nil {
+				err = yaml.Unmarshal(data, c)
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return nil
+}
+
+// envBinding 环境变量与配置字段的对应关系
+type envBinding struct {
+	name   string
+	target interface{}
+}
+
+func (c *Config) envBindings() []envBinding {
+	return []envBinding{
+		{"SERVER_ADDR", &c.Server.Addr},
+		{"SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout},
+		{"SERVER_DRAIN_DELAY", &c.Server.DrainDelay},
+		{"SERVER_TRUSTED_PROXIES", &c.Server.TrustedProxies},
+		{"LOG_LEVEL", &c.Log.Level},
+		{"LOG_FORMAT", &c.Log.Format},
+		{"METRICS_ENABLED", &c.Metrics.Enabled},
+		{"METRICS_PATH", &c.Metrics.Path},
+		{"METRICS_TOKEN", &c.Metrics.Token},
+		{"TRACING_EXPORTER", &c.Tracing.Exporter},
+		{"TRACING_ENDPOINT", &c.Tracing.Endpoint},
+		{"TRACING_INSECURE", &c.Tracing.Insecure},
+		{"TRACING_SERVICE_NAME", &c.Tracing.ServiceName},
+		{"TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio},
+		{"HEALTH_TIMEOUT", &c.Health.Timeout},
+		{"HEALTH_POOL_SATURATION", &c.Health.PoolSaturation},
+		{"HEALTH_PAYMENT_GATEWAY_URL", &c.Health.PaymentGatewayURL},
+		{"HEALTH_CHECK_LLM", &c.Health.CheckLLM},
+		{"DATABASE_DRIVER", &c.Database.Driver},
+		{"DATABASE_DSN", &c.Database.DSN},
+		{"DATABASE_MAX_OPEN_CONNS", &c.Database.MaxOpenConns},
+		{"DATABASE_MAX_IDLE_CONNS", &c.Database.MaxIdleConns},
+		{"DATABASE_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime},
+		{"JWT_ALGORITHM", &c.JWT.Algorithm},
+		{"JWT_EXPIRE", &c.JWT.Expire},
+		{"JWT_REFRESH_EXPIRE", &c.JWT.RefreshExpire},
+		{"JWT_KEY_ROTATION", &c.JWT.KeyRotation},
+		{"ACCOUNT_CODE_SECRET", &c.Account.CodeSecret},
+		{"ACCOUNT_VERIFY_CODE_EXPIRE", &c.Account.VerifyCodeExpire},
+		{"ACCOUNT_RESET_CODE_EXPIRE", &c.Account.ResetCodeExpire},
+		{"LOGIN_MAX_FAILURES", &c.Login.MaxFailures},
+		{"LOGIN_IP_MAX_FAILURES", &c.Login.IPMaxFailures},
+		{"LOGIN_LOCKOUT_DURATION", &c.Login.LockoutDuration},
+		{"LOGIN_BASE_DELAY", &c.Login.BaseDelay},
+		{"LOGIN_FAILURE_WINDOW", &c.Login.FailureWindow},
+		{"MFA_ISSUER", &c.MFA.Issuer},
+		{"MFA_CHALLENGE_EXPIRE", &c.MFA.ChallengeExpire},
+		{"MFA_REQUIRE_FOR_ADMIN", &c.MFA.RequireForAdmin},
+		{"RBAC_POLICY_RELOAD_INTERVAL", &c.RBAC.PolicyReloadInterval},
+		{"RATE_LIMIT_ENABLED", &c.RateLimit.Enabled},
+		{"RATE_LIMIT_STORE", &c.RateLimit.Store},
+		{"RATE_LIMIT_AUTH_REQUESTS", &c.RateLimit.Auth.Requests},
+		{"RATE_LIMIT_AUTH_PERIOD", &c.RateLimit.Auth.Period},
+		{"RATE_LIMIT_AUTH_BURST", &c.RateLimit.Auth.Burst},
+		{"RATE_LIMIT_AI_REQUESTS", &c.RateLimit.AI.Requests},
+		{"RATE_LIMIT_AI_PERIOD", &c.RateLimit.AI.Period},
+		{"RATE_LIMIT_AI_BURST", &c.RateLimit.AI.Burst},
+		{"RATE_LIMIT_PRODUCTS_REQUESTS", &c.RateLimit.Products.Requests},
+		{"RATE_LIMIT_PRODUCTS_PERIOD", &c.RateLimit.Products.Period},
+		{"RATE_LIMIT_PRODUCTS_BURST", &c.RateLimit.Products.Burst},
+		{"RATE_LIMIT_DEFAULT_REQUESTS", &c.RateLimit.Default.Requests},
+		{"RATE_LIMIT_DEFAULT_PERIOD", &c.RateLimit.Default.Period},
+		{"RATE_LIMIT_DEFAULT_BURST", &c.RateLimit.Default.Burst},
+		{"REDIS_ADDR", &c.Redis.Addr},
+		{"REDIS_PASSWORD", &c.Redis.Password},
+		{"REDIS_DB", &c.Redis.DB},
+		{"REDIS_MAX_IDLE", &c.Redis.MaxIdle},
+		{"REDIS_TIMEOUT", &c.Redis.Timeout},
+		{"MAIL_DRIVER", &c.Mail.Driver},
+		{"MAIL_FROM", &c.Mail.From},
+		{"MAIL_HOST", &c.Mail.Host},
+		{"MAIL_PORT", &c.Mail.Port},
+		{"MAIL_USERNAME", &c.Mail.Username},
+		{"MAIL_PASSWORD", &c.Mail.Password},
+		{"MAIL_DIR", &c.Mail.Dir},
+		{"ALIPAY_APP_ID", &c.Alipay.AppID},
+		{"ALIPAY_PRIVATE_KEY", &c.Alipay.PrivateKey},
+		{"ALIPAY_PUBLIC_KEY", &c.Alipay.PublicKey},
+		{"ALIPAY_IS_PRODUCTION", &c.Alipay.IsProduction},
+		{"ALIPAY_NOTIFY_URL", &c.Alipay.NotifyURL},
+		{"ALIPAY_RETURN_URL", &c.Alipay.ReturnURL},
+		{"WECHAT_APP_ID", &c.Wechat.AppID},
+		{"WECHAT_MCH_ID", &c.Wechat.MchID},
+		{"WECHAT_API_V3_KEY", &c.Wechat.ApiV3Key},
+		{"WECHAT_API_KEY", &c.Wechat.APIKey},
+		{"WECHAT_MCH_SERIAL_NO", &c.Wechat.MchSerialNo},
+		{"WECHAT_PRIVATE_KEY", &c.Wechat.PrivateKey},
+		{"WECHAT_PUBLIC_KEY", &c.Wechat.PublicKey},
+		{"WECHAT_NOTIFY_URL", &c.Wechat.NotifyURL},
+		{"WECHAT_REFUND_URL", &c.Wechat.RefundURL},
+		{"WECHAT_APP_SECRET", &c.Wechat.AppSecret},
+		{"WECHAT_MINI_APP_ID", &c.Wechat.MiniAppID},
+		{"WECHAT_MINI_APP_SECRET", &c.Wechat.MiniAppSecret},
+		{"WECHAT_API_BASE_URL", &c.Wechat.APIBaseURL},
+		{"WECHAT_TIMEOUT", &c.Wechat.Timeout},
+		{"OPENAI_API_KEY", &c.OpenAI.APIKey},
+		{"OPENAI_API_URL", &c.OpenAI.APIURL},
+		{"OPENAI_MODEL", &c.OpenAI.Model},
+		{"OPENAI_TIMEOUT", &c.OpenAI.Timeout},
+		{"SEARCH_BACKEND", &c.Search.Backend},
+		{"SEARCH_REFRESH_INTERVAL", &c.Search.RefreshInterval},
+		{"PRODUCT_VIEW_FLUSH_INTERVAL", &c.Product.ViewFlushInterval},
+		{"MEDIA_DRIVER", &c.Media.Driver},
+		{"MEDIA_DIR", &c.Media.Dir},
+		{"MEDIA_BASE_URL", &c.Media.BaseURL},
+		{"MEDIA_ENDPOINT", &c.Media.Endpoint},
+		{"MEDIA_REGION", &c.Media.Region},
+		{"MEDIA_BUCKET", &c.Media.Bucket},
+		{"MEDIA_ACCESS_KEY", &c.Media.AccessKey},
+		{"MEDIA_SECRET_KEY", &c.Media.SecretKey},
+		{"MEDIA_MAX_SIZE", &c.Media.MaxSize},
+	}
+}
+
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	for _, b := range c.envBindings() {
+		value, ok := lookup(EnvPrefix + b.name)
+		if !ok {
+			continue
+		}
+
+		switch target := b.target.(type) {
+		case *string:
+			*target = value
+		case *[]string:
+			// 多个值用逗号分隔
+			*target = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*target = append(*target, item)
+				}
+			}
+		case *int:
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 不是合法的整数: %v", EnvPrefix, b.name, err)
+			}
+			*target = v
+		case *bool:
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 不是合法的布尔值: %v", EnvPrefix, b.name, err)
+			}
+			*target = v
+		case *float64:
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 不是合法的数字: %v", EnvPrefix, b.name, err)
+			}
+			*target = v
+		case *time.Duration:
+			v, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 不是合法的时长: %v", EnvPrefix, b.name, err)
+			}
+			*target = v
+		}
+	}
+	return nil
+}
+
+// Validate 校验启动所需的必填配置
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr 不能为空"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout 必须大于0"))
+	}
+	if c.Server.DrainDelay < 0 || c.Server.DrainDelay >= c.Server.ShutdownTimeout {
+		errs = append(errs, errors.New("server.drain_delay 不能小于0，且必须小于 server.shutdown_timeout"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies 中的 %q 不是合法的 IP 或 CIDR", proxy))
+		}
+	}
+	if c.Health.Timeout <= 0 {
+		errs = append(errs, errors.New("health.timeout 必须大于0"))
+	}
+	if c.Health.PoolSaturation <= 0 || c.Health.PoolSaturation > 1 {
+		errs = append(errs, errors.New("health.pool_saturation 必须大于0且不超过1"))
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level 不支持 %q，可选 debug、info、warn、error", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("log.format 不支持 %q，可选 json、text", c.Log.Format))
+	}
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		errs = append(errs, errors.New("metrics.path 必须以 / 开头"))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			errs = append(errs, errors.New("使用 otlp 上报链路时 tracing.endpoint 不能为空"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter 不支持 %q，可选 none、otlp、stdout", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio 必须在 0 到 1 之间"))
+	}
+	switch c.Search.Backend {
+	case "sql", "index":
+	default:
+		errs = append(errs, fmt.Errorf("search.backend 不支持 %q，可选 sql、index", c.Search.Backend))
+	}
+	if c.Search.RefreshInterval < 0 {
+		errs = append(errs, errors.New("search.refresh_interval 不能小于0"))
+	}
+	for i, bound := range c.Search.PriceBuckets {
+		if bound <= 0 || (i > 0 && bound <= c.Search.PriceBuckets[i-1]) {
+			errs = append(errs, errors.New("search.price_buckets 必须是从小到大排列的正数"))
+			break
+		}
+	}
+	if c.Product.ViewFlushInterval <= 0 {
+		errs = append(errs, errors.New("product.view_flush_interval 必须大于0"))
+	}
+	if c.Product.LowStockThreshold < 0 {
+		errs = append(errs, errors.New("product.low_stock_threshold 不能小于0"))
+	}
+	if c.Product.RelatedLimit < 0 || c.Product.RelatedLimit > 50 {
+		errs = append(errs, errors.New("product.related_limit 必须在 0 到 50 之间"))
+	}
+	switch c.Media.Driver {
+	case "local":
+		if c.Media.Dir == "" {
+			errs = append(errs, errors.New("使用 local 存储图片时 media.dir 不能为空"))
+		}
+	case "s3":
+		if c.Media.Endpoint == "" || c.Media.Region == "" || c.Media.Bucket == "" || c.Media.AccessKey == "" || c.Media.SecretKey == "" {
+			errs = append(errs, errors.New("使用 s3 存储图片时 media.endpoint、media.region、media.bucket、media.access_key、media.secret_key 不能为空"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("media.driver 不支持 %q，可选 local、s3", c.Media.Driver))
+	}
+	if c.Media.MaxSize <= 0 || c.Media.MaxImages <= 0 {
+		errs = append(errs, errors.New("media.max_size、media.max_images 必须大于0"))
+	}
+	if c.Media.ThumbnailSize < 16 || c.Media.ThumbnailSize > 2048 {
+		errs = append(errs, errors.New("media.thumbnail_size 必须在 16 到 2048 之间"))
+	}
+	switch c.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		errs = append(errs, fmt.Errorf("database.driver 不支持 %q，可选 mysql、postgres、sqlite", c.Database.Driver))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn 不能为空"))
+	}
+	switch c.JWT.Algorithm {
+	case "RS256", "EdDSA":
+	default:
+		errs = append(errs, fmt.Errorf("jwt.algorithm 不支持 %q，可选 RS256、EdDSA", c.JWT.Algorithm))
+	}
+	if c.JWT.Expire <= 0 {
+		errs = append(errs, errors.New("jwt.expire 必须大于0"))
+	}
+	if c.JWT.RefreshExpire <= c.JWT.Expire {
+		errs = append(errs, errors.New("jwt.refresh_expire 必须大于 jwt.expire"))
+	}
+	if c.JWT.KeyRotation <= 0 {
+		errs = append(errs, errors.New("jwt.key_rotation 必须大于0"))
+	}
+	if len(c.Account.CodeSecret) < 32 {
+		errs = append(errs, errors.New("account.code_secret 至少需要32个字符"))
+	}
+	if c.Account.VerifyCodeExpire <= 0 || c.Account.ResetCodeExpire <= 0 {
+		errs = append(errs, errors.New("account.verify_code_expire 和 account.reset_code_expire 必须大于0"))
+	}
+	if c.Login.MaxFailures <= 0 || c.Login.IPMaxFailures <= 0 {
+		errs = append(errs, errors.New("login.max_failures 和 login.ip_max_failures 必须大于0"))
+	}
+	if c.Login.LockoutDuration <= 0 || c.Login.FailureWindow <= 0 || c.Login.BaseDelay < 0 {
+		errs = append(errs, errors.New("login.lockout_duration、login.failure_window 必须大于0，login.base_delay 不能小于0"))
+	}
+	if c.MFA.Issuer == "" || strings.Contains(c.MFA.Issuer, ":") {
+		errs = append(errs, errors.New("mfa.issuer 不能为空且不能包含冒号"))
+	}
+	if c.MFA.ChallengeExpire <= 0 {
+		errs = append(errs, errors.New("mfa.challenge_expire 必须大于0"))
+	}
+	if c.RBAC.PolicyReloadInterval < 0 {
+		errs = append(errs, errors.New("rbac.policy_reload_interval 不能小于0"))
+	}
+	if c.RateLimit.Enabled {
+		switch c.RateLimit.Store {
+		case "memory":
+		case "redis":
+			if c.Redis.Addr == "" || c.Redis.Timeout <= 0 {
+				errs = append(errs, errors.New("使用 redis 限流时 redis.addr 不能为空，redis.timeout 必须大于0"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("rate_limit.store 不支持 %q，可选 memory、redis", c.RateLimit.Store))
+		}
+		for _, group := range []struct {
+			name string
+			rule RateLimitRule
+		}{
+			{"auth", c.RateLimit.Auth},
+			{"ai", c.RateLimit.AI},
+			{"products", c.RateLimit.Products},
+			{"default", c.RateLimit.Default},
+		} {
+			if group.rule.Requests < 0 || group.rule.Burst < 0 || (group.rule.Requests > 0 && group.rule.Period <= 0) {
+				errs = append(errs, fmt.Errorf("rate_limit.%s 配置错误：requests、burst 不能小于0，限流时 period 必须大于0", group.name))
+			}
+		}
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		errs = append(errs, fmt.Errorf("mail.from 不是合法的邮件地址: %v", err))
+	}
+	switch c.Mail.Driver {
+	case "smtp":
+		if c.Mail.Host == "" || c.Mail.Port <= 0 {
+			errs = append(errs, errors.New("使用 smtp 发送邮件时 mail.host、mail.port 不能为空"))
+		}
+	case "file":
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("使用 file 发送邮件时 mail.dir 不能为空"))
+		}
+	case "log":
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver 不支持 %q，可选 smtp、file、log", c.Mail.Driver))
+	}
+	if c.Alipay.AppID == "" || c.Alipay.PrivateKey == "" || c.Alipay.PublicKey == "" {
+		errs = append(errs, errors.New("alipay.app_id、alipay.private_key、alipay.public_key 不能为空"))
+	}
+	if c.Wechat.MchID != "" && (c.Wechat.ApiV3Key == "" || c.Wechat.MchSerialNo == "" || c.Wechat.PrivateKey == "") {
+		errs = append(errs, errors.New("启用微信支付时 wechat.api_v3_key、wechat.mch_serial_no、wechat.private_key 不能为空"))
+	}
+	if c.Wechat.AppSecret != "" && c.Wechat.AppID == "" {
+		errs = append(errs, errors.New("启用微信网页授权登录时 wechat.app_id 不能为空"))
+	}
+	if c.Wechat.MiniAppID != "" && c.Wechat.MiniAppSecret == "" {
+		errs = append(errs, errors.New("启用微信小程序登录时 wechat.mini_app_secret 不能为空"))
+	}
+	if (c.Wechat.AppSecret != "" || c.Wechat.MiniAppID != "") && (c.Wechat.APIBaseURL == "" || c.Wechat.Timeout <= 0) {
+		errs = append(errs, errors.New("启用微信登录时 wechat.api_base_url 不能为空，wechat.timeout 必须大于0"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("配置校验失败: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package config
+
+import _ "embed"
+
+// RBACModel Casbin 权限模型，编译时嵌入，运行时不依赖工作目录
+//
+//go:embed rbac_model.conf
+var RBACModel string
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/mail"
+	"qaqmall/models"
+)
+
+// AccountHandler 邮箱验证、找回密码和修改密码
+type AccountHandler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	sessions *auth.Sessions
+	codes    *auth.Codes
+	mailer   mail.Mailer
+	// outbox 异步发送找回密码邮件，避免响应时间暴露邮箱是否已绑定账号
+	outbox *mail.Outbox
+}
+
+func NewAccountHandler(db *gorm.DB, cfg *config.Config, sessions *auth.Sessions, codes *auth.Codes, mailer mail.Mailer, outbox *mail.Outbox) *AccountHandler {
+	return &AccountHandler{db: db, cfg: cfg, sessions: sessions, codes: codes, mailer: mailer, outbox: outbox}
+}
+
+// VerifyEmail 使用邮件中的验证码完成邮箱验证
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"error": "无效的请求参数",
+		})
+		return
+	}
+
+	user, err := h.userByCode(auth.PurposeVerifyEmail, req.Code)
+	if err != nil {
+		h.codeError(c, err)
+		return
+	}
+
+	// 同一个邮箱只能被一个账号验证，找回密码时才能唯一确定账号
+	var count int64
+	if err := h.db.Model(&models.User{}).
+		Where("email = ? AND email_verified_at IS NOT NULL AND id <> ?", user.Email, user.ID).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "验证邮箱失败",
+		})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":  409,
+			"error": "该邮箱已被其他账号验证",
+		})
+		return
+	}
+
+	// 带条件更新，并发使用同一个验证码时只有一个请求成功
+	result := h.db.Model(&models.User{}).
+		Where("id = ? AND email = ? AND email_verified_at IS NULL", user.ID, user.Email).
+		Update("email_verified_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "验证邮箱失败",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.codeError(c, auth.ErrInvalidCode)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "邮箱验证成功",
+	})
+}
+
+// ResendVerification 重新发送邮箱验证邮件
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未设置邮箱"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已验证"})
+		return
+	}
+
+	if err := sendVerificationEmail(c.Request.Context(), h.mailer, h.codes, &user); err != nil {
+		logging.FromContext(c).Error("发送验证邮件失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送验证邮件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "验证邮件已发送",
+	})
+}
+
+// ForgotPassword 向已验证的邮箱发送重置密码邮件，多个账号验证了同一个邮箱时（如验证时的并发请求），每个账号各发一封
+// 无论邮箱是否存在都返回相同的结果；邮件放入队列异步发送，响应时间也不会暴露邮箱是否存在
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"error": "无效的邮箱地址",
+		})
+		return
+	}
+
+	var users []models.User
+	if err := h.db.Where("email = ? AND email_verified_at IS NOT NULL", req.Email).Order("id").Find(&users).Error; err != nil {
+		logging.FromContext(c).Error("查询用户失败", "error", err)
+	}
+	for i := range users {
+		if err := queuePasswordResetEmail(c.Request.Context(), h.outbox, h.codes, &users[i]); err != nil {
+			logging.FromContext(c).Error("发送重置密码邮件失败", "user_id", users[i].ID, "error", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "如果该邮箱已绑定账号，重置密码邮件已发送",
+	})
+}
+
+// ResetPassword 使用邮件中的验证码设置新密码，成功后所有设备需要重新登录
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Code     string `json:"code" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userByCode(auth.PurposeResetPassword, req.Code)
+	if err != nil {
+		h.codeError(c, err)
+		return
+	}
+
+	if err := h.setPassword(user, req.Password); err != nil {
+		if errors.Is(err, auth.ErrInvalidCode) {
+			h.codeError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "重置密码失败",
+		})
+		return
+	}
+	if _, err := h.sessions.RevokeAll(user.ID); err != nil {
+		logging.FromContext(c).Error("重置密码后结束会话失败", "user_id", user.ID, "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "密码已重置，请重新登录",
+	})
+}
+
+// ChangePassword 登录后修改密码，当前设备保持登录，其他设备需要重新登录
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"old_password"` // 通过微信登录注册、还没有设置过密码的用户不需要提供
+		NewPassword string `json:"new_password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.Password != "" && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "原密码错误"})
+		return
+	}
+
+	if err := h.setPassword(&user, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+	revoked, err := h.sessions.RevokeOthers(user.ID, c.GetString("session_id"))
+	if err != nil {
+		logging.FromContext(c).Error("修改密码后结束会话失败", "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "密码修改成功",
+		"data": gin.H{
+			"revoked_sessions": revoked,
+		},
+	})
+}
+
+// userByCode 校验验证码并返回所属用户
+func (h *AccountHandler) userByCode(purpose, code string) (*models.User, error) {
+	userID, err := h.codes.UserID(purpose, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidCode
+		}
+		return nil, err
+	}
+	if err := h.codes.Check(purpose, code, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setPassword 更新密码，只有密码未被并发修改时才会成功，保证重置密码的验证码只能使用一次
+func (h *AccountHandler) setPassword(user *models.User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	result := h.db.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", string(hashedPassword))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return auth.ErrInvalidCode
+	}
+	user.Password = string(hashedPassword)
+	return nil
+}
+
+func (h *AccountHandler) codeError(c *gin.Context, err error) {
+	if errors.Is(err, auth.ErrInvalidCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"error": "验证码无效或已过期",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code":  500,
+		"error": "校验验证码失败",
+	})
+}
+
+// sendVerificationEmail 向用户当前的邮箱发送验证邮件
+func sendVerificationEmail(ctx context.Context, mailer mail.Mailer, codes *auth.Codes, user *models.User) error {
+	code, err := codes.Issue(auth.PurposeVerifyEmail, user)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mail.SendTimeout)
+	defer cancel()
+	return mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "验证您的邮箱",
+		Body: fmt.Sprintf("%s，您好：\n\n您的邮箱验证码为：\n\n%s\n\n请调用 POST /email/verify 提交该验证码完成验证。\n如果这不是您本人的操作，请忽略本邮件。\n",
+			user.Username, code),
+	})
+}
+
+// queuePasswordResetEmail 把重置密码邮件放入发送队列，邮件中带有用户名，同一邮箱的多个账号可以区分
+func queuePasswordResetEmail(ctx context.Context, outbox *mail.Outbox, codes *auth.Codes, user *models.User) error {
+	code, err := codes.Issue(auth.PurposeResetPassword, user)
+	if err != nil {
+		return err
+	}
+
+	return outbox.Enqueue(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "重置您的密码",
+		Body: fmt.Sprintf("%s，您好：\n\n您的重置密码验证码为：\n\n%s\n\n该验证码只能使用一次。请调用 POST /password/reset 提交验证码和新密码，重置后所有设备需要重新登录。\n如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。\n",
+			user.Username, code),
+	})
+}
+
+// validEmail 校验是否为单纯的邮箱地址（不带显示名称），长度不超过 users.email 字段
+func validEmail(email string) bool {
+	if len(email) > 128 {
+		return false
+	}
+	addr, err := netmail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
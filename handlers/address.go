@@ -7,15 +7,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"qaqmall/config"
 	"qaqmall/models"
 )
 
 type AddressHandler struct {
-	db *gorm.DB
+	db  *gorm.DB
+	cfg *config.Config
 }
 
-func NewAddressHandler(db *gorm.DB) *AddressHandler {
-	return &AddressHandler{db: db}
+func NewAddressHandler(db *gorm.DB, cfg *config.Config) *AddressHandler {
+	return &AddressHandler{db: db, cfg: cfg}
 }
 
 func (h *AddressHandler) ListAddresses(c *gin.Context) {
@@ -26,7 +28,7 @@ func (h *AddressHandler) ListAddresses(c *gin.Context) {
 	}
 
 	var addresses []models.Address
-	if err := h.db.Where("user_id = ?", userID).Find(&addresses).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Where("user_id = ?", userID).Find(&addresses).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取地址列表失败"})
 		return
 	}
@@ -51,12 +53,12 @@ func (h *AddressHandler) CreateAddress(c *gin.Context) {
 
 	// 如果是第一个地址，设为默认地址
 	var count int64
-	h.db.Model(&models.Address{}).Where("user_id = ?", userID).Count(&count)
+	h.db.WithContext(c.Request.Context()).Model(&models.Address{}).Where("user_id = ?", userID).Count(&count)
 	if count == 0 {
 		address.IsDefault = true
 	}
 
-	if err := h.db.Create(&address).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&address).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建地址失败"})
 		return
 	}
@@ -64,13 +66,8 @@ func (h *AddressHandler) CreateAddress(c *gin.Context) {
 	c.JSON(http.StatusOK, address)
 }
 
+// UpdateAddress 修改地址，归属已由 middleware.Ownership 检查
 func (h *AddressHandler) UpdateAddress(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	addressID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的地址ID"})
@@ -78,20 +75,21 @@ func (h *AddressHandler) UpdateAddress(c *gin.Context) {
 	}
 
 	var address models.Address
-	if err := h.db.Where("id = ? AND user_id = ?", addressID, userID).First(&address).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&address, addressID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "地址不存在"})
 		return
 	}
 
+	ownerID := address.UserID
 	if err := c.ShouldBindJSON(&address); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
 		return
 	}
 
 	address.ID = addressID
-	address.UserID = userID.(uint64)
+	address.UserID = ownerID
 
-	if err := h.db.Save(&address).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Save(&address).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新地址失败"})
 		return
 	}
@@ -99,20 +97,15 @@ func (h *AddressHandler) UpdateAddress(c *gin.Context) {
 	c.JSON(http.StatusOK, address)
 }
 
+// DeleteAddress 删除地址，归属已由 middleware.Ownership 检查
 func (h *AddressHandler) DeleteAddress(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	addressID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的地址ID"})
 		return
 	}
 
-	result := h.db.Where("id = ? AND user_id = ?", addressID, userID).Delete(&models.Address{})
+	result := h.db.WithContext(c.Request.Context()).Where("id = ?", addressID).Delete(&models.Address{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除地址失败"})
 		return
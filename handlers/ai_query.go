@@ -6,19 +6,25 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"qaqmall/config"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/metrics"
+	"qaqmall/internal/tracing"
 	"qaqmall/models"
 )
 
 type AIQueryHandler struct {
-	db *gorm.DB
+	db  *gorm.DB
+	cfg *config.Config
 }
 
-func NewAIQueryHandler(db *gorm.DB) *AIQueryHandler {
-	return &AIQueryHandler{db: db}
+func NewAIQueryHandler(db *gorm.DB, cfg *config.Config) *AIQueryHandler {
+	return &AIQueryHandler{db: db, cfg: cfg}
 }
 
 type Message struct {
@@ -48,6 +54,11 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 		return
 	}
 
+	if h.cfg.OpenAI.APIKey == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI服务未配置"})
+		return
+	}
+
 	var req struct {
 		Query string `json:"query" binding:"required"`
 	}
@@ -62,7 +73,7 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 
 	// 获取购物车信息
 	var cartItems []models.CartItem
-	h.db.Where("user_id = ?", userID).Preload("Product").Find(&cartItems)
+	h.db.WithContext(c.Request.Context()).Where("user_id = ?", userID).Preload("Product").Find(&cartItems)
 
 	var cartInfo string
 	if len(cartItems) > 0 {
@@ -77,7 +88,7 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 
 	// 获取商品信息
 	var products []models.Product
-	h.db.Where("is_on_sale = ?", true).Limit(10).Find(&products)
+	h.db.WithContext(c.Request.Context()).Where("is_on_sale = ?", true).Limit(10).Find(&products)
 
 	var productInfo string
 	if len(products) > 0 {
@@ -92,7 +103,7 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 
 	// 获取订单信息
 	var orders []models.Order
-	h.db.Where("user_id = ?", userID).
+	h.db.WithContext(c.Request.Context()).Where("user_id = ?", userID).
 		Order("created_at DESC").
 		Limit(5).
 		Preload("Items").
@@ -114,7 +125,7 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 
 	// 构建 OpenAI 请求
 	openaiReq := OpenAIRequest{
-		Model: "gpt-3.5-turbo",
+		Model: h.cfg.OpenAI.Model,
 		Messages: []Message{
 			{
 				Role: "system",
@@ -138,31 +149,47 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 		return
 	}
 
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions",
-		bytes.NewBuffer(jsonData))
+	// 请求带上当前请求的 context，调用记录为 span 并在请求头中带上 traceparent
+	client := &http.Client{Timeout: h.cfg.OpenAI.Timeout, Transport: tracing.Transport(nil)}
+	request, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, h.cfg.OpenAI.APIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建请求失败"})
 		return
 	}
 
 	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Authorization", "Bearer sk-xxx")
+	request.Header.Set("Authorization", "Bearer "+h.cfg.OpenAI.APIKey)
+
+	// 调用耗时和失败原因记录到指标
+	start := time.Now()
+	defer func() {
+		metrics.AIQueryDuration.Observe(time.Since(start).Seconds())
+	}()
 
 	response, err := client.Do(request)
 	if err != nil {
+		metrics.AIQueryFailures.WithLabelValues("request").Inc()
+		logging.FromContext(c).Error("调用AI服务失败", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "调用AI服务失败"})
 		return
 	}
 	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		metrics.AIQueryFailures.WithLabelValues("status").Inc()
+		logging.FromContext(c).Error("AI服务返回错误状态码", "status", response.StatusCode)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "调用AI服务失败"})
+		return
+	}
 
 	var openaiResp OpenAIResponse
 	if err := json.NewDecoder(response.Body).Decode(&openaiResp); err != nil {
+		metrics.AIQueryFailures.WithLabelValues("decode").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析AI响应失败"})
 		return
 	}
 
 	if len(openaiResp.Choices) == 0 {
+		metrics.AIQueryFailures.WithLabelValues("empty").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI响应为空"})
 		return
 	}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+)
+
+// AuditHandler 管理员查询审计日志
+type AuditHandler struct {
+	db    *gorm.DB
+	cfg   *config.Config
+	audit *audit.Logger
+}
+
+func NewAuditHandler(db *gorm.DB, cfg *config.Config) *AuditHandler {
+	return &AuditHandler{db: db, cfg: cfg, audit: audit.New(db)}
+}
+
+// ListLogs 按用户、动作和时间范围分页查询审计日志，按时间倒序
+// from、to 为 RFC3339 格式的时间，范围包含 from，不包含 to
+func (h *AuditHandler) ListLogs(c *gin.Context) {
+	filter := audit.Filter{Action: c.Query("action")}
+
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的用户ID"})
+			return
+		}
+		filter.UserID = &userID
+	}
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": name + " 必须是 RFC3339 格式的时间，如 2024-01-02T15:04:05+08:00"})
+			return
+		}
+		*target = t
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "from 必须早于 to"})
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+
+	logs, total, err := h.audit.Query(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": logs,
+			"total": total,
+		},
+	})
+}
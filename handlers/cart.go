@@ -7,15 +7,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"qaqmall/config"
 	"qaqmall/models"
 )
 
 type CartHandler struct {
-	db *gorm.DB
+	db  *gorm.DB
+	cfg *config.Config
 }
 
-func NewCartHandler(db *gorm.DB) *CartHandler {
-	return &CartHandler{db: db}
+func NewCartHandler(db *gorm.DB, cfg *config.Config) *CartHandler {
+	return &CartHandler{db: db, cfg: cfg}
 }
 
 func (h *CartHandler) ListCart(c *gin.Context) {
@@ -26,7 +28,7 @@ func (h *CartHandler) ListCart(c *gin.Context) {
 	}
 
 	var cartItems []models.CartItem
-	if err := h.db.Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取购物车失败"})
 		return
 	}
@@ -44,27 +46,42 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	}
 
 	var req struct {
-		ProductID uint64 `json:"product_id"`
-		Quantity  int    `json:"quantity"`
+		ProductID uint64  `json:"product_id"`
+		SKUID     *uint64 `json:"sku_id"`
+		Quantity  int     `json:"quantity"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
 		return
 	}
 
+	db := h.db.WithContext(c.Request.Context())
+
 	// 检查商品是否存在
 	var product models.Product
-	if err := h.db.First(&product, req.ProductID).Error; err != nil {
+	if err := db.First(&product, req.ProductID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
 		return
 	}
 
+	// 商品有规格时必须选择 SKU，不同规格分别作为购物车项
+	sku, ok := resolveSKU(c, db, product, req.SKUID)
+	if !ok {
+		return
+	}
+	existing := db.Where("user_id = ? AND product_id = ?", userID, req.ProductID)
+	if sku != nil {
+		existing = existing.Where("sku_id = ?", sku.ID)
+	} else {
+		existing = existing.Where("sku_id IS NULL")
+	}
+
 	// 检查购物车中是否已存在该商品
 	var existingItem models.CartItem
-	if err := h.db.Where("user_id = ? AND product_id = ?", userID, req.ProductID).First(&existingItem).Error; err == nil {
+	if err := existing.First(&existingItem).Error; err == nil {
 		// 如果存在，更新数量
 		existingItem.Quantity += req.Quantity
-		if err := h.db.Save(&existingItem).Error; err != nil {
+		if err := db.Save(&existingItem).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新购物车失败"})
 			return
 		}
@@ -82,7 +99,15 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 		ProductImage: product.ImageURL,
 		Selected:     true,
 	}
-	if err := h.db.Create(&item).Error; err != nil {
+	if sku != nil {
+		item.SKUID = &sku.ID
+		item.SKUName = sku.Name
+		item.Price = sku.Price
+		if sku.ImageURL != "" {
+			item.ProductImage = sku.ImageURL
+		}
+	}
+	if err := db.Create(&item).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加到购物车失败"})
 		return
 	}
@@ -90,13 +115,8 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	c.JSON(http.StatusOK, item)
 }
 
+// UpdateCartItem 修改购物车项，归属已由 middleware.Ownership 检查
 func (h *CartHandler) UpdateCartItem(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的购物车项ID"})
@@ -113,7 +133,7 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	}
 
 	var item models.CartItem
-	if err := h.db.Where("id = ? AND user_id = ?", itemID, userID).First(&item).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&item, itemID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "购物车项不存在"})
 		return
 	}
@@ -121,7 +141,7 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	item.Quantity = updateInfo.Quantity
 	item.Selected = updateInfo.Selected
 
-	if err := h.db.Save(&item).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Save(&item).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新购物车失败"})
 		return
 	}
@@ -129,20 +149,15 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	c.JSON(http.StatusOK, item)
 }
 
+// RemoveFromCart 删除购物车项，归属已由 middleware.Ownership 检查
 func (h *CartHandler) RemoveFromCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的购物车项ID"})
 		return
 	}
 
-	result := h.db.Where("id = ? AND user_id = ?", itemID, userID).Delete(&models.CartItem{})
+	result := h.db.WithContext(c.Request.Context()).Where("id = ?", itemID).Delete(&models.CartItem{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除购物车项失败"})
 		return
@@ -162,7 +177,7 @@ func (h *CartHandler) EmptyCart(c *gin.Context) {
 		return
 	}
 
-	result := h.db.Where("user_id = ?", userID).Delete(&models.CartItem{})
+	result := h.db.WithContext(c.Request.Context()).Where("user_id = ?", userID).Delete(&models.CartItem{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空购物车失败"})
 		return
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/search"
+	"qaqmall/models"
+)
+
+// CategoryHandler 商品分类处理器，分类组成一棵树，同级分类按 sort_order 排序
+type CategoryHandler struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	audit  *audit.Logger
+	search search.Engine
+}
+
+func NewCategoryHandler(db *gorm.DB, cfg *config.Config, engine search.Engine) *CategoryHandler {
+	return &CategoryHandler{db: db, cfg: cfg, audit: audit.New(db), search: engine}
+}
+
+// CategoryRequest 创建或修改分类的请求，修改时不传的字段保持不变
+type CategoryRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	// ParentID 父分类，仅创建时有效，修改位置使用移动接口
+	ParentID *uint64 `json:"parent_id"`
+	// Position 在同级分类中的位置（从0开始），仅创建时有效，不传时排在最后
+	Position *int `json:"position"`
+}
+
+// MoveCategoryRequest 移动分类的请求，parent_id 为 null 表示移动为根分类
+type MoveCategoryRequest struct {
+	ParentID *uint64 `json:"parent_id"`
+	Position *int    `json:"position"`
+}
+
+// ListCategories 获取完整的分类树
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	tree, err := models.CategoryTree(h.db.WithContext(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取分类失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": tree})
+}
+
+// CreateCategory 创建分类
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求数据"})
+		return
+	}
+	name, ok := h.validName(c, req.Name, 0)
+	if !ok {
+		return
+	}
+
+	if !validDescription(c, req.Description) {
+		return
+	}
+
+	category := models.Category{Name: name}
+	if req.Description != nil {
+		category.Description = *req.Description
+	}
+	db := h.db.WithContext(c.Request.Context())
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+		return models.MoveCategory(tx, category.ID, req.ParentID, req.Position)
+	})
+	if errors.Is(err, models.ErrCategoryNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "父分类不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "创建分类失败"})
+		return
+	}
+	db.First(&category, category.ID)
+	h.audit.RecordRequest(c, audit.ActionCategoryCreated, fmt.Sprintf("创建分类 %s(%d)", category.Name, category.ID))
+
+	c.JSON(http.StatusCreated, gin.H{"code": 201, "data": category})
+}
+
+// UpdateCategory 修改分类的名称和描述
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	category, ok := h.find(c)
+	if !ok {
+		return
+	}
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求数据"})
+		return
+	}
+
+	if !validDescription(c, req.Description) {
+		return
+	}
+
+	previous := category.Name
+	if req.Name != nil {
+		name, ok := h.validName(c, req.Name, category.ID)
+		if !ok {
+			return
+		}
+		category.Name = name
+	}
+	if req.Description != nil {
+		category.Description = *req.Description
+	}
+	if err := h.db.WithContext(c.Request.Context()).Model(&category).
+		Updates(map[string]interface{}{"name": category.Name, "description": category.Description}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "更新分类失败"})
+		return
+	}
+	h.audit.RecordRequest(c, audit.ActionCategoryUpdated, fmt.Sprintf("更新分类 %s(%d)，名称 %s -> %s", category.Name, category.ID, previous, category.Name))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": category})
+}
+
+// MoveCategory 把分类移动到其他父分类下，或调整在同级分类中的顺序，子分类随之移动
+func (h *CategoryHandler) MoveCategory(c *gin.Context) {
+	category, ok := h.find(c)
+	if !ok {
+		return
+	}
+	var req MoveCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求数据"})
+		return
+	}
+
+	db := h.db.WithContext(c.Request.Context())
+	err := models.MoveCategory(db, category.ID, req.ParentID, req.Position)
+	switch {
+	case errors.Is(err, models.ErrCategoryCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": err.Error()})
+		return
+	case errors.Is(err, models.ErrCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "父分类不存在"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "移动分类失败"})
+		return
+	}
+	db.First(&category, category.ID)
+	parent := "根分类"
+	if category.ParentID != nil {
+		parent = fmt.Sprintf("分类 %d", *category.ParentID)
+	}
+	h.audit.RecordRequest(c, audit.ActionCategoryMoved, fmt.Sprintf("移动分类 %s(%d) 到%s下第 %d 位", category.Name, category.ID, parent, category.SortOrder))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": category})
+}
+
+// DeleteCategory 删除没有子分类的分类，并解除与商品的关联
+// 分类名称全局唯一，删除时直接删除记录而不是软删除，以便名称可以重新使用
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	category, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	db := h.db.WithContext(c.Request.Context())
+	var children int64
+	if err := db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "删除分类失败"})
+		return
+	}
+	if children > 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "error": "请先删除或移走子分类"})
+		return
+	}
+
+	var productIDs []uint64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("product_categories").Where("category_id = ?", category.ID).Pluck("product_id", &productIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&category).Association("Products").Clear(); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&category).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "删除分类失败"})
+		return
+	}
+	refreshSearch(c, h.search, productIDs...)
+	h.audit.RecordRequest(c, audit.ActionCategoryDeleted, fmt.Sprintf("删除分类 %s(%d)", category.Name, category.ID))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "分类已删除"})
+}
+
+// find 查询路径参数中的分类，不存在时直接返回 404
+func (h *CategoryHandler) find(c *gin.Context) (models.Category, bool) {
+	var category models.Category
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err == nil {
+		err = h.db.WithContext(c.Request.Context()).First(&category, id).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "分类不存在"})
+		return category, false
+	}
+	return category, true
+}
+
+// validName 校验分类名称不为空、不超过50个字符且没有被其他分类使用，exclude 为修改中的分类ID
+func (h *CategoryHandler) validName(c *gin.Context, name *string, exclude uint64) (string, bool) {
+	if name == nil || strings.TrimSpace(*name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "分类名称不能为空"})
+		return "", false
+	}
+	value := strings.TrimSpace(*name)
+	if len([]rune(value)) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "分类名称不能超过50个字符"})
+		return "", false
+	}
+
+	var count int64
+	if err := h.db.WithContext(c.Request.Context()).Model(&models.Category{}).
+		Where("name = ? AND id <> ?", value, exclude).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "检查分类名称失败"})
+		return "", false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "error": "分类名称已存在"})
+		return "", false
+	}
+	return value, true
+}
+
+// validDescription 校验分类描述不超过200个字符
+func validDescription(c *gin.Context, description *string) bool {
+	if description != nil && len([]rune(*description)) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "分类描述不能超过200个字符"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/service/wechat"
+	"qaqmall/models"
+)
+
+// IdentityHandler 用户管理自己绑定的第三方登录身份
+type IdentityHandler struct {
+	db         *gorm.DB
+	cfg        *config.Config
+	identities *auth.Identities
+	wechat     *wechat.Client
+}
+
+func NewIdentityHandler(db *gorm.DB, cfg *config.Config) *IdentityHandler {
+	return &IdentityHandler{
+		db:         db,
+		cfg:        cfg,
+		identities: auth.NewIdentities(db),
+		wechat:     wechat.NewClient(cfg.Wechat.APIBaseURL, cfg.Wechat.Timeout),
+	}
+}
+
+// ListIdentities 列出当前用户绑定的第三方登录身份
+func (h *IdentityHandler) ListIdentities(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	identities, err := h.identities.List(userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取绑定列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": identities,
+			"total": len(identities),
+		},
+	})
+}
+
+// BindWechat 把微信号绑定到当前用户，之后可以用微信登录该账号
+func (h *IdentityHandler) BindWechat(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var req struct {
+		Type  string `json:"type" binding:"required,oneof=mini web"` // mini 小程序，web 网页授权
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state"` // 网页授权必填，即授权地址中的 state
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	provider := models.IdentityWechatMini
+	if req.Type == "web" {
+		provider = models.IdentityWechatWeb
+		if h.cfg.Wechat.AppSecret != "" && !checkWechatState(c, h.cfg.Account.CodeSecret, req.State) {
+			wechatStateError(c)
+			return
+		}
+	}
+	openID, unionID, err := exchangeWechatCode(c.Request.Context(), h.wechat, h.cfg.Wechat, provider, req.Code)
+	if err != nil {
+		wechatError(c, err)
+		return
+	}
+
+	identity, err := h.identities.Bind(userID.(uint64), provider, openID, unionID)
+	if err != nil {
+		if errors.Is(err, auth.ErrIdentityTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "该微信号已绑定其他账号"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "绑定失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "绑定成功",
+		"data":    identity,
+	})
+}
+
+// UnbindIdentity 解绑第三方登录身份，没有设置密码时不能解绑最后一个
+func (h *IdentityHandler) UnbindIdentity(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的绑定ID"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if err := h.identities.Unbind(&user, id); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrIdentityNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "绑定记录不存在"})
+		case errors.Is(err, auth.ErrLastLoginMethod):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请先设置密码，再解绑唯一的微信账号"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解绑失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已解绑",
+	})
+}
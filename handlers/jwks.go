@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/internal/auth"
+)
+
+// JWKSHandler 公开 JWT 验证公钥，供其他服务验证商城签发的 token
+type JWKSHandler struct {
+	keys *auth.KeyRing
+}
+
+func NewJWKSHandler(keys *auth.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// GetJWKS 返回 JWK Set，包含当前签名密钥和尚未清理的历史密钥
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	// 密钥轮换后旧密钥仍会保留一段时间，短时间缓存不影响验证
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.keys.JWKS()})
+}
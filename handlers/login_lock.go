@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/models"
+)
+
+// LoginLockHandler 管理员查看和解除登录锁定
+type LoginLockHandler struct {
+	db         *gorm.DB
+	cfg        *config.Config
+	loginGuard *auth.LoginGuard
+}
+
+func NewLoginLockHandler(db *gorm.DB, cfg *config.Config, loginGuard *auth.LoginGuard) *LoginLockHandler {
+	return &LoginLockHandler{db: db, cfg: cfg, loginGuard: loginGuard}
+}
+
+// ListLocks 列出当前被锁定的用户名和 IP
+func (h *LoginLockHandler) ListLocks(c *gin.Context) {
+	locks, err := h.loginGuard.Locks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取锁定列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": locks,
+			"total": len(locks),
+		},
+	})
+}
+
+// Unlock 解除用户名或 IP 的登录锁定，并清除失败次数
+func (h *LoginLockHandler) Unlock(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Username == "") == (req.IP == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username 和 ip 必须且只能指定一个"})
+		return
+	}
+
+	kind, value := models.LoginFailureByUsername, req.Username
+	if req.IP != "" {
+		kind, value = models.LoginFailureByIP, req.IP
+	}
+
+	operatorID, _ := c.Get("user_id")
+	found, err := h.loginGuard.Unlock(kind, value, operatorID.(uint64), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除锁定失败"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有对应的登录失败记录"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已解除锁定",
+	})
+}
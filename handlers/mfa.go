@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/logging"
+	"qaqmall/models"
+)
+
+// MFAHandler 用户管理自己的两步验证
+type MFAHandler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	sessions *auth.Sessions
+	mfa      *auth.MFA
+}
+
+func NewMFAHandler(db *gorm.DB, cfg *config.Config, sessions *auth.Sessions, mfa *auth.MFA) *MFAHandler {
+	return &MFAHandler{db: db, cfg: cfg, sessions: sessions, mfa: mfa}
+}
+
+// GetStatus 查询两步验证是否开启、剩余恢复码数量，以及当前会话是否通过了两步验证
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	enabled, err := h.mfa.Enabled(userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取两步验证状态失败"})
+		return
+	}
+	remaining, err := h.mfa.RemainingRecoveryCodes(userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取两步验证状态失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"enabled":                  enabled,
+			"recovery_codes_remaining": remaining,
+			"session_verified":         c.GetBool("mfa"),
+		},
+	})
+}
+
+// EnrollTOTP 生成新的 TOTP 密钥，返回密钥、otpauth:// 地址和二维码
+// 用户用身份验证器 App 扫码后还需要调用 ConfirmTOTP 提交动态码才会开启
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(&user)
+	if err != nil {
+		if errors.Is(err, auth.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "已开启两步验证，请先关闭后再重新设置"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成二维码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"secret":      secret,
+			"otpauth_uri": uri,
+			"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		},
+	})
+}
+
+// ConfirmTOTP 提交动态码确认密钥，开启两步验证，返回只显示一次的恢复码
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	codes, err := h.mfa.Confirm(userID.(uint64), req.Code)
+	if err != nil {
+		h.mfaError(c, err)
+		return
+	}
+	// 当前会话刚刚验证过动态码，视为已通过两步验证
+	if err := h.sessions.MarkMFA(c.GetString("session_id")); err != nil {
+		logging.FromContext(c).Error("标记会话两步验证状态失败", "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "两步验证已开启，请妥善保存恢复码",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTOTP 关闭两步验证，需要同时提供密码和动态码（或恢复码）
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+	if err := h.mfa.Verify(user.ID, req.Code); err != nil {
+		h.mfaError(c, err)
+		return
+	}
+
+	if err := h.mfa.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭两步验证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "两步验证已关闭",
+	})
+}
+
+// RegenerateRecoveryCodes 作废原有的恢复码并生成新的一组，需要提供动态码
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.mfa.Verify(userID.(uint64), req.Code); err != nil {
+		h.mfaError(c, err)
+		return
+	}
+	codes, err := h.mfa.RegenerateRecoveryCodes(userID.(uint64))
+	if err != nil {
+		h.mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "恢复码已重新生成，原有恢复码已失效",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+func (h *MFAHandler) mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "动态码或恢复码错误"})
+	case errors.Is(err, auth.ErrMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未开启两步验证"})
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "已开启两步验证"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "两步验证操作失败"})
+	}
+}
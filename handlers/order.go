@@ -1,22 +1,29 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/metrics"
 	"qaqmall/models"
 )
 
 type OrderHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	cfg   *config.Config
+	audit *audit.Logger
 }
 
-func NewOrderHandler(db *gorm.DB) *OrderHandler {
-	return &OrderHandler{db: db}
+func NewOrderHandler(db *gorm.DB, cfg *config.Config) *OrderHandler {
+	return &OrderHandler{db: db, cfg: cfg, audit: audit.New(db)}
 }
 
 // CreateOrder 创建订单
@@ -30,8 +37,9 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var req struct {
 		AddressID uint64 `json:"address_id" binding:"required"`
 		Items     []struct {
-			ProductID uint64 `json:"product_id" binding:"required"`
-			Quantity  int    `json:"quantity" binding:"required,min=1"`
+			ProductID uint64  `json:"product_id" binding:"required"`
+			SKUID     *uint64 `json:"sku_id"`
+			Quantity  int     `json:"quantity" binding:"required,min=1"`
 		} `json:"items" binding:"required,min=1"`
 		Remark string `json:"remark"`
 	}
@@ -42,7 +50,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 
 	// 开始事务
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c.Request.Context()).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -63,8 +71,8 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// 生成订单号
-	orderNumber := fmt.Sprintf("%s%d", time.Now().Format("20060102150405"), userID)
+	// 生成订单号：时间 + 6位随机数 + 用户ID，避免同一用户同一秒内下单时订单号重复
+	orderNumber := fmt.Sprintf("%s%06d%d", time.Now().Format("20060102150405"), rand.Intn(1000000), userID)
 
 	// 创建订单
 	order := models.Order{
@@ -98,13 +106,12 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			return
 		}
 
-		if product.Stock < item.Quantity {
+		// 商品有规格时按 SKU 的价格、图片和库存下单
+		sku, ok := resolveSKU(c, tx, product, item.SKUID)
+		if !ok {
 			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 库存不足", product.Name)})
 			return
 		}
-
-		// 创建订单项
 		orderItem := models.OrderItem{
 			OrderID:      order.ID,
 			ProductID:    product.ID,
@@ -113,6 +120,24 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			Price:        product.Price,
 			Quantity:     item.Quantity,
 		}
+		stock, itemName := product.Stock, product.Name
+		if sku != nil {
+			orderItem.SKUID = &sku.ID
+			orderItem.SKUName = sku.Name
+			orderItem.Price = sku.Price
+			if sku.ImageURL != "" {
+				orderItem.ProductImage = sku.ImageURL
+			}
+			stock, itemName = sku.Stock, fmt.Sprintf("%s（%s）", product.Name, sku.Name)
+		}
+
+		if stock < item.Quantity {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 库存不足", itemName)})
+			return
+		}
+
+		// 创建订单项
 
 		if err := tx.Create(&orderItem).Error; err != nil {
 			tx.Rollback()
@@ -120,14 +145,18 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			return
 		}
 
-		// 扣减库存
-		if err := tx.Model(&product).Update("stock", product.Stock-item.Quantity).Error; err != nil {
+		// 扣减库存，并发下单时由条件更新保证不会超卖
+		if err := models.AdjustItemStock(tx, product.ID, orderItem.SKUID, -item.Quantity); err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新库存失败"})
+			if errors.Is(err, models.ErrInsufficientStock) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 库存不足", itemName)})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新库存失败"})
+			}
 			return
 		}
 
-		totalAmount += product.Price * float64(item.Quantity)
+		totalAmount += orderItem.Price * float64(item.Quantity)
 	}
 
 	// 更新订单总金额
@@ -142,6 +171,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
 		return
 	}
+	metrics.OrdersCreated.Inc()
 
 	// 返回订单信息
 	c.JSON(http.StatusOK, gin.H{
@@ -156,26 +186,15 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	})
 }
 
-// GetOrder 获取订单详情
+// GetOrder 获取订单详情，归属已由 middleware.Ownership 检查
 func (h *OrderHandler) GetOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	orderID := c.Param("id")
 	var order models.Order
-	if err := h.db.Preload("Items").Preload("Items.Product").Preload("Address").First(&order, orderID).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Preload("Items").Preload("Items.Product").Preload("Address").First(&order, orderID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
 	}
 
-	if order.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该订单"})
-		return
-	}
-
 	c.JSON(http.StatusOK, order)
 }
 
@@ -188,7 +207,7 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	}
 
 	var orders []models.Order
-	if err := h.db.Where("user_id = ?", userID).Preload("Items").Preload("Items.Product").Preload("Address").Find(&orders).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Where("user_id = ?", userID).Preload("Items").Preload("Items.Product").Preload("Address").Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单列表失败"})
 		return
 	}
@@ -198,26 +217,15 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	})
 }
 
-// UpdateOrder 修改订单信息
+// UpdateOrder 修改订单信息，归属已由 middleware.Ownership 检查
 func (h *OrderHandler) UpdateOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	orderID := c.Param("id")
 	var order models.Order
-	if err := h.db.First(&order, orderID).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&order, orderID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
 	}
 
-	if order.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改该订单"})
-		return
-	}
-
 	if order.Status != models.OrderStatusPending {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "只能修改待支付的订单"})
 		return
@@ -236,12 +244,13 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 	// 如果修改了地址，验证新地址
 	if req.AddressID > 0 {
 		var address models.Address
-		if err := h.db.First(&address, req.AddressID).Error; err != nil {
+		if err := h.db.WithContext(c.Request.Context()).First(&address, req.AddressID).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的收货地址"})
 			return
 		}
 
-		if address.UserID != userID.(uint64) {
+		// 管理员代为修改时，新地址同样必须属于下单用户
+		if address.UserID != order.UserID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "无权使用该地址"})
 			return
 		}
@@ -251,7 +260,7 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 
 	order.Remark = req.Remark
 
-	if err := h.db.Save(&order).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Save(&order).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
 		return
 	}
@@ -263,45 +272,39 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 	})
 }
 
-// CancelOrder 取消订单
+// CancelOrder 取消订单，归属已由 middleware.Ownership 检查
 func (h *OrderHandler) CancelOrder(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
-		return
-	}
-
 	orderID := c.Param("id")
 	var order models.Order
-	if err := h.db.Preload("Items").First(&order, orderID).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Preload("Items").First(&order, orderID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
 	}
 
-	if order.UserID != userID.(uint64) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权取消该订单"})
-		return
-	}
-
 	if order.Status != models.OrderStatusPending {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "只能取消待支付的订单"})
 		return
 	}
 
 	// 开始事务
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c.Request.Context()).Begin()
 
-	// 更新订单状态
-	if err := tx.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
+	// 更新订单状态，只取消仍处于待支付状态的订单，避免与支付回调、过期任务或重复请求并发时重复恢复库存
+	result := tx.Model(&order).Where("status = ?", models.OrderStatusPending).Update("status", models.OrderStatusCancelled)
+	if result.Error != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消订单失败"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能取消待支付的订单"})
+		return
+	}
 
 	// 恢复库存
 	for _, item := range order.Items {
-		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
-			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+		if err := models.AdjustItemStock(tx, item.ProductID, item.SKUID, item.Quantity); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复库存失败"})
 			return
@@ -313,6 +316,8 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消订单失败"})
 		return
 	}
+	metrics.OrdersCancelled.Inc()
+	h.audit.RecordRequest(c, audit.ActionOrderCancelled, fmt.Sprintf("用户取消订单 %s(%d)，金额 %.2f", order.OrderNumber, order.ID, order.TotalAmount))
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -10,14 +10,23 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-pay/gopay"
+	"github.com/go-pay/gopay/pkg/xhttp"
+	wechatv2 "github.com/go-pay/gopay/wechat"
 	"github.com/go-pay/gopay/wechat/v3"
 	"github.com/google/uuid" // 引入 uuid 库
 	"github.com/skip2/go-qrcode"
 	"github.com/smartwalle/alipay/v3"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 	"io/ioutil"
-	"log"
+	"math"
+	"net"
 	"net/http"
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/metrics"
+	"qaqmall/internal/tracing"
 	"qaqmall/models"
 	"time"
 )
@@ -46,40 +55,48 @@ type WechatPayConfig struct {
 	ApiV3Key    string // API v3 密钥
 	MchSerialNo string // 商户证书序列号
 	PrivateKey  string // 商户私钥
+	PublicKey   string // 微信支付公钥
 	NotifyUrl   string // 支付回调通知地址
 	RefundUrl   string // 退款回调地址
 }
 
-// PayAo 支付请求的输入参数结构体
+// PayAo 支付请求的输入参数结构体，支付用户和金额取自订单
 type PayAo struct {
-	OrderId       uint64  `json:"order_id"`       // 订单ID
-	UserId        uint64  `json:"user_id"`        // 用户ID
-	Amount        float64 `json:"amount"`         // 支付金额
-	PaymentMethod string  `json:"payment_method"` // 支付方式 (微信支付/支付宝等)
+	OrderId       uint64 `json:"order_id"`       // 订单ID
+	PaymentMethod string `json:"payment_method"` // 支付方式 (微信支付/支付宝等)
 }
 
 // PayHandler 支付处理结构体，包含了支付宝和微信支付的客户端
 type PayHandler struct {
 	db            *gorm.DB          // 数据库连接
+	cfg           *config.Config    // 应用配置
 	alipayClient  *alipay.Client    // 支付宝客户端
 	wechatService *WechatPayService // 微信支付服务客户端
 	payConfig     WechatPayConfig   // 微信支付配置
+	audit         *audit.Logger     // 审计日志，记录支付状态变化
 }
 
 func NewWechatPayService(ctx context.Context, config WechatPayConfig) *WechatPayService {
 	client, err := wechat.NewClientV3(config.MchId, config.MchSerialNo, config.ApiV3Key, config.PrivateKey)
 	if err != nil {
-		fmt.Println(err)
+		logging.FromContext(ctx).Error("创建微信支付客户端失败", "error", err)
 		return nil
 	}
+	// 对微信支付接口的请求记录为 span，并在请求头中带上 traceparent
+	httpClient := xhttp.NewClient()
+	httpClient.SetTransport(tracing.Transport(httpClient.HttpClient.Transport))
+	client.SetHttpClient(httpClient)
 	err = client.AutoVerifySign()
 	if err != nil {
-		fmt.Println(err)
+		logging.FromContext(ctx).Error("获取微信支付平台证书失败", "error", err)
 		return nil
 	}
-	client.DebugSwitch = gopay.DebugOn
+	// 调试模式会把完整的请求和响应打印到标准输出，其中包含签名等敏感信息
+	client.DebugSwitch = gopay.DebugOff
 
-	LoadConfig()
+	if err := LoadConfig(config.PublicKey); err != nil {
+		logging.FromContext(ctx).Error("加载微信支付公钥失败", "error", err)
+	}
 
 	return &WechatPayService{
 		ctx:       ctx,
@@ -88,9 +105,9 @@ func NewWechatPayService(ctx context.Context, config WechatPayConfig) *WechatPay
 	}
 }
 
-func LoadConfig() error {
+func LoadConfig(publicKey string) error {
 	GlobalConf = &Config{
-		WxPublicKey: "your_public_key_here", // TODO: 替换为实际的公钥内容
+		WxPublicKey: publicKey,
 	}
 
 	// 解析公钥
@@ -114,54 +131,46 @@ func LoadConfig() error {
 	return nil
 }
 
-func NewPayHandler(db *gorm.DB, ctx context.Context) *PayHandler {
-	// 支付宝 支付客户端 TODO
-	appID := "9021000144618446" //你的appID
-	privateKey := "MIIEowIBAAKCAQEAwq9xfKTvrTJYkJorBxowaY7PEpi5sxl4/7lzr/1k0VJ3rhb6zttW062s5M2n7BT1pQ3CLbMa+p9hg++QSCStKKo/5YWJoFTn1K/rTG2zEk" +
-		"WauNljebceGAywTlYORKjQkFUGHq+X2g8I3aRcGrIRdelffZQFblc31/GWzh+Vh/Wbax6Kos5GIZiwGcUk1y9WWmc1JiNmi+x1oPa2uFxdE8Y4dAvlvc7PSawqb4znAeSX" +
-		"53CrXY/JA9ExnaIV40tZzXGBvpLoCDhcKl3WJtckFndtRDXhk8gpwxzViCkBa50nczlSx/MVpHiJjbqRpv3eHhYPQRWmHfinQtqIXAkLdwIDAQABAoIBAGdzpQGP/5Bw" +
-		"RWGpmp2ui/U7nsuJ/nuuWH7DBDeLlewpP1FyApqzMSNQkaQPqGCqDpJDimCQYRC2arIaNfgwDRejyEpluGlLVNnPFWDKljJqbDo3wkVmSgaLj5BA6FoRvqpDk/nwYufLv3" +
-		"FPqmXBI8gdV9G6O1yT2ifUx8cGP4Y7zQVdZCdqOgQyPTHMPwDt0cD/wAhNiq9hXeWD38EdkMwlXi8G+Z4L5Kp16QOFiD9tmjoVPO8RtW55GFJzydj7wKP7B0M4NghGvn" +
-		"Q7MAyBMfSJNRmCu7Op4KTjpNZMsvttvo9HuXzwyVuWcU+v9twbwa2ykl3N1e3THWrd3ayxJkkCgYEA+3sTW7uPHGK+Tw2ycGCOb1yq2pLbMZHUXBLYa38ViZvmamnEN0" +
-		"/J+H+CHvi9WUfwTq8/+Zv4QZBq069vpbr2WWSEtFlW6O8nAXHABtW7dpqAKjqOBloUj0xKG+QEHgLsG1GBwXZFpypszd8CjpYw3otOZkLitZY502MXza/0eNsCgYEAxi8V" +
-		"S2AUkWZBpMWjtoj8QYropqS8jy6f0e9Qw5yfpjmHYlRtxQx7RhT087tVSRNHIJ870t7SgLkmaDIicKbYrRwdzXW0Xi/5q9rSzwwO2MMFE8Ajn8+1wydkna2hXmfXQ/o14d3" +
-		"rKdR48sNMuDHal4uiA9WZAr+mVuvUOH7wXJUCgYEA0gzW+oQK4RbJBpbWOG8uCW5Jdw+67gh0bAOBqSgZATuqla+KKPkIJfu638u7vFsOKWrP8NmJ3pmV4QJkKvWi1r/S6C" +
-		"DHKwC2f8pXLl5Pmp0p+Bu4jS2ohpiePfWSSs7+D0NhMgpr21jgUIS5SgfBAeExttCfNDUqT5oxQ6h4dokCgYAxCYVjWSq9r2eetaiEifCg5xYZ5bkiVI8HCwgY3rBCGQn+" +
-		"spVWpHf8J0NU6412v2ZiFARhcPD1GNr//Se4aBBFBSf6pp0ykPxeIY733CvwRpEDCg/Gg0aeOykSOtwq19bT4x1h/d8qQoCK0Pgyu2MzDEHSYQ+zNmiaKVAhioc+4QKBgAY" +
-		"LgBsUkZyOPNI5RHtnFBWKlc6L6YGNf6nQ8gHEmclTrGLg97EixeW4Dl7kyC/l7KiOFUST9uLGoA0k7WssS8ylRmkaCZyNl/5hSlNCOhtPaVUHMeNcRBBnboOVZrFhLeS918D" +
-		"gguDqDxiNHos4rZ0sOUlLI56AfIXf7Ih9zTlq" //私钥
-
-	aliPhublicKey := "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAg1guOKjqO4uxMCi6Zefp2RzWQ6lJF5j/0/iAm3deiaS+eE/lN/6zPBsNA+ZvcN+G8YHJ25LhRK7" +
-		"pH2btT0k0eXMZB4o2GuzvgUHbrNjlVNhKtuCXYLbMXNJO67cK2+xOk2FQSJ/SgFjNS1GzgM2s/aLI6X8MVNOmFhXZksovJd2fa4XwYtI6J3Fkkvs607MaKN93P3IS8MOG" +
-		"jeemzVexYX2FqAtq/ixF9Avbz5SwXCyX6Mm4RORieVWsJ37jWzW6szlc92jDctuFzkt2YLa/b4rYCN+pzUGZnAY0gUgmHZ25Lyz0zz64aOHmTqznT3T09Z7yow+IFEPlKAMf" +
-		"fNHywwIDAQAB" //支付宝的公钥
-	client, err := alipay.New(appID, privateKey, false)
+func NewPayHandler(db *gorm.DB, ctx context.Context, cfg *config.Config) (*PayHandler, error) {
+	// 支付宝 支付客户端
+	client, err := alipay.New(cfg.Alipay.AppID, cfg.Alipay.PrivateKey, cfg.Alipay.IsProduction,
+		alipay.WithHTTPClient(&http.Client{Transport: tracing.Transport(nil)}))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("初始化支付宝客户端失败: %v", err)
 	}
-	err = client.LoadAliPayPublicKey(aliPhublicKey)
+	err = client.LoadAliPayPublicKey(cfg.Alipay.PublicKey)
 	if err != nil {
-		panic(err)
-	}
-
-	// 初始化微信支付服务
-	service := NewWechatPayService(ctx, WechatPayConfig{
-		Appid:       "", // 微信支付应用的AppID
-		Appid1:      "", // 可能是另一个AppID，具体用途需确认
-		MchId:       "", // 商户号
-		ApiV3Key:    "", // API v3密钥
-		MchSerialNo: "", // 商户证书序列号
-		PrivateKey:  "", // 商户私钥
-		NotifyUrl:   "", // 支付结果通知地址
-		RefundUrl:   "", // 退款结果通知地址
-	})
+		return nil, fmt.Errorf("加载支付宝公钥失败: %v", err)
+	}
+
+	// 初始化微信支付服务，未配置商户号时不启用
+	var service *WechatPayService
+	var payConfig WechatPayConfig
+	if cfg.Wechat.MchID != "" {
+		payConfig = WechatPayConfig{
+			Appid:       cfg.Wechat.AppID,       // 微信支付应用的AppID
+			MchId:       cfg.Wechat.MchID,       // 商户号
+			ApiV3Key:    cfg.Wechat.ApiV3Key,    // API v3密钥
+			MchSerialNo: cfg.Wechat.MchSerialNo, // 商户证书序列号
+			PrivateKey:  cfg.Wechat.PrivateKey,  // 商户私钥
+			PublicKey:   cfg.Wechat.PublicKey,   // 微信支付公钥
+			NotifyUrl:   cfg.Wechat.NotifyURL,   // 支付结果通知地址
+			RefundUrl:   cfg.Wechat.RefundURL,   // 退款结果通知地址
+		}
+		service = NewWechatPayService(ctx, payConfig)
+		if service == nil {
+			return nil, fmt.Errorf("初始化微信支付客户端失败")
+		}
+	}
 
 	return &PayHandler{
 		db:            db,
+		cfg:           cfg,
 		alipayClient:  client,
 		wechatService: service, // 将 WechatPayService 注入 PayHandler
-		payConfig:     service.config,
-	}
+		payConfig:     payConfig,
+		audit:         audit.New(db),
+	}, nil
 }
 
 // 支付的接口
@@ -172,38 +181,44 @@ func (h *PayHandler) Charge(c *gin.Context) {
 		return
 	}
 
-	// 检查订单是否存在
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "未找到用户信息"})
+		return
+	}
+
+	// 只能支付本人的订单，其他用户的订单与不存在的订单返回相同的结果
 	var order models.Order
-	if err := h.db.First(&order, req.OrderId).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", req.OrderId, userID).First(&order).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "订单不存在"})
 		return
 	}
 
 	// 检查支付记录是否存在
 	var payment models.Payment
-	tx := h.db.Where("order_id = ?", req.OrderId).First(&payment)
+	tx := h.db.WithContext(c.Request.Context()).Where("order_id = ?", req.OrderId).First(&payment)
 
 	if tx.Error != nil {
 		if tx.Error == gorm.ErrRecordNotFound {
 			// 如果不存在 就创建新的支付记录
 			newPayment := models.Payment{
 				PaymentNumber: generateUniqueID(),
-				OrderID:       req.OrderId,
-				UserID:        req.UserId,
-				Amount:        req.Amount,
+				OrderID:       order.ID,
+				UserID:        order.UserID,
+				Amount:        order.TotalAmount,
 				PaymentMethod: models.PaymentMethod(req.PaymentMethod),
 				Status:        models.PaymentStatusPending,
 				CreatedAt:     time.Now(),
 				UpdatedAt:     time.Now(),
 			}
 
-			// 存储新的支付记录
-			if err := h.db.Create(&newPayment).Error; err != nil {
+			// 存储新的支付记录，超时未支付由 jobs.PaymentJobs 定时取消
+			if err := h.db.WithContext(c.Request.Context()).Create(&newPayment).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"message": "网络存在波动,请稍后重试"})
 				return
 			}
-			// 启动定时器，15分钟后检查支付状态
-			go h.checkAndCancelPayment(newPayment.ID, 15*time.Minute)
+			metrics.RecordPayments(newPayment.PaymentMethod, newPayment.Status, 1)
+			h.audit.PaymentStatusChanged(c.Request.Context(), newPayment, "", c.ClientIP(), "用户发起支付")
 			payment = newPayment
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "网络存在波动,请稍后重试"})
@@ -225,14 +240,17 @@ func (h *PayHandler) Charge(c *gin.Context) {
 func (h *PayHandler) PayService(payment models.Payment, c *gin.Context) {
 	body := "订单支付"
 	outTradeNo := payment.PaymentNumber
-	totalFee := int(payment.Amount * 100)              // 金额单位为分
-	notifyURL := "http://yourdomain.com/notify/wechat" // 确保这是正确的通知URL
+	totalFee := int(payment.Amount * 100) // 金额单位为分
 
 	switch payment.PaymentMethod {
 	case models.PaymentMethodWechat:
-		h.wechatService.WechatPay(payment, c, body, outTradeNo, totalFee, notifyURL) // 使用 wechatService 调用 WechatPay 方法
+		if h.wechatService == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "微信支付未启用"})
+			return
+		}
+		h.wechatService.WechatPay(payment, c, body, outTradeNo, totalFee, h.payConfig.NotifyUrl) // 使用 wechatService 调用 WechatPay 方法
 	case models.PaymentMethodAlipay:
-		h.Alipay(payment, c, body, outTradeNo, payment.Amount, notifyURL)
+		h.Alipay(payment, c, body, outTradeNo, payment.Amount, h.cfg.Alipay.NotifyURL)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"message": "不支持的支付方式"})
 	}
@@ -244,25 +262,29 @@ func (h *PayHandler) Alipay(payment models.Payment, c *gin.Context, body string,
 
 	var p = alipay.TradePagePay{}
 	p.NotifyURL = notifyURL                          // 支付宝通知回调地址
-	p.ReturnURL = notifyURL                          // 支付后跳转页面
+	p.ReturnURL = h.cfg.Alipay.ReturnURL             // 支付后跳转页面
 	p.Subject = body                                 // 标题
 	p.OutTradeNo = outTradeNo                        // 订单号
 	p.TotalAmount = fmt.Sprintf("%.2f", totalAmount) // 支付金额
 	p.ProductCode = "FAST_INSTANT_TRADE_PAY"         // 支付类型 (网页支付)
 
 	// 生成支付链接
+	_, span := tracing.Start(c.Request.Context(), "alipay.TradePagePay", attribute.String("payment.out_trade_no", outTradeNo))
 	url, err := h.alipayClient.TradePagePay(p)
+	tracing.End(span, err)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "支付宝支付请求失败", "error": err.Error()})
 		return
 	}
 
 	// 返回支付链接给前端，前端通过浏览器跳转到支付宝进行支付
-	c.JSON(http.StatusOK, gin.H{"message": "支付宝支付链接生成成功", "url": url})
+	c.JSON(http.StatusOK, gin.H{"message": "支付宝支付链接生成成功", "url": url.String()})
 }
 
 // 微信支付 PC端扫码
 func (w *WechatPayService) WechatPay(payment models.Payment, c *gin.Context, body string, outTradeNo string, totalFee int, notifyURL string) (result string, err error) {
+	_, span := tracing.Start(c.Request.Context(), "wechatpay.V3TransactionNative", attribute.String("payment.out_trade_no", outTradeNo))
+	defer func() { tracing.End(span, err) }()
 	//TODO 微信支付没有商业认证 这里考虑不处理 反正是测试功能
 	amount := totalFee
 	expire := time.Now().Add(10 * time.Minute).Format(time.RFC3339)
@@ -292,34 +314,13 @@ func (w *WechatPayService) WechatPay(payment models.Payment, c *gin.Context, bod
 	return
 }
 
-// 检查并取消支付状态
-func (h *PayHandler) checkAndCancelPayment(paymentId uint64, duration time.Duration) {
-	timer := time.NewTimer(duration)
-	defer timer.Stop()
-
-	select {
-	case <-timer.C:
-		var payment models.Payment
-		tx := h.db.First(&payment, paymentId)
-		if tx.Error != nil {
-			return
-		}
-
-		if payment.Status == models.PaymentStatusPending { // 0表示待支付状态
-			payment.Status = models.PaymentStatusCancelled // 3表示已取消状态
-			payment.UpdatedAt = time.Now()
-			h.db.Save(&payment)
-		}
-	}
-}
-
 // 生成一个唯一的ID 使用 uuid 库
 func generateUniqueID() string {
 	return uuid.New().String()
 }
 
-// 处理微信支付回调的函数
-func WxPayNotify(w http.ResponseWriter, r *http.Request) {
+// WxPayNotify 微信支付结果通知，校验签名和金额后把待支付的记录标记为支付成功
+func (h *PayHandler) WxPayNotify(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
@@ -328,7 +329,7 @@ func WxPayNotify(w http.ResponseWriter, r *http.Request) {
 	// 读取请求体
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Println("Failed to read request body:", err)
+		logging.FromContext(r.Context()).Error("读取微信支付回调失败", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -337,13 +338,21 @@ func WxPayNotify(w http.ResponseWriter, r *http.Request) {
 	var callbackData WeChatCallbackResponse
 	err = xml.Unmarshal(body, &callbackData)
 	if err != nil {
-		log.Println("Failed to unmarshal XML:", err)
+		logging.FromContext(r.Context()).Warn("解析微信支付回调失败", "error", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	// 打印回调信息
-	log.Printf("Received WeChat Callback: %+v\n", callbackData)
+	// 记录回调信息，签名和用户标识不写入日志
+	logger := logging.FromContext(r.Context()).With("out_trade_no", callbackData.OutTradeNo, "transaction_id", callbackData.TransactionID)
+	logger.Info("收到微信支付回调", "return_code", callbackData.ReturnCode, "result_code", callbackData.ResultCode, "total_fee", callbackData.TotalFee)
+
+	// 校验签名，未配置 API 密钥时无法确认通知来自微信，不处理
+	if !h.verifyWxPayNotify(body) {
+		logger.Warn("微信支付回调签名无效")
+		sendFailureResponse(w)
+		return
+	}
 
 	// 检查返回的结果
 	if callbackData.ReturnCode != "SUCCESS" {
@@ -351,22 +360,80 @@ func WxPayNotify(w http.ResponseWriter, r *http.Request) {
 		sendFailureResponse(w)
 		return
 	}
+	if callbackData.ResultCode != "SUCCESS" {
+		// 支付失败时支付记录保持待支付，用户可以重新支付，超时后由定时任务取消
+		logger.Warn("微信支付失败")
+		sendSuccessResponse(w)
+		return
+	}
 
-	// 这里你可以进行一些业务处理，比如检查订单状态、更新数据库等
-	// 比如：
-	if callbackData.ResultCode == "SUCCESS" {
-		// 处理支付成功的逻辑
-		log.Printf("Payment Success for Order: %s, TransactionID: %s\n", callbackData.OutTradeNo, callbackData.TransactionID)
-		// 更新订单状态等
-	} else {
-		// 处理支付失败的逻辑
-		log.Printf("Payment Failed for Order: %s\n", callbackData.OutTradeNo)
+	var payment models.Payment
+	if err := h.db.WithContext(r.Context()).Where("payment_number = ?", callbackData.OutTradeNo).First(&payment).Error; err != nil {
+		logger.Warn("微信支付回调的支付记录不存在", "error", err)
+		sendFailureResponse(w)
+		return
+	}
+	if callbackData.TotalFee != int(math.Round(payment.Amount*100)) {
+		logger.Error("微信支付回调的金额与支付记录不一致", "amount", payment.Amount)
+		sendFailureResponse(w)
+		return
+	}
+
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if err := h.markPaid(r.Context(), payment, ip, "微信支付通知交易 "+callbackData.TransactionID+" 支付成功"); err != nil {
+		logger.Error("更新支付状态失败", "error", err)
+		sendFailureResponse(w)
+		return
 	}
 
 	// 返回微信成功的响应
 	sendSuccessResponse(w)
 }
 
+// verifyWxPayNotify 用 V2 API 密钥校验支付结果通知的签名
+func (h *PayHandler) verifyWxPayNotify(body []byte) bool {
+	if h.cfg.Wechat.APIKey == "" {
+		return false
+	}
+	bm := make(gopay.BodyMap)
+	if err := xml.Unmarshal(body, &bm); err != nil {
+		return false
+	}
+	signType := bm.GetString("sign_type")
+	if signType == "" {
+		signType = wechatv2.SignType_MD5
+	}
+	ok, err := wechatv2.VerifySign(h.cfg.Wechat.APIKey, signType, bm)
+	return err == nil && ok
+}
+
+// markPaid 把待支付的记录标记为支付成功，并记录指标和审计日志
+// 支付平台会重复通知同一笔交易，并发的重复通知只有一个能更新成功；已被定时任务取消的支付不会被改回已支付
+func (h *PayHandler) markPaid(ctx context.Context, payment models.Payment, ip, reason string) error {
+	currentTime := time.Now()
+	result := h.db.WithContext(ctx).Model(&models.Payment{}).
+		Where("id = ? AND status = ?", payment.ID, models.PaymentStatusPending).
+		Updates(map[string]interface{}{
+			"status":     models.PaymentStatusPaid,
+			"paid_at":    currentTime,
+			"updated_at": currentTime,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		payment.Status = models.PaymentStatusPaid
+		payment.PaidAt = &currentTime
+		payment.UpdatedAt = currentTime
+		metrics.RecordPayments(payment.PaymentMethod, payment.Status, 1)
+		h.audit.PaymentStatusChanged(ctx, payment, models.PaymentStatusPending, ip, reason)
+	} else if payment.Status == models.PaymentStatusCancelled {
+		// 仍然向支付平台返回成功，避免不停重试，由人工核对后退款
+		logging.FromContext(ctx).Warn("已取消的支付收到支付成功通知，需要人工处理", "payment_number", payment.PaymentNumber)
+	}
+	return nil
+}
+
 // WeChatCallbackResponse 微信支付回调返回的结构体
 type WeChatCallbackResponse struct {
 	XMLName       xml.Name `xml:"xml"`            // XML根元素
@@ -440,7 +507,7 @@ func (h *PayHandler) AlipayNotify(w http.ResponseWriter, r *http.Request) {
 
 	// 查找支付记录
 	var payment models.Payment
-	if err := h.db.Where("payment_number = ?", outTradeNo).First(&payment).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).Where("payment_number = ?", outTradeNo).First(&payment).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "支付记录不存在", http.StatusNotFound) // 如果未找到支付记录，返回 404 错误
 		} else {
@@ -450,11 +517,8 @@ func (h *PayHandler) AlipayNotify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 更新支付状态
-	payment.Status = models.PaymentStatusPaid // 标记支付成功
-	currentTime := time.Now()
-	payment.PaidAt = &currentTime
-	payment.UpdatedAt = currentTime
-	if err := h.db.Save(&payment).Error; err != nil {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if err := h.markPaid(r.Context(), payment, ip, "支付宝通知交易 "+formData.Get("trade_no")+" 支付成功"); err != nil {
 		http.Error(w, "更新支付状态失败", http.StatusInternalServerError) // 如果更新失败，返回 500 错误
 		return
 	}
@@ -485,7 +549,7 @@ func (h *PayHandler) GetPayment(c *gin.Context) {
 	var payments []models.Payment
 
 	// 如果有支付状态，查询时加上状态条件
-	query := h.db.Where("user_id = ?", userIDUint64)
+	query := h.db.WithContext(c.Request.Context()).Where("user_id = ?", userIDUint64)
 	if paymentStatus != "" {
 		query = query.Where("status = ?", paymentStatus)
 	}
@@ -1,29 +1,167 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/search"
+	"qaqmall/internal/views"
 	"qaqmall/models"
 )
 
+// 商品详情中的库存状态
+const (
+	StockStatusInStock    = "in_stock"
+	StockStatusLowStock   = "low_stock"
+	StockStatusOutOfStock = "out_of_stock"
+)
+
 // ProductHandler 商品处理器
 type ProductHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cfg    *config.Config
+	audit  *audit.Logger
+	search search.Engine
+	views  *views.Counter
+}
+
+// NewProductHandler 创建商品处理器，商品变化后通知 engine 更新搜索索引，浏览商品详情时由 counter 计数
+func NewProductHandler(db *gorm.DB, cfg *config.Config, engine search.Engine, counter *views.Counter) *ProductHandler {
+	return &ProductHandler{db: db, cfg: cfg, audit: audit.New(db), search: engine, views: counter}
+}
+
+// ProductRequest 创建或修改商品的请求，category_ids 为商品所属的分类
+// 修改时不传 category_ids 保持原有分类不变，传空数组清空分类
+type ProductRequest struct {
+	models.Product
+	CategoryIDs *[]uint64 `json:"category_ids"`
+}
+
+// ProductDetail 商品详情，options 和 skus 为商品的规格项和启用的 SKU，没有规格时为空数组；
+// images 为按顺序排列的商品图片；stock_status 按实时库存计算；rating 为商品评价的评分汇总；
+// related 为同分类下浏览最多的其他在售商品
+type ProductDetail struct {
+	models.Product
+	Options     []models.ProductOption `json:"options"`
+	SKUs        []models.ProductSKU    `json:"skus"`
+	Images      []models.ProductImage  `json:"images"`
+	StockStatus string                 `json:"stock_status"`
+	Rating      models.RatingSummary   `json:"rating"`
+	Related     []models.Product       `json:"related"`
+}
+
+// GetProduct 获取商品详情并记录一次浏览，已删除的商品返回 404，已下架的商品照常返回
+func (h *ProductHandler) GetProduct(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的商品ID"})
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+
+	detail := ProductDetail{Options: []models.ProductOption{}, Related: []models.Product{}}
+	if err := db.Preload("Categories", orderCategories).First(&detail.Product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "商品不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+	if err := db.Where("product_id = ?", id).Order("position, id").Find(&detail.Options).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+	if detail.SKUs, err = models.ActiveSKUs(db, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+	if detail.SKUs == nil {
+		detail.SKUs = []models.ProductSKU{}
+	}
+	if detail.Images, err = models.ProductImages(db, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+	if detail.Rating, err = models.ProductRating(db, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+	if detail.Related, err = h.related(db, detail.Product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+	detail.StockStatus = stockStatus(detail.Stock, h.cfg.Product.LowStockThreshold)
+
+	h.views.Record(id)
+	if detail.ViewCount, err = h.views.ViewCount(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品详情失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": detail})
 }
 
-// NewProductHandler 创建商品处理器
-func NewProductHandler(db *gorm.DB) *ProductHandler {
-	return &ProductHandler{db: db}
+// related 返回与商品属于同一分类（不含子孙分类）的其他在售商品，按浏览次数从多到少排列
+func (h *ProductHandler) related(db *gorm.DB, product models.Product) ([]models.Product, error) {
+	related := make([]models.Product, 0)
+	if len(product.Categories) == 0 || h.cfg.Product.RelatedLimit == 0 {
+		return related, nil
+	}
+	categoryIDs := make([]uint64, len(product.Categories))
+	for i, category := range product.Categories {
+		categoryIDs[i] = category.ID
+	}
+	err := db.Where("id IN (?)", db.Table("product_categories").Select("product_id").Where("category_id IN ?", categoryIDs)).
+		Where("id <> ? AND is_on_sale = ?", product.ID, true).
+		Order("view_count DESC, id DESC").Limit(h.cfg.Product.RelatedLimit).
+		Find(&related).Error
+	return related, err
 }
 
-// ListProducts 获取商品列表
+// stockStatus 按库存返回库存状态，库存不超过 lowStock 时为 low_stock
+func stockStatus(stock, lowStock int) string {
+	switch {
+	case stock <= 0:
+		return StockStatusOutOfStock
+	case stock <= lowStock:
+		return StockStatusLowStock
+	default:
+		return StockStatusInStock
+	}
+}
+
+// ListProducts 获取商品列表，category_id 不为空时只返回该分类及其子孙分类下的商品
 func (h *ProductHandler) ListProducts(c *gin.Context) {
 	var products []models.Product
-	query := h.db.Model(&models.Product{})
+	db := h.db.WithContext(c.Request.Context())
+	query := db.Model(&models.Product{})
+
+	if value := c.Query("category_id"); value != "" {
+		categoryID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的分类ID"})
+			return
+		}
+		categoryIDs, err := models.CategoryDescendantIDs(db, categoryID)
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "分类不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取商品列表失败"})
+			return
+		}
+		query = query.Where("id IN (?)", db.Table("product_categories").Select("product_id").Where("category_id IN ?", categoryIDs))
+	}
 
 	// 处理分页
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -38,7 +176,7 @@ func (h *ProductHandler) ListProducts(c *gin.Context) {
 	}
 
 	// 获取商品列表
-	if err := query.Offset(offset).Limit(pageSize).Find(&products).Error; err != nil {
+	if err := query.Preload("Categories", orderCategories).Order("id").Offset(offset).Limit(pageSize).Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取商品列表失败"})
 		return
 	}
@@ -51,16 +189,39 @@ func (h *ProductHandler) ListProducts(c *gin.Context) {
 
 // CreateProduct 创建商品
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
+	// 不传 is_on_sale 时默认上架
+	req := ProductRequest{Product: models.Product{IsOnSale: true}}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的请求数据"})
 		return
 	}
+	product := req.Product
+	product.Categories = nil
 
-	if err := h.db.Create(&product).Error; err != nil {
+	categories, ok := h.categories(c, req.CategoryIDs)
+	if !ok {
+		return
+	}
+	err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		product.ViewCount = 0
+		if err := tx.Omit("Categories", "ViewCount").Create(&product).Error; err != nil {
+			return err
+		}
+		// is_on_sale 的默认值为 true，GORM 创建时会把 false 当作零值换成默认值，需要单独写入
+		if !req.IsOnSale {
+			if err := tx.Model(&product).UpdateColumn("is_on_sale", false).Error; err != nil {
+				return err
+			}
+			product.IsOnSale = false
+		}
+		return replaceCategories(tx, &product, categories)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "创建商品失败"})
 		return
 	}
+	refreshSearch(c, h.search, product.ID)
+	h.audit.RecordRequest(c, audit.ActionProductCreated, fmt.Sprintf("创建商品 %s(%d)，价格 %.2f，库存 %d", product.Name, product.ID, product.Price, product.Stock))
 
 	c.JSON(http.StatusCreated, product)
 }
@@ -70,20 +231,55 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	id := c.Param("id")
 	var product models.Product
 
-	if err := h.db.First(&product, id).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&product, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "商品不存在"})
 		return
 	}
 
-	if err := c.ShouldBindJSON(&product); err != nil {
+	previous := product
+	req := ProductRequest{Product: product}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "无效的请求数据"})
 		return
 	}
+	product = req.Product
+	product.ID = previous.ID
+	product.ViewCount = previous.ViewCount
+	product.Categories = nil
 
-	if err := h.db.Save(&product).Error; err != nil {
+	categories, ok := h.categories(c, req.CategoryIDs)
+	if !ok {
+		return
+	}
+	err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// 浏览次数由计数器并发累加，不能用读取时的值覆盖
+		if err := tx.Omit("Categories", "ViewCount").Save(&product).Error; err != nil {
+			return err
+		}
+		// 商品有启用的 SKU 时库存由 SKU 决定，忽略请求中的库存
+		if err := models.SyncSKUStock(tx, product.ID); err != nil {
+			return err
+		}
+		// 商品有图片时主图由排在第一位的图片决定，忽略请求中的和读取后被图片接口修改过的 image_url
+		if err := models.SyncProductImage(tx, product.ID, ""); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Product{}).Where("id = ?", product.ID).Select("stock", "image_url").
+			Row().Scan(&product.Stock, &product.ImageURL); err != nil {
+			return err
+		}
+		if req.CategoryIDs == nil {
+			return tx.Model(&product).Order("sort_order, id").Association("Categories").Find(&product.Categories)
+		}
+		return replaceCategories(tx, &product, categories)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "更新商品失败"})
 		return
 	}
+	refreshSearch(c, h.search, product.ID)
+	h.audit.RecordRequest(c, audit.ActionProductUpdated, fmt.Sprintf("更新商品 %s(%d)，价格 %.2f -> %.2f，库存 %d -> %d，上架 %t -> %t",
+		product.Name, product.ID, previous.Price, product.Price, previous.Stock, product.Stock, previous.IsOnSale, product.IsOnSale))
 
 	c.JSON(http.StatusOK, product)
 }
@@ -93,15 +289,71 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id := c.Param("id")
 	var product models.Product
 
-	if err := h.db.First(&product, id).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&product, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "商品不存在"})
 		return
 	}
 
-	if err := h.db.Delete(&product).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Delete(&product).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "删除商品失败"})
 		return
 	}
+	refreshSearch(c, h.search, product.ID)
+	h.audit.RecordRequest(c, audit.ActionProductDeleted, fmt.Sprintf("删除商品 %s(%d)", product.Name, product.ID))
 
 	c.JSON(http.StatusOK, gin.H{"message": "商品已删除"})
 }
+
+// categories 查询请求中的分类，ids 为 nil 时返回 nil，有分类不存在时直接返回 400
+func (h *ProductHandler) categories(c *gin.Context, ids *[]uint64) ([]models.Category, bool) {
+	if ids == nil {
+		return nil, true
+	}
+	categories := make([]models.Category, 0, len(*ids))
+	if len(*ids) == 0 {
+		return categories, true
+	}
+	if err := h.db.WithContext(c.Request.Context()).Order("sort_order, id").Find(&categories, *ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "查询商品分类失败"})
+		return nil, false
+	}
+
+	found := make(map[uint64]bool, len(categories))
+	for _, category := range categories {
+		found[category.ID] = true
+	}
+	for _, id := range *ids {
+		if !found[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("分类 %d 不存在", id)})
+			return nil, false
+		}
+	}
+	return categories, true
+}
+
+// replaceCategories 把商品的分类替换为 categories，只修改关联表，不会创建或修改分类本身
+func replaceCategories(tx *gorm.DB, product *models.Product, categories []models.Category) error {
+	if categories == nil {
+		return nil
+	}
+	if err := tx.Model(product).Omit("Categories.*").Association("Categories").Replace(categories); err != nil {
+		return err
+	}
+	product.Categories = categories
+	return nil
+}
+
+// orderCategories 预加载商品分类时按分类的排序返回
+func orderCategories(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order, id")
+}
+
+// refreshSearch 通知搜索后端商品已变化，失败时只记录日志，索引会在下次全量重建时恢复一致
+func refreshSearch(c *gin.Context, engine search.Engine, ids ...uint64) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := engine.Refresh(c.Request.Context(), ids...); err != nil {
+		logging.FromContext(c.Request.Context()).Error("更新搜索索引失败", "product_ids", ids, "error", err)
+	}
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/media"
+	"qaqmall/models"
+)
+
+// ProductImageHandler 商品图片处理器，图片文件保存在 storage 中，数据库只保存地址和 key
+type ProductImageHandler struct {
+	db      *gorm.DB
+	cfg     *config.Config
+	audit   *audit.Logger
+	storage media.Storage
+}
+
+func NewProductImageHandler(db *gorm.DB, cfg *config.Config, storage media.Storage) *ProductImageHandler {
+	return &ProductImageHandler{db: db, cfg: cfg, audit: audit.New(db), storage: storage}
+}
+
+// errTooManyImages 上传后商品的图片数量会超过 media.max_images
+var errTooManyImages = errors.New("商品图片数量超过上限")
+
+// ImageOrderRequest 调整商品图片顺序的请求，image_ids 必须恰好包含商品的全部图片
+type ImageOrderRequest struct {
+	ImageIDs []uint64 `json:"image_ids" binding:"required"`
+}
+
+// upload 一张待保存的图片及其缩略图
+type upload struct {
+	image     media.Image
+	data      []byte
+	thumb     []byte
+	thumbType string
+	thumbExt  string
+}
+
+// UploadImages 上传商品图片，multipart 表单中的 images 字段可以包含多个文件，按上传顺序排在已有图片之后
+// 图片类型按文件内容识别，只支持 JPEG、PNG、GIF；全部文件校验通过后才开始保存，任一文件不合法时都不保存
+// 上传后排在第一位的图片作为商品主图写入 image_url
+func (h *ProductImageHandler) UploadImages(c *gin.Context) {
+	product, ok := findProduct(c, h.db)
+	if !ok {
+		return
+	}
+	maxSize := h.cfg.Media.MaxSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxSize)*int64(h.cfg.Media.MaxImages)+1<<20)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 413, "error": "上传的文件过大"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "请使用 multipart/form-data 上传图片"})
+		return
+	}
+	files := form.File["images"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "请选择要上传的图片"})
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+
+	// 先按当前数量快速拒绝，保存前在事务中还会再检查一次
+	var count int64
+	if err := db.Model(&models.ProductImage{}).Where("product_id = ?", product.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询商品图片失败"})
+		return
+	}
+	if int(count)+len(files) > h.cfg.Media.MaxImages {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": fmt.Sprintf("每个商品最多%d张图片，已有%d张", h.cfg.Media.MaxImages, count)})
+		return
+	}
+
+	uploads := make([]upload, 0, len(files))
+	for _, file := range files {
+		if file.Size > int64(maxSize) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 413, "error": fmt.Sprintf("图片 %s 超过%dKB", file.Filename, maxSize>>10)})
+			return
+		}
+		data, err := readFile(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": fmt.Sprintf("读取图片 %s 失败", file.Filename)})
+			return
+		}
+		image, err := media.Inspect(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": fmt.Sprintf("图片 %s 不合法: %v", file.Filename, err)})
+			return
+		}
+		thumb, thumbType, thumbExt, err := media.Thumbnail(data, h.cfg.Media.ThumbnailSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": fmt.Sprintf("图片 %s 不合法: %v", file.Filename, err)})
+			return
+		}
+		uploads = append(uploads, upload{image: *image, data: data, thumb: thumb, thumbType: thumbType, thumbExt: thumbExt})
+	}
+
+	// 先保存文件再写数据库，写数据库失败时删除已保存的文件
+	images := make([]models.ProductImage, 0, len(uploads))
+	var stored []string
+	for _, u := range uploads {
+		image, err := h.store(c.Request.Context(), product.ID, u, &stored)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("保存商品图片失败", "product_id", product.ID, "error", err)
+			h.remove(c, stored...)
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "保存图片失败"})
+			return
+		}
+		images = append(images, image)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 更新商品行以加锁，同一商品的上传在此排队，数量检查和位置分配不会与并发的上传交错
+		result := tx.Model(&models.Product{}).Where("id = ?", product.ID).UpdateColumn("updated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", product.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count)+len(images) > h.cfg.Media.MaxImages {
+			return errTooManyImages
+		}
+		for i := range images {
+			images[i].Position = int(count) + i
+		}
+		if err := tx.Create(&images).Error; err != nil {
+			return err
+		}
+		return models.SyncProductImage(tx, product.ID, "")
+	})
+	if err != nil {
+		h.remove(c, stored...)
+		switch {
+		case errors.Is(err, errTooManyImages):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": fmt.Sprintf("每个商品最多%d张图片，已有%d张", h.cfg.Media.MaxImages, count)})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "商品不存在"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "保存图片失败"})
+		}
+		return
+	}
+	h.audit.RecordRequest(c, audit.ActionProductImagesUploaded, fmt.Sprintf("为商品 %s(%d) 上传 %d 张图片", product.Name, product.ID, len(images)))
+
+	all, err := models.ProductImages(db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询商品图片失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": 201, "data": all})
+}
+
+// ReorderImages 调整商品图片的顺序，排在第一位的图片作为商品主图
+func (h *ProductImageHandler) ReorderImages(c *gin.Context) {
+	product, ok := findProduct(c, h.db)
+	if !ok {
+		return
+	}
+	var req ImageOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求数据"})
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+
+	images, err := models.ProductImages(db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询商品图片失败"})
+		return
+	}
+	remaining := make(map[uint64]bool, len(images))
+	for _, image := range images {
+		remaining[image.ID] = true
+	}
+	for _, id := range req.ImageIDs {
+		if !remaining[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "image_ids 必须恰好包含商品的全部图片且不能重复"})
+			return
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "image_ids 必须恰好包含商品的全部图片且不能重复"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for position, id := range req.ImageIDs {
+			if err := tx.Model(&models.ProductImage{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return models.SyncProductImage(tx, product.ID, "")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "调整图片顺序失败"})
+		return
+	}
+	h.audit.RecordRequest(c, audit.ActionProductImagesReordered, fmt.Sprintf("调整商品 %s(%d) 的图片顺序: %v", product.Name, product.ID, req.ImageIDs))
+
+	if images, err = models.ProductImages(db, product.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询商品图片失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": images})
+}
+
+// DeleteImage 删除商品图片，其余图片的顺序保持不变；删除的是主图时由下一张图片接替
+func (h *ProductImageHandler) DeleteImage(c *gin.Context) {
+	product, ok := findProduct(c, h.db)
+	if !ok {
+		return
+	}
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的图片ID"})
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+	var image models.ProductImage
+	if err := db.Where("id = ? AND product_id = ?", imageID, product.ID).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "图片不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询图片失败"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		images, err := models.ProductImages(tx, product.ID)
+		if err != nil {
+			return err
+		}
+		for position, remaining := range images {
+			if remaining.Position == position {
+				continue
+			}
+			if err := tx.Model(&remaining).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return models.SyncProductImage(tx, product.ID, image.URL)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "删除图片失败"})
+		return
+	}
+	// 文件在数据库提交后再删除，删除失败只会留下无人引用的文件
+	h.remove(c, image.StorageKey, image.ThumbnailKey)
+	h.audit.RecordRequest(c, audit.ActionProductImageDeleted, fmt.Sprintf("删除商品 %s(%d) 的图片 %d", product.Name, product.ID, image.ID))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "图片已删除"})
+}
+
+// store 保存图片和缩略图，返回尚未写入数据库的图片记录，保存成功的 key 追加到 stored
+func (h *ProductImageHandler) store(ctx context.Context, productID uint64, u upload, stored *[]string) (models.ProductImage, error) {
+	key, err := media.NewKey(fmt.Sprintf("products/%d", productID))
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	image := models.ProductImage{
+		ProductID:    productID,
+		StorageKey:   key + u.image.Ext,
+		ThumbnailKey: key + "_thumb" + u.thumbExt,
+		ContentType:  u.image.ContentType,
+		Size:         int64(len(u.data)),
+		Width:        u.image.Width,
+		Height:       u.image.Height,
+	}
+	if image.URL, err = h.storage.Put(ctx, image.StorageKey, u.data, u.image.ContentType); err != nil {
+		return image, err
+	}
+	*stored = append(*stored, image.StorageKey)
+	if image.ThumbnailURL, err = h.storage.Put(ctx, image.ThumbnailKey, u.thumb, u.thumbType); err != nil {
+		return image, err
+	}
+	*stored = append(*stored, image.ThumbnailKey)
+	return image, nil
+}
+
+// remove 删除存储中的文件，请求已结束也继续删除，失败时只记录日志
+func (h *ProductImageHandler) remove(c *gin.Context, keys ...string) {
+	ctx := context.WithoutCancel(c.Request.Context())
+	for _, key := range keys {
+		if err := h.storage.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("删除商品图片文件失败", "key", key, "error", err)
+		}
+	}
+}
+
+func readFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
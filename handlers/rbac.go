@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/middleware"
+	"qaqmall/models"
+)
+
+// defaultRole 新注册用户的角色
+const defaultRole = "user"
+
+// roleNamePattern 角色名，长度受 users.role 字段限制
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,9}$`)
+
+// RBACHandler 管理员管理角色、权限策略和用户的角色分配
+type RBACHandler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	enforcer *casbin.SyncedEnforcer
+	audit    *audit.Logger
+}
+
+func NewRBACHandler(db *gorm.DB, cfg *config.Config, enforcer *casbin.SyncedEnforcer) *RBACHandler {
+	return &RBACHandler{db: db, cfg: cfg, enforcer: enforcer, audit: audit.New(db)}
+}
+
+// policyRequest 一条权限策略：角色 role 可以用 method 访问 path
+// path 支持 keyMatch 通配（如 /admin/*），method 为正则（如 (GET)|(POST)）
+type policyRequest struct {
+	Role   string `json:"role" binding:"required"`
+	Path   string `json:"path" binding:"required"`
+	Method string `json:"method" binding:"required"`
+}
+
+func (p *policyRequest) validate() error {
+	if !roleNamePattern.MatchString(p.Role) {
+		return errors.New("角色名只能包含小写字母、数字和下划线，以字母开头，不超过10个字符")
+	}
+	if !strings.HasPrefix(p.Path, "/") {
+		return errors.New("path 必须以 / 开头")
+	}
+	if _, err := regexp.Compile(p.Method); err != nil {
+		return fmt.Errorf("method 不是合法的正则表达式: %v", err)
+	}
+	return nil
+}
+
+// ListPolicies 列出权限策略，可以按 role 过滤
+func (h *RBACHandler) ListPolicies(c *gin.Context) {
+	var policies [][]string
+	var err error
+	if role := c.Query("role"); role != "" {
+		policies, err = h.enforcer.GetFilteredPolicy(0, role)
+	} else {
+		policies, err = h.enforcer.GetPolicy()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取权限策略失败"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(policies))
+	for _, policy := range policies {
+		items = append(items, gin.H{"role": policy[0], "path": policy[1], "method": policy[2]})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": items,
+			"total": len(items),
+		},
+	})
+}
+
+// AddPolicy 添加权限策略，立即生效
+func (h *RBACHandler) AddPolicy(c *gin.Context) {
+	var req policyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": err.Error()})
+		return
+	}
+
+	// 策略已存在时 AddPolicy 同样返回 true，需要先检查
+	exists, err := h.enforcer.HasPolicy(req.Role, req.Path, req.Method)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加权限策略失败"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "权限策略已存在"})
+		return
+	}
+	if _, err := h.enforcer.AddPolicy(req.Role, req.Path, req.Method); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加权限策略失败"})
+		return
+	}
+
+	h.audit.RecordRequest(c, audit.ActionPolicyAdded, fmt.Sprintf("添加权限策略: %s %s %s", req.Role, req.Path, req.Method))
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "权限策略已添加",
+		"data":    req,
+	})
+}
+
+// RemovePolicy 删除权限策略，立即生效
+func (h *RBACHandler) RemovePolicy(c *gin.Context) {
+	var req policyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+	// 防止管理员删除自己访问权限管理接口的权限后无法恢复
+	if req.Role == "admin" && req.Path == "/admin/*" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能删除管理员访问管理接口的权限"})
+		return
+	}
+
+	removed, err := h.enforcer.RemovePolicy(req.Role, req.Path, req.Method)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除权限策略失败"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "权限策略不存在"})
+		return
+	}
+
+	h.audit.RecordRequest(c, audit.ActionPolicyRemoved, fmt.Sprintf("删除权限策略: %s %s %s", req.Role, req.Path, req.Method))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "权限策略已删除",
+	})
+}
+
+// ListRoles 列出所有角色，以及每个角色的策略数和用户数
+func (h *RBACHandler) ListRoles(c *gin.Context) {
+	policies, err := h.enforcer.GetPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色列表失败"})
+		return
+	}
+	var counts []struct {
+		Role  string
+		Count int64
+	}
+	if err := h.db.Model(&models.User{}).Select("role, COUNT(*) AS count").Group("role").Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色列表失败"})
+		return
+	}
+
+	policyCount := map[string]int{defaultRole: 0, "admin": 0}
+	for _, policy := range policies {
+		policyCount[policy[0]]++
+	}
+	userCount := make(map[string]int64)
+	for _, count := range counts {
+		userCount[count.Role] = count.Count
+		if _, ok := policyCount[count.Role]; !ok {
+			policyCount[count.Role] = 0
+		}
+	}
+
+	names := make([]string, 0, len(policyCount))
+	for name := range policyCount {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		items = append(items, gin.H{"name": name, "policies": policyCount[name], "users": userCount[name]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": items,
+			"total": len(items),
+		},
+	})
+}
+
+// ListRoleUsers 列出拥有某个角色的用户
+func (h *RBACHandler) ListRoleUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := h.db.Model(&models.User{}).Where("role = ?", c.Param("role"))
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+	var users []models.User
+	if err := query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		items = append(items, gin.H{"id": user.ID, "username": user.Username, "email": user.Email, "role": user.Role})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": items,
+			"total": total,
+		},
+	})
+}
+
+// AssignRole 把用户的角色设置为 :role
+func (h *RBACHandler) AssignRole(c *gin.Context) {
+	role := c.Param("role")
+	if !roleNamePattern.MatchString(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色名"})
+		return
+	}
+	// 只能分配已有策略的角色，避免拼错角色名后用户失去所有权限
+	if role != defaultRole {
+		policies, err := h.enforcer.GetFilteredPolicy(0, role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "分配角色失败"})
+			return
+		}
+		if len(policies) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在，请先为该角色添加权限策略"})
+			return
+		}
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	h.setRole(c, user, role)
+}
+
+// RevokeRole 收回用户的 :role 角色，恢复为普通用户
+func (h *RBACHandler) RevokeRole(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	if user.Role != c.Param("role") || user.Role == defaultRole {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户没有该角色"})
+		return
+	}
+	h.setRole(c, user, defaultRole)
+}
+
+// targetUser 查找要修改角色的用户，不能修改自己的角色
+func (h *RBACHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return nil, false
+	}
+	if operatorID, _ := c.Get("user_id"); operatorID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+		}
+		return nil, false
+	}
+	return &user, true
+}
+
+// setRole 同时更新 users.role 和 Casbin 中的角色分配
+// 权限检查以 Casbin 中的分配为准，用户已签发的 token 不需要重新登录即可按新角色生效
+func (h *RBACHandler) setRole(c *gin.Context, user *models.User, role string) {
+	previous := user.Role
+	if err := h.db.Model(user).Update("role", role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配角色失败"})
+		return
+	}
+
+	subject := middleware.UserSubject(user.ID)
+	if _, err := h.enforcer.DeleteRolesForUser(subject); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配角色失败"})
+		return
+	}
+	if _, err := h.enforcer.AddRoleForUser(subject, role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配角色失败"})
+		return
+	}
+
+	h.audit.RecordRequest(c, audit.ActionRoleAssigned, fmt.Sprintf("用户 %s(%d) 的角色由 %s 改为 %s", user.Username, user.ID, previous, role))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "角色已更新",
+		"data": gin.H{
+			"user_id": user.ID,
+			"role":    role,
+		},
+	})
+}
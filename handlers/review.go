@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/config"
+	"qaqmall/internal/logging"
+	"qaqmall/models"
+)
+
+// reviewableStatuses 可以评价的订单状态，即已支付且未取消、未退款
+var reviewableStatuses = []models.OrderStatus{models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusCompleted}
+
+// ReviewHandler 商品评价处理器
+type ReviewHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func NewReviewHandler(db *gorm.DB, cfg *config.Config) *ReviewHandler {
+	return &ReviewHandler{db: db, cfg: cfg}
+}
+
+// CreateReview 评价自己订单中购买的商品，每个订单中的每个商品只能评价一次
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "error": "未找到用户信息"})
+		return
+	}
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的商品ID"})
+		return
+	}
+
+	var req struct {
+		OrderID uint64 `json:"order_id" binding:"required"`
+		Rating  int    `json:"rating" binding:"required,min=1,max=5"`
+		Content string `json:"content" binding:"max=2000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+
+	// 只能评价本人订单中的商品，其他用户的订单和不存在的订单一样返回 404
+	var order models.Order
+	if err := db.Where("id = ? AND user_id = ?", req.OrderID, userID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "订单不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "提交评价失败"})
+		return
+	}
+	if !containsStatus(reviewableStatuses, order.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "订单未支付，不能评价"})
+		return
+	}
+	var items int64
+	if err := db.Model(&models.OrderItem{}).Where("order_id = ? AND product_id = ?", order.ID, productID).
+		Count(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "提交评价失败"})
+		return
+	}
+	if items == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "订单中没有该商品"})
+		return
+	}
+
+	review := models.ProductReview{
+		ProductID: productID,
+		UserID:    order.UserID,
+		OrderID:   order.ID,
+		Rating:    req.Rating,
+		Content:   req.Content,
+	}
+	// 依靠 (order_id, product_id) 唯一索引判断是否已评价，并发提交时也只有一条成功
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&review)
+	if result.Error != nil {
+		logging.FromContext(c).Error("创建商品评价失败", "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "提交评价失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "error": "该订单中的商品已评价"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": review})
+}
+
+// containsStatus 判断订单状态是否在列表中
+func containsStatus(statuses []models.OrderStatus, status models.OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
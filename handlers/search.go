@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/search"
+	"qaqmall/models"
+)
+
+// maxKeywordLength 搜索关键词的最大长度（字符数）
+const maxKeywordLength = 100
+
+// descriptionSnippetLength 高亮时描述片段的最大长度（字符数）
+const descriptionSnippetLength = 120
+
+// SearchHandler 商品搜索处理器，具体的匹配、排序和分面由搜索后端完成
+type SearchHandler struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	search search.Engine
+}
+
+func NewSearchHandler(db *gorm.DB, cfg *config.Config, engine search.Engine) *SearchHandler {
+	return &SearchHandler{db: db, cfg: cfg, search: engine}
+}
+
+// SearchItem 搜索结果中的商品，highlight 为名称和描述中与关键词匹配的部分，匹配处用 <em></em> 标出
+type SearchItem struct {
+	models.Product
+	Highlight map[string]string `json:"highlight,omitempty"`
+}
+
+// Search 按关键词和筛选条件搜索商品，默认只返回在售商品
+func (h *SearchHandler) Search(c *gin.Context) {
+	q, ok := h.parseQuery(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	q.Offset = (page - 1) * pageSize
+	q.Limit = pageSize
+
+	ctx := c.Request.Context()
+	result, err := h.search.Search(ctx, q)
+	if err != nil {
+		logging.FromContext(ctx).Error("搜索商品失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "搜索商品失败"})
+		return
+	}
+
+	db := h.db.WithContext(ctx)
+	items := make([]SearchItem, 0, len(result.IDs))
+	if len(result.IDs) > 0 {
+		var products []models.Product
+		if err := db.Preload("Categories", orderCategories).Find(&products, result.IDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "搜索商品失败"})
+			return
+		}
+		byID := make(map[uint64]models.Product, len(products))
+		for _, product := range products {
+			byID[product.ID] = product
+		}
+		// 按搜索后端返回的顺序输出，索引中已删除但尚未刷新的商品跳过
+		for _, id := range result.IDs {
+			product, ok := byID[id]
+			if !ok {
+				continue
+			}
+			items = append(items, SearchItem{Product: product, Highlight: highlight(product, q.Keyword)})
+		}
+	}
+
+	if len(result.Facets.Categories) > 0 {
+		ids := make([]uint64, len(result.Facets.Categories))
+		for i, facet := range result.Facets.Categories {
+			ids[i] = facet.ID
+		}
+		var categories []models.Category
+		if err := db.Select("id", "name").Find(&categories, ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "搜索商品失败"})
+			return
+		}
+		names := make(map[uint64]string, len(categories))
+		for _, category := range categories {
+			names[category.ID] = category.Name
+		}
+		for i := range result.Facets.Categories {
+			result.Facets.Categories[i].Name = names[result.Facets.Categories[i].ID]
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items":  items,
+			"total":  result.Total,
+			"facets": result.Facets,
+		},
+	})
+}
+
+// Reindex 立即全量重建搜索索引，用于批量导入商品后；sql 后端不需要重建
+func (h *SearchHandler) Reindex(c *gin.Context) {
+	if err := h.search.Refresh(c.Request.Context()); err != nil {
+		logging.FromContext(c.Request.Context()).Error("重建搜索索引失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "重建搜索索引失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "搜索索引已重建"})
+}
+
+// parseQuery 解析搜索条件，参数不合法时直接返回 400
+func (h *SearchHandler) parseQuery(c *gin.Context) (search.Query, bool) {
+	q := search.Query{Keyword: strings.TrimSpace(c.Query("q"))}
+	if len([]rune(q.Keyword)) > maxKeywordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "关键词不能超过100个字符"})
+		return q, false
+	}
+
+	for name, target := range map[string]**float64{"min_price": &q.MinPrice, "max_price": &q.MaxPrice} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil || price < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": name + " 必须是不小于0的数字"})
+			return q, false
+		}
+		*target = &price
+	}
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "min_price 不能大于 max_price"})
+		return q, false
+	}
+
+	onSale, err := strconv.ParseBool(c.DefaultQuery("on_sale", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "on_sale 必须是 true 或 false"})
+		return q, false
+	}
+	q.OnSale = &onSale
+	if value := c.Query("in_stock"); value != "" {
+		if q.InStock, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "in_stock 必须是 true 或 false"})
+			return q, false
+		}
+	}
+
+	if value := c.Query("category_id"); value != "" {
+		categoryID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的分类ID"})
+			return q, false
+		}
+		q.CategoryIDs, err = models.CategoryDescendantIDs(h.db.WithContext(c.Request.Context()), categoryID)
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "分类不存在"})
+			return q, false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "搜索商品失败"})
+			return q, false
+		}
+	}
+
+	q.Sort = c.Query("sort")
+	switch {
+	case q.Sort == "" && q.Keyword != "":
+		q.Sort = search.SortRelevance
+	case q.Sort == "":
+		q.Sort = search.SortNewest
+	}
+	for _, sort := range search.Sorts {
+		if q.Sort == sort {
+			return q, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "sort 可选 " + strings.Join(search.Sorts, "、")})
+	return q, false
+}
+
+// highlight 返回商品名称和描述中与关键词匹配的部分，没有关键词或都不匹配时返回 nil
+func highlight(product models.Product, keyword string) map[string]string {
+	if keyword == "" {
+		return nil
+	}
+	result := make(map[string]string)
+	if name := search.Highlight(product.Name, keyword, 0); name != "" {
+		result["name"] = name
+	}
+	if description := search.Highlight(product.Description, keyword, descriptionSnippetLength); description != "" {
+		result["description"] = description
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+)
+
+type SessionHandler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	sessions *auth.Sessions
+}
+
+func NewSessionHandler(db *gorm.DB, cfg *config.Config, sessions *auth.Sessions) *SessionHandler {
+	return &SessionHandler{db: db, cfg: cfg, sessions: sessions}
+}
+
+// ListSessions 列出当前用户已登录的设备
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	sessions, err := h.sessions.List(userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	current := c.GetString("session_id")
+	items := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, gin.H{
+			"id":           session.ID,
+			"device":       session.Device,
+			"ip":           session.IP,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt.Format(time.RFC3339),
+			"last_seen_at": session.LastSeenAt.Format(time.RFC3339),
+			"expired_at":   session.ExpiredAt.Format(time.RFC3339),
+			"current":      session.ID == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"items": items,
+			"total": len(items),
+		},
+	})
+}
+
+// RevokeSession 退出指定设备上的登录
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	if err := h.sessions.Revoke(userID.(uint64), c.Param("id")); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已退出该设备",
+	})
+}
+
+// RevokeAllSessions 退出所有设备上的登录，包括当前设备
+func (h *SessionHandler) RevokeAllSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	}
+
+	revoked, err := h.sessions.RevokeAll(userID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已退出所有设备",
+		"data": gin.H{
+			"revoked": revoked,
+		},
+	})
+}
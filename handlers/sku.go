@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/search"
+	"qaqmall/models"
+)
+
+// 规格项和 SKU 数量的限制，避免一次生成过多的 SKU
+const (
+	maxSKUOptions      = 3
+	maxSKUOptionValues = 20
+	maxSKUCombinations = 200
+	maxSKUOptionLength = 20
+)
+
+// SKUHandler 商品规格和 SKU 处理器
+type SKUHandler struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	audit  *audit.Logger
+	search search.Engine
+}
+
+func NewSKUHandler(db *gorm.DB, cfg *config.Config, engine search.Engine) *SKUHandler {
+	return &SKUHandler{db: db, cfg: cfg, audit: audit.New(db), search: engine}
+}
+
+// SKUOptionsRequest 设置商品规格项的请求，按规格项的全部组合生成 SKU
+// price、stock 为新组合的价格和库存，不传时价格使用商品价格，库存为0；已有组合保持不变
+type SKUOptionsRequest struct {
+	Options []struct {
+		Name   string   `json:"name"`
+		Values []string `json:"values"`
+	} `json:"options"`
+	Price *float64 `json:"price"`
+	Stock *int     `json:"stock"`
+}
+
+// SKURequest 修改 SKU 的请求，不传的字段保持不变
+type SKURequest struct {
+	Price    *float64 `json:"price"`
+	Stock    *int     `json:"stock"`
+	ImageURL *string  `json:"image_url"`
+	Barcode  *string  `json:"barcode"`
+	IsActive *bool    `json:"is_active"`
+}
+
+// ListSKUs 获取商品的规格项和启用的 SKU
+func (h *SKUHandler) ListSKUs(c *gin.Context) {
+	product, ok := findProduct(c, h.db)
+	if !ok {
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+
+	options := make([]models.ProductOption, 0)
+	if err := db.Where("product_id = ?", product.ID).Order("position, id").Find(&options).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品规格失败"})
+		return
+	}
+	skus, err := models.ActiveSKUs(db, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "获取商品规格失败"})
+		return
+	}
+	if skus == nil {
+		skus = []models.ProductSKU{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"options": options, "skus": skus}})
+}
+
+// SetOptions 替换商品的规格项并重新生成 SKU 矩阵，options 为空时停用全部 SKU，商品恢复为无规格
+func (h *SKUHandler) SetOptions(c *gin.Context) {
+	product, ok := findProduct(c, h.db)
+	if !ok {
+		return
+	}
+	var req SKUOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求数据"})
+		return
+	}
+
+	options, ok := validOptions(c, req)
+	if !ok {
+		return
+	}
+	defaults := models.SKUDefaults{Price: product.Price}
+	if req.Price != nil {
+		if *req.Price <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "价格必须大于0"})
+			return
+		}
+		defaults.Price = *req.Price
+	}
+	if req.Stock != nil {
+		if *req.Stock < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "库存不能小于0"})
+			return
+		}
+		defaults.Stock = *req.Stock
+	}
+
+	skus, err := models.GenerateSKUs(h.db.WithContext(c.Request.Context()), product.ID, options, defaults)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "生成商品规格失败"})
+		return
+	}
+	if skus == nil {
+		skus = []models.ProductSKU{}
+	}
+	refreshSearch(c, h.search, product.ID)
+	h.audit.RecordRequest(c, audit.ActionSKUsGenerated, fmt.Sprintf("设置商品 %s(%d) 的规格，%d 个规格项，%d 个 SKU", product.Name, product.ID, len(options), len(skus)))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"options": options, "skus": skus}})
+}
+
+// UpdateSKU 修改 SKU 的价格、库存、图片、条码和启用状态，商品库存随之更新
+func (h *SKUHandler) UpdateSKU(c *gin.Context) {
+	product, ok := findProduct(c, h.db)
+	if !ok {
+		return
+	}
+	skuID, err := strconv.ParseUint(c.Param("sku_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的SKU ID"})
+		return
+	}
+	db := h.db.WithContext(c.Request.Context())
+	var sku models.ProductSKU
+	if err := db.Where("id = ? AND product_id = ?", skuID, product.ID).First(&sku).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "SKU不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询SKU失败"})
+		return
+	}
+
+	var req SKURequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的请求数据"})
+		return
+	}
+	updates := make(map[string]interface{})
+	switch {
+	case req.Price != nil && *req.Price <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "价格必须大于0"})
+		return
+	case req.Stock != nil && *req.Stock < 0:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "库存不能小于0"})
+		return
+	case req.ImageURL != nil && len(*req.ImageURL) > 255:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "图片地址不能超过255个字符"})
+		return
+	case req.Barcode != nil && len(*req.Barcode) > 64:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "条码不能超过64个字符"})
+		return
+	}
+	if req.Price != nil {
+		updates["price"] = *req.Price
+	}
+	if req.Stock != nil {
+		updates["stock"] = *req.Stock
+	}
+	if req.ImageURL != nil {
+		updates["image_url"] = *req.ImageURL
+	}
+	if req.Barcode != nil {
+		updates["barcode"] = strings.TrimSpace(*req.Barcode)
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+
+	previous := sku
+	if len(updates) > 0 {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&sku).Updates(updates).Error; err != nil {
+				return err
+			}
+			return models.SyncSKUStock(tx, product.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "更新SKU失败"})
+			return
+		}
+		db.First(&sku, sku.ID)
+	}
+	refreshSearch(c, h.search, product.ID)
+	h.audit.RecordRequest(c, audit.ActionSKUUpdated, fmt.Sprintf("更新商品 %s(%d) 的 SKU %s(%d)，价格 %.2f -> %.2f，库存 %d -> %d，启用 %t -> %t",
+		product.Name, product.ID, sku.Name, sku.ID, previous.Price, sku.Price, previous.Stock, sku.Stock, previous.IsActive, sku.IsActive))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": sku})
+}
+
+// findProduct 按路径中的 id 查询商品，不存在时直接返回 404
+func findProduct(c *gin.Context, db *gorm.DB) (models.Product, bool) {
+	var product models.Product
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": "无效的商品ID"})
+		return product, false
+	}
+	if err := db.WithContext(c.Request.Context()).First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "error": "商品不存在"})
+			return product, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "error": "查询商品失败"})
+		return product, false
+	}
+	return product, true
+}
+
+// validOptions 校验规格项：名称和取值不能为空、不能重复，不能包含 : 和 ;（用于 SKU 的 spec_key），
+// 组合数不能超过 maxSKUCombinations，不合法时直接返回 400
+func validOptions(c *gin.Context, req SKUOptionsRequest) ([]models.ProductOption, bool) {
+	invalid := func(message string) ([]models.ProductOption, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "error": message})
+		return nil, false
+	}
+	if len(req.Options) > maxSKUOptions {
+		return invalid(fmt.Sprintf("规格项不能超过%d个", maxSKUOptions))
+	}
+	validText := func(text string) bool {
+		return text != "" && len([]rune(text)) <= maxSKUOptionLength && !strings.ContainsAny(text, ":;")
+	}
+
+	options := make([]models.ProductOption, 0, len(req.Options))
+	names := make(map[string]bool)
+	combinations := 1
+	for _, option := range req.Options {
+		name := strings.TrimSpace(option.Name)
+		if !validText(name) {
+			return invalid(fmt.Sprintf("规格名称不能为空，不能超过%d个字符，且不能包含 : 或 ;", maxSKUOptionLength))
+		}
+		if names[name] {
+			return invalid(fmt.Sprintf("规格名称 %s 重复", name))
+		}
+		names[name] = true
+		if len(option.Values) == 0 || len(option.Values) > maxSKUOptionValues {
+			return invalid(fmt.Sprintf("规格 %s 的取值数量必须在1到%d之间", name, maxSKUOptionValues))
+		}
+
+		values := make([]string, 0, len(option.Values))
+		seen := make(map[string]bool)
+		for _, value := range option.Values {
+			value = strings.TrimSpace(value)
+			if !validText(value) {
+				return invalid(fmt.Sprintf("规格 %s 的取值不能为空，不能超过%d个字符，且不能包含 : 或 ;", name, maxSKUOptionLength))
+			}
+			if seen[value] {
+				return invalid(fmt.Sprintf("规格 %s 的取值 %s 重复", name, value))
+			}
+			seen[value] = true
+			values = append(values, value)
+		}
+		combinations *= len(values)
+		options = append(options, models.ProductOption{Name: name, Values: values})
+	}
+	if combinations > maxSKUCombinations {
+		return invalid(fmt.Sprintf("规格组合不能超过%d个", maxSKUCombinations))
+	}
+	return options, true
+}
+
+// resolveSKU 校验加购或下单时选择的 SKU，商品没有规格时返回 nil，不合法时直接返回 400
+func resolveSKU(c *gin.Context, db *gorm.DB, product models.Product, skuID *uint64) (*models.ProductSKU, bool) {
+	sku, err := models.ResolveSKU(db, product.ID, skuID)
+	switch {
+	case errors.Is(err, models.ErrSKURequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 请选择规格", product.Name)})
+		return nil, false
+	case errors.Is(err, models.ErrSKUNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("商品 %s 的规格不存在或已停用", product.Name)})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询商品规格失败"})
+		return nil, false
+	}
+	return sku, true
+}
@@ -1,25 +1,57 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
-	"strings"
-	"time"
+	"strconv"
+	"sync"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/mail"
+	"qaqmall/internal/service/wechat"
 	"qaqmall/middleware"
 	"qaqmall/models"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db            *gorm.DB
+	cfg           *config.Config
+	sessions      *auth.Sessions
+	accessTokens  *auth.AccessTokens
+	refreshTokens *auth.RefreshTokens
+	loginGuard    *auth.LoginGuard
+	codes         *auth.Codes
+	mfa           *auth.MFA
+	identities    *auth.Identities
+	wechat        *wechat.Client
+	mailer        mail.Mailer
+	audit         *audit.Logger
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(db *gorm.DB, cfg *config.Config, sessions *auth.Sessions, accessTokens *auth.AccessTokens, loginGuard *auth.LoginGuard, codes *auth.Codes, mfa *auth.MFA, mailer mail.Mailer) *UserHandler {
+	return &UserHandler{
+		db:            db,
+		cfg:           cfg,
+		sessions:      sessions,
+		accessTokens:  accessTokens,
+		refreshTokens: auth.NewRefreshTokens(db, cfg.JWT.RefreshExpire),
+		loginGuard:    loginGuard,
+		codes:         codes,
+		mfa:           mfa,
+		identities:    auth.NewIdentities(db),
+		wechat:        wechat.NewClient(cfg.Wechat.APIBaseURL, cfg.Wechat.Timeout),
+		mailer:        mailer,
+		audit:         audit.New(db),
+	}
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
@@ -41,10 +73,24 @@ func (h *UserHandler) Register(c *gin.Context) {
 		})
 		return
 	}
+	if user.Email != "" && !validEmail(user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"error": "无效的邮箱地址",
+		})
+		return
+	}
 
-	// 检查用户名是否已存在
+	// 检查用户名是否已存在；注销账号只做软删除，用户名的唯一约束仍包含已注销的账号，其用户名不能再注册
 	var existingUser models.User
-	if err := h.db.Where("username = ?", user.Username).First(&existingUser).Error; err == nil {
+	if err := h.db.Unscoped().Where("username = ?", user.Username).First(&existingUser).Error; err == nil {
+		if existingUser.DeletedAt.Valid {
+			c.JSON(http.StatusConflict, gin.H{
+				"code":  409,
+				"error": "该用户名属于已注销的账号，不能再次注册",
+			})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":  400,
 			"error": "用户名已存在",
@@ -64,8 +110,9 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 	user.Password = string(hashedPassword)
 
-	// 设置默认角色
+	// 设置默认角色，邮箱需要通过验证邮件验证
 	user.Role = "user"
+	user.EmailVerifiedAt = nil
 
 	// 创建用户
 	if err := h.db.Create(&user).Error; err != nil {
@@ -77,6 +124,13 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// 验证邮件发送失败不影响注册，用户可以稍后重新发送
+	if user.Email != "" {
+		if err := sendVerificationEmail(c.Request.Context(), h.mailer, h.codes, &user); err != nil {
+			logging.FromContext(c).Error("发送验证邮件失败", "user_id", user.ID, "error", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "注册成功",
@@ -88,10 +142,25 @@ func (h *UserHandler) Register(c *gin.Context) {
 	})
 }
 
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash 用户不存在时用于比较的 bcrypt 摘要，使耗时与密码错误时一致
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("qaqmall-dummy-password"), bcrypt.DefaultCost)
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
+
 func (h *UserHandler) Login(c *gin.Context) {
 	var loginInfo struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		Device   string `json:"device"` // 可选，设备名称，为空时根据 User-Agent 识别
 	}
 
 	if err := c.ShouldBindJSON(&loginInfo); err != nil {
@@ -103,43 +172,320 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// 失败次数过多时在校验密码之前直接拒绝；允许的尝试先计入失败次数，并发的请求同样受限
+	ip := c.ClientIP()
+	wait, err := h.loginGuard.Attempt(loginInfo.Username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "登录失败",
+		})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":  429,
+			"error": "登录失败次数过多，请稍后再试",
+		})
+		return
+	}
+
+	// 用户不存在时同样执行一次 bcrypt 比较，避免通过响应内容或耗时判断用户名是否存在
+	var user models.User
+	var userID *uint64
+	passwordHash := dummyPasswordHash()
+	err = h.db.Where("username = ?", loginInfo.Username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.releaseAttempt(c, loginInfo.Username, ip)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "登录失败",
+		})
+		return
+	}
+	if err == nil {
+		userID = &user.ID
+		passwordHash = user.Password
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(loginInfo.Password)) != nil || userID == nil {
+		if err := h.loginGuard.Fail(loginInfo.Username, ip, userID); err != nil {
+			logging.FromContext(c).Error("记录登录失败次数失败", "error", err)
+		}
+		h.audit.Record(c.Request.Context(), userID, ip, audit.ActionLoginFailed,
+			fmt.Sprintf("用户名 %s 密码登录失败", loginInfo.Username))
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":  401,
+			"error": "用户名或密码错误",
+		})
+		return
+	}
+
+	// 开启了两步验证时，密码正确后还需要提交动态码或恢复码才能完成登录
+	// 此时只撤销本次尝试，不清除之前的失败次数，动态码错误同样计入失败次数
+	if h.challengeMFA(c, &user, auth.AMRPassword) {
+		h.releaseAttempt(c, loginInfo.Username, ip)
+		return
+	}
+
+	if err := h.loginGuard.Succeed(loginInfo.Username, ip); err != nil {
+		logging.FromContext(c).Error("清除登录失败次数失败", "error", err)
+	}
+	h.completeLogin(c, &user, loginInfo.Device, auth.AMRPassword, false)
+}
+
+// LoginMFA 两步登录的第二步，提交密码登录返回的 mfa_token 和动态码（或恢复码）
+func (h *UserHandler) LoginMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"` // 身份验证器 App 中的 6 位动态码，或恢复码
+		Device   string `json:"device"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// mfa_token 与密码摘要绑定，修改密码后立即失效
 	var user models.User
-	if err := h.db.Where("username = ? AND deleted_at IS NULL", loginInfo.Username).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	userID, err := h.codes.UserID(auth.PurposeLoginMFA, req.MFAToken)
+	if err == nil {
+		err = h.db.First(&user, userID).Error
+	}
+	if err == nil {
+		err = h.codes.Check(auth.PurposeLoginMFA, req.MFAToken, &user)
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":  401,
+			"error": "登录已过期，请重新输入密码",
+		})
+		return
+	}
+
+	ip := c.ClientIP()
+	wait, err := h.loginGuard.Attempt(user.Username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "登录失败",
+		})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":  429,
+			"error": "登录失败次数过多，请稍后再试",
+		})
+		return
+	}
+
+	if err := h.mfa.Verify(user.ID, req.Code); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			if err := h.loginGuard.Fail(user.Username, ip, &user.ID); err != nil {
+				logging.FromContext(c).Error("记录登录失败次数失败", "error", err)
+			}
+			h.audit.Record(c.Request.Context(), &user.ID, ip, audit.ActionLoginFailed,
+				fmt.Sprintf("用户 %s 两步验证失败", user.Username))
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":  401,
+				"error": "动态码或恢复码错误",
+			})
+		case errors.Is(err, auth.ErrMFANotEnabled):
+			h.releaseAttempt(c, user.Username, ip)
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"code":  401,
-				"error": "用户不存在或已被删除",
+				"error": "登录已过期，请重新输入密码",
+			})
+		default:
+			h.releaseAttempt(c, user.Username, ip)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":  500,
+				"error": "登录失败",
+			})
+		}
+		return
+	}
+
+	if err := h.loginGuard.Succeed(user.Username, ip); err != nil {
+		logging.FromContext(c).Error("清除登录失败次数失败", "error", err)
+	}
+	h.completeLogin(c, &user, req.Device, h.codes.LoginMethod(req.MFAToken), true)
+}
+
+// challengeMFA 用户开启了两步验证时返回 mfa_token，等待调用 LoginMFA 完成登录
+// method 为第一步的认证方式，记录在 mfa_token 中；返回 true 表示已经写入了响应
+func (h *UserHandler) challengeMFA(c *gin.Context, user *models.User, method string) bool {
+	enabled, err := h.mfa.Enabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "登录失败",
+		})
+		return true
+	}
+	if !enabled {
+		return false
+	}
+
+	mfaToken, err := h.codes.IssueLoginMFA(user, method)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "登录失败",
+		})
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "请输入两步验证码",
+		"data": gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int64(h.cfg.MFA.ChallengeExpire.Seconds()),
+		},
+	})
+	return true
+}
+
+// releaseAttempt 撤销 Attempt 登记的尝试，用于校验没有失败就结束的登录
+func (h *UserHandler) releaseAttempt(c *gin.Context, username, ip string) {
+	if err := h.loginGuard.Release(username, ip); err != nil {
+		logging.FromContext(c).Error("撤销登录尝试失败", "error", err)
+	}
+}
+
+// completeLogin 登记会话，并签发 access token 和 refresh token，method 为登录的认证方式
+func (h *UserHandler) completeLogin(c *gin.Context, user *models.User, device, method string, mfa bool) {
+	session, err := h.sessions.Create(user.ID, device, c.ClientIP(), c.Request.UserAgent(), method, mfa)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "创建会话失败",
+		})
+		return
+	}
+	refreshToken, _, err := h.refreshTokens.Issue(user.ID, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "生成token失败",
+		})
+		return
+	}
+	token, err := h.accessTokens.Issue(user.ID, user.Username, user.Role, session.ID, method, mfa)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "生成token失败",
+		})
+		return
+	}
+
+	description := fmt.Sprintf("用户 %s 登录成功，设备 %s", user.Username, session.Device)
+	if mfa {
+		description += "，已通过两步验证"
+	}
+	h.audit.Record(c.Request.Context(), &user.ID, c.ClientIP(), audit.ActionLoginSucceeded, description)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "登录成功",
+		"data": gin.H{
+			"token":         token,
+			"refresh_token": refreshToken,
+			"expires_in":    int64(h.cfg.JWT.Expire.Seconds()),
+			"user_id":       user.ID,
+			"username":      user.Username,
+			"role":          user.Role,
+		},
+	})
+}
+
+// RefreshToken 使用 refresh token 换取新的 access token 和 refresh token
+// 每个 refresh token 只能使用一次，重复使用会结束该次登录的会话
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  400,
+			"error": "无效的请求参数",
+		})
+		return
+	}
+
+	refreshToken, record, err := h.refreshTokens.Rotate(req.RefreshToken)
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		// refresh token 可能已被盗用，该会话的 access token 也一并失效
+		h.sessions.Revoke(record.UserID, record.FamilyID)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":  401,
+				"error": "refresh token已失效，请重新登录",
 			})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"error":   "数据库查询错误",
-				"details": err.Error(),
+				"code":  500,
+				"error": "刷新token失败",
 			})
 		}
 		return
 	}
 
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginInfo.Password)); err != nil {
+	// 会话已结束或用户被删除后不再签发新令牌
+	session, err := h.sessions.Check(c.Request.Context(), record.FamilyID, c.ClientIP())
+	if err != nil {
+		h.refreshTokens.RevokeFamily(record.FamilyID)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":  401,
-			"error": "密码错误",
+			"error": "refresh token已失效，请重新登录",
+		})
+		return
+	}
+	var user models.User
+	if err := h.db.First(&user, record.UserID).Error; err != nil {
+		h.sessions.Revoke(record.UserID, record.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":  401,
+			"error": "用户不存在或已被删除",
+		})
+		return
+	}
+	if err := h.sessions.Extend(record.FamilyID, record.ExpiredAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "刷新token失败",
 		})
 		return
 	}
 
-	// 生成JWT令牌
-	token := generateToken(user.ID, user.Username, user.Role)
+	token, err := h.accessTokens.Issue(user.ID, user.Username, user.Role, record.FamilyID, session.AuthMethod, session.MFAVerifiedAt != nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "刷新token失败",
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
-		"message": "登录成功",
+		"message": "刷新成功",
 		"data": gin.H{
-			"token":    token,
-			"user_id":  user.ID,
-			"username": user.Username,
-			"role":     user.Role,
+			"token":         token,
+			"refresh_token": refreshToken,
+			"expires_in":    int64(h.cfg.JWT.Expire.Seconds()),
 		},
 	})
 }
@@ -158,11 +504,12 @@ func (h *UserHandler) GetUserInfo(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"email":    user.Email,
-		"phone":    user.Phone,
+		"id":             user.ID,
+		"username":       user.Username,
+		"role":           user.Role,
+		"email":          user.Email,
+		"email_verified": user.EmailVerifiedAt != nil,
+		"phone":          user.Phone,
 	})
 }
 
@@ -182,6 +529,10 @@ func (h *UserHandler) UpdateUserInfo(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
 		return
 	}
+	if updateInfo.Email != "" && !validEmail(updateInfo.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邮箱地址"})
+		return
+	}
 
 	var user models.User
 	if err := h.db.First(&user, userID).Error; err != nil {
@@ -189,6 +540,11 @@ func (h *UserHandler) UpdateUserInfo(c *gin.Context) {
 		return
 	}
 
+	// 修改邮箱后需要重新验证
+	emailChanged := user.Email != updateInfo.Email
+	if emailChanged {
+		user.EmailVerifiedAt = nil
+	}
 	user.Email = updateInfo.Email
 	user.Phone = updateInfo.Phone
 
@@ -196,15 +552,21 @@ func (h *UserHandler) UpdateUserInfo(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户信息失败"})
 		return
 	}
+	if emailChanged && user.Email != "" {
+		if err := sendVerificationEmail(c.Request.Context(), h.mailer, h.codes, &user); err != nil {
+			logging.FromContext(c).Error("发送验证邮件失败", "error", err)
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "更新成功",
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"role":     user.Role,
-			"email":    user.Email,
-			"phone":    user.Phone,
+			"id":             user.ID,
+			"username":       user.Username,
+			"role":           user.Role,
+			"email":          user.Email,
+			"email_verified": user.EmailVerifiedAt != nil,
+			"phone":          user.Phone,
 		},
 	})
 }
@@ -229,7 +591,7 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// 使用软删除
+	// 使用软删除，订单等记录仍然引用该用户；用户名保留，不能再被注册
 	if err := h.db.Delete(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":  500,
@@ -238,27 +600,24 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// 获取当前token并加入黑名单
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" {
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) == 2 && parts[0] == "Bearer" {
-			token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-				return []byte("your-secret-key"), nil
-			})
-			if err == nil {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
-					exp := time.Unix(int64(claims["exp"].(float64)), 0)
-					blacklistedToken := models.TokenBlacklist{
-						Token:     parts[1],
-						ExpiredAt: exp,
-					}
-					h.db.Create(&blacklistedToken)
-				}
-			}
-		}
+	// 解除第三方登录绑定，该微信号之后可以重新注册
+	if err := h.identities.DeleteAll(user.ID); err != nil {
+		logging.FromContext(c).Error("删除第三方登录绑定失败", "error", err)
+	}
+	if err := middleware.DeleteUserRoles(user.ID); err != nil {
+		logging.FromContext(c).Error("删除角色分配失败", "error", err)
+	}
+
+	// 结束该用户所有的会话
+	if _, err := h.sessions.RevokeAll(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "删除用户失败",
+		})
+		return
 	}
 
+	h.audit.RecordRequest(c, audit.ActionAccountDeleted, fmt.Sprintf("用户 %s(%d) 注销了账号", user.Username, user.ID))
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "用户已删除",
@@ -266,61 +625,22 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 }
 
 func (h *UserHandler) Logout(c *gin.Context) {
-	// 从请求头中获取token
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
+	userID, _ := c.Get("user_id")
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供token"})
 		return
 	}
 
-	parts := strings.SplitN(authHeader, " ", 2)
-	if !(len(parts) == 2 && parts[0] == "Bearer") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "token格式错误"})
-		return
-	}
-
-	tokenString := parts[1]
-
-	// 解析token以获取过期时间
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte("your-secret-key"), nil
-	})
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的token"})
-		return
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的token claims"})
-		return
-	}
-
-	// 获取token的过期时间
-	exp := time.Unix(int64(claims["exp"].(float64)), 0)
-
-	// 将token加入黑名单
-	blacklistedToken := models.TokenBlacklist{
-		Token:     tokenString,
-		ExpiredAt: exp,
-	}
-
-	if err := h.db.Create(&blacklistedToken).Error; err != nil {
+	// 结束当前会话，access token 和 refresh token 同时失效
+	if err := h.sessions.Revoke(userID.(uint64), sessionID); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
 		return
 	}
+	h.audit.RecordRequest(c, audit.ActionLogout, fmt.Sprintf("会话 %s 登出", sessionID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "登出成功",
 	})
 }
-
-func generateToken(userID uint64, username string, role string) string {
-	token, err := middleware.GenerateNewToken(userID, username, role)
-	if err != nil {
-		return ""
-	}
-	return token
-}
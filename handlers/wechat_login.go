@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/service/wechat"
+	"qaqmall/models"
+)
+
+// errWechatLoginDisabled 对应的微信登录方式没有配置
+var errWechatLoginDisabled = errors.New("微信登录未启用")
+
+// 网页授权的 state 同时写入签名的 cookie，回调提交 code 时核对两者一致，
+// 防止攻击者把自己的授权 code 塞给受害者完成登录（登录 CSRF）
+const (
+	wechatStateCookie = "wechat_oauth_state"
+	wechatStateExpire = 10 * time.Minute
+)
+
+// newWechatState 生成随机的 state，并把 state、过期时间和签名写入 cookie
+func newWechatState(c *gin.Context, secret string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(nonce)
+	expires := strconv.FormatInt(time.Now().Add(wechatStateExpire).Unix(), 10)
+	value := state + "." + expires + "." + signWechatState(secret, state, expires)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(wechatStateCookie, value, int(wechatStateExpire.Seconds()), "/", "", c.Request.TLS != nil, true)
+	return state, nil
+}
+
+// checkWechatState 校验 cookie 的签名和有效期，并确认与提交的 state 一致
+// 校验后清除 cookie，每个 state 只能使用一次
+func checkWechatState(c *gin.Context, secret, state string) bool {
+	value, err := c.Cookie(wechatStateCookie)
+	if err != nil {
+		return false
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(wechatStateCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || state == "" {
+		return false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signWechatState(secret, parts[0], parts[1]))) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(parts[0]), []byte(state))
+}
+
+func signWechatState(secret, state, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(wechatStateCookie + "." + state + "." + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// wechatStateError 网页授权的 state 校验失败
+func wechatStateError(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":  400,
+		"error": "授权状态无效或已过期，请重新授权",
+	})
+}
+
+// exchangeWechatCode 用微信登录的 code 换取 openid 和 unionid
+func exchangeWechatCode(ctx context.Context, client *wechat.Client, cfg config.WechatConfig, provider, code string) (string, string, error) {
+	switch provider {
+	case models.IdentityWechatMini:
+		if cfg.MiniAppID == "" {
+			return "", "", errWechatLoginDisabled
+		}
+		result, err := client.Code2Session(ctx, cfg.MiniAppID, cfg.MiniAppSecret, code)
+		if err != nil {
+			return "", "", err
+		}
+		return result.OpenID, result.UnionID, nil
+	case models.IdentityWechatWeb:
+		if cfg.AppSecret == "" {
+			return "", "", errWechatLoginDisabled
+		}
+		result, err := client.OAuthAccessToken(ctx, cfg.AppID, cfg.AppSecret, code)
+		if err != nil {
+			return "", "", err
+		}
+		return result.OpenID, result.UnionID, nil
+	default:
+		return "", "", errWechatLoginDisabled
+	}
+}
+
+// wechatError 把换取 openid 时的错误转换为响应
+func wechatError(c *gin.Context, err error) {
+	var apiErr *wechat.APIError
+	switch {
+	case errors.Is(err, errWechatLoginDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":  503,
+			"error": "微信登录未启用",
+		})
+	case errors.As(err, &apiErr):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":  401,
+			"error": "微信授权已失效，请重新授权",
+		})
+	default:
+		logging.FromContext(c).Error("调用微信登录接口失败", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"code":  502,
+			"error": "调用微信接口失败，请稍后再试",
+		})
+	}
+}
+
+// WechatMiniLogin 小程序登录，提交 wx.login 获取的 code
+func (h *UserHandler) WechatMiniLogin(c *gin.Context) {
+	h.wechatLogin(c, models.IdentityWechatMini)
+}
+
+// WechatWebLogin 网页授权登录，提交授权回调中的 code 和 state
+func (h *UserHandler) WechatWebLogin(c *gin.Context) {
+	h.wechatLogin(c, models.IdentityWechatWeb)
+}
+
+// WechatAuthorizeURL 返回网页授权地址，前端跳转过去，用户同意后微信带着 code 和 state 跳转回 redirect_uri
+// state 由服务端生成并写入 cookie，登录或绑定时需要原样提交
+func (h *UserHandler) WechatAuthorizeURL(c *gin.Context) {
+	var req struct {
+		RedirectURI string `form:"redirect_uri" binding:"required,url"`
+		Scope       string `form:"scope" binding:"omitempty,oneof=snsapi_base snsapi_userinfo"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+	if h.cfg.Wechat.AppSecret == "" {
+		wechatError(c, errWechatLoginDisabled)
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = wechat.ScopeBase
+	}
+
+	var authorizeURL string
+	state, err := newWechatState(c, h.cfg.Account.CodeSecret)
+	if err == nil {
+		authorizeURL, err = wechat.AuthorizeURL(h.cfg.Wechat.AppID, req.RedirectURI, req.Scope, state)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "生成授权地址失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"url": authorizeURL,
+		},
+	})
+}
+
+// wechatLogin 用 code 换取 openid，找到或注册对应的用户后签发与密码登录相同的令牌
+func (h *UserHandler) wechatLogin(c *gin.Context, provider string) {
+	var req struct {
+		Code   string `json:"code" binding:"required"`
+		State  string `json:"state"` // 网页授权必填，即授权地址中的 state
+		Device string `json:"device"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"error":   "无效的请求参数",
+			"details": err.Error(),
+		})
+		return
+	}
+	// 网页授权未启用时不校验 state，由 exchangeWechatCode 返回未启用
+	if provider == models.IdentityWechatWeb && h.cfg.Wechat.AppSecret != "" && !checkWechatState(c, h.cfg.Account.CodeSecret, req.State) {
+		wechatStateError(c)
+		return
+	}
+
+	openID, unionID, err := exchangeWechatCode(c.Request.Context(), h.wechat, h.cfg.Wechat, provider, req.Code)
+	if err != nil {
+		wechatError(c, err)
+		return
+	}
+
+	user, created, err := h.identities.Resolve(provider, openID, unionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":  500,
+			"error": "登录失败",
+		})
+		return
+	}
+	if created {
+		logging.FromContext(c).Info("微信登录注册新用户", "user_id", user.ID, "provider", provider)
+	}
+
+	// 开启了两步验证的用户同样需要提交动态码
+	if h.challengeMFA(c, user, auth.AMRWechat) {
+		return
+	}
+	h.completeLogin(c, user, req.Device, auth.AMRWechat, false)
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/internal/logging"
+	"qaqmall/models"
+)
+
+// 审计日志的动作，写入 system_logs.action
+const (
+	ActionLoginSucceeded = "login_succeeded"
+	ActionLoginFailed    = "login_failed"
+	ActionLoginLocked    = "login_locked"
+	ActionLoginUnlocked  = "login_unlocked"
+	ActionLogout         = "logout"
+	ActionAccountDeleted = "account_deleted"
+
+	ActionRoleAssigned  = "role_assigned"
+	ActionPolicyAdded   = "policy_added"
+	ActionPolicyRemoved = "policy_removed"
+
+	ActionProductCreated         = "product_created"
+	ActionProductUpdated         = "product_updated"
+	ActionProductDeleted         = "product_deleted"
+	ActionSKUsGenerated          = "skus_generated"
+	ActionSKUUpdated             = "sku_updated"
+	ActionProductImagesUploaded  = "product_images_uploaded"
+	ActionProductImagesReordered = "product_images_reordered"
+	ActionProductImageDeleted    = "product_image_deleted"
+
+	ActionCategoryCreated = "category_created"
+	ActionCategoryUpdated = "category_updated"
+	ActionCategoryDeleted = "category_deleted"
+	ActionCategoryMoved   = "category_moved"
+
+	ActionOrderCancelled       = "order_cancelled"
+	ActionPaymentStatusChanged = "payment_status_changed"
+)
+
+// Logger 把安全和资金相关的操作写入 system_logs
+// 写入失败只打印日志，不影响业务流程
+type Logger struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Logger {
+	return &Logger{db: db}
+}
+
+// Record 写入一条审计日志，userID 为操作人或操作涉及的用户，没有时为 nil（如定时任务）
+func (l *Logger) Record(ctx context.Context, userID *uint64, ip, action, description string) {
+	entry := &models.SystemLog{UserID: userID, Action: action, Description: description, IPAddress: ip}
+	if err := l.db.WithContext(ctx).Create(entry).Error; err != nil {
+		logging.FromContext(ctx).Error("写入审计日志失败", "action", action, "error", err)
+	}
+}
+
+// RecordRequest 记录当前请求中的操作，操作人为已登录的用户，IP 为客户端 IP
+func (l *Logger) RecordRequest(c *gin.Context, action, description string) {
+	var userID *uint64
+	if value, ok := c.Get("user_id"); ok {
+		if id, ok := value.(uint64); ok {
+			userID = &id
+		}
+	}
+	l.Record(c.Request.Context(), userID, c.ClientIP(), action, description)
+}
+
+// PaymentStatusChanged 记录支付记录的状态变化
+func (l *Logger) PaymentStatusChanged(ctx context.Context, payment models.Payment, from models.PaymentStatus, ip, reason string) {
+	userID := payment.UserID
+	description := fmt.Sprintf("支付记录 %s（订单 %d，%s，金额 %.2f）状态由 %s 变为 %s：%s",
+		payment.PaymentNumber, payment.OrderID, payment.PaymentMethod, payment.Amount, statusName(from), payment.Status, reason)
+	l.Record(ctx, &userID, ip, ActionPaymentStatusChanged, description)
+}
+
+func statusName(status models.PaymentStatus) string {
+	if status == "" {
+		return "无"
+	}
+	return string(status)
+}
+
+// Filter 查询审计日志的条件，零值表示不限制
+type Filter struct {
+	UserID   *uint64
+	Action   string
+	From     time.Time // 包含
+	To       time.Time // 不包含
+	Page     int
+	PageSize int
+}
+
+// Query 按条件分页查询审计日志，按时间倒序
+func (l *Logger) Query(ctx context.Context, filter Filter) ([]models.SystemLog, int64, error) {
+	query := l.db.WithContext(ctx).Model(&models.SystemLog{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []models.SystemLog
+	err := query.Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&logs).Error
+	return logs, total, err
+}
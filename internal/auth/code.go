@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"qaqmall/models"
+)
+
+// ErrInvalidCode 验证码格式错误、签名不符、已过期或已使用
+var ErrInvalidCode = errors.New("验证码无效或已过期")
+
+// 验证码用途，不同用途的验证码不能混用
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+	PurposeLoginMFA      = "login_mfa" // 密码验证通过、等待提交两步验证码的登录
+)
+
+// Codes 邮件中发送的一次性验证码，以及两步登录中间步骤的凭证
+// 验证码由用户ID、过期时间和用户状态指纹组成并用 HMAC 签名，不需要在数据库中保存。
+// 指纹取自验证码要修改的状态（邮箱验证状态或密码摘要），验证码使用后状态改变，指纹不再匹配，
+// 因此每个验证码只能使用一次
+type Codes struct {
+	secret []byte
+	ttl    map[string]time.Duration
+}
+
+// NewCodes 创建验证码签发器，ttl 为各用途验证码的有效期，未配置有效期的用途不能签发
+func NewCodes(secret string, ttl map[string]time.Duration) *Codes {
+	return &Codes{secret: []byte(secret), ttl: ttl}
+}
+
+type codePayload struct {
+	UserID      uint64 `json:"uid"`
+	ExpiresAt   int64  `json:"exp"`
+	Fingerprint string `json:"fp"`
+	Method      string `json:"amr,omitempty"` // 两步登录第一步使用的认证方式
+}
+
+// Issue 为用户签发指定用途的验证码
+func (c *Codes) Issue(purpose string, user *models.User) (string, error) {
+	return c.issue(purpose, user, "")
+}
+
+// IssueLoginMFA 签发两步登录的凭证，method 为第一步使用的认证方式，完成登录时通过 LoginMethod 取回
+func (c *Codes) IssueLoginMFA(user *models.User, method string) (string, error) {
+	return c.issue(PurposeLoginMFA, user, method)
+}
+
+func (c *Codes) issue(purpose string, user *models.User, method string) (string, error) {
+	if _, ok := c.ttl[purpose]; !ok {
+		return "", fmt.Errorf("未配置 %s 验证码的有效期", purpose)
+	}
+	payload, err := json.Marshal(codePayload{
+		UserID:      user.ID,
+		ExpiresAt:   time.Now().Add(c.ttl[purpose]).Unix(),
+		Fingerprint: fingerprint(purpose, user),
+		Method:      method,
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + c.sign(purpose, encoded), nil
+}
+
+// UserID 校验签名和有效期，返回验证码所属的用户ID
+// 调用方查出用户后还需要调用 Check 确认验证码未被使用
+func (c *Codes) UserID(purpose, code string) (uint64, error) {
+	payload, err := c.parse(purpose, code)
+	if err != nil {
+		return 0, err
+	}
+	return payload.UserID, nil
+}
+
+// LoginMethod 返回两步登录凭证中第一步的认证方式，凭证无效或未记录时为密码登录
+func (c *Codes) LoginMethod(code string) string {
+	payload, err := c.parse(PurposeLoginMFA, code)
+	if err != nil || payload.Method == "" {
+		return AMRPassword
+	}
+	return payload.Method
+}
+
+// Check 完整校验验证码，用户状态已改变（验证码已使用）时返回 ErrInvalidCode
+func (c *Codes) Check(purpose, code string, user *models.User) error {
+	payload, err := c.parse(purpose, code)
+	if err != nil {
+		return err
+	}
+	if payload.UserID != user.ID || !hmac.Equal([]byte(payload.Fingerprint), []byte(fingerprint(purpose, user))) {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+func (c *Codes) parse(purpose, code string) (*codePayload, error) {
+	if _, ok := c.ttl[purpose]; !ok {
+		return nil, ErrInvalidCode
+	}
+	encoded, signature, ok := strings.Cut(code, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(c.sign(purpose, encoded))) {
+		return nil, ErrInvalidCode
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCode
+	}
+	var payload codePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrInvalidCode
+	}
+	if time.Now().Unix() >= payload.ExpiresAt {
+		return nil, ErrInvalidCode
+	}
+	return &payload, nil
+}
+
+// sign 签名时带上用途，验证邮箱的验证码不能用来重置密码
+func (c *Codes) sign(purpose, encoded string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(purpose + "." + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// fingerprint 验证码要修改的用户状态的摘要
+func fingerprint(purpose string, user *models.User) string {
+	var state string
+	switch purpose {
+	case PurposeVerifyEmail:
+		// 邮箱修改或验证完成后指纹都会变化
+		state = user.Email
+		if user.EmailVerifiedAt != nil {
+			state += "|" + strconv.FormatInt(user.EmailVerifiedAt.Unix(), 10)
+		}
+	case PurposeResetPassword, PurposeLoginMFA:
+		// 密码修改后，尚未使用的重置验证码和登录凭证都失效
+		state = user.Password
+	}
+	sum := sha256.Sum256([]byte(purpose + "|" + state))
+	return hex.EncodeToString(sum[:8])
+}
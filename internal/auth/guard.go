@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/config"
+	"qaqmall/internal/audit"
+	"qaqmall/models"
+)
+
+// attemptRetry 进行中的尝试已达到失败次数上限时，需要等待它们完成后再尝试
+const attemptRetry = time.Second
+
+// errAttemptBlocked 尝试被拒绝，回滚本次计数
+var errAttemptBlocked = errors.New("登录尝试过于频繁")
+
+// LoginGuard 登录防暴力破解
+// 登录失败按用户名和 IP 分别计数：每次失败后需要等待的时间指数增长，
+// 达到阈值后锁定一段时间。计数保存在数据库中，多个实例共享。
+// 尝试在校验密码之前就计入失败次数，校验通过后再撤销，并发的请求同样受阈值限制
+type LoginGuard struct {
+	db    *gorm.DB
+	cfg   config.LoginConfig
+	audit *audit.Logger
+}
+
+func NewLoginGuard(db *gorm.DB, cfg config.LoginConfig) *LoginGuard {
+	return &LoginGuard{db: db, cfg: cfg, audit: audit.New(db)}
+}
+
+// Attempt 在校验密码（或动态码）之前登记一次尝试，返回还需要等待多久才能再次尝试，0 表示可以继续校验
+// 尝试先计入失败次数，之后必须调用 Fail、Succeed 或 Release 之一
+func (g *LoginGuard) Attempt(username, ip string) (time.Duration, error) {
+	keys := []struct{ kind, value string }{
+		{models.LoginFailureByUsername, truncate(username, 64)},
+		{models.LoginFailureByIP, truncate(ip, 64)},
+	}
+	now := time.Now()
+
+	var wait time.Duration
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		records := make([]models.LoginFailure, len(keys))
+		for i, key := range keys {
+			// 先原子地加一并锁住记录，再根据加一之前的状态判断是否允许本次尝试
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.LoginFailure{Kind: key.kind, Value: key.value, LastFailedAt: now}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&models.LoginFailure{}).Where("kind = ? AND value = ?", key.kind, key.value).
+				Update("failures", gorm.Expr("failures + 1")).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("kind = ? AND value = ?", key.kind, key.value).First(&records[i]).Error; err != nil {
+				return err
+			}
+
+			previous := records[i]
+			previous.Failures--
+			if until := g.blockedUntil(previous, now); until.Sub(now) > wait {
+				wait = until.Sub(now)
+			}
+		}
+		if wait > 0 {
+			return errAttemptBlocked
+		}
+
+		for i := range records {
+			// 锁定到期或长时间没有失败后重新计数
+			if g.expired(records[i], now) {
+				records[i].Failures = 1
+				records[i].LockedUntil = nil
+			}
+			records[i].LastFailedAt = now
+			if err := tx.Save(&records[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errAttemptBlocked) {
+		return wait, nil
+	}
+	return 0, err
+}
+
+// Fail 校验未通过，尝试已经计入失败次数，达到阈值时锁定并写入系统日志
+// userID 为空表示用户名不存在
+func (g *LoginGuard) Fail(username, ip string, userID *uint64) error {
+	if err := g.lock(models.LoginFailureByUsername, username, ip, userID); err != nil {
+		return err
+	}
+	return g.lock(models.LoginFailureByIP, ip, ip, nil)
+}
+
+// Succeed 登录成功后清除该用户名的失败次数，并撤销本次尝试对 IP 的计数
+// IP 之前的失败次数不清除，避免攻击者用自己的账号登录来重置计数
+func (g *LoginGuard) Succeed(username, ip string) error {
+	err := g.db.Where("kind = ? AND value = ?", models.LoginFailureByUsername, truncate(username, 64)).
+		Delete(&models.LoginFailure{}).Error
+	if err != nil {
+		return err
+	}
+	return g.release(models.LoginFailureByIP, ip)
+}
+
+// Release 撤销本次尝试的计数，用于密码正确、等待两步验证的登录，之前的失败次数保持不变
+func (g *LoginGuard) Release(username, ip string) error {
+	if err := g.release(models.LoginFailureByUsername, username); err != nil {
+		return err
+	}
+	return g.release(models.LoginFailureByIP, ip)
+}
+
+// Locks 返回当前所有被锁定的用户名和 IP
+func (g *LoginGuard) Locks() ([]models.LoginFailure, error) {
+	var records []models.LoginFailure
+	err := g.db.Where("locked_until > ?", time.Now()).Order("locked_until DESC").Find(&records).Error
+	return records, err
+}
+
+// Unlock 管理员手动解除锁定，同时清除失败次数，返回是否存在对应的记录
+func (g *LoginGuard) Unlock(kind, value string, operatorID uint64, ip string) (bool, error) {
+	result := g.db.Where("kind = ? AND value = ?", kind, truncate(value, 64)).Delete(&models.LoginFailure{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	g.audit.Record(context.Background(), &operatorID, ip, audit.ActionLoginUnlocked,
+		fmt.Sprintf("管理员解除了 %s %s 的登录锁定", kindName(kind), value))
+	return true, nil
+}
+
+// lock 失败次数达到阈值且尚未锁定时锁定，条件更新保证并发的失败只锁定一次、只写一条日志
+func (g *LoginGuard) lock(kind, value, ip string, userID *uint64) error {
+	value = truncate(value, 64)
+	until := time.Now().Add(g.cfg.LockoutDuration)
+	result := g.db.Model(&models.LoginFailure{}).
+		Where("kind = ? AND value = ? AND locked_until IS NULL AND failures >= ?", kind, value, g.limit(kind)).
+		Update("locked_until", until)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var record models.LoginFailure
+	if err := g.db.Where("kind = ? AND value = ?", kind, value).First(&record).Error; err != nil {
+		return err
+	}
+	g.audit.Record(context.Background(), userID, ip, audit.ActionLoginLocked,
+		fmt.Sprintf("%s %s 连续登录失败 %d 次，锁定至 %s",
+			kindName(kind), value, record.Failures, until.Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+// release 撤销一次尝试的计数
+func (g *LoginGuard) release(kind, value string) error {
+	return g.db.Model(&models.LoginFailure{}).
+		Where("kind = ? AND value = ? AND failures > 0", kind, truncate(value, 64)).
+		Update("failures", gorm.Expr("failures - 1")).Error
+}
+
+// expired 锁定已到期，或超过 FailureWindow 没有失败，此时重新计数
+func (g *LoginGuard) expired(record models.LoginFailure, now time.Time) bool {
+	if record.LockedUntil != nil {
+		return !record.LockedUntil.After(now)
+	}
+	return now.Sub(record.LastFailedAt) > g.cfg.FailureWindow
+}
+
+// blockedUntil 计算记录允许下一次尝试的时间
+func (g *LoginGuard) blockedUntil(record models.LoginFailure, now time.Time) time.Time {
+	if record.LockedUntil != nil {
+		return *record.LockedUntil
+	}
+	if g.expired(record, now) {
+		return time.Time{}
+	}
+	// 进行中的尝试已达到阈值，等它们完成后根据结果锁定或撤销计数
+	if record.Failures >= g.limit(record.Kind) {
+		return now.Add(attemptRetry)
+	}
+
+	// IP 可能是多个用户共用的出口，超过单个用户名的阈值后才开始退避
+	failures := record.Failures
+	if record.Kind == models.LoginFailureByIP {
+		failures -= g.cfg.MaxFailures
+	}
+	if failures <= 0 {
+		return time.Time{}
+	}
+	return record.LastFailedAt.Add(g.backoff(failures))
+}
+
+// backoff 第 n 次失败后需要等待 BaseDelay * 2^(n-1)，不超过锁定时长
+func (g *LoginGuard) backoff(failures int) time.Duration {
+	delay := g.cfg.BaseDelay
+	for i := 1; i < failures && delay < g.cfg.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > g.cfg.LockoutDuration {
+		delay = g.cfg.LockoutDuration
+	}
+	return delay
+}
+
+func (g *LoginGuard) limit(kind string) int {
+	if kind == models.LoginFailureByIP {
+		return g.cfg.IPMaxFailures
+	}
+	return g.cfg.MaxFailures
+}
+
+func kindName(kind string) string {
+	if kind == models.LoginFailureByIP {
+		return "IP"
+	}
+	return "用户名"
+}
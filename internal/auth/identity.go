@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+var (
+	// ErrIdentityTaken 第三方身份已绑定到其他用户
+	ErrIdentityTaken = errors.New("该账号已绑定其他用户")
+	// ErrIdentityNotFound 第三方身份不存在或不属于当前用户
+	ErrIdentityNotFound = errors.New("绑定记录不存在")
+	// ErrLastLoginMethod 用户没有设置密码，不能解绑最后一个第三方身份
+	ErrLastLoginMethod = errors.New("不能解绑唯一的登录方式")
+)
+
+// Identities 第三方登录身份与用户的绑定关系
+type Identities struct {
+	db *gorm.DB
+}
+
+func NewIdentities(db *gorm.DB) *Identities {
+	return &Identities{db: db}
+}
+
+// Resolve 返回第三方身份对应的用户，没有绑定时自动注册新用户，第二个返回值表示是否新注册
+// 身份未绑定但 unionID 与已绑定的其他身份相同时，视为同一个用户并自动绑定
+func (i *Identities) Resolve(provider, subject, unionID string) (*models.User, bool, error) {
+	var user models.User
+	var created bool
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+		switch {
+		case err == nil:
+			err = tx.First(&user, identity.UserID).Error
+			if err == nil {
+				if identity.UnionID == "" && unionID != "" {
+					return tx.Model(&identity).Update("union_id", unionID).Error
+				}
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			// 用户已注销，清除遗留的绑定后按新用户处理
+			if err := tx.Delete(&identity).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if unionID != "" {
+			err := tx.Joins("JOIN user_identities ON user_identities.user_id = users.id").
+				Where("user_identities.union_id = ?", unionID).First(&user).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if err == nil {
+				return tx.Create(&models.UserIdentity{UserID: user.ID, Provider: provider, Subject: subject, UnionID: unionID}).Error
+			}
+		}
+
+		// 通过第三方登录注册的用户没有密码，只能用第三方身份登录，设置密码后才能用密码登录
+		username, err := randomUsername()
+		if err != nil {
+			return err
+		}
+		user = models.User{Username: username, Role: "user"}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		created = true
+		return tx.Create(&models.UserIdentity{UserID: user.ID, Provider: provider, Subject: subject, UnionID: unionID}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &user, created, nil
+}
+
+// Bind 把第三方身份绑定到已有用户，已绑定到当前用户时直接返回
+func (i *Identities) Bind(userID uint64, provider, subject, unionID string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := i.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err == nil {
+		if identity.UserID != userID {
+			return nil, ErrIdentityTaken
+		}
+		return &identity, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	identity = models.UserIdentity{UserID: userID, Provider: provider, Subject: subject, UnionID: unionID}
+	if err := i.db.Create(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// List 返回用户绑定的所有第三方身份
+func (i *Identities) List(userID uint64) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := i.db.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, err
+}
+
+// Unbind 解绑用户的某个第三方身份
+func (i *Identities) Unbind(user *models.User, id uint64) error {
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		var identities []models.UserIdentity
+		if err := tx.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+			return err
+		}
+
+		found := false
+		for _, identity := range identities {
+			found = found || identity.ID == id
+		}
+		if !found {
+			return ErrIdentityNotFound
+		}
+		if user.Password == "" && len(identities) == 1 {
+			return ErrLastLoginMethod
+		}
+		return tx.Where("id = ? AND user_id = ?", id, user.ID).Delete(&models.UserIdentity{}).Error
+	})
+}
+
+// DeleteAll 删除用户的所有绑定，用于注销账号后允许该第三方身份重新注册
+func (i *Identities) DeleteAll(userID uint64) error {
+	return i.db.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error
+}
+
+// randomUsername 生成第三方登录注册用户的用户名，目前只有微信登录，统一使用 wx_ 前缀
+func randomUsername() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "wx_" + hex.EncodeToString(buf), nil
+}
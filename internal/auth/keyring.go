@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/logging"
+	"qaqmall/models"
+)
+
+// 支持的签名算法
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// signingKey 解析后的签名密钥
+type signingKey struct {
+	kid       string
+	algorithm string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+	retiredAt *time.Time
+}
+
+// KeyRing JWT 密钥环，包含一个当前签名密钥和仍可用于验证的历史密钥
+// 密钥保存在数据库中，多个实例共享同一组密钥，重启后已签发的令牌仍然有效
+type KeyRing struct {
+	db        *gorm.DB
+	algorithm string
+	rotation  time.Duration // 签名密钥轮换周期
+	retention time.Duration // 退役密钥继续用于验证的时长，等于 access token 有效期
+
+	mu       sync.RWMutex
+	active   *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+}
+
+// reloadInterval 遇到未知 kid 时重新加载密钥的最小间隔，避免伪造的 kid 导致频繁查询数据库
+const reloadInterval = 10 * time.Second
+
+// NewKeyRing 从数据库加载密钥，没有可用的签名密钥时生成一个
+func NewKeyRing(db *gorm.DB, cfg config.JWTConfig) (*KeyRing, error) {
+	k := &KeyRing{
+		db:        db,
+		algorithm: cfg.Algorithm,
+		rotation:  cfg.KeyRotation,
+		retention: cfg.Expire,
+	}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+	if active == nil || active.algorithm != k.algorithm {
+		if err := k.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Rotate 由定时任务调用：当前签名密钥超过轮换周期时生成新密钥，并清理已无令牌可验证的退役密钥
+// 每次调用都会重新加载密钥，使其他实例轮换出的密钥在本实例生效
+func (k *KeyRing) Rotate(ctx context.Context) error {
+	if err := k.load(); err != nil {
+		return fmt.Errorf("加载JWT签名密钥失败: %v", err)
+	}
+
+	k.mu.RLock()
+	due := k.active == nil || time.Since(k.active.createdAt) >= k.rotation
+	k.mu.RUnlock()
+	if due {
+		if err := k.rotate(); err != nil {
+			return fmt.Errorf("轮换JWT签名密钥失败: %v", err)
+		}
+		logging.FromContext(ctx).Info("JWT签名密钥已轮换")
+	}
+
+	result := k.db.WithContext(ctx).Where("retired_at < ?", time.Now().Add(-k.retention)).Delete(&models.JWTKey{})
+	if result.Error != nil {
+		return fmt.Errorf("清理退役的JWT签名密钥失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		if err := k.load(); err != nil {
+			return fmt.Errorf("加载JWT签名密钥失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// rotate 生成新的签名密钥，并将原有的签名密钥标记为退役
+func (k *KeyRing) rotate() error {
+	private, err := generateKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("编码签名密钥失败: %v", err)
+	}
+
+	record := models.JWTKey{
+		KID:        uuid.New().String(),
+		Algorithm:  k.algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+	err = k.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JWTKey{}).Where("retired_at IS NULL").Update("retired_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return fmt.Errorf("保存签名密钥失败: %v", err)
+	}
+	return k.load()
+}
+
+// load 从数据库重新加载所有密钥，最新的未退役密钥作为签名密钥
+func (k *KeyRing) load() error {
+	var records []models.JWTKey
+	if err := k.db.Order("created_at").Find(&records).Error; err != nil {
+		return fmt.Errorf("查询签名密钥失败: %v", err)
+	}
+
+	keys := make(map[string]*signingKey, len(records))
+	var active *signingKey
+	for _, record := range records {
+		key, err := parseKey(record)
+		if err != nil {
+			return err
+		}
+		keys[key.kid] = key
+		if key.retiredAt == nil {
+			active = key
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.active = active
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// sign 使用当前签名密钥签名，并在 header 中写入 kid
+func (k *KeyRing) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+	if active == nil {
+		return "", fmt.Errorf("没有可用的签名密钥")
+	}
+
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.kid
+	return token.SignedString(active.private)
+}
+
+// keyFunc 根据 kid 查找验证公钥，并校验算法与密钥一致，防止算法替换攻击
+func (k *KeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token缺少kid")
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	stale := time.Since(k.loadedAt) > reloadInterval
+	k.mu.RUnlock()
+	if !ok && stale {
+		// 可能是其他实例刚轮换出的密钥
+		if err := k.load(); err != nil {
+			return nil, err
+		}
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("未知的kid: %s", kid)
+	}
+
+	if token.Method.Alg() != key.algorithm {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.private.Public(), nil
+}
+
+// JWK 单个公钥，字段含义见 RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS 返回所有可用于验证的公钥
+func (k *KeyRing) JWKS() []JWK {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.algorithm}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+func generateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", algorithm)
+	}
+}
+
+func parseKey(record models.JWTKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(record.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("签名密钥 %s 格式错误", record.KID)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析签名密钥 %s 失败: %v", record.KID, err)
+	}
+
+	key := &signingKey{
+		kid:       record.KID,
+		algorithm: record.Algorithm,
+		createdAt: record.CreatedAt,
+		retiredAt: record.RetiredAt,
+	}
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		key.private, key.method = p, jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		key.private, key.method = p, jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("签名密钥 %s 类型不支持", record.KID)
+	}
+	if key.method.Alg() != record.Algorithm {
+		return nil, fmt.Errorf("签名密钥 %s 的算法与密钥类型不一致", record.KID)
+	}
+	return key, nil
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+var (
+	// ErrMFANotEnabled 用户没有开启（或尚未开始设置）两步验证
+	ErrMFANotEnabled = errors.New("未开启两步验证")
+	// ErrMFAAlreadyEnabled 用户已经开启了两步验证
+	ErrMFAAlreadyEnabled = errors.New("已开启两步验证")
+	// ErrInvalidMFACode 动态码或恢复码错误、已使用
+	ErrInvalidMFACode = errors.New("动态码或恢复码错误")
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// MFA TOTP 两步验证和恢复码
+type MFA struct {
+	db     *gorm.DB
+	issuer string
+}
+
+func NewMFA(db *gorm.DB, issuer string) *MFA {
+	return &MFA{db: db, issuer: issuer}
+}
+
+// Enabled 返回用户是否已开启两步验证
+func (m *MFA) Enabled(userID uint64) (bool, error) {
+	var count int64
+	err := m.db.Model(&models.UserTOTP{}).Where("user_id = ? AND confirmed_at IS NOT NULL", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// RemainingRecoveryCodes 返回未使用的恢复码数量
+func (m *MFA) RemainingRecoveryCodes(userID uint64) (int64, error) {
+	var count int64
+	err := m.db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// Enroll 为用户生成新的 TOTP 密钥，返回密钥和供 App 扫码的 otpauth:// 地址
+// 重复调用会替换尚未确认的密钥
+func (m *MFA) Enroll(user *models.User) (string, string, error) {
+	enabled, err := m.Enabled(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	record := models.UserTOTP{UserID: user.ID, Secret: secret}
+	if err := m.db.Save(&record).Error; err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(m.issuer, user.Username, secret), nil
+}
+
+// Confirm 使用 App 生成的动态码确认密钥，开启两步验证并返回恢复码
+func (m *MFA) Confirm(userID uint64, code string) ([]string, error) {
+	var record models.UserTOTP
+	if err := m.db.Where("user_id = ?", userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, err
+	}
+	if record.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, ok := validateTOTP(record.Secret, code, time.Now(), record.LastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	var codes []string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.UserTOTP{}).Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMFAAlreadyEnabled
+		}
+
+		var err error
+		codes, err = m.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify 校验动态码或恢复码，两者都只能使用一次
+func (m *MFA) Verify(userID uint64, code string) error {
+	var record models.UserTOTP
+	if err := m.db.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := validateTOTP(record.Secret, code, time.Now(), record.LastStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		// 带条件更新，同一个动态码并发提交时只有一个请求成功
+		result := m.db.Model(&models.UserTOTP{}).Where("user_id = ? AND last_step < ?", userID, step).
+			Update("last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	result := m.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes 作废原有的恢复码并生成新的一组
+func (m *MFA) RegenerateRecoveryCodes(userID uint64) ([]string, error) {
+	enabled, err := m.Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	var codes []string
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = m.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable 关闭两步验证，删除密钥和恢复码
+func (m *MFA) Disable(userID uint64) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error
+	})
+}
+
+func (m *MFA) replaceRecoveryCodes(tx *gorm.DB, userID uint64) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		// 10 个 base32 字符，分两段显示便于抄写
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		records = append(records, models.MFARecoveryCode{UserID: userID, CodeHash: hashToken(raw)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode 忽略大小写、空格和分隔符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在、已过期或已吊销
+	ErrInvalidRefreshToken = errors.New("无效的refresh token")
+	// ErrRefreshTokenReused 已轮换过的刷新令牌被再次使用，整个 family 已被吊销
+	ErrRefreshTokenReused = errors.New("refresh token被重复使用")
+)
+
+// RefreshTokens 刷新令牌存储
+// 客户端拿到的是随机生成的不透明字符串，数据库中只保存其摘要
+type RefreshTokens struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewRefreshTokens(db *gorm.DB, ttl time.Duration) *RefreshTokens {
+	return &RefreshTokens{db: db, ttl: ttl}
+}
+
+// Issue 登录时为用户签发刷新令牌，familyID 为本次登录的会话ID
+func (s *RefreshTokens) Issue(userID uint64, familyID string) (string, *models.RefreshToken, error) {
+	return s.create(s.db, userID, familyID)
+}
+
+// Rotate 使用刷新令牌换取同一 family 下的新令牌，旧令牌立即失效
+// 已轮换过的令牌再次出现说明令牌可能被盗用，吊销整个 family 并返回 ErrRefreshTokenReused，
+// 此时同时返回被重复使用的令牌记录，供调用方结束对应的会话
+func (s *RefreshTokens) Rotate(raw string) (string, *models.RefreshToken, error) {
+	var newRaw string
+	var newToken *models.RefreshToken
+	var reused *models.RefreshToken
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if token.RevokedAt != nil || time.Now().After(token.ExpiredAt) {
+			return ErrInvalidRefreshToken
+		}
+		if token.UsedAt != nil {
+			reused = &token
+			return ErrRefreshTokenReused
+		}
+
+		// 带条件更新，并发的两个轮换请求只有一个能成功
+		result := tx.Model(&token).Where("used_at IS NULL").Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = &token
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		newRaw, newToken, err = s.create(tx, token.UserID, token.FamilyID)
+		return err
+	})
+
+	// 在事务外吊销，避免随事务一起回滚
+	if reused != nil {
+		if err := s.RevokeFamily(reused.FamilyID); err != nil {
+			return "", nil, err
+		}
+		return "", reused, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return newRaw, newToken, nil
+}
+
+// RevokeFamily 吊销同一次登录轮换出的所有刷新令牌
+func (s *RefreshTokens) RevokeFamily(familyID string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *RefreshTokens) create(db *gorm.DB, userID uint64, familyID string) (string, *models.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	token := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiredAt: time.Now().Add(s.ttl),
+	}
+	if err := db.Create(token).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+// ErrSessionNotFound 会话不存在、已过期或已被吊销
+var ErrSessionNotFound = errors.New("会话不存在或已失效")
+
+const (
+	// sessionCacheTTL 会话状态在本地缓存的时长
+	// 本实例吊销的会话立即生效，其他实例吊销的会话最多延迟这么久生效
+	sessionCacheTTL = 10 * time.Second
+	// touchInterval 更新最后活跃时间的最小间隔，避免每个请求都写数据库
+	touchInterval = time.Minute
+)
+
+type cachedSession struct {
+	session   models.Session
+	checkedAt time.Time
+}
+
+// Sessions 服务端会话登记表
+// 每次登录创建一个会话，access token 的 jti 和 refresh token family 都是会话ID，
+// 吊销会话后该会话签发的 access token 和 refresh token 都立即失效
+type Sessions struct {
+	db  *gorm.DB
+	ttl time.Duration // 会话有效期，等于 refresh token 有效期
+
+	mu    sync.Mutex
+	cache map[string]cachedSession
+}
+
+func NewSessions(db *gorm.DB, ttl time.Duration) *Sessions {
+	return &Sessions{db: db, ttl: ttl, cache: make(map[string]cachedSession)}
+}
+
+// Create 登录时登记新会话，device 为空时根据 User-Agent 推断，method 为登录的认证方式，mfa 表示本次登录是否通过了两步验证
+func (s *Sessions) Create(userID uint64, device, ip, userAgent, method string, mfa bool) (*models.Session, error) {
+	if device == "" {
+		device = deviceFromUserAgent(userAgent)
+	}
+	now := time.Now()
+	session := &models.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Device:     truncate(device, 100),
+		IP:         truncate(ip, 45),
+		UserAgent:  truncate(userAgent, 255),
+		LastSeenAt: now,
+		ExpiredAt:  now.Add(s.ttl),
+		AuthMethod: method,
+	}
+	if mfa {
+		session.MFAVerifiedAt = &now
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Check 校验会话仍然有效，并按间隔记录最后活跃时间和 IP；ctx 为请求的 context，用于关联日志和链路
+func (s *Sessions) Check(ctx context.Context, id, ip string) (*models.Session, error) {
+	session, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(session.LastSeenAt) >= touchInterval || (ip != "" && session.IP != ip) {
+		now := time.Now()
+		updates := map[string]interface{}{"last_seen_at": now}
+		if ip != "" {
+			updates["ip"] = truncate(ip, 45)
+		}
+		if err := s.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Updates(updates).Error; err == nil {
+			session.LastSeenAt = now
+			if ip != "" {
+				session.IP = ip
+			}
+			s.store(*session)
+		}
+	}
+	return session, nil
+}
+
+// Extend 刷新 token 后延长会话有效期
+func (s *Sessions) Extend(id string, expiredAt time.Time) error {
+	s.forget(id)
+	return s.db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"expired_at": expiredAt, "last_seen_at": time.Now()}).Error
+}
+
+// MarkMFA 记录会话已通过两步验证，用于在当前会话中开启两步验证
+func (s *Sessions) MarkMFA(id string) error {
+	s.forget(id)
+	return s.db.Model(&models.Session{}).Where("id = ? AND mfa_verified_at IS NULL", id).
+		Update("mfa_verified_at", time.Now()).Error
+}
+
+// List 返回用户所有有效的会话，最近活跃的在前
+func (s *Sessions) List(userID uint64) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expired_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke 吊销用户的某个会话
+func (s *Sessions) Revoke(userID uint64, id string) error {
+	revoked, err := s.revoke("user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll 吊销用户的所有会话，用于"退出所有设备"、修改密码和注销账号
+func (s *Sessions) RevokeAll(userID uint64) (int64, error) {
+	return s.revoke("user_id = ?", userID)
+}
+
+// RevokeOthers 吊销用户除 keepID 以外的所有会话，用于修改密码后让其他设备重新登录
+func (s *Sessions) RevokeOthers(userID uint64, keepID string) (int64, error) {
+	return s.revoke("user_id = ? AND id <> ?", userID, keepID)
+}
+
+// revoke 在同一事务中吊销会话及其 refresh token
+func (s *Sessions) revoke(query string, args ...interface{}) (int64, error) {
+	var ids []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where(query, args...).Where("revoked_at IS NULL").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).Where("family_id IN ? AND revoked_at IS NULL", ids).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		s.forget(id)
+	}
+	return int64(len(ids)), nil
+}
+
+func (s *Sessions) get(ctx context.Context, id string) (*models.Session, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[id]
+	s.mu.Unlock()
+
+	if !ok || time.Since(cached.checkedAt) > sessionCacheTTL {
+		var session models.Session
+		if err := s.db.WithContext(ctx).Where("id = ?", id).First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrSessionNotFound
+			}
+			return nil, err
+		}
+		cached = s.store(session)
+	}
+
+	session := cached.session
+	if session.RevokedAt != nil || time.Now().After(session.ExpiredAt) {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (s *Sessions) store(session models.Session) cachedSession {
+	cached := cachedSession{session: session, checkedAt: time.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 清理过期的缓存，防止缓存无限增长
+	if len(s.cache) > 10000 {
+		for id, c := range s.cache {
+			if time.Since(c.checkedAt) > sessionCacheTTL {
+				delete(s.cache, id)
+			}
+		}
+	}
+	s.cache[session.ID] = cached
+	return cached
+}
+
+func (s *Sessions) forget(id string) {
+	s.mu.Lock()
+	delete(s.cache, id)
+	s.mu.Unlock()
+}
+
+// deviceFromUserAgent 从 User-Agent 中粗略识别设备类型
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "micromessenger"):
+		return "微信"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return "iOS"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "mac os"):
+		return "macOS"
+	case strings.Contains(ua, "linux"):
+		return "Linux"
+	default:
+		return "未知设备"
+	}
+}
+
+// truncate 按字节截断字符串，不会截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Issuer access token 的签发方
+const Issuer = "qaqmall"
+
+// ErrInvalidToken access token 无效或已过期
+var ErrInvalidToken = errors.New("无效的token")
+
+// 认证方式（RFC 8176 amr）
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRWechat   = "wechat" // 微信登录，RFC 8176 没有对应的取值
+)
+
+// Claims access token 中携带的用户信息，jti（StandardClaims.Id）为会话ID
+type Claims struct {
+	UserID   uint64   `json:"user_id"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	AMR      []string `json:"amr,omitempty"` // 本次登录使用的认证方式
+	jwt.StandardClaims
+}
+
+// MFA 返回签发 token 的登录是否通过了两步验证
+func (c *Claims) MFA() bool {
+	for _, method := range c.AMR {
+		if method == AMROTP {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTokens 签发和验证 access token，所有解析 token 的地方都应通过 Verify
+type AccessTokens struct {
+	keys   *KeyRing
+	expire time.Duration
+}
+
+func NewAccessTokens(keys *KeyRing, expire time.Duration) *AccessTokens {
+	return &AccessTokens{keys: keys, expire: expire}
+}
+
+// Issue 使用当前签名密钥签发 access token，method 为登录时使用的认证方式，mfa 表示会话是否通过了两步验证
+func (t *AccessTokens) Issue(userID uint64, username, role, sessionID, method string, mfa bool) (string, error) {
+	amr := []string{method}
+	if mfa {
+		amr = append(amr, AMROTP)
+	}
+	now := time.Now()
+	return t.keys.sign(&Claims{
+		UserID:   userID,
+		Username: username,
+		Role:     role,
+		AMR:      amr,
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
+			Issuer:    Issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(t.expire).Unix(),
+		},
+	})
+}
+
+// Verify 校验签名、有效期和签发方，返回 token 中的用户信息
+func (t *AccessTokens) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, t.keys.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != Issuer || claims.ExpiresAt == 0 || claims.Id == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/casbin/casbin/v2"
+	"gorm.io/gorm"
+)
+
+// Database 检查数据库能否连接
+func Database(db *gorm.DB) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		if err := sqlDB.PingContext(ctx); err != nil {
+			return nil, fmt.Errorf("连接数据库失败: %w", err)
+		}
+		return nil, nil
+	}
+}
+
+// DatabasePool 检查连接池是否饱和：使用中的连接数达到最大连接数的 saturation 比例时失败
+// 没有限制最大连接数时只输出统计信息
+func DatabasePool(db *gorm.DB, saturation float64) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		stats := sqlDB.Stats()
+		details := map[string]interface{}{
+			"open":          stats.OpenConnections,
+			"in_use":        stats.InUse,
+			"idle":          stats.Idle,
+			"max_open":      stats.MaxOpenConnections,
+			"wait_count":    stats.WaitCount,
+			"wait_duration": stats.WaitDuration.String(),
+		}
+		if stats.MaxOpenConnections > 0 && float64(stats.InUse) >= saturation*float64(stats.MaxOpenConnections) {
+			return details, fmt.Errorf("连接池已饱和: 使用中 %d / 最大 %d", stats.InUse, stats.MaxOpenConnections)
+		}
+		return details, nil
+	}
+}
+
+// Casbin 检查权限策略已加载，且管理员仍然可以访问管理接口
+func Casbin(enforcer *casbin.SyncedEnforcer) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		policies, err := enforcer.GetPolicy()
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]interface{}{"policies": len(policies)}
+		if len(policies) == 0 {
+			return details, errors.New("没有加载任何权限策略")
+		}
+		ok, err := enforcer.Enforce("admin", "/admin/", http.MethodGet)
+		if err != nil {
+			return details, fmt.Errorf("权限检查失败: %w", err)
+		}
+		if !ok {
+			return details, errors.New("管理员没有访问管理接口的权限")
+		}
+		return details, nil
+	}
+}
+
+// Reachable 检查外部 HTTP 服务是否可达，收到任何响应（包括 4xx、5xx）都视为可达
+func Reachable(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return map[string]interface{}{"status_code": resp.StatusCode}, nil
+	}
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 组件和整体的状态
+const (
+	StatusUp          = "up"
+	StatusDown        = "down"
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"    // 只有可选组件失败，仍然就绪
+	StatusUnavailable = "unavailable" // 关键组件失败或正在关闭，未就绪
+)
+
+// CheckFunc 检查一个组件，返回的 details 原样输出到报告中
+type CheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Checker 汇总各组件的检查结果，供 /readyz 使用
+// 关键组件失败时未就绪；可选组件（支付网关、LLM）失败只降级展示，不影响就绪状态
+type Checker struct {
+	timeout      time.Duration
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register 注册关键组件的检查
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.add(check{name: name, critical: true, fn: fn})
+}
+
+// RegisterOptional 注册可选组件的检查
+func (c *Checker) RegisterOptional(name string, fn CheckFunc) {
+	c.add(check{name: name, fn: fn})
+}
+
+func (c *Checker) add(ch check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, ch)
+}
+
+// SetShuttingDown 开始优雅关闭时调用，之后的检查都返回未就绪
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Component 一个组件的检查结果
+type Component struct {
+	Status    string                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	LatencyMs int64                  `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report 就绪检查报告
+type Report struct {
+	Status       string               `json:"status"`
+	Ready        bool                 `json:"ready"`
+	ShuttingDown bool                 `json:"shutting_down,omitempty"`
+	Components   map[string]Component `json:"components"`
+}
+
+// Check 并发执行所有检查，每项检查受 timeout 限制
+// 正在关闭时不再执行检查，直接返回未就绪，避免访问已关闭的连接池
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusUnavailable, ShuttingDown: true, Components: map[string]Component{}}
+	}
+
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	results := make([]Component, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Ready: true, Components: make(map[string]Component, len(checks))}
+	for i, ch := range checks {
+		result := results[i]
+		report.Components[ch.name] = result
+		if result.Status == StatusUp {
+			continue
+		}
+		if ch.critical {
+			report.Status, report.Ready = StatusUnavailable, false
+		} else if report.Ready {
+			report.Status = StatusDegraded
+		}
+	}
+	// 检查过程中开始关闭时同样返回未就绪
+	if c.shuttingDown.Load() {
+		report.Status, report.Ready, report.ShuttingDown = StatusUnavailable, false, true
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, ch check) Component {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := ch.fn(ctx)
+	result := Component{
+		Status:    StatusUp,
+		Critical:  ch.critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,224 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/logging"
+	"qaqmall/internal/metrics"
+	"qaqmall/internal/tracing"
+)
+
+// Manager 负责 HTTP 服务、后台任务和数据库连接池的启动与优雅关闭
+type Manager struct {
+	server          *http.Server
+	db              *gorm.DB
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
+
+	mu         sync.Mutex
+	onShutdown []func()
+	heartbeats map[string]*heartbeat
+}
+
+// heartbeat 定时任务的执行间隔和最近一次执行结束的时间
+type heartbeat struct {
+	interval time.Duration
+	last     time.Time
+}
+
+// New 创建生命周期管理器
+// drainDelay 为开始关闭后、停止接收请求前的等待时间，期间就绪检查已经失败，便于负载均衡摘除实例
+func New(server *http.Server, db *gorm.DB, shutdownTimeout, drainDelay time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		server:          server,
+		db:              db,
+		shutdownTimeout: shutdownTimeout,
+		drainDelay:      drainDelay,
+		ctx:             ctx,
+		cancel:          cancel,
+		heartbeats:      make(map[string]*heartbeat),
+	}
+}
+
+// OnShutdown 注册开始关闭时最先调用的函数，如把就绪检查置为失败
+func (m *Manager) OnShutdown(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onShutdown = append(m.onShutdown, fn)
+}
+
+// Context 返回在关闭时被取消的上下文，后台任务应据此尽快退出
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go 启动一个受管理的后台任务，关闭时会等待其返回
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.jobs.Add(1)
+	go func() {
+		defer m.jobs.Done()
+		fn(m.ctx)
+		slog.Info("后台任务已停止", "job", name)
+	}()
+}
+
+// Every 按固定间隔执行任务，关闭时停止定时器，正在执行的任务会被等待完成
+func (m *Manager) Every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	m.heartbeats[name] = &heartbeat{interval: interval, last: time.Now()}
+	m.mu.Unlock()
+
+	m.Go(name, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+				// fn 通过 logging.FromContext(ctx) 获取带有任务名称和本次执行 request_id 的 logger
+				logger := logging.WithElapsed(slog.Default(), start).With("job", name, "request_id", logging.NewRequestID())
+				// 每次执行作为一个 span，其中的 SQL 是它的子 span
+				jobCtx, span := tracing.Tracer().Start(logging.WithContext(ctx, logger), "job "+name)
+				err := fn(jobCtx)
+				if err != nil {
+					logger.Error("定时任务执行失败", "error", err)
+				}
+				tracing.End(span, err)
+				// 记录耗时和最近一次成功的时间
+				metrics.ObserveJob(name, start, err)
+				// 无论成败都更新心跳，供 CheckJobs 发现停止调度或卡住的任务
+				m.beat(name)
+			}
+		}
+	})
+}
+
+func (m *Manager) beat(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heartbeats[name].last = time.Now()
+}
+
+// staleIntervals 定时任务超过这么多个执行间隔没有心跳时视为异常
+const staleIntervals = 3
+
+// CheckJobs 检查定时任务的心跳，有任务超过 3 个执行间隔没有执行结束时返回错误，可以注册为就绪检查
+func (m *Manager) CheckJobs(ctx context.Context) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	details := make(map[string]interface{}, len(m.heartbeats))
+	var stale []string
+	for name, hb := range m.heartbeats {
+		details[name] = hb.last.Format(time.RFC3339)
+		if time.Since(hb.last) > staleIntervals*hb.interval {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return details, fmt.Errorf("定时任务长时间没有执行: %s", strings.Join(stale, ", "))
+	}
+	return details, nil
+}
+
+// Run 启动 HTTP 服务并阻塞，直到收到 SIGINT/SIGTERM 或服务异常退出，随后执行优雅关闭
+func (m *Manager) Run() error {
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("HTTP 服务开始监听", "addr", m.server.Addr)
+		if err := m.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	var runErr error
+	select {
+	case sig := <-quit:
+		slog.Info("收到信号，开始优雅关闭", "signal", sig.String())
+	case err := <-serverErr:
+		runErr = err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		return errors.Join(runErr, err)
+	}
+	return runErr
+}
+
+// Shutdown 依次调用 OnShutdown 注册的函数并等待 drainDelay、停止接收新请求并等待处理中的请求、停止后台任务、关闭数据库连接池
+func (m *Manager) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	m.mu.Lock()
+	hooks := m.onShutdown
+	m.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+	if m.drainDelay > 0 {
+		slog.Info("等待负载均衡摘除实例", "drain_delay", m.drainDelay.String())
+		select {
+		case <-time.After(m.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	// 等待处理中的请求完成
+	if err := m.server.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// 通知后台任务退出并等待
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("等待后台任务退出超时"))
+	}
+
+	// 关闭数据库连接池
+	if m.db != nil {
+		if sqlDB, err := m.db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	slog.Info("服务已关闭")
+	return errors.Join(errs...)
+}
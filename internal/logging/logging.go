@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"qaqmall/config"
+)
+
+// contextKey 在 context 中保存 logger 的 key
+type contextKey struct{}
+
+// New 按配置创建输出到 w 的 logger，敏感字段在输出前脱敏
+func New(cfg config.LogConfig, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("日志级别不合法: %v", err)
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	switch cfg.Format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("不支持的日志格式: %s", cfg.Format)
+	}
+}
+
+// NewRequestID 生成请求ID，后台任务每次执行也使用它标识
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// WithContext 返回携带 logger 的 context
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext 返回 context 中的 logger，没有时返回默认 logger
+// 传入 *gin.Context 时从请求的 context 中获取
+func FromContext(ctx context.Context) *slog.Logger {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return slog.Default()
+		}
+		ctx = c.Request.Context()
+	}
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With 为当前请求的 logger 追加字段，之后的中间件和 handler 输出的日志都会带上
+func With(c *gin.Context, args ...any) {
+	logger := FromContext(c).With(args...)
+	c.Request = c.Request.WithContext(WithContext(c.Request.Context(), logger))
+}
+
+// WithElapsed 返回的 logger 输出的每一行都带有从 start 开始经过的毫秒数 latency_ms
+func WithElapsed(logger *slog.Logger, start time.Time) *slog.Logger {
+	return slog.New(&elapsedHandler{Handler: logger.Handler(), start: start})
+}
+
+type elapsedHandler struct {
+	slog.Handler
+	start time.Time
+}
+
+func (h *elapsedHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.Float64("latency_ms", float64(r.Time.Sub(h.start).Microseconds())/1000))
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *elapsedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &elapsedHandler{Handler: h.Handler.WithAttrs(attrs), start: h.start}
+}
+
+func (h *elapsedHandler) WithGroup(name string) slog.Handler {
+	return &elapsedHandler{Handler: h.Handler.WithGroup(name), start: h.start}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted 敏感字段脱敏后输出的内容
+const redacted = "[REDACTED]"
+
+// sensitiveKeys 字段名包含这些词时整个值脱敏
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "api_key", "private_key", "recovery_code"}
+
+// codeKeys 验证码类字段，只按完整字段名匹配，return_code 等状态码不受影响
+var codeKeys = map[string]bool{"code": true, "verify_code": true, "reset_code": true, "mfa_code": true}
+
+var (
+	// phonePattern 中国大陆手机号，保留前三位和后四位
+	phonePattern = regexp.MustCompile(`(^|\D)(1[3-9]\d)\d{4}(\d{4})($|\D)`)
+	// jwtPattern 混在错误信息等字符串中的 JWT
+	jwtPattern = regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]+`)
+)
+
+// redact 作为 slog.HandlerOptions.ReplaceAttr 使用，对敏感字段脱敏
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+		return a
+	}
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, maskString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, maskString(err.Error()))
+		}
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	// 邮箱验证码、两步验证动态码、微信登录 code 等
+	if codeKeys[key] {
+		return true
+	}
+	for _, word := range sensitiveKeys {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskString 遮盖字符串中的手机号和 JWT
+func maskString(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	// 相邻的手机号共用分隔字符，替换一次可能遗漏，替换到不再变化为止
+	for {
+		masked := phonePattern.ReplaceAllString(s, "${1}${2}****${3}${4}")
+		if masked == s {
+			return s
+		}
+		s = masked
+	}
+}
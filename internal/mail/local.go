@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"qaqmall/internal/logging"
+)
+
+// FileMailer 把邮件写入目录下的 .eml 文件，供本地开发和测试查看
+type FileMailer struct {
+	dir  string
+	from *mail.Address
+	seq  atomic.Uint64
+}
+
+func NewFileMailer(dir string, from *mail.Address) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建邮件目录失败: %v", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.build(m.from)
+	if err != nil {
+		return err
+	}
+	// 文件名按时间和序号排序，同一秒内发送的邮件不会互相覆盖
+	name := fmt.Sprintf("%s-%06d.eml", time.Now().Format("20060102150405"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// LogMailer 把邮件内容打印到日志，不真正发送
+type LogMailer struct {
+	from *mail.Address
+}
+
+func NewLogMailer(from *mail.Address) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("收件人地址不合法: %v", err)
+	}
+	logging.FromContext(ctx).Info("发送邮件", "from", m.from.Address, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"qaqmall/internal/logging"
+)
+
+// SendTimeout 发送一封邮件的最长时间
+const SendTimeout = 10 * time.Second
+
+// outboxSize 发送队列最多缓存的邮件数
+const outboxSize = 100
+
+// ErrOutboxFull 发送队列已满，邮件没有放入队列
+var ErrOutboxFull = errors.New("邮件发送队列已满")
+
+// Outbox 异步发送邮件的队列，由一个后台任务依次发送，调用方不用等待邮件服务器响应，
+// 响应时间不会因为是否发送了邮件而不同
+type Outbox struct {
+	mailer Mailer
+	queue  chan outgoing
+}
+
+// outgoing 队列中的一封邮件，ctx 为入队时的上下文，只用于记录日志和链路
+type outgoing struct {
+	ctx context.Context
+	msg Message
+}
+
+func NewOutbox(mailer Mailer) *Outbox {
+	return &Outbox{mailer: mailer, queue: make(chan outgoing, outboxSize)}
+}
+
+// Enqueue 把邮件放入发送队列，发送失败时记录到 ctx 中的 logger；请求结束不影响发送
+func (o *Outbox) Enqueue(ctx context.Context, msg Message) error {
+	select {
+	case o.queue <- outgoing{ctx: context.WithoutCancel(ctx), msg: msg}:
+		return nil
+	default:
+		return ErrOutboxFull
+	}
+}
+
+// Run 依次发送队列中的邮件，阻塞到 ctx 取消，返回前把已入队的邮件发送完；
+// 应作为受管理的后台任务运行
+func (o *Outbox) Run(ctx context.Context) {
+	for {
+		select {
+		case out := <-o.queue:
+			o.send(out)
+		case <-ctx.Done():
+			for {
+				select {
+				case out := <-o.queue:
+					o.send(out)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (o *Outbox) send(out outgoing) {
+	ctx, cancel := context.WithTimeout(out.ctx, SendTimeout)
+	defer cancel()
+	if err := o.mailer.Send(ctx, out.msg); err != nil {
+		logging.FromContext(ctx).Error("发送邮件失败", "subject", out.msg.Subject, "error", err)
+	}
+}
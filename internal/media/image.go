@@ -0,0 +1,124 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// maxPixels 允许处理的图片最大像素数，避免尺寸很大但压缩后很小的图片在生成缩略图时占满内存
+const maxPixels = 40_000_000
+
+var (
+	// ErrUnsupportedImage 文件不是支持的图片格式，或者无法解码
+	ErrUnsupportedImage = errors.New("只支持 JPEG、PNG、GIF 格式的图片")
+	// ErrImageTooLarge 图片的像素数超过限制
+	ErrImageTooLarge = errors.New("图片尺寸过大")
+)
+
+// imageTypes 支持的图片类型及保存时使用的扩展名，按文件内容识别，不信任文件名和请求中的 Content-Type
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Image 识别后的图片
+type Image struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Inspect 按文件内容识别图片的类型和尺寸
+func Inspect(data []byte) (*Image, error) {
+	contentType := mimetype.Detect(data).String()
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	return &Image{ContentType: contentType, Ext: ext, Width: config.Width, Height: config.Height}, nil
+}
+
+// Thumbnail 把图片等比缩小到宽高都不超过 size，返回缩略图的内容、类型和扩展名
+// 按区域平均缩小，PNG 保留透明通道输出为 PNG，其他格式（GIF 只取第一帧，透明部分填充白色）输出为 JPEG；
+// 图片本身不大于 size 时只转换格式
+func Thumbnail(data []byte, size int) ([]byte, string, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrUnsupportedImage
+	}
+	keepAlpha := format == "png"
+	thumb := resize(src, size, keepAlpha)
+
+	var buf bytes.Buffer
+	if keepAlpha {
+		err = png.Encode(&buf, thumb)
+		return buf.Bytes(), "image/png", ".png", err
+	}
+	err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	return buf.Bytes(), "image/jpeg", ".jpg", err
+}
+
+// resize 把图片等比缩小到宽高都不超过 size，目标像素取源图片对应区域的平均值，keepAlpha 为 false 时先铺白色背景
+// 源图片逐行转换为 RGBA 后累加到目标像素，只需要一行的缓冲区，不复制整张源图片
+func resize(src image.Image, size int, keepAlpha bool) *image.RGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := sw, sh
+	if sw > size || sh > size {
+		if sw >= sh {
+			dw, dh = size, max(1, sh*size/sw)
+		} else {
+			dw, dh = max(1, sw*size/sh), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	row := image.NewRGBA(image.Rect(0, 0, sw, 1))
+	sums := make([]uint64, dw*4)
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		clear(sums)
+		for sy := y0; sy < y1; sy++ {
+			at := image.Pt(bounds.Min.X, bounds.Min.Y+sy)
+			if keepAlpha {
+				draw.Draw(row, row.Bounds(), src, at, draw.Src)
+			} else {
+				draw.Draw(row, row.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+				draw.Draw(row, row.Bounds(), src, at, draw.Over)
+			}
+			for x := 0; x < dw; x++ {
+				x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+				sum := sums[x*4 : x*4+4]
+				for sx := x0; sx < x1; sx++ {
+					p := row.Pix[sx*4 : sx*4+4]
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+uint64(p[0]), sum[1]+uint64(p[1]), sum[2]+uint64(p[2]), sum[3]+uint64(p[3])
+				}
+			}
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			n := uint64((x1 - x0) * (y1 - y0))
+			sum := sums[x*4 : x*4+4]
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(sum[0]/n), uint8(sum[1]/n), uint8(sum[2]/n), uint8(sum[3]/n)
+		}
+	}
+	return dst
+}
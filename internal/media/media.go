@@ -0,0 +1,70 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"qaqmall/config"
+)
+
+// ErrInvalidKey 对象的 key 不合法
+var ErrInvalidKey = errors.New("对象 key 不合法")
+
+// keyPattern key 只能包含小写字母、数字和 . _ - /，不能以 / 开头，
+// 这样写入本地文件和作为 S3 路径时都不需要转义，也不会越出存储目录
+var keyPattern = regexp.MustCompile(`^[a-z0-9_-][a-z0-9._/-]*$`)
+
+// Storage 图片等媒体文件的存储
+type Storage interface {
+	// Put 保存对象并返回访问地址，key 已存在时覆盖
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// New 按配置创建存储，client 为 s3 驱动发送请求使用的 HTTP 客户端
+func New(cfg config.MediaConfig, client *http.Client) (Storage, error) {
+	switch cfg.Driver {
+	case "local":
+		return NewLocal(cfg.Dir, cfg.BaseURL)
+	case "s3":
+		return NewS3(cfg, client)
+	default:
+		return nil, fmt.Errorf("不支持的存储驱动: %s", cfg.Driver)
+	}
+}
+
+// NewKey 生成 prefix 下随机的对象 key，不含扩展名
+func NewKey(prefix string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return prefix + "/" + hex.EncodeToString(buf), nil
+}
+
+func validKey(key string) error {
+	if !keyPattern.MatchString(key) || containsDotSegment(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// containsDotSegment 判断 key 中是否有 . 或 .. 路径段
+func containsDotSegment(key string) bool {
+	start := 0
+	for i := 0; i <= len(key); i++ {
+		if i == len(key) || key[i] == '/' {
+			if segment := key[start:i]; segment == "." || segment == ".." || segment == "" {
+				return true
+			}
+			start = i + 1
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"qaqmall/models"
+)
+
+// namespace 所有指标名称的前缀
+const namespace = "qaqmall"
+
+var (
+	// HTTPRequests HTTP 请求数，route 为路由模板，未匹配的路由记为 unmatched，避免指标数量随路径无限增长
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration HTTP 请求耗时
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时（秒）",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// DBQueryDuration 数据库操作耗时，由 GORM 回调记录，operation 为 create、query、update、delete、row 或 raw
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "数据库操作耗时（秒）",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table", "status"})
+
+	// OrdersCreated 创建的订单数
+	OrdersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_created_total",
+		Help:      "创建的订单数",
+	})
+
+	// OrdersCancelled 用户取消的订单数
+	OrdersCancelled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_cancelled_total",
+		Help:      "用户取消的订单数",
+	})
+
+	// OrdersExpired 超时未支付被定时任务取消的订单数
+	OrdersExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_expired_total",
+		Help:      "超时未支付被自动取消的订单数",
+	})
+
+	// Payments 支付记录状态变化次数，status 为变化后的状态，通过 RecordPayments 记录
+	Payments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_total",
+		Help:      "支付记录按支付方式和状态统计的变化次数",
+	}, []string{"method", "status"})
+
+	// AIQueryDuration 调用 LLM 的耗时，包括失败的调用
+	AIQueryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ai_query_duration_seconds",
+		Help:      "调用 LLM 的耗时（秒）",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+	})
+
+	// AIQueryFailures 调用 LLM 失败的次数，reason 为 request、status、decode 或 empty
+	AIQueryFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_query_failures_total",
+		Help:      "调用 LLM 失败的次数",
+	}, []string{"reason"})
+
+	// JobDuration 定时任务每次执行的耗时
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "定时任务执行耗时（秒）",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"job", "status"})
+
+	// JobLastSuccess 定时任务最近一次执行成功的时间
+	JobLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_last_success_timestamp_seconds",
+		Help:      "定时任务最近一次执行成功的 Unix 时间戳",
+	}, []string{"job"})
+)
+
+// ObserveJob 记录定时任务的一次执行，err 为 nil 时更新最近成功时间
+func ObserveJob(job string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	} else {
+		JobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+	JobDuration.WithLabelValues(job, status).Observe(time.Since(start).Seconds())
+}
+
+// RecordPayments 记录 count 条支付记录变为 status 状态，不支持的支付方式记为 other
+func RecordPayments(method models.PaymentMethod, status models.PaymentStatus, count int64) {
+	label := string(method)
+	if method != models.PaymentMethodAlipay && method != models.PaymentMethodWechat {
+		label = "other"
+	}
+	Payments.WithLabelValues(label, string(status)).Add(float64(count))
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Check 对比数据库中的实际表结构与模型定义，返回发现的差异
+// 只检查模型需要的表、字段和字符串长度，数据库中多出的字段不视为差异
+func Check(db *gorm.DB, models ...interface{}) ([]string, error) {
+	var problems []string
+	migrator := db.Migrator()
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("解析模型 %T 失败: %v", model, err)
+		}
+		table := stmt.Schema.Table
+
+		if !migrator.HasTable(table) {
+			problems = append(problems, fmt.Sprintf("缺少表 %s（模型 %s）", table, stmt.Schema.Name))
+			continue
+		}
+
+		columnTypes, err := migrator.ColumnTypes(table)
+		if err != nil {
+			return nil, fmt.Errorf("读取表 %s 的字段失败: %v", table, err)
+		}
+		columns := make(map[string]gorm.ColumnType, len(columnTypes))
+		for _, ct := range columnTypes {
+			columns[ct.Name()] = ct
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+
+			column, ok := columns[field.DBName]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("表 %s 缺少字段 %s", table, field.DBName))
+				continue
+			}
+
+			if field.DataType == schema.String && field.Size > 0 {
+				if length, ok := column.Length(); ok && length > 0 && length < int64(field.Size) {
+					problems = append(problems, fmt.Sprintf("表 %s 字段 %s 长度为 %d，模型要求 %d", table, field.DBName, length, field.Size))
+				}
+			}
+		}
+
+		// 多对多关联的中间表
+		for _, rel := range stmt.Schema.Relationships.Many2Many {
+			if rel.JoinTable != nil && !migrator.HasTable(rel.JoinTable.Table) {
+				problems = append(problems, fmt.Sprintf("缺少多对多中间表 %s（模型 %s.%s）", rel.JoinTable.Table, stmt.Schema.Name, rel.Name))
+			}
+		}
+	}
+
+	return problems, nil
+}
@@ -1,11 +1,4 @@
--- 创建数据库
-DROP DATABASE IF EXISTS qaqmall;
-CREATE DATABASE qaqmall CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
-
--- 使用数据库
-USE qaqmall;
-
--- 创建用户表
+-- 用户表
 CREATE TABLE IF NOT EXISTS users (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(20) NOT NULL UNIQUE,
@@ -16,13 +9,12 @@ CREATE TABLE IF NOT EXISTS users (
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
-    INDEX idx_users_username (username),
     INDEX idx_users_email (email),
     INDEX idx_users_phone (phone),
     INDEX idx_users_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建token黑名单表
+-- token黑名单表
 CREATE TABLE IF NOT EXISTS token_blacklist (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     token VARCHAR(500) NOT NULL UNIQUE,
@@ -30,63 +22,70 @@ CREATE TABLE IF NOT EXISTS token_blacklist (
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
-    INDEX idx_token_blacklist_token (token),
     INDEX idx_token_blacklist_expired_at (expired_at),
     INDEX idx_token_blacklist_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建商品分类表
+-- 商品分类表
 CREATE TABLE IF NOT EXISTS categories (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    name VARCHAR(50) NOT NULL,
-    description TEXT,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    description VARCHAR(200),
     parent_id BIGINT UNSIGNED,
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
     INDEX idx_categories_parent_id (parent_id),
     INDEX idx_categories_deleted_at (deleted_at),
-    FOREIGN KEY (parent_id) REFERENCES categories(id)
+    CONSTRAINT fk_categories_parent_id FOREIGN KEY (parent_id) REFERENCES categories(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建商品表
+-- 商品表
 CREATE TABLE IF NOT EXISTS products (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-    name VARCHAR(100) NOT NULL,
+    name VARCHAR(255) NOT NULL,
     description TEXT,
     price DECIMAL(10,2) NOT NULL,
     stock INT NOT NULL DEFAULT 0,
     image_url VARCHAR(255),
     is_on_sale BOOLEAN NOT NULL DEFAULT TRUE,
-    category_id BIGINT UNSIGNED,
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
-    INDEX idx_products_category (category_id),
-    INDEX idx_products_deleted_at (deleted_at),
-    FOREIGN KEY (category_id) REFERENCES categories(id)
+    INDEX idx_products_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建购物车表
+-- 商品分类关联表（对应 models.Product 的 many2many:product_categories）
+CREATE TABLE IF NOT EXISTS product_categories (
+    product_id BIGINT UNSIGNED NOT NULL,
+    category_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (product_id, category_id),
+    INDEX idx_product_categories_category_id (category_id),
+    CONSTRAINT fk_product_categories_product_id FOREIGN KEY (product_id) REFERENCES products(id),
+    CONSTRAINT fk_product_categories_category_id FOREIGN KEY (category_id) REFERENCES categories(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 购物车表
 CREATE TABLE IF NOT EXISTS cart_items (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT UNSIGNED NOT NULL,
     product_id BIGINT UNSIGNED NOT NULL,
     quantity INT NOT NULL DEFAULT 1,
     price DECIMAL(10,2) NOT NULL COMMENT '商品价格',
-    product_name VARCHAR(100) NOT NULL COMMENT '商品名称',
-    product_image VARCHAR(200) COMMENT '商品图片',
+    product_name VARCHAR(255) NOT NULL COMMENT '商品名称',
+    product_image VARCHAR(1024) COMMENT '商品图片',
     selected BOOLEAN NOT NULL DEFAULT TRUE,
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
-    INDEX idx_cart_items_user (user_id),
+    INDEX idx_cart_items_user_id (user_id),
+    INDEX idx_cart_items_product_id (product_id),
     INDEX idx_cart_items_deleted_at (deleted_at),
-    FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (product_id) REFERENCES products(id)
+    CONSTRAINT fk_cart_items_user_id FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_cart_items_product_id FOREIGN KEY (product_id) REFERENCES products(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建地址表
+-- 地址表
 CREATE TABLE IF NOT EXISTS addresses (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT UNSIGNED NOT NULL,
@@ -103,12 +102,12 @@ CREATE TABLE IF NOT EXISTS addresses (
     created_at DATETIME(3),
     updated_at DATETIME(3),
     deleted_at DATETIME(3),
-    INDEX idx_addresses_user (user_id),
+    INDEX idx_addresses_user_id (user_id),
     INDEX idx_addresses_deleted_at (deleted_at),
-    FOREIGN KEY (user_id) REFERENCES users(id)
+    CONSTRAINT fk_addresses_user_id FOREIGN KEY (user_id) REFERENCES users(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建系统日志表
+-- 系统日志表
 CREATE TABLE IF NOT EXISTS system_logs (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT UNSIGNED,
@@ -116,77 +115,70 @@ CREATE TABLE IF NOT EXISTS system_logs (
     description TEXT,
     ip_address VARCHAR(50),
     created_at DATETIME(3),
-    INDEX idx_system_logs_user (user_id),
+    INDEX idx_system_logs_user_id (user_id),
     INDEX idx_system_logs_action (action),
-    FOREIGN KEY (user_id) REFERENCES users(id)
+    CONSTRAINT fk_system_logs_user_id FOREIGN KEY (user_id) REFERENCES users(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
--- 创建默认管理员账号
-INSERT INTO users (username, password, role, created_at, updated_at) 
-VALUES ('admin', '$2a$10$rV4Qp0lQHsYUqhd5ABqk6OyK4Yb8/oSE.f33Pba.XNhE3X8DYlA1O', 'admin', NOW(), NOW());
-
 -- 订单表
 CREATE TABLE IF NOT EXISTS orders (
-    id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
-    order_number VARCHAR(32) UNIQUE NOT NULL COMMENT '订单号',
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    order_number VARCHAR(32) NOT NULL UNIQUE COMMENT '订单号',
     user_id BIGINT UNSIGNED NOT NULL COMMENT '用户ID',
     status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT '订单状态',
     total_amount DECIMAL(10,2) NOT NULL COMMENT '订单总金额',
     address_id BIGINT UNSIGNED NOT NULL COMMENT '收货地址ID',
     remark TEXT COMMENT '订单备注',
-    expired_at DATETIME NOT NULL COMMENT '订单过期时间',
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    deleted_at DATETIME,
-    INDEX idx_user_id (user_id),
-    INDEX idx_order_number (order_number),
-    INDEX idx_status (status),
-    INDEX idx_created_at (created_at)
+    expired_at DATETIME(3) NOT NULL COMMENT '订单过期时间',
+    created_at DATETIME(3) NOT NULL,
+    updated_at DATETIME(3) NOT NULL,
+    deleted_at DATETIME(3),
+    INDEX idx_orders_user_id (user_id),
+    INDEX idx_orders_status (status),
+    INDEX idx_orders_created_at (created_at),
+    INDEX idx_orders_deleted_at (deleted_at),
+    CONSTRAINT fk_orders_user_id FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_orders_address_id FOREIGN KEY (address_id) REFERENCES addresses(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单表';
 
 -- 订单项表
 CREATE TABLE IF NOT EXISTS order_items (
-    id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     order_id BIGINT UNSIGNED NOT NULL COMMENT '订单ID',
     product_id BIGINT UNSIGNED NOT NULL COMMENT '商品ID',
-    product_name VARCHAR(100) NOT NULL COMMENT '商品名称',
-    product_image VARCHAR(200) COMMENT '商品图片',
+    product_name VARCHAR(255) NOT NULL COMMENT '商品名称',
+    product_image VARCHAR(1024) COMMENT '商品图片',
     price DECIMAL(10,2) NOT NULL COMMENT '商品单价',
     quantity INT NOT NULL COMMENT '购买数量',
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    INDEX idx_order_id (order_id),
-    INDEX idx_product_id (product_id)
+    created_at DATETIME(3) NOT NULL,
+    updated_at DATETIME(3) NOT NULL,
+    INDEX idx_order_items_order_id (order_id),
+    INDEX idx_order_items_product_id (product_id),
+    CONSTRAINT fk_order_items_order_id FOREIGN KEY (order_id) REFERENCES orders(id),
+    CONSTRAINT fk_order_items_product_id FOREIGN KEY (product_id) REFERENCES products(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单项表';
 
--- 支付记录表
+-- 支付记录表，payment_number 存放 36 位 UUID
 CREATE TABLE IF NOT EXISTS payments (
-    id BIGINT UNSIGNED PRIMARY KEY AUTO_INCREMENT,
-    payment_number VARCHAR(32) UNIQUE NOT NULL COMMENT '支付单号',
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    payment_number VARCHAR(64) NOT NULL UNIQUE COMMENT '支付单号',
     order_id BIGINT UNSIGNED NOT NULL COMMENT '订单ID',
     user_id BIGINT UNSIGNED NOT NULL COMMENT '用户ID',
     amount DECIMAL(10,2) NOT NULL COMMENT '支付金额',
     payment_method VARCHAR(20) NOT NULL COMMENT '支付方式',
     status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT '支付状态',
-    paid_at DATETIME COMMENT '支付时间',
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    deleted_at DATETIME,
-    INDEX idx_payment_number (payment_number),
-    INDEX idx_order_id (order_id),
-    INDEX idx_user_id (user_id),
-    INDEX idx_status (status)
+    paid_at DATETIME(3) COMMENT '支付时间',
+    created_at DATETIME(3) NOT NULL,
+    updated_at DATETIME(3) NOT NULL,
+    deleted_at DATETIME(3),
+    INDEX idx_payments_order_id (order_id),
+    INDEX idx_payments_user_id (user_id),
+    INDEX idx_payments_status (status),
+    INDEX idx_payments_deleted_at (deleted_at),
+    CONSTRAINT fk_payments_order_id FOREIGN KEY (order_id) REFERENCES orders(id),
+    CONSTRAINT fk_payments_user_id FOREIGN KEY (user_id) REFERENCES users(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='支付记录表';
 
--- 添加外键约束
-ALTER TABLE orders
-    ADD CONSTRAINT fk_orders_user_id FOREIGN KEY (user_id) REFERENCES users(id),
-    ADD CONSTRAINT fk_orders_address_id FOREIGN KEY (address_id) REFERENCES addresses(id);
-
-ALTER TABLE order_items
-    ADD CONSTRAINT fk_order_items_order_id FOREIGN KEY (order_id) REFERENCES orders(id),
-    ADD CONSTRAINT fk_order_items_product_id FOREIGN KEY (product_id) REFERENCES products(id);
-
-ALTER TABLE payments
-    ADD CONSTRAINT fk_payments_order_id FOREIGN KEY (order_id) REFERENCES orders(id),
-    ADD CONSTRAINT fk_payments_user_id FOREIGN KEY (user_id) REFERENCES users(id);
\ No newline at end of file
+-- 默认管理员账号
+INSERT INTO users (username, password, role, created_at, updated_at)
+VALUES ('admin', '$2a$10$rV4Qp0lQHsYUqhd5ABqk6OyK4Yb8/oSE.f33Pba.XNhE3X8DYlA1O', 'admin', NOW(3), NOW(3));
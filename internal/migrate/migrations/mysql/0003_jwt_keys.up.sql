@@ -0,0 +1,10 @@
+-- JWT 签名密钥表
+CREATE TABLE IF NOT EXISTS jwt_keys (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    kid VARCHAR(36) NOT NULL UNIQUE,
+    algorithm VARCHAR(10) NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at DATETIME(3),
+    retired_at DATETIME(3),
+    INDEX idx_jwt_keys_retired_at (retired_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,17 @@
+-- 登录会话表，取代按 token 查询的黑名单
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(36) NOT NULL PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    device VARCHAR(100),
+    ip VARCHAR(45),
+    user_agent VARCHAR(255),
+    last_seen_at DATETIME(3) NOT NULL,
+    expired_at DATETIME(3) NOT NULL,
+    revoked_at DATETIME(3),
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    INDEX idx_sessions_user_id (user_id),
+    CONSTRAINT fk_sessions_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+DROP TABLE IF EXISTS token_blacklist;
@@ -0,0 +1,2 @@
+-- 邮箱验证时间，为空表示邮箱未验证
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME(3) NULL;
@@ -0,0 +1,11 @@
+-- 登录失败计数，用于防止暴力破解
+CREATE TABLE IF NOT EXISTS login_failures (
+    kind VARCHAR(10) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at DATETIME(3) NOT NULL,
+    locked_until DATETIME(3),
+    updated_at DATETIME(3),
+    PRIMARY KEY (kind, value),
+    INDEX idx_login_failures_locked_until (locked_until)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
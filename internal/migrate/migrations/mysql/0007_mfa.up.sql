@@ -0,0 +1,24 @@
+-- TOTP 两步验证密钥
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at DATETIME(3),
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    CONSTRAINT fk_user_totp_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 两步验证恢复码
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    used_at DATETIME(3),
+    created_at DATETIME(3),
+    INDEX idx_mfa_recovery_codes_user_id (user_id),
+    CONSTRAINT fk_mfa_recovery_codes_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 会话是否通过了两步验证
+ALTER TABLE sessions ADD COLUMN mfa_verified_at DATETIME(3) NULL;
@@ -0,0 +1 @@
+DROP INDEX idx_system_logs_created_at ON system_logs;
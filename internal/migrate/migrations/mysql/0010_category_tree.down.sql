@@ -0,0 +1,2 @@
+DROP INDEX idx_categories_parent_sort ON categories;
+ALTER TABLE categories DROP COLUMN sort_order;
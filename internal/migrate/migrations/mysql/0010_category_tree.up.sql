@@ -0,0 +1,3 @@
+-- 同级分类的排序，越小越靠前
+ALTER TABLE categories ADD COLUMN sort_order INT NOT NULL DEFAULT 0;
+CREATE INDEX idx_categories_parent_sort ON categories (parent_id, sort_order);
@@ -0,0 +1,5 @@
+DROP INDEX idx_order_items_sku_id ON order_items;
+ALTER TABLE order_items DROP COLUMN sku_id, DROP COLUMN sku_name;
+ALTER TABLE cart_items DROP COLUMN sku_id, DROP COLUMN sku_name;
+DROP TABLE IF EXISTS product_skus;
+DROP TABLE IF EXISTS product_options;
@@ -0,0 +1,42 @@
+-- 商品规格项，option_values 为 JSON 数组，如 ["红色","蓝色"]
+CREATE TABLE IF NOT EXISTS product_options (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    product_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(20) NOT NULL,
+    option_values TEXT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    INDEX idx_product_options_product_id (product_id),
+    CONSTRAINT fk_product_options_product_id FOREIGN KEY (product_id) REFERENCES products(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 商品 SKU，每个规格组合一条，spec_key 为规格组合的规范写法，如 颜色:红色;尺码:M
+-- 规格组合不再存在时只停用不删除，购物车和历史订单仍然可以引用
+CREATE TABLE IF NOT EXISTS product_skus (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    product_id BIGINT UNSIGNED NOT NULL,
+    spec_key VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL COMMENT '规格名称，如 红色 / M',
+    specs TEXT NOT NULL COMMENT '规格组合，JSON',
+    price DECIMAL(10,2) NOT NULL,
+    stock INT NOT NULL DEFAULT 0,
+    image_url VARCHAR(255),
+    barcode VARCHAR(64),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    position INT NOT NULL DEFAULT 0,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    UNIQUE INDEX idx_product_skus_product_spec (product_id, spec_key),
+    INDEX idx_product_skus_barcode (barcode),
+    CONSTRAINT fk_product_skus_product_id FOREIGN KEY (product_id) REFERENCES products(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 购物车项和订单项引用的 SKU，商品没有规格时为 NULL
+ALTER TABLE cart_items
+    ADD COLUMN sku_id BIGINT UNSIGNED NULL,
+    ADD COLUMN sku_name VARCHAR(255) NULL COMMENT '规格名称';
+ALTER TABLE order_items
+    ADD COLUMN sku_id BIGINT UNSIGNED NULL COMMENT 'SKU ID',
+    ADD COLUMN sku_name VARCHAR(255) NULL COMMENT '规格名称';
+CREATE INDEX idx_order_items_sku_id ON order_items (sku_id);
@@ -0,0 +1,2 @@
+DROP INDEX idx_products_view_count ON products;
+ALTER TABLE products DROP COLUMN view_count;
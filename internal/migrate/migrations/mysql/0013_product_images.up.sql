@@ -0,0 +1,18 @@
+-- 商品图片，按 position 排序，排在第一位的图片同时写入 products.image_url 作为主图
+CREATE TABLE IF NOT EXISTS product_images (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    product_id BIGINT UNSIGNED NOT NULL,
+    url VARCHAR(255) NOT NULL,
+    thumbnail_url VARCHAR(255) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL COMMENT '原图在存储中的 key',
+    thumbnail_key VARCHAR(255) NOT NULL COMMENT '缩略图在存储中的 key',
+    content_type VARCHAR(50) NOT NULL,
+    size BIGINT NOT NULL COMMENT '原图字节数',
+    width INT NOT NULL,
+    height INT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    INDEX idx_product_images_product_position (product_id, position),
+    CONSTRAINT fk_product_images_product_id FOREIGN KEY (product_id) REFERENCES products(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
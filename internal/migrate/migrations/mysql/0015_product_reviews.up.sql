@@ -0,0 +1,16 @@
+-- 商品评价，rating 为 1~5 分，每个订单中的每个商品只能评价一次；商品详情中的评分汇总据此计算
+CREATE TABLE IF NOT EXISTS product_reviews (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    product_id BIGINT UNSIGNED NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    order_id BIGINT UNSIGNED NOT NULL,
+    rating TINYINT NOT NULL COMMENT '1~5 分',
+    content TEXT,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    INDEX idx_product_reviews_product_id (product_id),
+    UNIQUE INDEX idx_product_reviews_order_product (order_id, product_id),
+    CONSTRAINT fk_product_reviews_product_id FOREIGN KEY (product_id) REFERENCES products(id),
+    CONSTRAINT fk_product_reviews_user_id FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_product_reviews_order_id FOREIGN KEY (order_id) REFERENCES orders(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
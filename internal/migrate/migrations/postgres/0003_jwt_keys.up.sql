@@ -0,0 +1,10 @@
+-- JWT 签名密钥表
+CREATE TABLE IF NOT EXISTS jwt_keys (
+    id BIGSERIAL PRIMARY KEY,
+    kid VARCHAR(36) NOT NULL UNIQUE,
+    algorithm VARCHAR(10) NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    retired_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_jwt_keys_retired_at ON jwt_keys (retired_at);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS sessions CASCADE;
+
+CREATE TABLE IF NOT EXISTS token_blacklist (
+    id BIGSERIAL PRIMARY KEY,
+    token VARCHAR(500) NOT NULL UNIQUE,
+    expired_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_token_blacklist_expired_at ON token_blacklist (expired_at);
+CREATE INDEX IF NOT EXISTS idx_token_blacklist_deleted_at ON token_blacklist (deleted_at);
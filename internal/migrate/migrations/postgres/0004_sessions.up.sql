@@ -0,0 +1,16 @@
+-- 登录会话表，取代按 token 查询的黑名单
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(36) NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    device VARCHAR(100),
+    ip VARCHAR(45),
+    user_agent VARCHAR(255),
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    expired_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+DROP TABLE IF EXISTS token_blacklist CASCADE;
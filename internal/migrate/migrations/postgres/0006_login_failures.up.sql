@@ -0,0 +1,11 @@
+-- 登录失败计数，用于防止暴力破解
+CREATE TABLE IF NOT EXISTS login_failures (
+    kind VARCHAR(10) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (kind, value)
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_locked_until ON login_failures (locked_until);
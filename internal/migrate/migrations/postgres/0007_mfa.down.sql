@@ -0,0 +1,3 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS mfa_verified_at;
+DROP TABLE IF EXISTS mfa_recovery_codes CASCADE;
+DROP TABLE IF EXISTS user_totp CASCADE;
@@ -0,0 +1,13 @@
+-- 第三方登录身份（微信小程序、微信网页授权）
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    provider VARCHAR(20) NOT NULL,
+    subject VARCHAR(64) NOT NULL,
+    union_id VARCHAR(64),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_identities_union_id ON user_identities (union_id);
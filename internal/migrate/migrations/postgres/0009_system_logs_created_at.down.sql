@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_system_logs_created_at;
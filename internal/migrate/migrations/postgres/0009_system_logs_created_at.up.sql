@@ -0,0 +1,2 @@
+-- 审计日志按时间范围查询
+CREATE INDEX IF NOT EXISTS idx_system_logs_created_at ON system_logs (created_at);
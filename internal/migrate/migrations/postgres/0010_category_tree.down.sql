@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_categories_parent_sort;
+ALTER TABLE categories DROP COLUMN IF EXISTS sort_order;
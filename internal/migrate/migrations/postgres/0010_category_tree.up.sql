@@ -0,0 +1,3 @@
+-- 同级分类的排序，越小越靠前
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_categories_parent_sort ON categories (parent_id, sort_order);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_order_items_sku_id;
+ALTER TABLE order_items DROP COLUMN IF EXISTS sku_name;
+ALTER TABLE order_items DROP COLUMN IF EXISTS sku_id;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS sku_name;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS sku_id;
+DROP TABLE IF EXISTS product_skus;
+DROP TABLE IF EXISTS product_options;
@@ -0,0 +1,38 @@
+-- 商品规格项，option_values 为 JSON 数组，如 ["红色","蓝色"]
+CREATE TABLE IF NOT EXISTS product_options (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id),
+    name VARCHAR(20) NOT NULL,
+    option_values TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_product_options_product_id ON product_options (product_id);
+
+-- 商品 SKU，每个规格组合一条，spec_key 为规格组合的规范写法，如 颜色:红色;尺码:M
+-- 规格组合不再存在时只停用不删除，购物车和历史订单仍然可以引用
+CREATE TABLE IF NOT EXISTS product_skus (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id),
+    spec_key VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    specs TEXT NOT NULL,
+    price DECIMAL(10,2) NOT NULL,
+    stock INTEGER NOT NULL DEFAULT 0,
+    image_url VARCHAR(255),
+    barcode VARCHAR(64),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_skus_product_spec ON product_skus (product_id, spec_key);
+CREATE INDEX IF NOT EXISTS idx_product_skus_barcode ON product_skus (barcode);
+
+-- 购物车项和订单项引用的 SKU，商品没有规格时为 NULL
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS sku_id BIGINT;
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS sku_name VARCHAR(255);
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS sku_id BIGINT;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS sku_name VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_order_items_sku_id ON order_items (sku_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_products_view_count;
+ALTER TABLE products DROP COLUMN IF EXISTS view_count;
@@ -0,0 +1 @@
+-- 不删除规则：无法区分是本迁移补上的还是首次启动时写入的默认策略
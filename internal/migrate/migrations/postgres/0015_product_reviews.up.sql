@@ -0,0 +1,13 @@
+-- 商品评价，rating 为 1~5 分，每个订单中的每个商品只能评价一次；商品详情中的评分汇总据此计算
+CREATE TABLE IF NOT EXISTS product_reviews (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id),
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    order_id BIGINT NOT NULL REFERENCES orders(id),
+    rating SMALLINT NOT NULL,
+    content TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_product_reviews_product_id ON product_reviews (product_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_reviews_order_product ON product_reviews (order_id, product_id);
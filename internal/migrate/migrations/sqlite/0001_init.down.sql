@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS system_logs;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS product_categories;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS token_blacklist;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,22 @@
+-- TOTP 两步验证密钥
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER NOT NULL PRIMARY KEY REFERENCES users(id),
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at DATETIME,
+    last_step INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+
+-- 两步验证恢复码
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    used_at DATETIME,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+-- 会话是否通过了两步验证
+ALTER TABLE sessions ADD COLUMN mfa_verified_at DATETIME;
@@ -0,0 +1,3 @@
+-- 商品浏览次数，由浏览计数器在内存中累加后定期写入
+ALTER TABLE products ADD COLUMN view_count INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_products_view_count ON products (view_count);
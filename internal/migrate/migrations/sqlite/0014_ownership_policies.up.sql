@@ -0,0 +1,35 @@
+-- 访问其他用户的订单、购物车和地址的权限规则，首次启动时随默认策略写入；
+-- 已有部署的策略表不为空，默认策略不会再写入，这里补上缺少的规则，之后管理员删除的规则不会再恢复
+-- casbin_rule 由 Casbin 的 gorm 适配器创建，全新安装时先按相同的结构建表，首次启动时仍会写入全部默认策略
+CREATE TABLE IF NOT EXISTS casbin_rule (
+    id INTEGER,
+    ptype TEXT,
+    v0 TEXT,
+    v1 TEXT,
+    v2 TEXT,
+    v3 TEXT,
+    v4 TEXT,
+    v5 TEXT,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_casbin_rule ON casbin_rule (ptype, v0, v1, v2, v3, v4, v5);
+
+INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+SELECT 'p', 'admin', '/orders*', '(GET)|(POST)|(PUT)|(DELETE)', '', '', '' FROM (SELECT 1 AS seed) seed
+WHERE EXISTS (SELECT 1 FROM casbin_rule)
+  AND NOT EXISTS (SELECT 1 FROM casbin_rule WHERE ptype = 'p' AND v0 = 'admin' AND v1 = '/orders*' AND v2 = '(GET)|(POST)|(PUT)|(DELETE)');
+
+INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+SELECT 'p', 'admin', '/cart/items*', '(GET)|(POST)|(PUT)|(DELETE)', '', '', '' FROM (SELECT 1 AS seed) seed
+WHERE EXISTS (SELECT 1 FROM casbin_rule)
+  AND NOT EXISTS (SELECT 1 FROM casbin_rule WHERE ptype = 'p' AND v0 = 'admin' AND v1 = '/cart/items*' AND v2 = '(GET)|(POST)|(PUT)|(DELETE)');
+
+INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+SELECT 'p', 'admin', '/addresses*', '(GET)|(POST)|(PUT)|(DELETE)', '', '', '' FROM (SELECT 1 AS seed) seed
+WHERE EXISTS (SELECT 1 FROM casbin_rule)
+  AND NOT EXISTS (SELECT 1 FROM casbin_rule WHERE ptype = 'p' AND v0 = 'admin' AND v1 = '/addresses*' AND v2 = '(GET)|(POST)|(PUT)|(DELETE)');
+
+INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+SELECT 'p', 'support', '/orders*', 'GET', '', '', '' FROM (SELECT 1 AS seed) seed
+WHERE EXISTS (SELECT 1 FROM casbin_rule)
+  AND NOT EXISTS (SELECT 1 FROM casbin_rule WHERE ptype = 'p' AND v0 = 'support' AND v1 = '/orders*' AND v2 = 'GET');
@@ -0,0 +1,2 @@
+-- 会话的登录方式（RFC 8176 amr），pwd 为密码登录，wechat 为微信登录
+ALTER TABLE sessions ADD COLUMN auth_method VARCHAR(20) NOT NULL DEFAULT 'pwd';
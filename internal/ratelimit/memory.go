@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"qaqmall/config"
+)
+
+// sweepInterval 内存存储清理已装满的令牌桶的间隔
+const sweepInterval = time.Minute
+
+// MemoryStore 把令牌桶保存在进程内存中，只适合单实例部署
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rule config.RateLimitRule) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	tat, result := take(s.buckets[key], now, rule)
+	if result.Allowed {
+		s.buckets[key] = tat
+	}
+	return result, nil
+}
+
+// sweep 删除已经重新装满的令牌桶，它们与不存在的令牌桶等价
+// 每隔 sweepInterval 最多清理一次，不在每次请求时遍历全部 key
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for key, tat := range s.buckets {
+		if !tat.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.nextSweep = now.Add(sweepInterval)
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"qaqmall/config"
+)
+
+// Result 一次取令牌的结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 令牌桶容量
+	Remaining  int           // 剩余令牌数
+	ResetAfter time.Duration // 令牌桶重新装满还需要的时间
+	RetryAfter time.Duration // 被拒绝时，下一个令牌补充前需要等待的时间
+}
+
+// Store 保存每个 key 对应的令牌桶
+type Store interface {
+	// Take 从 key 对应的令牌桶中取一个令牌
+	Take(ctx context.Context, key string, rule config.RateLimitRule) (Result, error)
+}
+
+// New 根据配置创建令牌桶存储，ctx 取消时释放存储占用的资源
+func New(ctx context.Context, cfg config.RateLimitConfig, redisCfg config.RedisConfig) (Store, error) {
+	switch cfg.Store {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		store := NewRedisStore(redisCfg)
+		go func() {
+			<-ctx.Done()
+			store.Close()
+		}()
+		return store, nil
+	default:
+		return nil, fmt.Errorf("不支持的限流存储: %s", cfg.Store)
+	}
+}
+
+// take 按 GCRA 算法计算取令牌的结果，与令牌桶等价，但每个 key 只需要保存一个时间点
+// tat（theoretical arrival time）为令牌桶重新装满的时间，返回取令牌后新的 tat，被拒绝时不变
+func take(tat, now time.Time, rule config.RateLimitRule) (time.Time, Result) {
+	burst := rule.Capacity()
+	interval := rule.Period / time.Duration(rule.Requests)
+	result := Result{Limit: burst}
+
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	// 令牌桶装满时最多可以连续取 burst 个，即 tat 最多领先当前时间 burst 个间隔
+	allowAt := next.Add(-interval * time.Duration(burst))
+	if now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+		result.ResetAfter = tat.Sub(now)
+		return tat, result
+	}
+
+	result.Allowed = true
+	result.ResetAfter = next.Sub(now)
+	result.Remaining = burst - int((result.ResetAfter+interval-1)/interval)
+	return next, result
+}
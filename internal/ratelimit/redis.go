@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"qaqmall/config"
+)
+
+const (
+	// redisKeyPrefix 令牌桶在 Redis 中的 key 前缀
+	redisKeyPrefix = "qaqmall:ratelimit:"
+	// redisMaxRetries 其他实例同时修改同一个令牌桶时的最大重试次数
+	redisMaxRetries = 5
+)
+
+// RedisStore 把令牌桶保存在 Redis 中，多个实例共享同一份计数
+// 只使用 WATCH/GET/MULTI/SET/EXEC 等基础命令，兼容 Redis 协议的其他服务也可以使用
+// 令牌桶按各实例的本地时间计算，实例之间的时钟需要同步
+type RedisStore struct {
+	pool *redis.Pool
+}
+
+func NewRedisStore(cfg config.RedisConfig) *RedisStore {
+	return &RedisStore{pool: &redis.Pool{
+		MaxIdle:     cfg.MaxIdle,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", cfg.Addr,
+				redis.DialPassword(cfg.Password),
+				redis.DialDatabase(cfg.DB),
+				redis.DialConnectTimeout(cfg.Timeout),
+				redis.DialReadTimeout(cfg.Timeout),
+				redis.DialWriteTimeout(cfg.Timeout),
+			)
+		},
+	}}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, rule config.RateLimitRule) (Result, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("连接 Redis 失败: %v", err)
+	}
+	defer conn.Close()
+
+	key = redisKeyPrefix + key
+	var result Result
+	for i := 0; i < redisMaxRetries; i++ {
+		if _, err := conn.Do("WATCH", key); err != nil {
+			return Result{}, err
+		}
+		stored, err := redis.Int64(conn.Do("GET", key))
+		if err != nil && !errors.Is(err, redis.ErrNil) {
+			return Result{}, err
+		}
+
+		now := time.Now()
+		var tat time.Time
+		if stored > 0 {
+			tat = time.UnixMilli(stored)
+		}
+		var next time.Time
+		next, result = take(tat, now, rule)
+		if !result.Allowed {
+			_, err := conn.Do("UNWATCH")
+			return result, err
+		}
+
+		// 令牌桶装满后与不存在等价，key 在那之后过期
+		ttl := next.Sub(now).Milliseconds() + 1
+		conn.Send("MULTI")
+		conn.Send("SET", key, next.UnixMilli(), "PX", ttl)
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return Result{}, err
+		}
+		// WATCH 的 key 被其他实例修改时 EXEC 返回 nil，重新计算
+		if reply != nil {
+			return result, nil
+		}
+	}
+	// 重试多次仍冲突说明同一个 key 正在被大量并发请求，按拒绝处理，不能因此放行
+	return conflicted(result, rule), nil
+}
+
+// conflicted 重试多次仍冲突时的结果，等待一个令牌的补充间隔后重试
+func conflicted(last Result, rule config.RateLimitRule) Result {
+	return Result{
+		Limit:      last.Limit,
+		ResetAfter: last.ResetAfter,
+		RetryAfter: rule.Period / time.Duration(rule.Requests),
+	}
+}
+
+// Close 关闭连接池
+func (s *RedisStore) Close() error {
+	return s.pool.Close()
+}
@@ -0,0 +1,268 @@
+package router
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"qaqmall/models"
+)
+
+// codePattern 邮件正文中的验证码
+var codePattern = regexp.MustCompile(`[A-Za-z0-9_-]+\.[A-Za-z0-9_-]{43}`)
+
+// sentMail file 邮件驱动写入的一封邮件
+type sentMail struct {
+	To      string
+	Subject string
+	Code    string
+}
+
+// sentMails 返回 file 邮件驱动写入的所有邮件，按发送顺序排列
+func (s *testServer) sentMails() []sentMail {
+	s.t.Helper()
+	files, err := filepath.Glob(filepath.Join(s.cfg.Mail.Dir, "*.eml"))
+	if err != nil {
+		s.t.Fatalf("读取邮件目录失败: %v", err)
+	}
+	sort.Strings(files)
+
+	mails := make([]sentMail, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			s.t.Fatalf("读取邮件失败: %v", err)
+		}
+		msg, err := mail.ReadMessage(f)
+		if err != nil {
+			s.t.Fatalf("解析邮件失败: %v", err)
+		}
+		body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+		f.Close()
+		if err != nil {
+			s.t.Fatalf("解码邮件正文失败: %v", err)
+		}
+		to, err := mail.ParseAddress(msg.Header.Get("To"))
+		if err != nil {
+			s.t.Fatalf("解析收件人失败: %v", err)
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if err != nil {
+			s.t.Fatalf("解码邮件主题失败: %v", err)
+		}
+		mails = append(mails, sentMail{To: to.Address, Subject: subject, Code: codePattern.FindString(string(body))})
+	}
+	return mails
+}
+
+// lastMail 返回最近一封发给 to 的邮件
+func (s *testServer) lastMail(to string) sentMail {
+	s.t.Helper()
+	mails := s.sentMails()
+	for i := len(mails) - 1; i >= 0; i-- {
+		if mails[i].To == to {
+			if mails[i].Code == "" {
+				s.t.Fatalf("发给 %s 的邮件中没有验证码", to)
+			}
+			return mails[i]
+		}
+	}
+	s.t.Fatalf("没有发给 %s 的邮件", to)
+	return sentMail{}
+}
+
+// waitMails 等待异步发送的邮件，直到共有 n 封邮件
+func (s *testServer) waitMails(n int) []sentMail {
+	s.t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if mails := s.sentMails(); len(mails) >= n {
+			return mails
+		}
+	}
+	s.t.Fatalf("期望 %d 封邮件，实际 %d 封", n, len(s.sentMails()))
+	return nil
+}
+
+func TestEmailVerificationRoutes(t *testing.T) {
+	s := newTestServer(t)
+	w := s.do(http.MethodPost, "/register", "", map[string]interface{}{
+		"username":          "alice",
+		"password":          "password",
+		"email":             "alice@example.com",
+		"email_verified_at": time.Now(),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("注册失败: %d %s", w.Code, w.Body.String())
+	}
+	token := s.login("alice", "password")
+	_, otherToken := s.loginAsUser("bob")
+
+	verification := s.lastMail("alice@example.com")
+	if verification.Subject != "验证您的邮箱" {
+		t.Fatalf("期望验证邮件，实际主题 %q", verification.Subject)
+	}
+	code := verification.Code
+
+	emailVerified := func(want bool) func(t *testing.T, w *httptest.ResponseRecorder) {
+		return func(t *testing.T, w *httptest.ResponseRecorder) {
+			var resp struct {
+				EmailVerified bool `json:"email_verified"`
+			}
+			decode(t, w, &resp)
+			if resp.EmailVerified != want {
+				t.Errorf("期望 email_verified=%v，实际 %v", want, resp.EmailVerified)
+			}
+		}
+	}
+
+	s.run([]routeCase{
+		{name: "register with invalid email", method: http.MethodPost, path: "/register",
+			body: map[string]string{"username": "carol", "password": "password", "email": "not-an-email"},
+			want: http.StatusBadRequest},
+		{name: "client cannot self verify", method: http.MethodGet, path: "/user/info", token: token,
+			want: http.StatusOK, check: emailVerified(false)},
+		{name: "verify with tampered code", method: http.MethodPost, path: "/email/verify",
+			body: map[string]string{"code": "x" + code}, want: http.StatusBadRequest},
+		{name: "verify", method: http.MethodPost, path: "/email/verify",
+			body: map[string]string{"code": code}, want: http.StatusOK},
+		{name: "verified", method: http.MethodGet, path: "/user/info", token: token,
+			want: http.StatusOK, check: emailVerified(true)},
+		{name: "code is single use", method: http.MethodPost, path: "/email/verify",
+			body: map[string]string{"code": code}, want: http.StatusBadRequest},
+		{name: "resend when verified", method: http.MethodPost, path: "/user/email/verification", token: token,
+			want: http.StatusBadRequest},
+		{name: "resend without email", method: http.MethodPost, path: "/user/email/verification", token: otherToken,
+			want: http.StatusBadRequest},
+		{name: "change email resets verification", method: http.MethodPut, path: "/user/info", token: token,
+			body: map[string]string{"email": "alice@example.org"}, want: http.StatusOK},
+		{name: "unverified after change", method: http.MethodGet, path: "/user/info", token: token,
+			want: http.StatusOK, check: emailVerified(false)},
+		{name: "resend", method: http.MethodPost, path: "/user/email/verification", token: token,
+			want: http.StatusOK},
+		{name: "other user claims verified email", method: http.MethodPut, path: "/user/info", token: otherToken,
+			body: map[string]string{"email": "alice@example.org"}, want: http.StatusOK},
+	})
+
+	// 两个账号使用同一个邮箱时，只有先验证的账号可以验证成功
+	mails := s.sentMails()
+	aliceCode, bobCode := mails[len(mails)-2].Code, mails[len(mails)-1].Code
+	s.run([]routeCase{
+		{name: "verify changed email", method: http.MethodPost, path: "/email/verify",
+			body: map[string]string{"code": aliceCode}, want: http.StatusOK},
+		{name: "email already verified by other account", method: http.MethodPost, path: "/email/verify",
+			body: map[string]string{"code": bobCode}, want: http.StatusConflict},
+	})
+}
+
+func TestPasswordResetRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+	now := time.Now()
+	s.db.Model(&models.User{}).Where("username = ?", "alice").
+		Updates(map[string]interface{}{"email": "alice@example.com", "email_verified_at": now})
+	s.registerUser("bob", "password")
+	s.db.Model(&models.User{}).Where("username = ?", "bob").Update("email", "bob@example.com")
+
+	token, refreshToken := s.loginTokens("alice", "password")
+
+	s.run([]routeCase{
+		{name: "forgot invalid email", method: http.MethodPost, path: "/password/forgot",
+			body: map[string]string{"email": "alice"}, want: http.StatusBadRequest},
+		{name: "forgot unknown email", method: http.MethodPost, path: "/password/forgot",
+			body: map[string]string{"email": "nobody@example.com"}, want: http.StatusOK},
+		{name: "forgot unverified email", method: http.MethodPost, path: "/password/forgot",
+			body: map[string]string{"email": "bob@example.com"}, want: http.StatusOK},
+		{name: "forgot", method: http.MethodPost, path: "/password/forgot",
+			body: map[string]string{"email": "alice@example.com"}, want: http.StatusOK},
+	})
+
+	// 邮件异步发送，找到 alice 的邮件时其余请求已处理完，不应再有其他邮件
+	if mails := s.waitMails(1); len(mails) != 1 {
+		t.Fatalf("只应向已验证的邮箱发送 1 封邮件，实际 %d 封", len(mails))
+	}
+	reset := s.lastMail("alice@example.com")
+	if reset.Subject != "重置您的密码" {
+		t.Fatalf("期望重置密码邮件，实际主题 %q", reset.Subject)
+	}
+	code := reset.Code
+
+	// 邮箱验证码不能用来重置密码
+	s.db.Model(&models.User{}).Where("username = ?", "bob").Update("email", "bob@example.org")
+	s.do(http.MethodPost, "/user/email/verification", s.login("bob", "password"), nil)
+	verifyCode := s.lastMail("bob@example.org").Code
+
+	s.run([]routeCase{
+		{name: "reset with verify code", method: http.MethodPost, path: "/password/reset",
+			body: map[string]string{"code": verifyCode, "password": "newpassword"}, want: http.StatusBadRequest},
+		{name: "reset short password", method: http.MethodPost, path: "/password/reset",
+			body: map[string]string{"code": code, "password": "123"}, want: http.StatusBadRequest},
+		{name: "reset", method: http.MethodPost, path: "/password/reset",
+			body: map[string]string{"code": code, "password": "newpassword"}, want: http.StatusOK},
+		{name: "code is single use", method: http.MethodPost, path: "/password/reset",
+			body: map[string]string{"code": code, "password": "another"}, want: http.StatusBadRequest},
+		{name: "sessions ended after reset", method: http.MethodGet, path: "/user/info", token: token,
+			want: http.StatusUnauthorized},
+		{name: "refresh token revoked after reset", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": refreshToken}, want: http.StatusUnauthorized},
+		{name: "old password rejected", method: http.MethodPost, path: "/login",
+			body: map[string]string{"username": "alice", "password": "password"}, want: http.StatusUnauthorized},
+		{name: "new password accepted", method: http.MethodPost, path: "/login",
+			body: map[string]string{"username": "alice", "password": "newpassword"}, want: http.StatusOK},
+	})
+}
+
+func TestPasswordResetSharedEmail(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+	s.registerUser("bob", "password")
+	// 两个账号并发验证同一个邮箱时都可能验证成功，找回密码时每个账号各收到一封邮件
+	s.db.Model(&models.User{}).Where("username IN ?", []string{"alice", "bob"}).
+		Updates(map[string]interface{}{"email": "shared@example.com", "email_verified_at": time.Now()})
+
+	s.run([]routeCase{
+		{name: "forgot", method: http.MethodPost, path: "/password/forgot",
+			body: map[string]string{"email": "shared@example.com"}, want: http.StatusOK},
+	})
+	// 邮件按账号ID顺序发送，每封邮件的验证码只能重置对应的账号
+	mails := s.waitMails(2)
+	for i, username := range []string{"alice", "bob"} {
+		s.run([]routeCase{
+			{name: "reset " + username, method: http.MethodPost, path: "/password/reset",
+				body: map[string]string{"code": mails[i].Code, "password": "newpassword"}, want: http.StatusOK},
+			{name: username + " logs in with new password", method: http.MethodPost, path: "/login",
+				body: map[string]string{"username": username, "password": "newpassword"}, want: http.StatusOK},
+		})
+	}
+}
+
+func TestChangePasswordRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+	token := s.login("alice", "password")
+	otherToken, otherRefreshToken := s.loginTokens("alice", "password")
+
+	s.run([]routeCase{
+		{name: "change without token", method: http.MethodPut, path: "/user/password",
+			body: map[string]string{"old_password": "password", "new_password": "newpassword"}, want: http.StatusUnauthorized},
+		{name: "wrong old password", method: http.MethodPut, path: "/user/password", token: token,
+			body: map[string]string{"old_password": "wrong", "new_password": "newpassword"}, want: http.StatusBadRequest},
+		{name: "change", method: http.MethodPut, path: "/user/password", token: token,
+			body: map[string]string{"old_password": "password", "new_password": "newpassword"}, want: http.StatusOK},
+		{name: "current session kept", method: http.MethodGet, path: "/user/info", token: token, want: http.StatusOK},
+		{name: "other sessions ended", method: http.MethodGet, path: "/user/info", token: otherToken,
+			want: http.StatusUnauthorized},
+		{name: "other refresh token revoked", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": otherRefreshToken}, want: http.StatusUnauthorized},
+		{name: "login with new password", method: http.MethodPost, path: "/login",
+			body: map[string]string{"username": "alice", "password": "newpassword"}, want: http.StatusOK},
+	})
+}
@@ -0,0 +1,153 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"qaqmall/jobs"
+	"qaqmall/models"
+)
+
+// auditLogs 通过管理员接口查询审计日志
+func (s *testServer) auditLogs(token string, query url.Values) ([]models.SystemLog, int64) {
+	s.t.Helper()
+	w := s.do(http.MethodGet, "/admin/audit-logs?"+query.Encode(), token, nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("查询审计日志失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Items []models.SystemLog `json:"items"`
+			Total int64              `json:"total"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data.Items, resp.Data.Total
+}
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	adminID, adminToken := s.loginAsAdmin("admin1")
+	aliceID := s.registerUser("alice", "password")
+
+	// 登录失败和成功
+	if w := s.do(http.MethodPost, "/login", "", loginBody("alice", "wrong")); w.Code != http.StatusUnauthorized {
+		t.Fatalf("期望登录失败，实际 %d", w.Code)
+	}
+	aliceToken := s.login("alice", "password")
+
+	// 管理员维护商品
+	w := s.do(http.MethodPost, "/admin/products", adminToken, map[string]interface{}{"name": "鼠标", "price": 99, "stock": 5, "is_on_sale": true})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建商品失败: %d", w.Code)
+	}
+	var product models.Product
+	decode(t, w, &product)
+	productPath := fmt.Sprintf("/admin/products/%d", product.ID)
+	if w := s.do(http.MethodPut, productPath, adminToken, map[string]interface{}{"price": 89}); w.Code != http.StatusOK {
+		t.Fatalf("更新商品失败: %d", w.Code)
+	}
+
+	// 取消订单
+	address := s.seedAddress(aliceID)
+	orderID := s.seedOrder(aliceToken, address.ID, product.ID, 1)
+	if w := s.do(http.MethodPost, fmt.Sprintf("/orders/%d/cancel", orderID), aliceToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("取消订单失败: %d", w.Code)
+	}
+
+	// 发起支付，超时后由定时任务取消
+	payOrderID := s.seedOrder(aliceToken, address.ID, product.ID, 1)
+	if w := s.do(http.MethodPost, "/payments", aliceToken, map[string]interface{}{"order_id": payOrderID, "user_id": aliceID,
+		"amount": 89, "payment_method": string(models.PaymentMethodAlipay)}); w.Code != http.StatusOK {
+		t.Fatalf("发起支付失败: %d %s", w.Code, w.Body.String())
+	}
+	s.db.Model(&models.Payment{}).Where("order_id = ?", payOrderID).Update("created_at", time.Now().Add(-time.Hour))
+	if err := jobs.NewPaymentJobs(s.db).CancelExpiredPayments(context.Background()); err != nil {
+		t.Fatalf("取消超时支付失败: %v", err)
+	}
+
+	if w := s.do(http.MethodDelete, productPath, adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除商品失败: %d", w.Code)
+	}
+
+	// 登出和注销账号
+	if w := s.do(http.MethodPost, "/logout", aliceToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("登出失败: %d", w.Code)
+	}
+	aliceToken = s.login("alice", "password")
+	if w := s.do(http.MethodDelete, "/user", aliceToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("注销账号失败: %d", w.Code)
+	}
+
+	want := []struct {
+		action string
+		userID uint64
+		text   string
+	}{
+		{"login_failed", aliceID, "alice"},
+		{"login_succeeded", aliceID, "alice"},
+		{"product_created", adminID, "鼠标"},
+		{"product_updated", adminID, "99.00 -> 89.00"},
+		{"product_deleted", adminID, "鼠标"},
+		{"order_cancelled", aliceID, "用户取消订单"},
+		{"payment_status_changed", aliceID, "由 pending 变为 cancelled"},
+		{"logout", aliceID, "登出"},
+		{"account_deleted", aliceID, "alice"},
+	}
+	for _, tc := range want {
+		logs := s.systemLogs(tc.action)
+		if len(logs) == 0 {
+			t.Errorf("没有 %s 的审计日志", tc.action)
+			continue
+		}
+		last := logs[len(logs)-1]
+		if last.UserID == nil || *last.UserID != tc.userID || !strings.Contains(last.Description, tc.text) {
+			t.Errorf("%s 的审计日志不正确: user_id=%v %q", tc.action, last.UserID, last.Description)
+		}
+	}
+	if logs := s.systemLogs("payment_status_changed"); len(logs) != 2 || !strings.Contains(logs[0].Description, "由 无 变为 pending") {
+		t.Errorf("期望记录支付记录创建和超时取消两次状态变化: %+v", logs)
+	}
+
+	// 按用户和动作过滤
+	items, total := s.auditLogs(adminToken, url.Values{"user_id": {fmt.Sprint(aliceID)}, "action": {"login_succeeded"}})
+	if total != 2 || len(items) != 2 {
+		t.Errorf("期望 alice 有 2 条登录成功日志，实际 %d", total)
+	}
+	items, _ = s.auditLogs(adminToken, url.Values{"user_id": {fmt.Sprint(adminID)}, "pageSize": {"2"}})
+	if len(items) != 2 || items[0].Action != "product_deleted" {
+		t.Errorf("期望按时间倒序分页返回，实际 %+v", items)
+	}
+
+	// 按时间范围过滤
+	if _, total := s.auditLogs(adminToken, url.Values{"to": {time.Now().Add(-time.Hour).Format(time.RFC3339)}}); total != 0 {
+		t.Errorf("一小时前不应有审计日志，实际 %d 条", total)
+	}
+	if _, total := s.auditLogs(adminToken, url.Values{"from": {time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		"to": {time.Now().Add(time.Hour).Format(time.RFC3339)}}); total < int64(len(want)) {
+		t.Errorf("时间范围内的审计日志数量不正确: %d", total)
+	}
+
+	_, userToken := s.loginAsUser("bob")
+	s.run([]routeCase{
+		{name: "user cannot query audit logs", method: http.MethodGet, path: "/admin/audit-logs", token: userToken,
+			want: http.StatusForbidden},
+		{name: "invalid user id", method: http.MethodGet, path: "/admin/audit-logs?user_id=abc", token: adminToken,
+			want: http.StatusBadRequest},
+		{name: "invalid time", method: http.MethodGet, path: "/admin/audit-logs?from=yesterday", token: adminToken,
+			want: http.StatusBadRequest},
+		{name: "from after to", method: http.MethodGet, token: adminToken,
+			path: "/admin/audit-logs?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z", want: http.StatusBadRequest,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if !strings.Contains(w.Body.String(), "from 必须早于 to") {
+					t.Errorf("错误信息不正确: %s", w.Body.String())
+				}
+			}},
+	})
+}
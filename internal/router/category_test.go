@@ -0,0 +1,211 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"qaqmall/models"
+)
+
+// createCategory 通过管理员接口创建分类，parentID 为 0 时创建根分类
+func (s *testServer) createCategory(token, name string, parentID uint64) models.Category {
+	s.t.Helper()
+	body := map[string]interface{}{"name": name}
+	if parentID != 0 {
+		body["parent_id"] = parentID
+	}
+	w := s.do(http.MethodPost, "/admin/categories", token, body)
+	if w.Code != http.StatusCreated {
+		s.t.Fatalf("创建分类 %s 失败: %d %s", name, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data models.Category `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data
+}
+
+// categoryTree 获取分类树，返回每个分类按顺序排列的子分类名称，根分类的 key 为空字符串
+func (s *testServer) categoryTree() map[string][]string {
+	s.t.Helper()
+	w := s.do(http.MethodGet, "/categories", "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("获取分类树失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []*models.Category `json:"data"`
+	}
+	decode(s.t, w, &resp)
+
+	tree := make(map[string][]string)
+	var walk func(parent string, nodes []*models.Category)
+	walk = func(parent string, nodes []*models.Category) {
+		for _, node := range nodes {
+			tree[parent] = append(tree[parent], node.Name)
+			walk(node.Name, node.Children)
+		}
+	}
+	walk("", resp.Data)
+	return tree
+}
+
+// productNames 按分类查询商品列表，返回商品名称
+func (s *testServer) productNames(categoryID uint64) []string {
+	s.t.Helper()
+	w := s.do(http.MethodGet, idPath("/products?category_id=%d", categoryID), "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("按分类查询商品失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Items []models.Product `json:"items"`
+	}
+	decode(s.t, w, &resp)
+	names := make([]string, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestCategoryTree(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.loginAsAdmin("admin1")
+	_, userToken := s.loginAsUser("alice")
+
+	digital := s.createCategory(adminToken, "数码", 0)
+	phones := s.createCategory(adminToken, "手机", digital.ID)
+	laptops := s.createCategory(adminToken, "笔记本", digital.ID)
+	accessories := s.createCategory(adminToken, "配件", phones.ID)
+	books := s.createCategory(adminToken, "图书", 0)
+
+	want := map[string][]string{"": {"数码", "图书"}, "数码": {"手机", "笔记本"}, "手机": {"配件"}}
+	if got := s.categoryTree(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("分类树不正确: %v", got)
+	}
+
+	// 调整顺序：笔记本移到手机前面
+	if w := s.do(http.MethodPut, idPath("/admin/categories/%d/move", laptops.ID), adminToken,
+		map[string]interface{}{"parent_id": digital.ID, "position": 0}); w.Code != http.StatusOK {
+		t.Fatalf("调整分类顺序失败: %d %s", w.Code, w.Body.String())
+	}
+	// 移动：配件移到数码下，排在最后
+	if w := s.do(http.MethodPut, idPath("/admin/categories/%d/move", accessories.ID), adminToken,
+		map[string]interface{}{"parent_id": digital.ID}); w.Code != http.StatusOK {
+		t.Fatalf("移动分类失败: %d %s", w.Code, w.Body.String())
+	}
+	// 移动为根分类，排在第一位
+	if w := s.do(http.MethodPut, idPath("/admin/categories/%d/move", books.ID), adminToken,
+		map[string]interface{}{"parent_id": nil, "position": 0}); w.Code != http.StatusOK {
+		t.Fatalf("移动分类失败: %d %s", w.Code, w.Body.String())
+	}
+	want = map[string][]string{"": {"图书", "数码"}, "数码": {"笔记本", "手机", "配件"}}
+	if got := s.categoryTree(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("移动后的分类树不正确: %v", got)
+	}
+
+	// 创建商品时指定分类，修改时不传 category_ids 保持不变
+	w := s.do(http.MethodPost, "/admin/products", adminToken, map[string]interface{}{"name": "手机壳", "price": 19, "stock": 10,
+		"is_on_sale": true, "category_ids": []uint64{accessories.ID}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建商品失败: %d %s", w.Code, w.Body.String())
+	}
+	var phoneCase models.Product
+	decode(t, w, &phoneCase)
+	if len(phoneCase.Categories) != 1 || phoneCase.Categories[0].Name != "配件" {
+		t.Errorf("创建商品返回的分类不正确: %+v", phoneCase.Categories)
+	}
+	w = s.do(http.MethodPut, idPath("/admin/products/%d", phoneCase.ID), adminToken, map[string]interface{}{"price": 29})
+	decode(t, w, &phoneCase)
+	if w.Code != http.StatusOK || len(phoneCase.Categories) != 1 {
+		t.Errorf("不传 category_ids 时应保持原有分类: %d %s", w.Code, w.Body.String())
+	}
+
+	laptop := s.seedProduct("轻薄本", 4999, 5)
+	if w := s.do(http.MethodPut, idPath("/admin/products/%d", laptop.ID), adminToken,
+		map[string]interface{}{"category_ids": []uint64{laptops.ID, digital.ID}}); w.Code != http.StatusOK {
+		t.Fatalf("设置商品分类失败: %d %s", w.Code, w.Body.String())
+	}
+	novel := s.seedProduct("小说", 39, 5)
+	if w := s.do(http.MethodPut, idPath("/admin/products/%d", novel.ID), adminToken,
+		map[string]interface{}{"category_ids": []uint64{books.ID}}); w.Code != http.StatusOK {
+		t.Fatalf("设置商品分类失败: %d %s", w.Code, w.Body.String())
+	}
+	s.seedProduct("未分类", 1, 1)
+
+	// 按分类查询包括子孙分类，同时属于多个分类的商品只出现一次
+	for _, tc := range []struct {
+		category models.Category
+		want     string
+	}{
+		{digital, "[手机壳 轻薄本]"},
+		{accessories, "[手机壳]"},
+		{phones, "[]"},
+		{books, "[小说]"},
+	} {
+		if got := s.productNames(tc.category.ID); fmt.Sprint(got) != tc.want {
+			t.Errorf("分类 %s 下的商品期望 %s，实际 %v", tc.category.Name, tc.want, got)
+		}
+	}
+
+	// 清空商品分类
+	if w := s.do(http.MethodPut, idPath("/admin/products/%d", novel.ID), adminToken,
+		map[string]interface{}{"category_ids": []uint64{}}); w.Code != http.StatusOK {
+		t.Fatalf("清空商品分类失败: %d", w.Code)
+	}
+	if got := s.productNames(books.ID); len(got) != 0 {
+		t.Errorf("清空分类后不应再按分类查到商品: %v", got)
+	}
+
+	s.run([]routeCase{
+		{name: "user cannot create category", method: http.MethodPost, path: "/admin/categories", token: userToken,
+			body: map[string]interface{}{"name": "家电"}, want: http.StatusForbidden},
+		{name: "duplicate name", method: http.MethodPost, path: "/admin/categories", token: adminToken,
+			body: map[string]interface{}{"name": "手机"}, want: http.StatusConflict},
+		{name: "empty name", method: http.MethodPost, path: "/admin/categories", token: adminToken,
+			body: map[string]interface{}{"name": " "}, want: http.StatusBadRequest},
+		{name: "missing parent", method: http.MethodPost, path: "/admin/categories", token: adminToken,
+			body: map[string]interface{}{"name": "家电", "parent_id": 999}, want: http.StatusBadRequest},
+		{name: "rename category", method: http.MethodPut, path: idPath("/admin/categories/%d", phones.ID), token: adminToken,
+			body: map[string]interface{}{"name": "智能手机", "description": "各品牌手机"}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data models.Category `json:"data"`
+				}
+				decode(t, w, &resp)
+				if resp.Data.Name != "智能手机" || resp.Data.ParentID == nil || *resp.Data.ParentID != digital.ID {
+					t.Errorf("修改后的分类不正确: %+v", resp.Data)
+				}
+			}},
+		{name: "rename to existing name", method: http.MethodPut, path: idPath("/admin/categories/%d", phones.ID), token: adminToken,
+			body: map[string]interface{}{"name": "图书"}, want: http.StatusConflict},
+		{name: "move under itself", method: http.MethodPut, path: idPath("/admin/categories/%d/move", digital.ID), token: adminToken,
+			body: map[string]interface{}{"parent_id": digital.ID}, want: http.StatusBadRequest},
+		{name: "move under descendant", method: http.MethodPut, path: idPath("/admin/categories/%d/move", digital.ID), token: adminToken,
+			body: map[string]interface{}{"parent_id": accessories.ID}, want: http.StatusBadRequest},
+		{name: "move missing category", method: http.MethodPut, path: "/admin/categories/999/move", token: adminToken,
+			body: map[string]interface{}{"parent_id": nil}, want: http.StatusNotFound},
+		{name: "delete category with children", method: http.MethodDelete, path: idPath("/admin/categories/%d", digital.ID),
+			token: adminToken, want: http.StatusConflict},
+		{name: "delete leaf category", method: http.MethodDelete, path: idPath("/admin/categories/%d", accessories.ID),
+			token: adminToken, want: http.StatusOK},
+		{name: "products of deleted category", method: http.MethodGet, path: idPath("/products?category_id=%d", accessories.ID),
+			want: http.StatusNotFound},
+		{name: "invalid category id", method: http.MethodGet, path: "/products?category_id=abc", want: http.StatusBadRequest},
+		{name: "product with missing category", method: http.MethodPost, path: "/admin/products", token: adminToken,
+			body: map[string]interface{}{"name": "电视", "price": 1999, "stock": 1, "category_ids": []uint64{999}},
+			want: http.StatusBadRequest},
+	})
+
+	// 删除分类后名称可以重新使用，商品不再属于该分类
+	s.createCategory(adminToken, "配件", digital.ID)
+	var count int64
+	s.db.Table("product_categories").Where("product_id = ?", phoneCase.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("删除分类后应解除商品关联，实际还有 %d 条", count)
+	}
+	if logs := s.systemLogs("category_moved"); len(logs) != 3 {
+		t.Errorf("期望 3 条移动分类的审计日志，实际 %d", len(logs))
+	}
+}
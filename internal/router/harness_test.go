@@ -0,0 +1,349 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/database"
+	"qaqmall/internal/health"
+	"qaqmall/internal/lifecycle"
+	"qaqmall/internal/migrate"
+	"qaqmall/models"
+)
+
+// fakeLLMAnswer 假 LLM 服务固定返回的回答
+const fakeLLMAnswer = "您的购物车目前是空的"
+
+// testServer 基于内存 SQLite 构建的完整路由，供集成测试使用
+type testServer struct {
+	t      *testing.T
+	db     *gorm.DB
+	cfg    *config.Config
+	keys   *auth.KeyRing
+	engine *gin.Engine
+	// checker 就绪检查，测试可以注册额外的检查项或模拟开始关闭
+	checker *health.Checker
+	// app 管理路由注册的后台任务
+	app *lifecycle.Manager
+
+	// llmRequests 假 LLM 服务收到的请求，llmHeaders 为对应的请求头
+	llmRequests []map[string]interface{}
+	llmHeaders  []http.Header
+}
+
+// newTestServer 创建测试服务，options 可以在创建路由前修改默认的测试配置
+func newTestServer(t *testing.T, options ...func(cfg *config.Config)) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	s := &testServer{t: t}
+
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		s.llmRequests = append(s.llmRequests, req)
+		s.llmHeaders = append(s.llmHeaders, r.Header.Clone())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": fakeLLMAnswer}},
+			},
+		})
+	}))
+	t.Cleanup(llm.Close)
+
+	wx := httptest.NewServer(http.HandlerFunc(fakeWechat))
+	t.Cleanup(wx.Close)
+
+	privateKey, publicKey := newAlipayKeys(t)
+
+	cfg := config.Default()
+	cfg.Database = config.DatabaseConfig{Driver: database.DriverSQLite, DSN: ":memory:"}
+	cfg.Alipay.AppID = "2021000000000000"
+	cfg.Alipay.PrivateKey = privateKey
+	cfg.Alipay.PublicKey = publicKey
+	cfg.OpenAI.APIKey = "test-key"
+	cfg.OpenAI.APIURL = llm.URL
+	cfg.Account.CodeSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Wechat.AppID = "wx-test-app"
+	cfg.Wechat.AppSecret = "wx-test-secret"
+	cfg.Wechat.MiniAppID = "wx-test-mini"
+	cfg.Wechat.MiniAppSecret = "wx-test-mini-secret"
+	cfg.Wechat.APIBaseURL = wx.URL
+	cfg.Mail.Driver = "file"
+	cfg.Mail.Dir = t.TempDir()
+	cfg.Media.Dir = t.TempDir()
+	// 登录失败后的退避只在专门的用例中开启，避免影响其他用例中故意输错密码后的登录
+	cfg.Login.BaseDelay = 0
+	// 限流同理，只在专门的用例中开启
+	cfg.RateLimit.Enabled = false
+	for _, option := range options {
+		option(cfg)
+	}
+	s.cfg = cfg
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	s.db = db
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		t.Fatalf("加载迁移失败: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+
+	// 路由注册的后台任务由 app 管理，测试结束时停止；数据库由上面的清理函数关闭
+	app := lifecycle.New(&http.Server{}, nil, 5*time.Second, 0)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		app.Shutdown(ctx)
+	})
+	s.app = app
+
+	keys, err := auth.NewKeyRing(db, cfg.JWT)
+	if err != nil {
+		t.Fatalf("初始化JWT密钥失败: %v", err)
+	}
+	s.keys = keys
+
+	s.checker = health.New(cfg.Health.Timeout)
+	engine, err := New(app, db, cfg, keys, s.checker)
+	if err != nil {
+		t.Fatalf("创建路由失败: %v", err)
+	}
+	s.engine = engine
+	return s
+}
+
+// newAlipayKeys 生成测试用的支付宝应用私钥和支付宝公钥（不带 PEM 头的 base64）
+func newAlipayKeys(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成 RSA 密钥失败: %v", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("编码公钥失败: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key)),
+		base64.StdEncoding.EncodeToString(publicKey)
+}
+
+// do 发送请求，body 为 nil 时不带请求体，为 string 时原样发送，
+// 为 url.Values 时按表单发送，其余类型编码为 JSON
+func (s *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	var contentType string
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case url.Values:
+		reader = strings.NewReader(b.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			panic(fmt.Sprintf("编码请求体失败: %v", err))
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// registerUser 注册用户并返回用户ID
+func (s *testServer) registerUser(username, password string) uint64 {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/register", "", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("注册用户 %s 失败: %d %s", username, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			UserID uint64 `json:"user_id"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data.UserID
+}
+
+// login 登录并返回 access token
+func (s *testServer) login(username, password string) string {
+	s.t.Helper()
+	token, _ := s.loginTokens(username, password)
+	return token
+}
+
+// loginTokens 登录并返回 access token 和 refresh token
+func (s *testServer) loginTokens(username, password string) (string, string) {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/login", "", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("用户 %s 登录失败: %d %s", username, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data.Token, resp.Data.RefreshToken
+}
+
+// loginAsUser 注册并登录普通用户，返回用户ID和 token
+func (s *testServer) loginAsUser(username string) (uint64, string) {
+	s.t.Helper()
+	userID := s.registerUser(username, "password")
+	return userID, s.login(username, "password")
+}
+
+// loginAsAdmin 注册用户并提升为管理员后登录，返回用户ID和 token
+func (s *testServer) loginAsAdmin(username string) (uint64, string) {
+	s.t.Helper()
+	userID := s.registerUser(username, "password")
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("role", "admin").Error; err != nil {
+		s.t.Fatalf("设置管理员角色失败: %v", err)
+	}
+	return userID, s.login(username, "password")
+}
+
+// seedProduct 直接写入一个在售商品
+func (s *testServer) seedProduct(name string, price float64, stock int) models.Product {
+	s.t.Helper()
+	product := models.Product{Name: name, Price: price, Stock: stock, IsOnSale: true}
+	if err := s.db.Create(&product).Error; err != nil {
+		s.t.Fatalf("创建商品失败: %v", err)
+	}
+	return product
+}
+
+// seedAddress 直接为用户写入一个收货地址
+func (s *testServer) seedAddress(userID uint64) models.Address {
+	s.t.Helper()
+	address := models.Address{
+		UserID:   userID,
+		Name:     "张三",
+		Phone:    "13800000000",
+		Province: "浙江省",
+		City:     "杭州市",
+		District: "西湖区",
+		Street:   "文三路",
+		Detail:   "1号",
+	}
+	if err := s.db.Create(&address).Error; err != nil {
+		s.t.Fatalf("创建地址失败: %v", err)
+	}
+	return address
+}
+
+// seedOrder 通过接口为用户创建一个订单并返回订单ID
+func (s *testServer) seedOrder(token string, addressID, productID uint64, quantity int) uint64 {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/orders", token, map[string]interface{}{
+		"address_id": addressID,
+		"items":      []map[string]interface{}{{"product_id": productID, "quantity": quantity}},
+	})
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("创建订单失败: %d %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			OrderID uint64 `json:"order_id"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data.OrderID
+}
+
+// decode 解析 JSON 响应
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("解析响应失败: %v, body: %s", err, w.Body.String())
+	}
+}
+
+// routeCase 一条路由测试用例
+type routeCase struct {
+	name   string
+	method string
+	path   string
+	token  string
+	body   interface{}
+	want   int
+	// check 可选，对响应做进一步断言
+	check func(t *testing.T, w *httptest.ResponseRecorder)
+}
+
+// run 按顺序执行用例，后面的用例可以依赖前面用例产生的数据
+func (s *testServer) run(cases []routeCase) {
+	s.t.Helper()
+	for _, tc := range cases {
+		s.t.Run(tc.name, func(t *testing.T) {
+			w := s.do(tc.method, tc.path, tc.token, tc.body)
+			if w.Code != tc.want {
+				t.Fatalf("%s %s: 期望状态码 %d，实际 %d，body: %s", tc.method, tc.path, tc.want, w.Code, w.Body.String())
+			}
+			if tc.check != nil {
+				tc.check(t, w)
+			}
+		})
+	}
+}
+
+// idPath 拼接带ID的路径
+func idPath(format string, id uint64) string {
+	return fmt.Sprintf(format, id)
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+	"qaqmall/internal/health"
+	"qaqmall/internal/lifecycle"
+)
+
+// readyz 请求 /readyz 并解析报告
+func (s *testServer) readyz() (int, health.Report) {
+	s.t.Helper()
+	w := s.do(http.MethodGet, "/readyz", "", nil)
+	var report health.Report
+	decode(s.t, w, &report)
+	return w.Code, report
+}
+
+func TestLiveness(t *testing.T) {
+	s := newTestServer(t)
+	s.checker.Register("broken", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("依赖故障")
+	})
+
+	// 存活检查不受依赖影响
+	for _, path := range []string{"/livez", "/health"} {
+		if w := s.do(http.MethodGet, path, "", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok"`) {
+			t.Errorf("%s 期望返回 200，实际 %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Health.CheckLLM = true
+	})
+
+	code, report := s.readyz()
+	if code != http.StatusOK || !report.Ready || report.Status != health.StatusOK {
+		t.Fatalf("期望就绪，实际 %d %+v", code, report)
+	}
+	for _, name := range []string{"database", "database_pool", "casbin", "llm"} {
+		if report.Components[name].Status != health.StatusUp {
+			t.Errorf("组件 %s 期望正常，实际 %+v", name, report.Components[name])
+		}
+	}
+	if report.Components["llm"].Critical || !report.Components["database"].Critical {
+		t.Errorf("LLM 应为可选组件、数据库应为关键组件: %+v", report.Components)
+	}
+	if report.Components["casbin"].Details["policies"] == float64(0) {
+		t.Errorf("Casbin 报告缺少策略数量: %+v", report.Components["casbin"])
+	}
+
+	// 可选组件失败时降级，仍然就绪
+	s.checker.RegisterOptional("payment_gateway", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("连接超时")
+	})
+	code, report = s.readyz()
+	if code != http.StatusOK || report.Status != health.StatusDegraded || report.Components["payment_gateway"].Error != "连接超时" {
+		t.Errorf("期望降级但仍就绪，实际 %d %+v", code, report)
+	}
+
+	// 定时任务心跳：任务卡住超过 3 个执行间隔后未就绪，恢复后重新就绪
+	app := lifecycle.New(&http.Server{}, nil, time.Second, 0)
+	release := make(chan struct{})
+	app.Every("stuck-job", 20*time.Millisecond, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	s.checker.Register("jobs", app.CheckJobs)
+	time.Sleep(100 * time.Millisecond)
+	code, report = s.readyz()
+	if code != http.StatusServiceUnavailable || report.Status != health.StatusUnavailable ||
+		!strings.Contains(report.Components["jobs"].Error, "stuck-job") {
+		t.Errorf("定时任务卡住时期望未就绪，实际 %d %+v", code, report.Components["jobs"])
+	}
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if code, report = s.readyz(); code != http.StatusOK {
+		t.Errorf("定时任务恢复后期望就绪，实际 %d %+v", code, report.Components["jobs"])
+	}
+
+	// 开始关闭后立即未就绪
+	app.OnShutdown(s.checker.SetShuttingDown)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	code, report = s.readyz()
+	if code != http.StatusServiceUnavailable || !report.ShuttingDown || report.Ready {
+		t.Errorf("关闭中期望返回 503，实际 %d %+v", code, report)
+	}
+	if w := s.do(http.MethodGet, "/livez", "", nil); w.Code != http.StatusOK {
+		t.Errorf("关闭中存活检查仍应返回 200，实际 %d", w.Code)
+	}
+}
+
+func TestReadinessPoolSaturated(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Health.Timeout = 200 * time.Millisecond
+	})
+
+	// 内存 SQLite 只有一个连接，占用后连接池饱和
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		t.Fatalf("获取连接池失败: %v", err)
+	}
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("获取连接失败: %v", err)
+	}
+
+	code, report := s.readyz()
+	pool := report.Components["database_pool"]
+	if code != http.StatusServiceUnavailable || pool.Status != health.StatusDown || !strings.Contains(pool.Error, "饱和") {
+		t.Errorf("连接池饱和时期望未就绪，实际 %d %+v", code, pool)
+	}
+	if pool.Details["in_use"] != float64(1) || pool.Details["max_open"] != float64(1) {
+		t.Errorf("连接池统计不正确: %+v", pool.Details)
+	}
+
+	conn.Close()
+	if code, report := s.readyz(); code != http.StatusOK {
+		t.Errorf("释放连接后期望就绪，实际 %d %+v", code, report)
+	}
+}
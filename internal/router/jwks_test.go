@@ -0,0 +1,172 @@
+package router
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+)
+
+// fetchJWKS 获取 JWKS 并按 kid 解析出公钥，模拟其他服务验证 token 的方式
+func fetchJWKS(t *testing.T, s *testServer) map[string]interface{} {
+	t.Helper()
+	w := s.do(http.MethodGet, "/.well-known/jwks.json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("获取 JWKS 失败: %d %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+	decode(t, w, &resp)
+
+	keys := make(map[string]interface{}, len(resp.Keys))
+	for _, jwk := range resp.Keys {
+		switch jwk.Kty {
+		case "RSA":
+			n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "OKP":
+			x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+			keys[jwk.Kid] = ed25519.PublicKey(x)
+		default:
+			t.Fatalf("未知的密钥类型: %s", jwk.Kty)
+		}
+	}
+	return keys
+}
+
+// verifyWithJWKS 只使用 JWKS 中的公钥验证 token
+func verifyWithJWKS(t *testing.T, keys map[string]interface{}, tokenString string) jwt.MapClaims {
+	t.Helper()
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return keys[token.Header["kid"].(string)], nil
+	})
+	if err != nil || !token.Valid {
+		t.Fatalf("使用 JWKS 验证 token 失败: %v", err)
+	}
+	return token.Claims.(jwt.MapClaims)
+}
+
+func TestJWKS(t *testing.T) {
+	for _, algorithm := range []string{auth.AlgorithmRS256, auth.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.JWT.Algorithm = algorithm
+			})
+			_, token := s.loginAsUser("alice")
+
+			keys := fetchJWKS(t, s)
+			if len(keys) != 1 {
+				t.Fatalf("期望 1 个公钥，实际 %d", len(keys))
+			}
+			claims := verifyWithJWKS(t, keys, token)
+			if claims["username"] != "alice" || claims["iss"] != auth.Issuer {
+				t.Errorf("token claims 不符合预期: %v", claims)
+			}
+
+			s.run([]routeCase{
+				{name: "token accepted", method: http.MethodGet, path: "/user/info", token: token, want: http.StatusOK},
+			})
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		// 每次轮换任务都会生成新密钥
+		cfg.JWT.KeyRotation = time.Nanosecond
+	})
+	_, oldToken := s.loginAsUser("alice")
+
+	if err := s.keys.Rotate(context.Background()); err != nil {
+		t.Fatalf("轮换密钥失败: %v", err)
+	}
+	newToken := s.login("alice", "password")
+
+	keys := fetchJWKS(t, s)
+	if len(keys) != 2 {
+		t.Fatalf("轮换后期望 2 个公钥，实际 %d", len(keys))
+	}
+	oldKid := kidOf(t, oldToken)
+	newKid := kidOf(t, newToken)
+	if oldKid == newKid {
+		t.Fatal("轮换后应使用新的密钥签名")
+	}
+	verifyWithJWKS(t, keys, oldToken)
+	verifyWithJWKS(t, keys, newToken)
+
+	s.run([]routeCase{
+		{name: "token signed by previous key", method: http.MethodGet, path: "/user/info", token: oldToken,
+			want: http.StatusOK},
+		{name: "token signed by new key", method: http.MethodGet, path: "/user/info", token: newToken,
+			want: http.StatusOK},
+	})
+}
+
+func TestForgedTokens(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+	kid := kidOf(t, token)
+
+	claims := jwt.MapClaims{
+		"user_id":  1,
+		"username": "alice",
+		"role":     "admin",
+		"iss":      auth.Issuer,
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+
+	// 使用 HS256 并以公开的 kid 作为密钥，验证方不能接受与密钥类型不符的算法
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hs.Header["kid"] = kid
+	hsToken, err := hs.SignedString([]byte(kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unknown.Header["kid"] = "unknown"
+	unknownToken, err := unknown.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.run([]routeCase{
+		{name: "algorithm mismatch", method: http.MethodGet, path: "/user/info", token: hsToken,
+			want: http.StatusUnauthorized},
+		{name: "unknown kid", method: http.MethodGet, path: "/user/info", token: unknownToken,
+			want: http.StatusUnauthorized},
+		{name: "tampered payload", method: http.MethodGet, path: "/user/info", token: tamper(token),
+			want: http.StatusUnauthorized},
+	})
+}
+
+// kidOf 读取 token header 中的 kid
+func kidOf(t *testing.T, tokenString string) string {
+	t.Helper()
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("解析 token 失败: %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+// tamper 替换 token 的 payload 而保留原签名
+func tamper(tokenString string) string {
+	parts := strings.Split(tokenString, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":1,"username":"alice","role":"admin","iss":"qaqmall","exp":4102444800}`))
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,143 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"qaqmall/config"
+	"qaqmall/internal/logging"
+)
+
+// logBuffer 收集 JSON 格式的日志
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// accessLog 返回 request_id 对应请求的访问日志
+func (b *logBuffer) accessLog(t *testing.T, requestID string) map[string]interface{} {
+	t.Helper()
+	for _, line := range strings.Split(b.String(), "\n") {
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) != nil {
+			continue
+		}
+		if entry["msg"] == "请求完成" && entry["request_id"] == requestID {
+			return entry
+		}
+	}
+	t.Fatalf("没有找到请求 %s 的访问日志", requestID)
+	return nil
+}
+
+// captureLogs 把默认 logger 替换为写入缓冲区的 JSON logger，需要在 newTestServer 之前调用
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	logger, err := logging.New(config.LogConfig{Level: "debug", Format: "json"}, buf)
+	if err != nil {
+		t.Fatalf("创建 logger 失败: %v", err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return buf
+}
+
+func TestRequestID(t *testing.T) {
+	logs := captureLogs(t)
+	s := newTestServer(t)
+
+	send := func(requestID string) string {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, req)
+		return w.Header().Get("X-Request-ID")
+	}
+
+	// 没有时生成
+	generated := send("")
+	if len(generated) != 36 {
+		t.Fatalf("期望生成 UUID 格式的请求ID，实际 %q", generated)
+	}
+	if entry := logs.accessLog(t, generated); entry["route"] != "/health" || entry["status"] != float64(http.StatusOK) {
+		t.Errorf("访问日志缺少 route 或 status: %v", entry)
+	}
+
+	// 调用方传入时沿用
+	if got := send("gateway-42.a:b"); got != "gateway-42.a:b" {
+		t.Errorf("期望沿用请求ID，实际 %q", got)
+	}
+
+	// 格式不合法时重新生成
+	if got := send(`bad id"}`); got == `bad id"}` || len(got) != 36 {
+		t.Errorf("期望重新生成请求ID，实际 %q", got)
+	}
+	if got := send(strings.Repeat("a", 129)); len(got) != 36 {
+		t.Errorf("过长的请求ID应重新生成，实际 %q", got)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+	s := newTestServer(t)
+	aliceID, aliceToken := s.loginAsUser("alice")
+
+	w := s.do(http.MethodGet, "/user/info", aliceToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("获取用户信息失败: %d", w.Code)
+	}
+	entry := logs.accessLog(t, w.Header().Get("X-Request-ID"))
+	if entry["user_id"] != float64(aliceID) || entry["route"] != "/user/info" || entry["method"] != http.MethodGet {
+		t.Errorf("访问日志缺少 user_id、route 或 method: %v", entry)
+	}
+	if _, ok := entry["latency_ms"].(float64); !ok {
+		t.Errorf("访问日志缺少 latency_ms: %v", entry)
+	}
+
+	// 查询参数中的敏感字段脱敏
+	w = s.do(http.MethodGet, "/products?page=1&token=secret-value&phone=13812348000&remark=call+13912345678", "", nil)
+	entry = logs.accessLog(t, w.Header().Get("X-Request-ID"))
+	query, _ := entry["query"].(map[string]interface{})
+	want := map[string]interface{}{"page": "1", "token": "[REDACTED]", "phone": "138****8000", "remark": "call 139****5678"}
+	for key, value := range want {
+		if query[key] != value {
+			t.Errorf("query.%s 期望 %v，实际 %v", key, value, query[key])
+		}
+	}
+
+	// 未匹配的路由同样记录
+	w = s.do(http.MethodGet, "/no-such-route", "", nil)
+	if entry := logs.accessLog(t, w.Header().Get("X-Request-ID")); entry["route"] != "unmatched" || entry["level"] != "WARN" {
+		t.Errorf("未匹配路由的访问日志不正确: %v", entry)
+	}
+
+	// 令牌和手机号不会出现在日志中
+	output := logs.String()
+	for _, secret := range []string{aliceToken, "secret-value", "13812348000", "13912345678"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("日志中出现了敏感信息 %q", secret)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+// loginBody 登录请求体
+func loginBody(username, password string) map[string]string {
+	return map[string]string{"username": username, "password": password}
+}
+
+// systemLogs 返回指定动作的系统日志
+func (s *testServer) systemLogs(action string) []models.SystemLog {
+	s.t.Helper()
+	var logs []models.SystemLog
+	if err := s.db.Where("action = ?", action).Order("id").Find(&logs).Error; err != nil {
+		s.t.Fatalf("查询系统日志失败: %v", err)
+	}
+	return logs
+}
+
+func TestLoginFailureIsUniform(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+
+	unknown := s.do(http.MethodPost, "/login", "", loginBody("nobody", "password"))
+	wrong := s.do(http.MethodPost, "/login", "", loginBody("alice", "wrong"))
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("期望都返回 401，实际 %d、%d", unknown.Code, wrong.Code)
+	}
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Fatalf("用户不存在和密码错误的响应不同: %s / %s", unknown.Body.String(), wrong.Body.String())
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 3
+	})
+	aliceID := s.registerUser("alice", "password")
+	_, adminToken := s.loginAsAdmin("manager")
+	_, userToken := s.loginAsUser("bob")
+
+	s.run([]routeCase{
+		{name: "fail 1", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "fail 2", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "success resets counter", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusOK},
+		{name: "fail 1 again", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "fail 2 again", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "fail 3 locks", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "correct password rejected while locked", method: http.MethodPost, path: "/login",
+			body: loginBody("alice", "password"), want: http.StatusTooManyRequests,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+				if err != nil || retryAfter <= 0 || retryAfter > int((15*time.Minute).Seconds()) {
+					t.Errorf("Retry-After 不正确: %q", w.Header().Get("Retry-After"))
+				}
+			}},
+		{name: "other users unaffected", method: http.MethodPost, path: "/login", body: loginBody("bob", "password"), want: http.StatusOK},
+		{name: "unknown username locked too", method: http.MethodPost, path: "/login", body: loginBody("nobody", "x"), want: http.StatusUnauthorized},
+		{name: "unknown username fail 2", method: http.MethodPost, path: "/login", body: loginBody("nobody", "x"), want: http.StatusUnauthorized},
+		{name: "unknown username fail 3", method: http.MethodPost, path: "/login", body: loginBody("nobody", "x"), want: http.StatusUnauthorized},
+		{name: "unknown username locked", method: http.MethodPost, path: "/login", body: loginBody("nobody", "x"), want: http.StatusTooManyRequests},
+		{name: "list locks requires admin", method: http.MethodGet, path: "/admin/login-locks", token: userToken, want: http.StatusForbidden},
+		{name: "list locks", method: http.MethodGet, path: "/admin/login-locks", token: adminToken, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Items []models.LoginFailure `json:"items"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Data.Items) != 2 {
+					t.Errorf("期望 2 个锁定，实际 %d", len(resp.Data.Items))
+				}
+			}},
+		{name: "unlock requires exactly one target", method: http.MethodPost, path: "/admin/login-locks/unlock", token: adminToken,
+			body: map[string]string{"username": "alice", "ip": "192.0.2.1"}, want: http.StatusBadRequest},
+		{name: "unlock unknown", method: http.MethodPost, path: "/admin/login-locks/unlock", token: adminToken,
+			body: map[string]string{"username": "carol"}, want: http.StatusNotFound},
+		{name: "unlock", method: http.MethodPost, path: "/admin/login-locks/unlock", token: adminToken,
+			body: map[string]string{"username": "alice"}, want: http.StatusOK},
+		{name: "login after unlock", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusOK},
+	})
+
+	locked := s.systemLogs("login_locked")
+	if len(locked) != 2 {
+		t.Fatalf("期望 2 条锁定日志，实际 %d", len(locked))
+	}
+	if locked[0].UserID == nil || *locked[0].UserID != aliceID || locked[0].IPAddress == "" {
+		t.Errorf("锁定日志应记录用户和 IP: %+v", locked[0])
+	}
+	if locked[1].UserID != nil {
+		t.Errorf("不存在的用户名的锁定日志不应关联用户: %+v", locked[1])
+	}
+	if unlocked := s.systemLogs("login_unlocked"); len(unlocked) != 1 {
+		t.Errorf("期望 1 条解锁日志，实际 %d", len(unlocked))
+	}
+
+	// 锁定到期后自动解除
+	s.run([]routeCase{
+		{name: "relock 1", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "relock 2", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "relock 3", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "relocked", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusTooManyRequests},
+	})
+	s.db.Model(&models.LoginFailure{}).Where("kind = ? AND value = ?", "username", "alice").
+		Update("locked_until", time.Now().Add(-time.Second))
+	s.run([]routeCase{
+		{name: "login after lock expired", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusOK},
+	})
+}
+
+func TestConcurrentLoginFailures(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 3
+	})
+	s.registerUser("alice", "password")
+
+	// 并发的错误密码最多校验 MaxFailures 次，其余直接拒绝
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := s.do(http.MethodPost, "/login", "", loginBody("alice", "wrong"))
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if codes[http.StatusUnauthorized] != 3 || codes[http.StatusTooManyRequests] != 17 {
+		t.Fatalf("期望 3 次 401、17 次 429，实际 %v", codes)
+	}
+
+	var record models.LoginFailure
+	s.db.Where("kind = ? AND value = ?", "username", "alice").First(&record)
+	if record.Failures != 3 || record.LockedUntil == nil {
+		t.Fatalf("期望失败 3 次并锁定，实际 %+v", record)
+	}
+	if locked := s.systemLogs("login_locked"); len(locked) != 1 {
+		t.Fatalf("期望 1 条锁定日志，实际 %d", len(locked))
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.BaseDelay = time.Minute
+	})
+	s.registerUser("alice", "password")
+
+	s.run([]routeCase{
+		{name: "fail", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "retry too soon", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"),
+			want: http.StatusTooManyRequests,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After")); retryAfter <= 0 || retryAfter > 60 {
+					t.Errorf("第 1 次失败后应等待不超过 60 秒，Retry-After: %q", w.Header().Get("Retry-After"))
+				}
+			}},
+	})
+
+	// 等待期过后再次失败，等待时间翻倍
+	s.db.Model(&models.LoginFailure{}).Where("kind = ? AND value = ?", "username", "alice").
+		Update("last_failed_at", time.Now().Add(-2*time.Minute))
+	s.run([]routeCase{
+		{name: "fail again", method: http.MethodPost, path: "/login", body: loginBody("alice", "wrong"), want: http.StatusUnauthorized},
+		{name: "delay doubled", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"),
+			want: http.StatusTooManyRequests,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After")); retryAfter <= 60 || retryAfter > 120 {
+					t.Errorf("第 2 次失败后应等待 60~120 秒，Retry-After: %q", w.Header().Get("Retry-After"))
+				}
+			}},
+	})
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 10
+		cfg.Login.IPMaxFailures = 3
+	})
+	s.registerUser("alice", "password")
+	_, adminToken := s.loginAsAdmin("manager")
+
+	s.run([]routeCase{
+		{name: "fail user 1", method: http.MethodPost, path: "/login", body: loginBody("u1", "x"), want: http.StatusUnauthorized},
+		{name: "fail user 2", method: http.MethodPost, path: "/login", body: loginBody("u2", "x"), want: http.StatusUnauthorized},
+		{name: "fail user 3", method: http.MethodPost, path: "/login", body: loginBody("u3", "x"), want: http.StatusUnauthorized},
+		{name: "ip locked", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusTooManyRequests},
+		{name: "unlock ip", method: http.MethodPost, path: "/admin/login-locks/unlock", token: adminToken,
+			body: map[string]string{"ip": "192.0.2.1"}, want: http.StatusOK},
+		{name: "login after ip unlock", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusOK},
+	})
+}
@@ -0,0 +1,291 @@
+package router
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pay/gopay"
+	wechatv2 "github.com/go-pay/gopay/wechat"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"qaqmall/config"
+	"qaqmall/internal/metrics"
+	"qaqmall/jobs"
+	"qaqmall/models"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t)
+	aliceID, aliceToken := s.loginAsUser("alice")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(aliceID)
+
+	// 指标是进程内全局的，按执行前后的差值断言
+	created := testutil.ToFloat64(metrics.OrdersCreated)
+	cancelled := testutil.ToFloat64(metrics.OrdersCancelled)
+	expired := testutil.ToFloat64(metrics.OrdersExpired)
+	aiQueries := metricValue(scrape(t, s, ""), "qaqmall_ai_query_duration_seconds_count")
+
+	cancelID := s.seedOrder(aliceToken, address.ID, product.ID, 1)
+	expiredID := s.seedOrder(aliceToken, address.ID, product.ID, 1)
+	s.run([]routeCase{
+		{name: "cancel order", method: http.MethodPost, path: idPath("/orders/%d/cancel", cancelID), token: aliceToken, want: http.StatusOK},
+		{name: "ai query", method: http.MethodPost, path: "/ai/query", token: aliceToken, body: map[string]string{"query": "购物车"}, want: http.StatusOK},
+	})
+
+	// 过期订单由定时任务取消
+	s.db.Model(&models.Order{}).Where("id = ?", expiredID).Update("expired_at", time.Now().Add(-time.Minute))
+	if err := jobs.NewOrderJobs(s.db).CancelExpiredOrders(context.Background()); err != nil {
+		t.Fatalf("取消过期订单失败: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.OrdersCreated) - created; got != 2 {
+		t.Errorf("期望新增 2 个订单，实际 %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.OrdersCancelled) - cancelled; got != 1 {
+		t.Errorf("期望取消 1 个订单，实际 %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.OrdersExpired) - expired; got != 1 {
+		t.Errorf("期望 1 个订单过期，实际 %v", got)
+	}
+
+	body := scrape(t, s, "")
+	if got := metricValue(body, "qaqmall_ai_query_duration_seconds_count") - aiQueries; got != 1 {
+		t.Errorf("期望记录 1 次 AI 查询耗时，实际 %v", got)
+	}
+	for _, want := range []string{
+		`qaqmall_http_requests_total{method="POST",route="/orders/:id/cancel",status="200"}`,
+		`qaqmall_http_request_duration_seconds_bucket{method="GET",route="/user/info"`,
+		`qaqmall_db_query_duration_seconds_count{operation="query",status="success",table="orders"}`,
+		`qaqmall_db_query_duration_seconds_count{operation="update",status="success",table="products"}`,
+		`qaqmall_orders_created_total`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("指标中缺少 %s", want)
+		}
+	}
+}
+
+func TestPaymentMetricsIgnoreRepeatedNotify(t *testing.T) {
+	s := newTestServer(t)
+	userID, token := s.loginAsUser("alice")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(userID)
+	orderID := s.seedOrder(token, address.ID, product.ID, 1)
+	s.run([]routeCase{
+		{name: "charge with alipay", method: http.MethodPost, path: "/payments", token: token,
+			body: map[string]interface{}{"order_id": orderID, "user_id": userID, "amount": 199,
+				"payment_method": string(models.PaymentMethodAlipay)},
+			want: http.StatusOK},
+	})
+	var payment models.Payment
+	if err := s.db.Where("order_id = ?", orderID).First(&payment).Error; err != nil {
+		t.Fatalf("查询支付记录失败: %v", err)
+	}
+
+	paid := testutil.ToFloat64(metrics.Payments.WithLabelValues(string(models.PaymentMethodAlipay), string(models.PaymentStatusPaid)))
+	notify := s.signAlipayNotify(url.Values{
+		"out_trade_no": {payment.PaymentNumber},
+		"trade_no":     {"2024000000000001"},
+		"trade_status": {"TRADE_SUCCESS"},
+	})
+	// 支付宝在没有收到 success 时会重复通知，同时到达的重复通知也只计数一次
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := s.do(http.MethodPost, "/payments/callback", "", notify); w.Code != http.StatusOK {
+				t.Errorf("支付通知期望 200，实际 %d %s", w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if got := testutil.ToFloat64(metrics.Payments.WithLabelValues(string(models.PaymentMethodAlipay), string(models.PaymentStatusPaid))) - paid; got != 1 {
+		t.Errorf("期望记录 1 笔支付成功，实际 %v", got)
+	}
+	// 发起支付和支付成功各一条
+	if logs := s.systemLogs("payment_status_changed"); len(logs) != 2 {
+		t.Errorf("期望 2 条支付状态审计日志，实际 %d", len(logs))
+	}
+}
+
+func TestAlipayNotifyKeepsCancelledPayment(t *testing.T) {
+	s := newTestServer(t)
+	userID, token := s.loginAsUser("alice")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(userID)
+	orderID := s.seedOrder(token, address.ID, product.ID, 1)
+	s.run([]routeCase{
+		{name: "charge with alipay", method: http.MethodPost, path: "/payments", token: token,
+			body: map[string]interface{}{"order_id": orderID, "user_id": userID, "amount": 199,
+				"payment_method": string(models.PaymentMethodAlipay)},
+			want: http.StatusOK},
+	})
+	var payment models.Payment
+	s.db.Where("order_id = ?", orderID).First(&payment)
+	s.db.Model(&payment).Update("status", models.PaymentStatusCancelled)
+
+	// 已被定时任务取消的支付收到迟到的通知时不改回已支付
+	notify := s.signAlipayNotify(url.Values{
+		"out_trade_no": {payment.PaymentNumber},
+		"trade_no":     {"2024000000000002"},
+		"trade_status": {"TRADE_SUCCESS"},
+	})
+	s.run([]routeCase{
+		{name: "late notify", method: http.MethodPost, path: "/payments/callback", body: notify, want: http.StatusOK},
+	})
+	s.db.First(&payment, payment.ID)
+	if payment.Status != models.PaymentStatusCancelled || payment.PaidAt != nil {
+		t.Fatalf("已取消的支付不应改为已支付，实际状态 %s，支付时间 %v", payment.Status, payment.PaidAt)
+	}
+}
+
+// wxPayNotify 生成用 apiKey 签名的微信支付结果通知
+func wxPayNotify(apiKey string, fields map[string]string) string {
+	bm := make(gopay.BodyMap)
+	for key, value := range fields {
+		bm.Set(key, value)
+	}
+	bm.Set("sign", wechatv2.GetReleaseSign(apiKey, wechatv2.SignType_MD5, bm))
+	var b strings.Builder
+	b.WriteString("<xml>")
+	for key := range bm {
+		b.WriteString("<" + key + "><![CDATA[" + bm.GetString(key) + "]]></" + key + ">")
+	}
+	b.WriteString("</xml>")
+	return b.String()
+}
+
+func TestWxPayNotify(t *testing.T) {
+	const apiKey = "wx-test-api-key-0123456789abcdef"
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Wechat.APIKey = apiKey
+	})
+	userID, token := s.loginAsUser("alice")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(userID)
+	orderID := s.seedOrder(token, address.ID, product.ID, 1)
+	payment := models.Payment{PaymentNumber: "wx-payment-1", OrderID: orderID, UserID: userID, Amount: 199,
+		PaymentMethod: models.PaymentMethodWechat, Status: models.PaymentStatusPending}
+	if err := s.db.Create(&payment).Error; err != nil {
+		t.Fatalf("创建支付记录失败: %v", err)
+	}
+
+	notify := func(key, totalFee string) string {
+		return wxPayNotify(key, map[string]string{
+			"return_code": "SUCCESS", "result_code": "SUCCESS", "out_trade_no": payment.PaymentNumber,
+			"transaction_id": "4200000000000001", "total_fee": totalFee,
+		})
+	}
+	expectReturnCode := func(code string) func(t *testing.T, w *httptest.ResponseRecorder) {
+		return func(t *testing.T, w *httptest.ResponseRecorder) {
+			if !strings.Contains(w.Body.String(), "<return_code><![CDATA["+code+"]]>") {
+				t.Errorf("期望返回 %s，实际 %s", code, w.Body.String())
+			}
+		}
+	}
+	status := func() models.PaymentStatus {
+		var current models.Payment
+		s.db.First(&current, payment.ID)
+		return current.Status
+	}
+
+	s.run([]routeCase{
+		{name: "forged signature", method: http.MethodPost, path: "/payments/wechat/callback", body: notify("forged-key", "19900"),
+			want: http.StatusOK, check: expectReturnCode("FAIL")},
+		{name: "amount mismatch", method: http.MethodPost, path: "/payments/wechat/callback", body: notify(apiKey, "1"),
+			want: http.StatusOK, check: expectReturnCode("FAIL")},
+	})
+	if got := status(); got != models.PaymentStatusPending {
+		t.Fatalf("签名或金额不正确的通知不应修改支付状态，实际 %s", got)
+	}
+
+	s.run([]routeCase{
+		{name: "paid", method: http.MethodPost, path: "/payments/wechat/callback", body: notify(apiKey, "19900"),
+			want: http.StatusOK, check: expectReturnCode("SUCCESS")},
+		{name: "repeated notify", method: http.MethodPost, path: "/payments/wechat/callback", body: notify(apiKey, "19900"),
+			want: http.StatusOK, check: expectReturnCode("SUCCESS")},
+	})
+	if got := status(); got != models.PaymentStatusPaid {
+		t.Fatalf("期望支付状态为 paid，实际 %s", got)
+	}
+	logs := s.systemLogs("payment_status_changed")
+	if len(logs) != 1 || !strings.Contains(logs[0].Description, "4200000000000001") {
+		t.Fatalf("期望 1 条微信支付成功的审计日志，实际 %+v", logs)
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Metrics.Token = "scrape-token"
+	})
+
+	s.run([]routeCase{
+		{name: "missing token", method: http.MethodGet, path: "/metrics", want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/metrics", token: "wrong", want: http.StatusUnauthorized},
+		{name: "valid token", method: http.MethodGet, path: "/metrics", token: "scrape-token", want: http.StatusOK},
+	})
+}
+
+// scrape 抓取 /metrics 的内容
+func scrape(t *testing.T, s *testServer, token string) string {
+	t.Helper()
+	w := s.do(http.MethodGet, "/metrics", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("抓取指标失败: %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+// metricValue 返回抓取内容中 series 的值，没有时返回 0
+func metricValue(body, series string) float64 {
+	for _, line := range strings.Split(body, "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, _ := strconv.ParseFloat(value, 64)
+			return v
+		}
+	}
+	return 0
+}
+
+// signAlipayNotify 用测试的应用私钥给支付宝通知签名，测试中支付宝公钥与应用私钥是同一对密钥
+func (s *testServer) signAlipayNotify(values url.Values) url.Values {
+	s.t.Helper()
+	der, err := base64.StdEncoding.DecodeString(s.cfg.Alipay.PrivateKey)
+	if err != nil {
+		s.t.Fatalf("解码私钥失败: %v", err)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		s.t.Fatalf("解析私钥失败: %v", err)
+	}
+	pairs := make([]string, 0, len(values))
+	for k := range values {
+		pairs = append(pairs, k+"="+values.Get(k))
+	}
+	sort.Strings(pairs)
+	digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	sign, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		s.t.Fatalf("签名失败: %v", err)
+	}
+	values.Set("sign_type", "RSA2")
+	values.Set("sign", base64.StdEncoding.EncodeToString(sign))
+	return values
+}
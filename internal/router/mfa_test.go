@@ -0,0 +1,352 @@
+package router
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/models"
+)
+
+// enableMFA 为已登录用户开启两步验证，返回 TOTP 密钥和恢复码
+func (s *testServer) enableMFA(token string) (string, []string) {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/user/mfa/totp", token, nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("生成 TOTP 密钥失败: %d %s", w.Code, w.Body.String())
+	}
+	var enroll struct {
+		Data struct {
+			Secret string `json:"secret"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &enroll)
+
+	w = s.do(http.MethodPost, "/user/mfa/totp/confirm", token, map[string]string{"code": totpCode(s.t, enroll.Data.Secret, 0)})
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("开启两步验证失败: %d %s", w.Code, w.Body.String())
+	}
+	var confirm struct {
+		Data struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &confirm)
+	return enroll.Data.Secret, confirm.Data.RecoveryCodes
+}
+
+// mfaChallenge 密码登录，返回两步登录的 mfa_token
+func (s *testServer) mfaChallenge(username, password string) string {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/login", "", loginBody(username, password))
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("用户 %s 登录失败: %d %s", username, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+			Token       string `json:"token"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	if !resp.Data.MFARequired || resp.Data.MFAToken == "" || resp.Data.Token != "" {
+		s.t.Fatalf("开启两步验证后密码登录不应直接签发 token: %s", w.Body.String())
+	}
+	return resp.Data.MFAToken
+}
+
+// resetTOTPStep 清除已使用的时间步，使当前时间的动态码可以再次使用
+func (s *testServer) resetTOTPStep(userID uint64) {
+	s.t.Helper()
+	if err := s.db.Model(&models.UserTOTP{}).Where("user_id = ?", userID).Update("last_step", 0).Error; err != nil {
+		s.t.Fatalf("重置 TOTP 时间步失败: %v", err)
+	}
+}
+
+// totpCode 计算当前时间偏移 offset 个时间步的动态码
+func totpCode(t *testing.T, secret string, offset int) string {
+	t.Helper()
+	code, err := auth.TOTPCode(secret, time.Now().Add(time.Duration(offset)*30*time.Second))
+	if err != nil {
+		t.Fatalf("计算动态码失败: %v", err)
+	}
+	return code
+}
+
+// tokenAMR 读取 access token 中的 amr，不校验签名
+func tokenAMR(t *testing.T, token string) []string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token 格式错误: %q", token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("解码 token 失败: %v", err)
+	}
+	var claims struct {
+		AMR []string `json:"amr"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("解析 token 失败: %v", err)
+	}
+	return claims.AMR
+}
+
+func mfaLoginBody(mfaToken, code string) map[string]string {
+	return map[string]string{"mfa_token": mfaToken, "code": code}
+}
+
+func expectMFAStatus(enabled bool, remaining int, verified bool) func(t *testing.T, w *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		var resp struct {
+			Data struct {
+				Enabled   bool `json:"enabled"`
+				Remaining int  `json:"recovery_codes_remaining"`
+				Verified  bool `json:"session_verified"`
+			} `json:"data"`
+		}
+		decode(t, w, &resp)
+		if resp.Data.Enabled != enabled || resp.Data.Remaining != remaining || resp.Data.Verified != verified {
+			t.Errorf("期望 enabled=%v remaining=%d verified=%v，实际 %+v", enabled, remaining, verified, resp.Data)
+		}
+	}
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+
+	var secret string
+	s.run([]routeCase{
+		{name: "status disabled", method: http.MethodGet, path: "/user/mfa", token: token, want: http.StatusOK,
+			check: expectMFAStatus(false, 0, false)},
+		{name: "confirm before enroll", method: http.MethodPost, path: "/user/mfa/totp/confirm", token: token,
+			body: map[string]string{"code": "123456"}, want: http.StatusBadRequest},
+		{name: "enroll", method: http.MethodPost, path: "/user/mfa/totp", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Secret     string `json:"secret"`
+						OTPAuthURI string `json:"otpauth_uri"`
+						QRCode     string `json:"qr_code"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				secret = resp.Data.Secret
+				if secret == "" || !strings.HasPrefix(resp.Data.OTPAuthURI, "otpauth://totp/qaqmall:alice?") ||
+					!strings.Contains(resp.Data.OTPAuthURI, "secret="+secret) {
+					t.Errorf("otpauth 地址不正确: %+v", resp.Data)
+				}
+				if !strings.HasPrefix(resp.Data.QRCode, "data:image/png;base64,") {
+					t.Errorf("二维码应为 PNG data URI: %.40s", resp.Data.QRCode)
+				}
+			}},
+		{name: "not enabled before confirm", method: http.MethodGet, path: "/user/mfa", token: token, want: http.StatusOK,
+			check: expectMFAStatus(false, 0, false)},
+	})
+
+	s.run([]routeCase{
+		{name: "confirm wrong code", method: http.MethodPost, path: "/user/mfa/totp/confirm", token: token,
+			body: map[string]string{"code": "000000"}, want: http.StatusBadRequest},
+		{name: "confirm", method: http.MethodPost, path: "/user/mfa/totp/confirm", token: token,
+			body: map[string]string{"code": totpCode(t, secret, 0)}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						RecoveryCodes []string `json:"recovery_codes"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Data.RecoveryCodes) != 10 {
+					t.Errorf("期望 10 个恢复码，实际 %d", len(resp.Data.RecoveryCodes))
+				}
+			}},
+		{name: "current session verified", method: http.MethodGet, path: "/user/mfa", token: token, want: http.StatusOK,
+			check: expectMFAStatus(true, 10, true)},
+		{name: "enroll again conflicts", method: http.MethodPost, path: "/user/mfa/totp", token: token, want: http.StatusConflict},
+	})
+
+	var secretInDB models.UserTOTP
+	s.db.First(&secretInDB)
+	if secretInDB.ConfirmedAt == nil || secretInDB.Secret != secret {
+		t.Fatalf("密钥未正确保存: %+v", secretInDB)
+	}
+}
+
+func TestMFALogin(t *testing.T) {
+	s := newTestServer(t)
+	aliceID, token := s.loginAsUser("alice")
+	secret, recoveryCodes := s.enableMFA(token)
+	usedCode := totpCode(t, secret, 0)
+
+	mfaToken := s.mfaChallenge("alice", "password")
+	var mfaAccessToken string
+	s.run([]routeCase{
+		{name: "replayed code rejected", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, usedCode), want: http.StatusUnauthorized},
+		{name: "invalid mfa token", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken+"x", totpCode(t, secret, 1)), want: http.StatusUnauthorized},
+		{name: "next code accepted", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, totpCode(t, secret, 1)), want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Token string `json:"token"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				mfaAccessToken = resp.Data.Token
+			}},
+		{name: "same code not reusable", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, totpCode(t, secret, 1)), want: http.StatusUnauthorized},
+	})
+	s.run([]routeCase{
+		{name: "session verified", method: http.MethodGet, path: "/user/mfa", token: mfaAccessToken, want: http.StatusOK,
+			check: expectMFAStatus(true, 10, true)},
+		{name: "recovery code", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, strings.ToUpper(recoveryCodes[0])), want: http.StatusOK},
+		{name: "recovery code is single use", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, recoveryCodes[0]), want: http.StatusUnauthorized},
+		{name: "recovery code consumed", method: http.MethodGet, path: "/user/mfa", token: mfaAccessToken, want: http.StatusOK,
+			check: expectMFAStatus(true, 9, true)},
+	})
+
+	// 重新生成恢复码后原有恢复码失效
+	s.resetTOTPStep(aliceID)
+	var newCodes []string
+	s.run([]routeCase{
+		{name: "regenerate requires code", method: http.MethodPost, path: "/user/mfa/recovery-codes", token: mfaAccessToken,
+			body: map[string]string{"code": "000000"}, want: http.StatusBadRequest},
+		{name: "regenerate", method: http.MethodPost, path: "/user/mfa/recovery-codes", token: mfaAccessToken,
+			body: map[string]string{"code": totpCode(t, secret, 0)}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						RecoveryCodes []string `json:"recovery_codes"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				newCodes = resp.Data.RecoveryCodes
+			}},
+		{name: "old recovery code invalid", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, recoveryCodes[1]), want: http.StatusUnauthorized},
+	})
+	s.run([]routeCase{
+		{name: "new recovery code valid", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, newCodes[0]), want: http.StatusOK},
+	})
+
+	// 关闭两步验证后恢复为只需要密码
+	s.resetTOTPStep(aliceID)
+	s.run([]routeCase{
+		{name: "disable wrong password", method: http.MethodDelete, path: "/user/mfa/totp", token: mfaAccessToken,
+			body: map[string]string{"password": "wrong", "code": totpCode(t, secret, 0)}, want: http.StatusBadRequest},
+		{name: "disable", method: http.MethodDelete, path: "/user/mfa/totp", token: mfaAccessToken,
+			body: map[string]string{"password": "password", "code": totpCode(t, secret, 0)}, want: http.StatusOK},
+		{name: "mfa token useless after disable", method: http.MethodPost, path: "/login/mfa",
+			body: mfaLoginBody(mfaToken, newCodes[1]), want: http.StatusUnauthorized},
+	})
+	if token := s.login("alice", "password"); token == "" {
+		t.Fatal("关闭两步验证后应直接签发 token")
+	}
+}
+
+func TestMFAFailuresCountTowardsLockout(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 3
+	})
+	_, token := s.loginAsUser("alice")
+	secret, _ := s.enableMFA(token)
+
+	mfaToken := s.mfaChallenge("alice", "password")
+	s.run([]routeCase{
+		{name: "wrong code 1", method: http.MethodPost, path: "/login/mfa", body: mfaLoginBody(mfaToken, "000000"), want: http.StatusUnauthorized},
+		{name: "password again does not reset", method: http.MethodPost, path: "/login", body: loginBody("alice", "password"), want: http.StatusOK},
+		{name: "wrong code 2", method: http.MethodPost, path: "/login/mfa", body: mfaLoginBody(mfaToken, "000000"), want: http.StatusUnauthorized},
+		{name: "wrong code 3", method: http.MethodPost, path: "/login/mfa", body: mfaLoginBody(mfaToken, "000000"), want: http.StatusUnauthorized},
+		{name: "locked", method: http.MethodPost, path: "/login/mfa", body: mfaLoginBody(mfaToken, totpCode(t, secret, 1)), want: http.StatusTooManyRequests},
+	})
+}
+
+// 是否需要两步验证由权限策略决定：能访问管理接口的任何角色都需要，其他角色不需要
+func TestPrivilegedRoleRequiresMFA(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.MFA.RequireForAdmin = true
+	})
+	_, adminToken := s.loginAsAdmin("manager")
+	s.enableMFA(adminToken)
+	aliceID, aliceToken := s.loginAsUser("alice")
+	opsID, opsToken := s.loginAsUser("olivia")
+	supportID, supportToken := s.loginAsUser("carol")
+	orderID := s.seedOrder(aliceToken, s.seedAddress(aliceID).ID, s.seedProduct("键盘", 199, 10).ID, 1)
+
+	s.run([]routeCase{
+		{name: "grant ops admin path", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("ops", "/admin/login-locks", "GET"), want: http.StatusCreated},
+		{name: "grant ops orders", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("ops", "/orders*", "GET"), want: http.StatusCreated},
+		{name: "assign ops", method: http.MethodPut, path: idPath("/admin/roles/ops/users/%d", opsID), token: adminToken, want: http.StatusOK},
+		{name: "assign support", method: http.MethodPut, path: idPath("/admin/roles/support/users/%d", supportID), token: adminToken, want: http.StatusOK},
+
+		{name: "ops admin path without mfa", method: http.MethodGet, path: "/admin/login-locks", token: opsToken, want: http.StatusForbidden},
+		{name: "ops other user's order without mfa", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: opsToken, want: http.StatusNotFound},
+		{name: "support needs no mfa", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: supportToken, want: http.StatusOK},
+	})
+	s.enableMFA(opsToken)
+	s.run([]routeCase{
+		{name: "ops admin path with mfa", method: http.MethodGet, path: "/admin/login-locks", token: opsToken, want: http.StatusOK},
+		{name: "ops other user's order with mfa", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: opsToken, want: http.StatusOK},
+	})
+}
+
+func TestAdminRequiresMFA(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.MFA.RequireForAdmin = true
+	})
+	_, token := s.loginAsAdmin("manager")
+
+	s.run([]routeCase{
+		{name: "admin without mfa rejected", method: http.MethodGet, path: "/admin/login-locks", token: token, want: http.StatusForbidden},
+	})
+	secret, _ := s.enableMFA(token)
+	s.run([]routeCase{
+		{name: "allowed after enabling in this session", method: http.MethodGet, path: "/admin/login-locks", token: token, want: http.StatusOK},
+	})
+
+	// 新的登录必须通过两步验证，刷新 token 后仍保持两步验证状态
+	w := s.do(http.MethodPost, "/login/mfa", "", mfaLoginBody(s.mfaChallenge("manager", "password"), totpCode(t, secret, 1)))
+	var resp struct {
+		Data struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+	decode(t, w, &resp)
+	if amr := tokenAMR(t, resp.Data.Token); strings.Join(amr, ",") != "pwd,otp" {
+		t.Fatalf("两步登录签发的 token amr 应为 pwd,otp，实际 %v", amr)
+	}
+	s.run([]routeCase{
+		{name: "mfa login allowed", method: http.MethodGet, path: "/admin/login-locks", token: resp.Data.Token, want: http.StatusOK},
+		{name: "refresh keeps mfa", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": resp.Data.RefreshToken}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var refreshed struct {
+					Data struct {
+						Token string `json:"token"`
+					} `json:"data"`
+				}
+				decode(t, w, &refreshed)
+				if got := s.do(http.MethodGet, "/admin/login-locks", refreshed.Data.Token, nil); got.Code != http.StatusOK {
+					t.Errorf("刷新后的 token 应保持两步验证状态: %d", got.Code)
+				}
+			}},
+	})
+}
@@ -0,0 +1,117 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"qaqmall/config"
+	"qaqmall/internal/database"
+	"qaqmall/internal/migrate"
+	"qaqmall/models"
+)
+
+func TestOwnership(t *testing.T) {
+	s := newTestServer(t)
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, bobToken := s.loginAsUser("bob")
+	_, adminToken := s.loginAsAdmin("manager")
+	supportID, supportToken := s.loginAsUser("carol")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(aliceID)
+	orderID := s.seedOrder(aliceToken, address.ID, product.ID, 1)
+
+	s.run([]routeCase{
+		{name: "assign support", method: http.MethodPut, path: idPath("/admin/roles/support/users/%d", supportID), token: adminToken, want: http.StatusOK},
+
+		// 其他用户的资源与不存在的资源返回相同的结果
+		{name: "other user's order", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: bobToken, want: http.StatusNotFound},
+		{name: "invalid id", method: http.MethodGet, path: "/orders/abc", token: bobToken, want: http.StatusBadRequest},
+
+		// 客服可以查看任意订单，但不能修改
+		{name: "support views order", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: supportToken, want: http.StatusOK},
+		{name: "support cannot cancel", method: http.MethodPost, path: idPath("/orders/%d/cancel", orderID), token: supportToken, want: http.StatusNotFound},
+		{name: "support cannot edit address", method: http.MethodPut, path: idPath("/addresses/%d", address.ID), token: supportToken,
+			body: map[string]interface{}{"name": "客服"}, want: http.StatusNotFound},
+
+		// 管理员可以查看和处理任意用户的资源
+		{name: "admin views order", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: adminToken, want: http.StatusOK},
+		{name: "admin edits address", method: http.MethodPut, path: idPath("/addresses/%d", address.ID), token: adminToken,
+			body: map[string]interface{}{"name": "张三"}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var updated models.Address
+				if err := s.db.First(&updated, address.ID).Error; err != nil {
+					t.Fatalf("查询地址失败: %v", err)
+				}
+				if updated.UserID != aliceID {
+					t.Errorf("管理员修改后地址仍应属于原用户，实际 %d", updated.UserID)
+				}
+			}},
+		{name: "admin cancels order", method: http.MethodPost, path: idPath("/orders/%d/cancel", orderID), token: adminToken, want: http.StatusOK},
+	})
+}
+
+func TestOwnershipAdminRequiresMFA(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.MFA.RequireForAdmin = true
+	})
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, adminToken := s.loginAsAdmin("manager")
+	product := s.seedProduct("键盘", 199, 10)
+	orderID := s.seedOrder(aliceToken, s.seedAddress(aliceID).ID, product.ID, 1)
+
+	s.run([]routeCase{
+		{name: "admin without mfa", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: adminToken, want: http.StatusNotFound},
+		{name: "owner unaffected", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: aliceToken, want: http.StatusOK},
+	})
+}
+
+// 升级前的部署已经写入过当时的默认策略，首次启动的默认策略不会再写入，由迁移补上访问其他用户资源的规则
+func TestOwnershipPoliciesAddedOnUpgrade(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "upgrade.db")
+	db, err := database.Open(config.DatabaseConfig{Driver: database.DriverSQLite, DSN: dsn})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	migrator, err := migrate.New(db)
+	if err != nil {
+		t.Fatalf("加载迁移失败: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	// 回到迁移 0014 之前：策略表中只有旧版本的默认策略
+	if err := db.Where("version = ?", 14).Delete(&migrate.SchemaMigration{}).Error; err != nil {
+		t.Fatalf("删除迁移记录失败: %v", err)
+	}
+	for _, rule := range [][]string{
+		{"admin", "/admin/*", "(GET)|(POST)|(PUT)|(DELETE)"},
+		{"admin", "/products*", "(GET)|(POST)|(PUT)|(DELETE)"},
+		{"user", "/products*", "GET"},
+		{"admin", "/users*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	} {
+		if err := db.Exec("INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES ('p', ?, ?, ?, '', '', '')", rule[0], rule[1], rule[2]).Error; err != nil {
+			t.Fatalf("写入旧策略失败: %v", err)
+		}
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Database.DSN = dsn
+	})
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, adminToken := s.loginAsAdmin("manager")
+	supportID, supportToken := s.loginAsUser("carol")
+	product := s.seedProduct("键盘", 199, 10)
+	orderID := s.seedOrder(aliceToken, s.seedAddress(aliceID).ID, product.ID, 1)
+
+	s.run([]routeCase{
+		{name: "policies added", method: http.MethodGet, path: "/admin/policies", token: adminToken, want: http.StatusOK, check: expectTotal(8)},
+		{name: "assign support", method: http.MethodPut, path: idPath("/admin/roles/support/users/%d", supportID), token: adminToken, want: http.StatusOK},
+		{name: "support views order", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: supportToken, want: http.StatusOK},
+		{name: "admin views order", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: adminToken, want: http.StatusOK},
+	})
+}
@@ -0,0 +1,405 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+// uploadFile 上传的一个文件
+type uploadFile struct {
+	name string
+	data []byte
+}
+
+// uploadImages 以 multipart/form-data 上传商品图片
+func (s *testServer) uploadImages(token string, productID uint64, files ...uploadFile) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := form.CreateFormFile("images", file.name)
+		if err != nil {
+			s.t.Fatalf("创建表单失败: %v", err)
+		}
+		part.Write(file.data)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, idPath("/admin/products/%d/images", productID), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// uploadedImages 上传商品图片并返回商品的全部图片
+func (s *testServer) uploadedImages(token string, productID uint64, files ...uploadFile) []models.ProductImage {
+	s.t.Helper()
+	w := s.uploadImages(token, productID, files...)
+	if w.Code != http.StatusCreated {
+		s.t.Fatalf("上传图片失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []models.ProductImage `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data
+}
+
+// productImageURL 商品当前的主图
+func (s *testServer) productImageURL(productID uint64) string {
+	s.t.Helper()
+	var product models.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		s.t.Fatalf("查询商品失败: %v", err)
+	}
+	return product.ImageURL
+}
+
+// pngFile 生成 width x height 的半透明 PNG 图片
+func pngFile(name string, width, height int) uploadFile {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 128})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return uploadFile{name: name, data: buf.Bytes()}
+}
+
+// jpegFile 生成 width x height 的 JPEG 图片
+func jpegFile(name string, width, height int) uploadFile {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 3), G: 100, B: uint8(y * 3), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	return uploadFile{name: name, data: buf.Bytes()}
+}
+
+// imageConfig 获取 path 指向的图片，返回类型和尺寸
+func (s *testServer) imageConfig(path string) (string, image.Config) {
+	s.t.Helper()
+	w := s.do(http.MethodGet, path, "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("获取图片 %s 失败: %d", path, w.Code)
+	}
+	config, format, err := image.DecodeConfig(w.Body)
+	if err != nil {
+		s.t.Fatalf("解码图片 %s 失败: %v", path, err)
+	}
+	return format, config
+}
+
+func TestProductImages(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Media.MaxSize = 64 << 10
+		cfg.Media.MaxImages = 3
+		cfg.Media.ThumbnailSize = 32
+	})
+	_, adminToken := s.loginAsAdmin("admin1")
+	_, userToken := s.loginAsUser("alice")
+	product := s.seedProduct("手机", 100, 10)
+	other := s.seedProduct("耳机", 50, 10)
+
+	// 一次上传多张图片，类型按内容识别，与文件名无关
+	images := s.uploadedImages(adminToken, product.ID, pngFile("a.jpg", 200, 100), jpegFile("b", 40, 80))
+	if len(images) != 2 {
+		t.Fatalf("期望 2 张图片，实际 %d", len(images))
+	}
+	first, second := images[0], images[1]
+	if first.ContentType != "image/png" || first.Width != 200 || first.Height != 100 || first.Position != 0 ||
+		!strings.HasPrefix(first.URL, idPath("/uploads/products/%d/", product.ID)) || !strings.HasSuffix(first.URL, ".png") {
+		t.Errorf("第一张图片不正确: %+v", first)
+	}
+	if second.ContentType != "image/jpeg" || second.Width != 40 || second.Height != 80 || second.Position != 1 || !strings.HasSuffix(second.URL, ".jpg") {
+		t.Errorf("第二张图片不正确: %+v", second)
+	}
+
+	// 原图和缩略图由本服务提供，缩略图等比缩小，PNG 保持 PNG，其他格式转为 JPEG
+	if format, config := s.imageConfig(first.URL); format != "png" || config.Width != 200 {
+		t.Errorf("原图不正确: %s %+v", format, config)
+	}
+	if format, config := s.imageConfig(first.ThumbnailURL); format != "png" || config.Width != 32 || config.Height != 16 {
+		t.Errorf("PNG 缩略图不正确: %s %+v", format, config)
+	}
+	if format, config := s.imageConfig(second.ThumbnailURL); format != "jpeg" || config.Width != 16 || config.Height != 32 {
+		t.Errorf("JPEG 缩略图不正确: %s %+v", format, config)
+	}
+
+	// 第一张图片作为商品主图，详情中按顺序返回全部图片
+	if got := s.productImageURL(product.ID); got != first.URL {
+		t.Errorf("商品主图应为第一张图片，实际 %q", got)
+	}
+	if detail := s.productDetail(product.ID); len(detail.Images) != 2 || detail.Images[0].ID != first.ID {
+		t.Errorf("商品详情中的图片不正确: %+v", detail.Images)
+	}
+	if detail := s.productDetail(other.ID); detail.Images == nil || len(detail.Images) != 0 {
+		t.Errorf("没有图片的商品应返回空数组: %+v", detail.Images)
+	}
+
+	// 调整顺序后主图随之变化
+	w := s.do(http.MethodPut, idPath("/admin/products/%d/images/order", product.ID), adminToken, map[string]interface{}{"image_ids": []uint64{second.ID, first.ID}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("调整图片顺序失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := s.productImageURL(product.ID); got != second.URL {
+		t.Errorf("调整顺序后商品主图应为第二张图片，实际 %q", got)
+	}
+
+	// 有图片时修改商品不会改动主图
+	w = s.do(http.MethodPut, idPath("/admin/products/%d", product.ID), adminToken, map[string]interface{}{"price": 120, "image_url": "https://cdn.example.com/x.png"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("修改商品失败: %d %s", w.Code, w.Body.String())
+	}
+	var updated models.Product
+	decode(t, w, &updated)
+	if got := s.productImageURL(product.ID); got != second.URL || updated.ImageURL != second.URL || updated.Price != 120 {
+		t.Errorf("修改商品后主图应保持第一张图片，实际 %q %q", got, updated.ImageURL)
+	}
+
+	// 删除图片同时删除文件，剩余图片重新编号，删除最后一张后清空主图
+	files := func(image models.ProductImage) []string {
+		return []string{
+			filepath.Join(s.cfg.Media.Dir, filepath.FromSlash(strings.TrimPrefix(image.URL, "/uploads/"))),
+			filepath.Join(s.cfg.Media.Dir, filepath.FromSlash(strings.TrimPrefix(image.ThumbnailURL, "/uploads/"))),
+		}
+	}
+	for _, path := range files(second) {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("图片文件应已保存: %v", err)
+		}
+	}
+	if w := s.do(http.MethodDelete, fmt.Sprintf("/admin/products/%d/images/%d", product.ID, second.ID), adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除图片失败: %d %s", w.Code, w.Body.String())
+	}
+	for _, path := range files(second) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("删除图片后文件应被删除: %s", path)
+		}
+	}
+	detail := s.productDetail(product.ID)
+	if len(detail.Images) != 1 || detail.Images[0].ID != first.ID || detail.Images[0].Position != 0 || detail.ImageURL != first.URL {
+		t.Errorf("删除图片后商品图片不正确: %q %+v", detail.ImageURL, detail.Images)
+	}
+	if w := s.do(http.MethodDelete, fmt.Sprintf("/admin/products/%d/images/%d", product.ID, first.ID), adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除图片失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := s.productImageURL(product.ID); got != "" {
+		t.Errorf("删除全部图片后主图应为空，实际 %q", got)
+	}
+
+	// 直接填写的外部主图在上传图片后被替换
+	s.db.Model(&models.Product{}).Where("id = ?", other.ID).Update("image_url", "https://cdn.example.com/a.png")
+	uploaded := s.uploadedImages(adminToken, other.ID, jpegFile("c.jpg", 10, 10))
+	if got := s.productImageURL(other.ID); got != uploaded[0].URL {
+		t.Errorf("上传图片后主图应为上传的图片，实际 %q", got)
+	}
+
+	// 校验不通过时一张都不保存
+	invalid := []struct {
+		name  string
+		files []uploadFile
+		want  int
+	}{
+		{"not an image", []uploadFile{pngFile("a.png", 10, 10), {name: "b.png", data: []byte("not an image")}}, http.StatusBadRequest},
+		{"file too large", []uploadFile{{name: "big.png", data: bytes.Repeat([]byte{0}, 64<<10+1)}}, http.StatusRequestEntityTooLarge},
+		{"too many images", []uploadFile{pngFile("a.png", 10, 10), pngFile("b.png", 10, 10), pngFile("c.png", 10, 10)}, http.StatusBadRequest},
+		{"no files", nil, http.StatusBadRequest},
+	}
+	for _, tc := range invalid {
+		if w := s.uploadImages(adminToken, other.ID, tc.files...); w.Code != tc.want {
+			t.Errorf("%s: 期望状态码 %d，实际 %d，body: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+	var count int64
+	s.db.Model(&models.ProductImage{}).Where("product_id = ?", other.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("上传失败后不应保存图片，实际 %d 张", count)
+	}
+	if w := s.uploadImages(userToken, other.ID, pngFile("a.png", 10, 10)); w.Code != http.StatusForbidden {
+		t.Errorf("普通用户上传图片应返回 403，实际 %d", w.Code)
+	}
+
+	s.run([]routeCase{
+		{name: "reorder missing image", method: http.MethodPut, path: idPath("/admin/products/%d/images/order", other.ID), token: adminToken,
+			body: map[string]interface{}{"image_ids": []uint64{}}, want: http.StatusBadRequest},
+		{name: "reorder duplicate image", method: http.MethodPut, path: idPath("/admin/products/%d/images/order", other.ID), token: adminToken,
+			body: map[string]interface{}{"image_ids": []uint64{uploaded[0].ID, uploaded[0].ID}}, want: http.StatusBadRequest},
+		{name: "reorder other product image", method: http.MethodPut, path: idPath("/admin/products/%d/images/order", product.ID), token: adminToken,
+			body: map[string]interface{}{"image_ids": []uint64{uploaded[0].ID}}, want: http.StatusBadRequest},
+		{name: "delete other product image", method: http.MethodDelete, path: fmt.Sprintf("/admin/products/%d/images/%d", product.ID, uploaded[0].ID), token: adminToken, want: http.StatusNotFound},
+		{name: "invalid image id", method: http.MethodDelete, path: idPath("/admin/products/%d/images/abc", other.ID), token: adminToken, want: http.StatusBadRequest},
+		{name: "missing product", method: http.MethodPost, path: "/admin/products/999/images", token: adminToken, want: http.StatusNotFound},
+		{name: "user cannot delete", method: http.MethodDelete, path: fmt.Sprintf("/admin/products/%d/images/%d", other.ID, uploaded[0].ID), token: userToken, want: http.StatusForbidden},
+	})
+}
+
+// fakeObjectStorage 模拟 MinIO 的对象存储，按 bucket/key 保存上传的对象，并检查请求带有 SigV4 签名
+type fakeObjectStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeObjectStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio-key/") || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeObjectStorage) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestConcurrentProductImageUploads(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Media.MaxImages = 3
+		cfg.Media.ThumbnailSize = 32
+	})
+	_, adminToken := s.loginAsAdmin("admin1")
+	product := s.seedProduct("手机", 100, 10)
+
+	// 并发上传时数量检查和位置分配在同一事务内完成，不会超过上限或出现重复的位置
+	codes := make([]int, 6)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = s.uploadImages(adminToken, product.ID, pngFile(fmt.Sprintf("%d.png", i), 40, 40)).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("并发上传返回了意外的状态码: %v", codes)
+		}
+	}
+	if created != 3 {
+		t.Errorf("期望 3 次上传成功，实际 %d: %v", created, codes)
+	}
+	images, err := models.ProductImages(s.db, product.ID)
+	if err != nil {
+		t.Fatalf("查询商品图片失败: %v", err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("期望 3 张图片，实际 %d", len(images))
+	}
+	for position, image := range images {
+		if image.Position != position {
+			t.Errorf("图片位置应为 0、1、2，实际 %+v", images)
+			break
+		}
+	}
+	// 被拒绝的上传已保存的文件会被删除
+	files, _ := filepath.Glob(filepath.Join(s.cfg.Media.Dir, "products", fmt.Sprint(product.ID), "*"))
+	if len(files) != 6 {
+		t.Errorf("期望保留 3 张图片及其缩略图，实际 %d 个文件", len(files))
+	}
+}
+
+// s3Media 使用 endpoint 上的对象存储保存图片
+func s3Media(endpoint, accessKey string) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Media.Driver = "s3"
+		cfg.Media.Endpoint = endpoint
+		cfg.Media.Bucket = "mall"
+		cfg.Media.AccessKey = accessKey
+		cfg.Media.SecretKey = "minio-secret"
+		cfg.Media.BaseURL = "https://img.example.com"
+	}
+}
+
+func TestProductImagesS3(t *testing.T) {
+	storage := &fakeObjectStorage{objects: make(map[string][]byte)}
+	minio := httptest.NewServer(storage)
+	t.Cleanup(minio.Close)
+
+	s := newTestServer(t, s3Media(minio.URL, "minio-key"))
+	_, adminToken := s.loginAsAdmin("admin1")
+	product := s.seedProduct("手机", 100, 10)
+
+	uploaded := s.uploadedImages(adminToken, product.ID, pngFile("a.png", 20, 20))[0]
+	if !strings.HasPrefix(uploaded.URL, idPath("https://img.example.com/products/%d/", product.ID)) || !strings.HasSuffix(uploaded.ThumbnailURL, "_thumb.png") {
+		t.Errorf("图片地址不正确: %+v", uploaded)
+	}
+	keys := storage.keys()
+	if len(keys) != 2 {
+		t.Fatalf("对象存储中应有原图和缩略图，实际 %v", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "/mall/products/") {
+			t.Errorf("对象应保存在 bucket 下: %s", key)
+		}
+	}
+	if _, report := s.readyz(); report.Components["media_storage"].Status == "" {
+		t.Errorf("s3 存储应注册就绪检查: %+v", report)
+	}
+
+	if w := s.do(http.MethodDelete, fmt.Sprintf("/admin/products/%d/images/%d", product.ID, uploaded.ID), adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除图片失败: %d %s", w.Code, w.Body.String())
+	}
+	if keys := storage.keys(); len(keys) != 0 {
+		t.Errorf("删除图片后对象应被删除，剩余 %v", keys)
+	}
+
+	// 对象存储拒绝请求时上传失败，不写入数据库
+	denied := newTestServer(t, s3Media(minio.URL, "wrong-key"))
+	_, deniedToken := denied.loginAsAdmin("admin1")
+	other := denied.seedProduct("耳机", 50, 10)
+	if w := denied.uploadImages(deniedToken, other.ID, pngFile("a.png", 20, 20)); w.Code != http.StatusInternalServerError {
+		t.Errorf("对象存储拒绝时应返回 500，实际 %d", w.Code)
+	}
+	var count int64
+	denied.db.Model(&models.ProductImage{}).Count(&count)
+	if count != 0 {
+		t.Errorf("上传失败后不应保存图片，实际 %d 张", count)
+	}
+}
@@ -0,0 +1,204 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+	"qaqmall/handlers"
+	"qaqmall/models"
+)
+
+// productDetail 获取商品详情
+func (s *testServer) productDetail(productID uint64) handlers.ProductDetail {
+	s.t.Helper()
+	w := s.do(http.MethodGet, idPath("/products/%d", productID), "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("获取商品详情失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data handlers.ProductDetail `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data
+}
+
+// waitViewCount 等待浏览计数器把商品的浏览次数写入数据库
+func (s *testServer) waitViewCount(productID uint64, want int64) {
+	s.t.Helper()
+	var product models.Product
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err := s.db.First(&product, productID).Error; err != nil {
+			s.t.Fatalf("查询商品失败: %v", err)
+		}
+		if product.ViewCount == want {
+			return
+		}
+	}
+	s.t.Fatalf("商品 %d 的浏览次数期望 %d，实际 %d", productID, want, product.ViewCount)
+}
+
+func TestProductDetail(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Product.ViewFlushInterval = 20 * time.Millisecond
+		cfg.Product.LowStockThreshold = 5
+		cfg.Product.RelatedLimit = 2
+	})
+	_, adminToken := s.loginAsAdmin("admin1")
+
+	phones := s.createCategory(adminToken, "手机", 0)
+	books := s.createCategory(adminToken, "图书", 0)
+	inPhones := func(name string, stock int, onSale bool) models.Product {
+		return s.createProduct(adminToken, map[string]interface{}{"name": name, "price": 100, "stock": stock,
+			"is_on_sale": onSale, "category_ids": []uint64{phones.ID}})
+	}
+	phone := inPhones("手机A", 3, true)
+	popular := inPhones("手机B", 100, true)
+	other := inPhones("手机C", 0, true)
+	inPhones("手机D", 20, true)
+	offSale := inPhones("手机E", 20, false)
+	book := s.createProduct(adminToken, map[string]interface{}{"name": "Go 语言编程", "price": 89, "stock": 50,
+		"is_on_sale": true, "category_ids": []uint64{books.ID}})
+	s.db.Model(&models.Product{}).Where("id IN ?", []uint64{popular.ID, offSale.ID}).Update("view_count", 50)
+	s.db.Model(&models.Product{}).Where("id = ?", other.ID).Update("view_count", 10)
+
+	// 详情包含分类、规格、实时库存状态和同分类下浏览最多的在售商品
+	detail := s.productDetail(phone.ID)
+	if detail.Name != "手机A" || len(detail.Categories) != 1 || detail.Categories[0].ID != phones.ID {
+		t.Fatalf("商品详情不正确: %+v", detail)
+	}
+	if detail.StockStatus != handlers.StockStatusLowStock || len(detail.Options) != 0 || len(detail.SKUs) != 0 {
+		t.Errorf("库存状态或规格不正确: %s %+v %+v", detail.StockStatus, detail.Options, detail.SKUs)
+	}
+	var related []string
+	for _, product := range detail.Related {
+		related = append(related, product.Name)
+	}
+	if fmt.Sprint(related) != "[手机B 手机C]" {
+		t.Errorf("相关商品不正确: %v", related)
+	}
+	if got := s.productDetail(other.ID).StockStatus; got != handlers.StockStatusOutOfStock {
+		t.Errorf("无库存商品的库存状态应为 out_of_stock，实际 %s", got)
+	}
+	if detail.Rating != (models.RatingSummary{}) {
+		t.Errorf("没有评价的商品评分汇总应为 0，实际 %+v", detail.Rating)
+	}
+
+	// 评分汇总按商品的评价计算，平均分保留一位小数
+	aliceID, aliceToken := s.loginAsUser("alice")
+	address := s.seedAddress(aliceID)
+	for _, rating := range []int{5, 4, 4} {
+		orderID := s.seedOrder(aliceToken, address.ID, book.ID, 1)
+		if err := s.db.Create(&models.ProductReview{ProductID: book.ID, UserID: aliceID, OrderID: orderID, Rating: rating}).Error; err != nil {
+			t.Fatalf("创建评价失败: %v", err)
+		}
+	}
+	got := s.productDetail(book.ID)
+	if got.StockStatus != handlers.StockStatusInStock || len(got.Related) != 0 {
+		t.Errorf("图书详情不正确: %s %+v", got.StockStatus, got.Related)
+	}
+	if got.Rating != (models.RatingSummary{Average: 4.3, Count: 3}) {
+		t.Errorf("评分汇总不正确: %+v", got.Rating)
+	}
+
+	// 库存状态实时反映下单后的库存
+	s.db.Model(&models.Product{}).Where("id = ?", phone.ID).Update("stock", 0)
+	if got := s.productDetail(phone.ID); got.StockStatus != handlers.StockStatusOutOfStock {
+		t.Errorf("库存变化后应立即反映在详情中，实际 %s", got.StockStatus)
+	}
+
+	// 有规格的商品返回规格项和启用的 SKU
+	s.setOptions(adminToken, popular.ID, map[string]interface{}{
+		"options": []map[string]interface{}{{"name": "容量", "values": []string{"128G", "256G"}}},
+		"stock":   1,
+	})
+	if got := s.productDetail(popular.ID); len(got.Options) != 1 || len(got.SKUs) != 2 || got.Stock != 2 || got.StockStatus != handlers.StockStatusLowStock {
+		t.Errorf("有规格商品的详情不正确: %+v", got)
+	}
+
+	// 浏览次数先在内存中累加，响应中已包含，随后定期写入数据库
+	if got := s.productDetail(phone.ID).ViewCount; got != 3 {
+		t.Errorf("第三次浏览后浏览次数应为 3，实际 %d", got)
+	}
+	s.waitViewCount(phone.ID, 3)
+	s.waitViewCount(popular.ID, 51)
+
+	// 修改商品不会覆盖浏览次数
+	if w := s.do(http.MethodPut, idPath("/admin/products/%d", phone.ID), adminToken, map[string]interface{}{"name": "手机A2", "view_count": 999}); w.Code != http.StatusOK {
+		t.Fatalf("修改商品失败: %d", w.Code)
+	}
+	s.waitViewCount(phone.ID, 3)
+
+	// 搜索可以按浏览次数排序
+	if got := s.search(url.Values{"sort": {"popular"}, "category_id": {fmt.Sprint(phones.ID)}}); fmt.Sprint(got.names()) != "[手机B 手机C 手机A2 手机D]" {
+		t.Errorf("按浏览次数排序不正确: %v", got.names())
+	}
+
+	if w := s.do(http.MethodDelete, idPath("/admin/products/%d", book.ID), adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除商品失败: %d", w.Code)
+	}
+	s.run([]routeCase{
+		{name: "invalid id", method: http.MethodGet, path: "/products/abc", want: http.StatusBadRequest},
+		{name: "missing product", method: http.MethodGet, path: "/products/999", want: http.StatusNotFound},
+		{name: "deleted product", method: http.MethodGet, path: idPath("/products/%d", book.ID), want: http.StatusNotFound},
+		{name: "off sale product", method: http.MethodGet, path: idPath("/products/%d", offSale.ID), want: http.StatusOK},
+	})
+}
+
+func TestProductViewsFlushedOnShutdown(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Product.ViewFlushInterval = time.Hour
+	})
+	product := s.seedProduct("键盘", 199, 10)
+	s.productDetail(product.ID)
+	s.productDetail(product.ID)
+
+	// 关闭时等待计数器最后写入一次，之后才关闭数据库
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.app.Shutdown(ctx); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	var got models.Product
+	if err := s.db.First(&got, product.ID).Error; err != nil {
+		t.Fatalf("查询商品失败: %v", err)
+	}
+	if got.ViewCount != 2 {
+		t.Errorf("关闭后浏览次数应已写入数据库，期望 2，实际 %d", got.ViewCount)
+	}
+}
+
+func TestProductReview(t *testing.T) {
+	s := newTestServer(t)
+	book := s.seedProduct("Go 语言编程", 89, 50)
+	pen := s.seedProduct("钢笔", 20, 50)
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, bobToken := s.loginAsUser("bob")
+	orderID := s.seedOrder(aliceToken, s.seedAddress(aliceID).ID, book.ID, 1)
+	path := idPath("/products/%d/reviews", book.ID)
+	review := map[string]interface{}{"order_id": orderID, "rating": 4, "content": "不错"}
+
+	s.run([]routeCase{
+		{name: "unauthenticated", method: http.MethodPost, path: path, body: review, want: http.StatusUnauthorized},
+		{name: "unpaid order", method: http.MethodPost, path: path, token: aliceToken, body: review, want: http.StatusBadRequest},
+	})
+	s.db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", models.OrderStatusPaid)
+	s.run([]routeCase{
+		{name: "invalid rating", method: http.MethodPost, path: path, token: aliceToken,
+			body: map[string]interface{}{"order_id": orderID, "rating": 6}, want: http.StatusBadRequest},
+		{name: "other user's order", method: http.MethodPost, path: path, token: bobToken, body: review, want: http.StatusNotFound},
+		{name: "product not in order", method: http.MethodPost, path: idPath("/products/%d/reviews", pen.ID), token: aliceToken,
+			body: review, want: http.StatusBadRequest},
+		{name: "create", method: http.MethodPost, path: path, token: aliceToken, body: review, want: http.StatusOK},
+		{name: "duplicate", method: http.MethodPost, path: path, token: aliceToken,
+			body: map[string]interface{}{"order_id": orderID, "rating": 1}, want: http.StatusConflict},
+	})
+
+	if got := s.productDetail(book.ID).Rating; got != (models.RatingSummary{Average: 4, Count: 1}) {
+		t.Errorf("评分汇总不正确: %+v", got)
+	}
+}
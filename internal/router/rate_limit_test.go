@@ -0,0 +1,192 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+)
+
+// withRateLimit 开启限流，store 为 memory 或 redis
+func withRateLimit(store string, redisAddr string) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.RateLimit.Enabled = true
+		cfg.RateLimit.Store = store
+		cfg.RateLimit.Auth = config.RateLimitRule{Requests: 6, Period: time.Minute}
+		cfg.RateLimit.AI = config.RateLimitRule{Requests: 1, Period: time.Minute}
+		cfg.RateLimit.Products = config.RateLimitRule{Requests: 5, Period: time.Minute}
+		cfg.RateLimit.Default = config.RateLimitRule{Requests: 100, Period: time.Hour}
+		cfg.Redis.Addr = redisAddr
+	}
+}
+
+// expectRateLimitHeaders 检查限流响应头，注册登录时的密码哈希比较慢，reset 允许比预期少几秒
+func expectRateLimitHeaders(limit, remaining string, reset int) func(t *testing.T, w *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		got := []string{w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"), w.Header().Get("RateLimit-Reset")}
+		if got[0] != limit || got[1] != remaining || !approxSeconds(got[2], reset) {
+			t.Errorf("期望 RateLimit-Limit/Remaining/Reset 为 %s/%s/%d，实际 %v", limit, remaining, reset, got)
+		}
+	}
+}
+
+func approxSeconds(value string, want int) bool {
+	got, err := strconv.Atoi(value)
+	return err == nil && got <= want && got >= want-5
+}
+
+func testRateLimit(t *testing.T, s *testServer) {
+	// 注册和登录 alice、bob 用掉 auth 分组的 4 个令牌
+	_, aliceToken := s.loginAsUser("alice")
+	_, bobToken := s.loginAsUser("bob")
+
+	s.run([]routeCase{
+		{name: "login attempt", method: http.MethodPost, path: "/login", body: loginBody("nobody", "password"),
+			want: http.StatusUnauthorized, check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				expectRateLimitHeaders("6", "1", 50)(t, w)
+				if policy := w.Header().Get("RateLimit-Policy"); policy != "6;w=60;burst=6" {
+					t.Errorf("RateLimit-Policy 不正确: %q", policy)
+				}
+			}},
+		// 同一分组内的接口共用计数
+		{name: "forgot password", method: http.MethodPost, path: "/password/forgot", body: map[string]string{"email": "nobody@example.com"},
+			want: http.StatusOK, check: expectRateLimitHeaders("6", "0", 60)},
+		{name: "limited", method: http.MethodPost, path: "/login", body: loginBody("nobody", "password"),
+			want: http.StatusTooManyRequests, check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				expectRateLimitHeaders("6", "0", 60)(t, w)
+				if retry := w.Header().Get("Retry-After"); !approxSeconds(retry, 10) {
+					t.Errorf("期望 Retry-After 为 10，实际 %q", retry)
+				}
+			}},
+		// 刷新令牌同样接受凭据，与登录共用计数
+		{name: "token refresh limited", method: http.MethodPost, path: "/token/refresh", body: map[string]string{"refresh_token": "guess"},
+			want: http.StatusTooManyRequests},
+		// 其他分组不受影响
+		{name: "products not limited", method: http.MethodGet, path: "/products", want: http.StatusOK, check: expectRateLimitHeaders("5", "4", 12)},
+
+		// 登录后按用户计数，不同用户互不影响
+		{name: "alice ai query", method: http.MethodPost, path: "/ai/query", token: aliceToken, body: map[string]string{"query": "购物车"}, want: http.StatusOK},
+		{name: "alice limited", method: http.MethodPost, path: "/ai/query", token: aliceToken, body: map[string]string{"query": "购物车"}, want: http.StatusTooManyRequests},
+		{name: "bob not limited", method: http.MethodPost, path: "/ai/query", token: bobToken, body: map[string]string{"query": "购物车"}, want: http.StatusOK},
+		{name: "default group", method: http.MethodGet, path: "/user/info", token: aliceToken, want: http.StatusOK, check: expectRateLimitHeaders("100", "97", 108)},
+	})
+
+	// 并发请求不会超过令牌桶容量
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := s.do(http.MethodGet, "/products", "", nil); w.Code == http.StatusOK {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 4 {
+		t.Fatalf("期望并发请求中只有剩余的 4 个通过，实际 %d", allowed)
+	}
+}
+
+func TestRateLimitMemory(t *testing.T) {
+	testRateLimit(t, newTestServer(t, withRateLimit("memory", "")))
+}
+
+func TestRateLimitRedis(t *testing.T) {
+	redis := newFakeRedis(t)
+	testRateLimit(t, newTestServer(t, withRateLimit("redis", redis.Addr())))
+
+	keys := redis.Keys()
+	ttl, ok := keys["qaqmall:ratelimit:auth:ip:192.0.2.1"]
+	if !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("令牌桶应在装满后过期，keys: %v", keys)
+	}
+	for key := range keys {
+		if !strings.HasPrefix(key, "qaqmall:ratelimit:") {
+			t.Errorf("key 缺少前缀: %s", key)
+		}
+	}
+}
+
+// loginFrom 带着 X-Forwarded-For 发送一次失败的登录请求，返回状态码
+// 调用方每次使用不同的用户名，避免触发按用户名的登录锁定
+func (s *testServer) loginFrom(username, forwardedFor string) int {
+	data, _ := json.Marshal(loginBody(username, "password"))
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	// 默认不信任代理，伪造的 X-Forwarded-For 仍按连接的对端地址计数
+	s := newTestServer(t, withRateLimit("memory", ""))
+	for i := 0; i < 6; i++ {
+		if code := s.loginFrom(fmt.Sprintf("nobody%d", i), fmt.Sprintf("198.51.100.%d", i)); code != http.StatusUnauthorized {
+			t.Fatalf("第 %d 次登录期望 401，实际 %d", i+1, code)
+		}
+	}
+	if code := s.loginFrom("nobody99", "198.51.100.99"); code != http.StatusTooManyRequests {
+		t.Fatalf("更换 X-Forwarded-For 不应获得新的令牌桶，实际 %d", code)
+	}
+
+	// 请求来自可信代理时按 X-Forwarded-For 中的客户端 IP 计数
+	s = newTestServer(t, withRateLimit("memory", ""), func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	})
+	for i := 0; i < 6; i++ {
+		s.loginFrom(fmt.Sprintf("nobody%d", i), "198.51.100.1")
+	}
+	if code := s.loginFrom("nobody6", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("同一客户端超过限制应返回 429，实际 %d", code)
+	}
+	if code := s.loginFrom("nobody7", "198.51.100.2"); code != http.StatusUnauthorized {
+		t.Fatalf("可信代理转发的其他客户端应单独计数，实际 %d", code)
+	}
+}
+
+func TestRateLimitRedisConflict(t *testing.T) {
+	redis := newFakeRedis(t)
+	s := newTestServer(t, withRateLimit("redis", redis.Addr()))
+
+	// 同一个 key 的并发修改不停冲突时按拒绝处理，不能放行
+	redis.mu.Lock()
+	redis.conflict = true
+	redis.mu.Unlock()
+	s.run([]routeCase{
+		{name: "conflict rejected", method: http.MethodPost, path: "/login", body: loginBody("nobody", "password"),
+			want: http.StatusTooManyRequests, check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if retry := w.Header().Get("Retry-After"); !approxSeconds(retry, 10) {
+					t.Errorf("期望 Retry-After 为 10，实际 %q", retry)
+				}
+			}},
+	})
+}
+
+func TestRateLimitStoreUnavailable(t *testing.T) {
+	redis := newFakeRedis(t)
+	addr := redis.Addr()
+	redis.listener.Close()
+	s := newTestServer(t, withRateLimit("redis", addr))
+
+	// 限流存储不可用时放行
+	for i := 0; i < 5; i++ {
+		if w := s.do(http.MethodPost, "/login", "", loginBody("nobody", "password")); w.Code != http.StatusUnauthorized {
+			t.Fatalf("限流存储不可用时应放行，实际 %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"qaqmall/middleware"
+	"qaqmall/models"
+)
+
+func policyBody(role, path, method string) map[string]string {
+	return map[string]string{"role": role, "path": path, "method": method}
+}
+
+// expectTotal 断言列表接口返回的 total
+func expectTotal(want int) func(t *testing.T, w *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		var resp struct {
+			Data struct {
+				Total int `json:"total"`
+			} `json:"data"`
+		}
+		decode(t, w, &resp)
+		if resp.Data.Total != want {
+			t.Errorf("期望 total 为 %d，实际 %d: %s", want, resp.Data.Total, w.Body.String())
+		}
+	}
+}
+
+func TestPolicyRoutes(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.loginAsAdmin("manager")
+	_, userToken := s.loginAsUser("alice")
+
+	s.run([]routeCase{
+		{name: "list policies", method: http.MethodGet, path: "/admin/policies", token: adminToken, want: http.StatusOK, check: expectTotal(8)},
+		{name: "filter by role", method: http.MethodGet, path: "/admin/policies?role=user", token: adminToken, want: http.StatusOK, check: expectTotal(1)},
+		{name: "user forbidden", method: http.MethodGet, path: "/admin/policies", token: userToken, want: http.StatusForbidden},
+		{name: "user cannot list locks", method: http.MethodGet, path: "/admin/login-locks", token: userToken, want: http.StatusForbidden},
+
+		// 添加的策略立即生效
+		{name: "add policy", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "/admin/login-locks", "GET"), want: http.StatusCreated},
+		{name: "granted", method: http.MethodGet, path: "/admin/login-locks", token: userToken, want: http.StatusOK},
+		{name: "duplicate", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "/admin/login-locks", "GET"), want: http.StatusConflict},
+		{name: "invalid role", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("Bad Role", "/admin/login-locks", "GET"), want: http.StatusBadRequest},
+		{name: "invalid path", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "admin/*", "GET"), want: http.StatusBadRequest},
+		{name: "invalid method regexp", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "/admin/*", "(GET"), want: http.StatusBadRequest},
+
+		// 删除的策略立即失效
+		{name: "remove policy", method: http.MethodDelete, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "/admin/login-locks", "GET"), want: http.StatusOK},
+		{name: "revoked", method: http.MethodGet, path: "/admin/login-locks", token: userToken, want: http.StatusForbidden},
+		{name: "remove missing", method: http.MethodDelete, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "/admin/login-locks", "GET"), want: http.StatusNotFound},
+		{name: "cannot remove admin access", method: http.MethodDelete, path: "/admin/policies", token: adminToken,
+			body: policyBody("admin", "/admin/*", "(GET)|(POST)|(PUT)|(DELETE)"), want: http.StatusBadRequest},
+	})
+
+	if added, removed := s.systemLogs("policy_added"), s.systemLogs("policy_removed"); len(added) != 1 || len(removed) != 1 {
+		t.Fatalf("期望各记录 1 条策略变更日志，实际添加 %d 条，删除 %d 条", len(added), len(removed))
+	}
+}
+
+func TestDeletedPoliciesStayDeleted(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.loginAsAdmin("manager")
+
+	s.run([]routeCase{
+		{name: "remove default policy", method: http.MethodDelete, path: "/admin/policies", token: adminToken,
+			body: policyBody("user", "/products*", "GET"), want: http.StatusOK},
+	})
+
+	// 重新初始化（相当于重启服务）不应恢复已删除的默认策略
+	if _, err := middleware.InitCasbin(context.Background(), s.db, 0); err != nil {
+		t.Fatalf("重新初始化 Casbin 失败: %v", err)
+	}
+	s.run([]routeCase{
+		{name: "still removed", method: http.MethodGet, path: "/admin/policies", token: adminToken, want: http.StatusOK, check: expectTotal(7)},
+	})
+}
+
+func TestRoleRoutes(t *testing.T) {
+	s := newTestServer(t)
+	adminID, adminToken := s.loginAsAdmin("manager")
+	aliceID, aliceToken := s.loginAsUser("alice")
+
+	s.run([]routeCase{
+		{name: "list roles", method: http.MethodGet, path: "/admin/roles", token: adminToken, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Items []struct {
+							Name     string `json:"name"`
+							Policies int    `json:"policies"`
+						} `json:"items"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Data.Items) != 3 || resp.Data.Items[0].Name != "admin" || resp.Data.Items[0].Policies != 6 {
+					t.Errorf("角色列表不正确: %s", w.Body.String())
+				}
+			}},
+		{name: "alice is not admin", method: http.MethodGet, path: "/admin/roles", token: aliceToken, want: http.StatusForbidden},
+
+		// 提升为管理员后，已签发的 token 立即获得管理员权限
+		{name: "assign admin", method: http.MethodPut, path: idPath("/admin/roles/admin/users/%d", aliceID), token: adminToken, want: http.StatusOK},
+		{name: "alice is admin", method: http.MethodGet, path: "/admin/roles", token: aliceToken, want: http.StatusOK},
+		{name: "list admins", method: http.MethodGet, path: "/admin/roles/admin/users", token: adminToken, want: http.StatusOK, check: expectTotal(3)},
+		{name: "cannot change own role", method: http.MethodPut, path: idPath("/admin/roles/user/users/%d", adminID), token: adminToken, want: http.StatusBadRequest},
+		{name: "unknown role", method: http.MethodPut, path: idPath("/admin/roles/auditor/users/%d", aliceID), token: adminToken, want: http.StatusNotFound},
+		{name: "unknown user", method: http.MethodPut, path: "/admin/roles/admin/users/9999", token: adminToken, want: http.StatusNotFound},
+
+		// 收回后立即失效
+		{name: "revoke admin", method: http.MethodDelete, path: idPath("/admin/roles/admin/users/%d", aliceID), token: adminToken, want: http.StatusOK},
+		{name: "alice is user again", method: http.MethodGet, path: "/admin/roles", token: aliceToken, want: http.StatusForbidden},
+		{name: "revoke again", method: http.MethodDelete, path: idPath("/admin/roles/admin/users/%d", aliceID), token: adminToken, want: http.StatusNotFound},
+	})
+
+	var alice models.User
+	if err := s.db.First(&alice, aliceID).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	if alice.Role != "user" {
+		t.Fatalf("users.role 应与角色分配同步，实际 %q", alice.Role)
+	}
+	logs := s.systemLogs("role_assigned")
+	if len(logs) != 2 || logs[0].UserID == nil || *logs[0].UserID != adminID || !strings.Contains(logs[0].Description, "alice") {
+		t.Fatalf("角色变更日志不正确: %+v", logs)
+	}
+}
+
+func TestCustomRole(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.loginAsAdmin("manager")
+	aliceID, aliceToken := s.loginAsUser("alice")
+
+	s.run([]routeCase{
+		{name: "create ops role", method: http.MethodPost, path: "/admin/policies", token: adminToken,
+			body: policyBody("ops", "/admin/login-locks*", "(GET)|(POST)"), want: http.StatusCreated},
+		{name: "assign ops", method: http.MethodPut, path: idPath("/admin/roles/ops/users/%d", aliceID), token: adminToken, want: http.StatusOK},
+		{name: "ops can list locks", method: http.MethodGet, path: "/admin/login-locks", token: aliceToken, want: http.StatusOK},
+		{name: "ops cannot manage roles", method: http.MethodGet, path: "/admin/roles", token: aliceToken, want: http.StatusForbidden},
+	})
+}
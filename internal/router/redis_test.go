@@ -0,0 +1,196 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 假的 Redis 服务，只实现限流用到的命令：GET、SET（支持 PX）、WATCH、UNWATCH、MULTI、EXEC
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+	versions map[string]uint64
+	// conflict 为 true 时 EXEC 总是返回冲突，模拟其他实例不停修改同一个 key
+	conflict bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动假 Redis 失败: %v", err)
+	}
+	r := &fakeRedis{
+		listener: listener,
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]uint64),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Keys 返回未过期的 key 及其剩余有效期
+func (r *fakeRedis) Keys() map[string]time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make(map[string]time.Duration)
+	for key := range r.values {
+		if r.expired(key) {
+			continue
+		}
+		keys[key] = time.Until(r.expires[key])
+	}
+	return keys
+}
+
+func (r *fakeRedis) expired(key string) bool {
+	expireAt, ok := r.expires[key]
+	return ok && !time.Now().Before(expireAt)
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	var watched map[string]uint64
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "WATCH":
+			r.mu.Lock()
+			if watched == nil {
+				watched = make(map[string]uint64)
+			}
+			for _, key := range args[1:] {
+				watched[key] = r.versions[key]
+			}
+			r.mu.Unlock()
+			reply = "+OK\r\n"
+		case "UNWATCH":
+			watched = nil
+			reply = "+OK\r\n"
+		case "MULTI":
+			inMulti, queued = true, nil
+			reply = "+OK\r\n"
+		case "EXEC":
+			r.mu.Lock()
+			conflict := r.conflict
+			for key, version := range watched {
+				conflict = conflict || r.versions[key] != version
+			}
+			if conflict {
+				reply = "*-1\r\n"
+			} else {
+				reply = fmt.Sprintf("*%d\r\n", len(queued))
+				for _, cmd := range queued {
+					reply += r.execute(cmd)
+				}
+			}
+			r.mu.Unlock()
+			inMulti, queued, watched = false, nil, nil
+		default:
+			if inMulti {
+				queued = append(queued, args)
+				reply = "+QUEUED\r\n"
+				break
+			}
+			r.mu.Lock()
+			reply = r.execute(args)
+			r.mu.Unlock()
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// execute 执行读写命令，调用方持有锁
+func (r *fakeRedis) execute(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := r.values[args[1]]
+		if !ok || r.expired(args[1]) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		key := args[1]
+		r.values[key] = args[2]
+		delete(r.expires, key)
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			r.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		r.versions[key]++
+		return "+OK\r\n"
+	case "PING":
+		return "+PONG\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+// readCommand 读取一条 RESP 数组格式的命令
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("不支持的命令格式: %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
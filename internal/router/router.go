@@ -0,0 +1,292 @@
+package router
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/handlers"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/health"
+	"qaqmall/internal/lifecycle"
+	"qaqmall/internal/mail"
+	"qaqmall/internal/media"
+	"qaqmall/internal/ratelimit"
+	"qaqmall/internal/search"
+	"qaqmall/internal/tracing"
+	"qaqmall/internal/views"
+	"qaqmall/middleware"
+	"qaqmall/models"
+)
+
+// New 创建 Gin 引擎并注册全部路由
+// 路由需要的后台任务（如定期重建搜索索引）注册到 app，关闭时由 app 停止并等待；keys 由调用方负责定期轮换；
+// 数据库、连接池、Casbin 以及配置了的支付网关和 LLM 的检查注册到 checker，调用方可以再注册其他检查（如定时任务心跳）
+func New(app *lifecycle.Manager, db *gorm.DB, cfg *config.Config, keys *auth.KeyRing, checker *health.Checker) (*gin.Engine, error) {
+	ctx := app.Context()
+
+	// 初始化 Casbin
+	enforcer, err := middleware.InitCasbin(ctx, db, cfg.RBAC.PolicyReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建Gin引擎
+	r := gin.New()
+	// 只信任配置的反向代理转发的 X-Forwarded-For，否则客户端可以伪造 IP 绕过按 IP 的限流
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	// 添加中间件
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Logger(slog.Default()))
+	if cfg.Metrics.Enabled {
+		r.Use(middleware.Metrics())
+	}
+	r.Use(middleware.Recovery())
+	r.Use(middleware.CORS())
+
+	// 健康检查：/livez 只表示进程存活，/readyz 检查依赖；/health 保留给旧的调用方，与 /livez 相同
+	checker.Register("database", health.Database(db))
+	checker.Register("database_pool", health.DatabasePool(db, cfg.Health.PoolSaturation))
+	checker.Register("casbin", health.Casbin(enforcer))
+	probe := &http.Client{Transport: tracing.Transport(nil)}
+	if cfg.Health.PaymentGatewayURL != "" {
+		checker.RegisterOptional("payment_gateway", health.Reachable(probe, cfg.Health.PaymentGatewayURL))
+	}
+	if cfg.Health.CheckLLM && cfg.OpenAI.APIURL != "" {
+		checker.RegisterOptional("llm", health.Reachable(probe, cfg.OpenAI.APIURL))
+	}
+	healthHandler := handlers.NewHealthHandler(checker)
+	r.GET("/health", healthHandler.Livez)
+	r.GET("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
+
+	// Prometheus 指标
+	if cfg.Metrics.Enabled {
+		r.GET(cfg.Metrics.Path, middleware.MetricsHandler(cfg.Metrics.Token))
+	}
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+
+	// 初始化处理器
+	sessions := auth.NewSessions(db, cfg.JWT.RefreshExpire)
+	accessTokens := auth.NewAccessTokens(keys, cfg.JWT.Expire)
+	codes := auth.NewCodes(cfg.Account.CodeSecret, map[string]time.Duration{
+		auth.PurposeVerifyEmail:   cfg.Account.VerifyCodeExpire,
+		auth.PurposeResetPassword: cfg.Account.ResetCodeExpire,
+		auth.PurposeLoginMFA:      cfg.MFA.ChallengeExpire,
+	})
+	loginGuard := auth.NewLoginGuard(db, cfg.Login)
+	mfa := auth.NewMFA(db, cfg.MFA.Issuer)
+	userHandler := handlers.NewUserHandler(db, cfg, sessions, accessTokens, loginGuard, codes, mfa, mailer)
+	sessionHandler := handlers.NewSessionHandler(db, cfg, sessions)
+	outbox := mail.NewOutbox(mailer)
+	app.Go("send-mail", outbox.Run)
+	accountHandler := handlers.NewAccountHandler(db, cfg, sessions, codes, mailer, outbox)
+	mfaHandler := handlers.NewMFAHandler(db, cfg, sessions, mfa)
+	identityHandler := handlers.NewIdentityHandler(db, cfg)
+	loginLockHandler := handlers.NewLoginLockHandler(db, cfg, loginGuard)
+	rbacHandler := handlers.NewRBACHandler(db, cfg, enforcer)
+	auditHandler := handlers.NewAuditHandler(db, cfg)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+	searchEngine, err := search.New(ctx, db, cfg.Search)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Search.Backend == "index" && cfg.Search.RefreshInterval > 0 {
+		app.Every("refresh-search-index", cfg.Search.RefreshInterval, func(ctx context.Context) error {
+			return searchEngine.Refresh(ctx)
+		})
+	}
+	viewCounter := views.New(db)
+	app.Go("flush-product-views", func(ctx context.Context) {
+		viewCounter.FlushEvery(ctx, cfg.Product.ViewFlushInterval)
+	})
+	productHandler := handlers.NewProductHandler(db, cfg, searchEngine, viewCounter)
+	categoryHandler := handlers.NewCategoryHandler(db, cfg, searchEngine)
+	searchHandler := handlers.NewSearchHandler(db, cfg, searchEngine)
+	skuHandler := handlers.NewSKUHandler(db, cfg, searchEngine)
+	storage, err := media.New(cfg.Media, &http.Client{Transport: tracing.Transport(nil), Timeout: 30 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	productImageHandler := handlers.NewProductImageHandler(db, cfg, storage)
+	switch {
+	case cfg.Media.Driver == "s3":
+		checker.RegisterOptional("media_storage", health.Reachable(probe, cfg.Media.Endpoint))
+	case strings.HasPrefix(cfg.Media.BaseURL, "/"):
+		// 本地存储的访问地址是站内路径时由本服务提供文件，否则由 Nginx、CDN 等提供
+		r.Static(cfg.Media.BaseURL, cfg.Media.Dir)
+	}
+	cartHandler := handlers.NewCartHandler(db, cfg)
+	addressHandler := handlers.NewAddressHandler(db, cfg)
+	orderHandler := handlers.NewOrderHandler(db, cfg)
+	reviewHandler := handlers.NewReviewHandler(db, cfg)
+
+	paymentHandler, err := handlers.NewPayHandler(db, ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	aiQueryHandler := handlers.NewAIQueryHandler(db, cfg)
+
+	// 接口限流，未启用时各分组的中间件直接放行
+	var limiter ratelimit.Store
+	if cfg.RateLimit.Enabled {
+		if limiter, err = ratelimit.New(ctx, cfg.RateLimit, cfg.Redis); err != nil {
+			return nil, err
+		}
+	}
+	authLimit := middleware.RateLimit(limiter, "auth", cfg.RateLimit.Auth)
+	aiLimit := middleware.RateLimit(limiter, "ai", cfg.RateLimit.AI)
+	productsLimit := middleware.RateLimit(limiter, "products", cfg.RateLimit.Products)
+
+	// JWT 验证公钥
+	r.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
+	// 用户相关路由
+	r.POST("/register", authLimit, userHandler.Register)
+	r.POST("/login", authLimit, userHandler.Login)
+	r.POST("/login/mfa", authLimit, userHandler.LoginMFA)
+	r.POST("/login/wechat/mini", authLimit, userHandler.WechatMiniLogin)
+	r.GET("/login/wechat/authorize", authLimit, userHandler.WechatAuthorizeURL)
+	r.POST("/login/wechat/web", authLimit, userHandler.WechatWebLogin)
+	r.POST("/token/refresh", authLimit, userHandler.RefreshToken)
+	r.POST("/email/verify", authLimit, accountHandler.VerifyEmail)
+	r.POST("/password/forgot", authLimit, accountHandler.ForgotPassword)
+	r.POST("/password/reset", authLimit, accountHandler.ResetPassword)
+
+	// 订单、购物车、地址只有本人或权限策略允许的角色（如管理员、客服）可以访问
+	ownership := middleware.NewOwnership(db, cfg.MFA.RequireForAdmin)
+	ownOrder := ownership.Require("订单", middleware.OwnerOf(&models.Order{}))
+	ownCartItem := ownership.Require("购物车项", middleware.OwnerOf(&models.CartItem{}))
+	ownAddress := ownership.Require("地址", middleware.OwnerOf(&models.Address{}))
+
+	// 需要认证的路由组
+	authorized := r.Group("/")
+	authorized.Use(middleware.Auth(sessions, accessTokens), middleware.RateLimit(limiter, "default", cfg.RateLimit.Default))
+	{
+		// 用户管理
+		authorized.POST("/logout", userHandler.Logout)
+		authorized.GET("/user/info", userHandler.GetUserInfo)
+		authorized.PUT("/user/info", userHandler.UpdateUserInfo)
+		authorized.DELETE("/user", userHandler.DeleteUser)
+		authorized.PUT("/user/password", accountHandler.ChangePassword)
+		authorized.POST("/user/email/verification", accountHandler.ResendVerification)
+
+		// 会话管理
+		authorized.GET("/user/sessions", sessionHandler.ListSessions)
+		authorized.DELETE("/user/sessions/:id", sessionHandler.RevokeSession)
+		authorized.POST("/user/sessions/revoke-all", sessionHandler.RevokeAllSessions)
+
+		// 两步验证
+		authorized.GET("/user/mfa", mfaHandler.GetStatus)
+		authorized.POST("/user/mfa/totp", mfaHandler.EnrollTOTP)
+		authorized.POST("/user/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+		authorized.DELETE("/user/mfa/totp", mfaHandler.DisableTOTP)
+		authorized.POST("/user/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+
+		// 第三方登录绑定
+		authorized.GET("/user/identities", identityHandler.ListIdentities)
+		authorized.POST("/user/identities/wechat", identityHandler.BindWechat)
+		authorized.DELETE("/user/identities/:id", identityHandler.UnbindIdentity)
+
+		// 购物车管理
+		authorized.GET("/cart/items", cartHandler.ListCart)
+		authorized.POST("/cart/items", cartHandler.AddToCart)
+		authorized.PUT("/cart/items/:id", ownCartItem, cartHandler.UpdateCartItem)
+		authorized.DELETE("/cart/items/:id", ownCartItem, cartHandler.RemoveFromCart)
+		authorized.DELETE("/cart/items", cartHandler.EmptyCart)
+
+		// 地址管理
+		authorized.GET("/addresses", addressHandler.ListAddresses)
+		authorized.POST("/addresses", addressHandler.CreateAddress)
+		authorized.PUT("/addresses/:id", ownAddress, addressHandler.UpdateAddress)
+		authorized.DELETE("/addresses/:id", ownAddress, addressHandler.DeleteAddress)
+
+		// 订单管理
+		authorized.POST("/orders", orderHandler.CreateOrder)
+		authorized.GET("/orders", orderHandler.GetOrders)
+		authorized.GET("/orders/:id", ownOrder, orderHandler.GetOrder)
+		authorized.PUT("/orders/:id", ownOrder, orderHandler.UpdateOrder)
+		authorized.POST("/orders/:id/cancel", ownOrder, orderHandler.CancelOrder)
+
+		// 商品评价，只能评价本人已支付订单中的商品
+		authorized.POST("/products/:id/reviews", reviewHandler.CreateReview)
+
+		// 支付管理
+		authorized.POST("/payments", paymentHandler.Charge)        // 支付接口
+		authorized.GET("/payments/:id", paymentHandler.GetPayment) // 更具用户id和支付状态查询记录
+
+		// AI 查询
+		authorized.POST("/ai/query", aiLimit, aiQueryHandler.Query)
+	}
+
+	// 需要管理员权限的路由组
+	admin := authorized.Group("/admin")
+	admin.Use(middleware.RBACMiddleware(cfg.MFA.RequireForAdmin))
+	{
+		// 商品管理
+		admin.POST("/products", productHandler.CreateProduct)
+		admin.PUT("/products/:id", productHandler.UpdateProduct)
+		admin.DELETE("/products/:id", productHandler.DeleteProduct)
+		admin.PUT("/products/:id/options", skuHandler.SetOptions)
+		admin.PUT("/products/:id/skus/:sku_id", skuHandler.UpdateSKU)
+		admin.POST("/products/:id/images", productImageHandler.UploadImages)
+		admin.PUT("/products/:id/images/order", productImageHandler.ReorderImages)
+		admin.DELETE("/products/:id/images/:image_id", productImageHandler.DeleteImage)
+
+		// 商品分类
+		admin.POST("/categories", categoryHandler.CreateCategory)
+		admin.PUT("/categories/:id", categoryHandler.UpdateCategory)
+		admin.PUT("/categories/:id/move", categoryHandler.MoveCategory)
+		admin.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+
+		// 搜索索引
+		admin.POST("/search/reindex", searchHandler.Reindex)
+
+		// 登录锁定
+		admin.GET("/login-locks", loginLockHandler.ListLocks)
+		admin.POST("/login-locks/unlock", loginLockHandler.Unlock)
+
+		// 角色和权限
+		admin.GET("/policies", rbacHandler.ListPolicies)
+		admin.POST("/policies", rbacHandler.AddPolicy)
+		admin.DELETE("/policies", rbacHandler.RemovePolicy)
+		admin.GET("/roles", rbacHandler.ListRoles)
+		admin.GET("/roles/:role/users", rbacHandler.ListRoleUsers)
+		admin.PUT("/roles/:role/users/:user_id", rbacHandler.AssignRole)
+		admin.DELETE("/roles/:role/users/:user_id", rbacHandler.RevokeRole)
+
+		// 审计日志
+		admin.GET("/audit-logs", auditHandler.ListLogs)
+	}
+
+	// 不需要认证的路由
+	r.GET("/products", productsLimit, productHandler.ListProducts)
+	r.GET("/products/search", productsLimit, searchHandler.Search)
+	r.GET("/products/:id", productsLimit, productHandler.GetProduct)
+	r.GET("/products/:id/skus", productsLimit, skuHandler.ListSKUs)
+	r.GET("/categories", productsLimit, categoryHandler.ListCategories)
+
+	// 支付回调接口（不需要认证）
+	r.POST("/payments/callback", func(c *gin.Context) {
+		paymentHandler.AlipayNotify(c.Writer, c.Request)
+	}) // 支付宝回调接口
+	r.POST("/payments/wechat/callback", func(c *gin.Context) {
+		paymentHandler.WxPayNotify(c.Writer, c.Request)
+	}) // 微信支付回调接口
+
+	return r, nil
+}
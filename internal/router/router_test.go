@@ -0,0 +1,596 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"qaqmall/models"
+)
+
+func TestHealth(t *testing.T) {
+	s := newTestServer(t)
+	s.run([]routeCase{
+		{name: "health", method: http.MethodGet, path: "/health", want: http.StatusOK},
+	})
+}
+
+func TestUserRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+	token := s.login("alice", "password")
+	_, otherToken := s.loginAsUser("bob")
+
+	s.run([]routeCase{
+		{name: "register missing password", method: http.MethodPost, path: "/register",
+			body: map[string]string{"username": "carol"}, want: http.StatusBadRequest},
+		{name: "register duplicate username", method: http.MethodPost, path: "/register",
+			body: map[string]string{"username": "alice", "password": "password"}, want: http.StatusBadRequest},
+		{name: "register invalid json", method: http.MethodPost, path: "/register",
+			body: "{", want: http.StatusBadRequest},
+		{name: "login wrong password", method: http.MethodPost, path: "/login",
+			body: map[string]string{"username": "alice", "password": "wrong"}, want: http.StatusUnauthorized},
+		{name: "login unknown user", method: http.MethodPost, path: "/login",
+			body: map[string]string{"username": "nobody", "password": "password"}, want: http.StatusUnauthorized},
+		{name: "login missing fields", method: http.MethodPost, path: "/login",
+			body: map[string]string{}, want: http.StatusBadRequest},
+		{name: "user info without token", method: http.MethodGet, path: "/user/info", want: http.StatusUnauthorized},
+		{name: "user info with invalid token", method: http.MethodGet, path: "/user/info",
+			token: "not-a-jwt", want: http.StatusUnauthorized},
+		{name: "get user info", method: http.MethodGet, path: "/user/info", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if !strings.Contains(w.Body.String(), `"alice"`) {
+					t.Errorf("用户信息中缺少用户名: %s", w.Body.String())
+				}
+			}},
+		{name: "update user info", method: http.MethodPut, path: "/user/info", token: token,
+			body: map[string]string{"email": "alice@example.com", "phone": "13800000000"}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var user models.User
+				s.db.Where("username = ?", "alice").First(&user)
+				if user.Email != "alice@example.com" || user.Phone != "13800000000" {
+					t.Errorf("用户信息未更新: %+v", user)
+				}
+			}},
+		{name: "logout", method: http.MethodPost, path: "/logout", token: token, want: http.StatusOK},
+		{name: "token rejected after logout", method: http.MethodGet, path: "/user/info", token: token,
+			want: http.StatusUnauthorized},
+		{name: "delete user", method: http.MethodDelete, path: "/user", token: otherToken, want: http.StatusOK},
+		{name: "token rejected after delete", method: http.MethodGet, path: "/user/info", token: otherToken,
+			want: http.StatusUnauthorized},
+		{name: "deleted user cannot login", method: http.MethodPost, path: "/login",
+			body: map[string]string{"username": "bob", "password": "password"}, want: http.StatusUnauthorized},
+		{name: "deleted username cannot register again", method: http.MethodPost, path: "/register",
+			body: map[string]string{"username": "bob", "password": "password"}, want: http.StatusConflict},
+	})
+}
+
+func TestTokenRefreshRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+	_, refreshToken := s.loginTokens("alice", "password")
+	logoutToken, logoutRefreshToken := s.loginTokens("alice", "password")
+
+	// rotated 记录每次轮换得到的新令牌，供后续用例使用
+	var rotated struct {
+		Data struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+
+	s.run([]routeCase{
+		{name: "refresh missing token", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{}, want: http.StatusBadRequest},
+		{name: "refresh unknown token", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": "unknown"}, want: http.StatusUnauthorized},
+		{name: "refresh", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": refreshToken}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				decode(t, w, &rotated)
+				if rotated.Data.Token == "" || rotated.Data.RefreshToken == "" || rotated.Data.RefreshToken == refreshToken {
+					t.Fatalf("刷新后应返回新的令牌: %s", w.Body.String())
+				}
+				if got := s.do(http.MethodGet, "/user/info", rotated.Data.Token, nil); got.Code != http.StatusOK {
+					t.Errorf("新的 access token 不可用: %d", got.Code)
+				}
+			}},
+		{name: "reuse rotated token", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": refreshToken}, want: http.StatusUnauthorized},
+		{name: "family revoked after reuse", method: http.MethodPost, path: "/token/refresh",
+			body: &rotated.Data, want: http.StatusUnauthorized},
+		{name: "logout", method: http.MethodPost, path: "/logout", token: logoutToken, want: http.StatusOK},
+		{name: "refresh token revoked by logout", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": logoutRefreshToken}, want: http.StatusUnauthorized},
+	})
+}
+
+func TestSessionRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser("alice", "password")
+	_, bobToken := s.loginAsUser("bob")
+
+	// loginDevice 以指定设备名登录，返回 access token 和 refresh token
+	loginDevice := func(device string) (string, string) {
+		w := s.do(http.MethodPost, "/login", "", map[string]string{
+			"username": "alice",
+			"password": "password",
+			"device":   device,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("登录失败: %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			} `json:"data"`
+		}
+		decode(t, w, &resp)
+		return resp.Data.Token, resp.Data.RefreshToken
+	}
+	phoneToken, _ := loginDevice("iPhone")
+	laptopToken, laptopRefreshToken := loginDevice("MacBook")
+	tabletToken, tabletRefreshToken := loginDevice("iPad")
+
+	type sessionItem struct {
+		ID      string `json:"id"`
+		Device  string `json:"device"`
+		Current bool   `json:"current"`
+	}
+	var sessions struct {
+		Data struct {
+			Items []sessionItem `json:"items"`
+		} `json:"data"`
+	}
+	// sessionOf 返回指定设备的会话ID
+	sessionOf := func(device string) string {
+		for _, item := range sessions.Data.Items {
+			if item.Device == device {
+				return item.ID
+			}
+		}
+		t.Fatalf("未找到设备 %s 的会话", device)
+		return ""
+	}
+
+	s.run([]routeCase{
+		{name: "list sessions without token", method: http.MethodGet, path: "/user/sessions", want: http.StatusUnauthorized},
+		{name: "list sessions", method: http.MethodGet, path: "/user/sessions", token: phoneToken, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				decode(t, w, &sessions)
+				if len(sessions.Data.Items) != 3 {
+					t.Fatalf("期望 3 个会话，实际 %d", len(sessions.Data.Items))
+				}
+				for _, item := range sessions.Data.Items {
+					if item.Current != (item.Device == "iPhone") {
+						t.Errorf("会话 %s 的 current 标记错误", item.Device)
+					}
+				}
+			}},
+	})
+
+	s.run([]routeCase{
+		{name: "revoke unknown session", method: http.MethodDelete, path: "/user/sessions/unknown", token: phoneToken,
+			want: http.StatusNotFound},
+		{name: "revoke other user's session", method: http.MethodDelete, path: "/user/sessions/" + sessionOf("MacBook"),
+			token: bobToken, want: http.StatusNotFound},
+		{name: "revoke session", method: http.MethodDelete, path: "/user/sessions/" + sessionOf("MacBook"),
+			token: phoneToken, want: http.StatusOK},
+		{name: "revoked session token rejected", method: http.MethodGet, path: "/user/info", token: laptopToken,
+			want: http.StatusUnauthorized},
+		{name: "revoked session refresh rejected", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": laptopRefreshToken}, want: http.StatusUnauthorized},
+		{name: "other sessions still valid", method: http.MethodGet, path: "/user/info", token: tabletToken,
+			want: http.StatusOK},
+		{name: "revoked session not listed", method: http.MethodGet, path: "/user/sessions", token: phoneToken,
+			want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Items []sessionItem `json:"items"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Data.Items) != 2 {
+					t.Errorf("期望 2 个会话，实际 %d", len(resp.Data.Items))
+				}
+			}},
+		{name: "revoke all sessions", method: http.MethodPost, path: "/user/sessions/revoke-all", token: phoneToken,
+			want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Revoked int64 `json:"revoked"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				if resp.Data.Revoked != 2 {
+					t.Errorf("期望结束 2 个会话，实际 %d", resp.Data.Revoked)
+				}
+			}},
+		{name: "current session token rejected", method: http.MethodGet, path: "/user/info", token: phoneToken,
+			want: http.StatusUnauthorized},
+		{name: "all session tokens rejected", method: http.MethodGet, path: "/user/info", token: tabletToken,
+			want: http.StatusUnauthorized},
+		{name: "all session refresh rejected", method: http.MethodPost, path: "/token/refresh",
+			body: map[string]string{"refresh_token": tabletRefreshToken}, want: http.StatusUnauthorized},
+		{name: "other user unaffected", method: http.MethodGet, path: "/user/info", token: bobToken, want: http.StatusOK},
+	})
+}
+
+func TestCartRoutes(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+	_, otherToken := s.loginAsUser("bob")
+	product := s.seedProduct("键盘", 199, 10)
+
+	s.run([]routeCase{
+		{name: "list empty cart", method: http.MethodGet, path: "/cart/items", token: token, want: http.StatusOK},
+		{name: "add unknown product", method: http.MethodPost, path: "/cart/items", token: token,
+			body: map[string]interface{}{"product_id": 999, "quantity": 1}, want: http.StatusNotFound},
+		{name: "add to cart", method: http.MethodPost, path: "/cart/items", token: token,
+			body: map[string]interface{}{"product_id": product.ID, "quantity": 1}, want: http.StatusOK},
+		{name: "add same product merges quantity", method: http.MethodPost, path: "/cart/items", token: token,
+			body: map[string]interface{}{"product_id": product.ID, "quantity": 2}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var item models.CartItem
+				decode(t, w, &item)
+				if item.Quantity != 3 {
+					t.Errorf("期望数量 3，实际 %d", item.Quantity)
+				}
+			}},
+		{name: "list cart", method: http.MethodGet, path: "/cart/items", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Items []models.CartItem `json:"items"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Items) != 1 {
+					t.Errorf("期望 1 个购物车项，实际 %d", len(resp.Items))
+				}
+			}},
+		{name: "update cart item", method: http.MethodPut, path: "/cart/items/1", token: token,
+			body: map[string]interface{}{"quantity": 5, "selected": true}, want: http.StatusOK},
+		{name: "update cart item invalid id", method: http.MethodPut, path: "/cart/items/abc", token: token,
+			body: map[string]interface{}{"quantity": 5}, want: http.StatusBadRequest},
+		{name: "update other user's cart item", method: http.MethodPut, path: "/cart/items/1", token: otherToken,
+			body: map[string]interface{}{"quantity": 5}, want: http.StatusNotFound},
+		{name: "remove other user's cart item", method: http.MethodDelete, path: "/cart/items/1", token: otherToken,
+			want: http.StatusNotFound},
+		{name: "remove cart item", method: http.MethodDelete, path: "/cart/items/1", token: token, want: http.StatusOK},
+		{name: "remove missing cart item", method: http.MethodDelete, path: "/cart/items/1", token: token,
+			want: http.StatusNotFound},
+		{name: "add again", method: http.MethodPost, path: "/cart/items", token: token,
+			body: map[string]interface{}{"product_id": product.ID, "quantity": 1}, want: http.StatusOK},
+		{name: "empty cart", method: http.MethodDelete, path: "/cart/items", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var count int64
+				s.db.Model(&models.CartItem{}).Count(&count)
+				if count != 0 {
+					t.Errorf("清空后仍有 %d 个购物车项", count)
+				}
+			}},
+		{name: "cart requires auth", method: http.MethodGet, path: "/cart/items", want: http.StatusUnauthorized},
+	})
+}
+
+func TestAddressRoutes(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+	_, otherToken := s.loginAsUser("bob")
+
+	address := map[string]interface{}{
+		"name":     "张三",
+		"phone":    "13800000000",
+		"province": "浙江省",
+		"city":     "杭州市",
+		"district": "西湖区",
+		"street":   "文三路",
+		"detail":   "1号",
+	}
+
+	s.run([]routeCase{
+		{name: "create first address is default", method: http.MethodPost, path: "/addresses", token: token,
+			body: address, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var got models.Address
+				decode(t, w, &got)
+				if !got.IsDefault {
+					t.Error("第一个地址应设为默认地址")
+				}
+			}},
+		{name: "create address invalid json", method: http.MethodPost, path: "/addresses", token: token,
+			body: "{", want: http.StatusBadRequest},
+		{name: "list addresses", method: http.MethodGet, path: "/addresses", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var got []models.Address
+				decode(t, w, &got)
+				if len(got) != 1 {
+					t.Errorf("期望 1 个地址，实际 %d", len(got))
+				}
+			}},
+		{name: "other user sees no addresses", method: http.MethodGet, path: "/addresses", token: otherToken,
+			want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var got []models.Address
+				decode(t, w, &got)
+				if len(got) != 0 {
+					t.Errorf("期望 0 个地址，实际 %d", len(got))
+				}
+			}},
+		{name: "update address", method: http.MethodPut, path: "/addresses/1", token: token,
+			body: map[string]interface{}{"detail": "2号"}, want: http.StatusOK},
+		{name: "update other user's address", method: http.MethodPut, path: "/addresses/1", token: otherToken,
+			body: map[string]interface{}{"detail": "3号"}, want: http.StatusNotFound},
+		{name: "update address invalid id", method: http.MethodPut, path: "/addresses/abc", token: token,
+			body: map[string]interface{}{"detail": "2号"}, want: http.StatusBadRequest},
+		{name: "delete other user's address", method: http.MethodDelete, path: "/addresses/1", token: otherToken,
+			want: http.StatusNotFound},
+		{name: "delete address", method: http.MethodDelete, path: "/addresses/1", token: token, want: http.StatusOK},
+		{name: "delete missing address", method: http.MethodDelete, path: "/addresses/1", token: token,
+			want: http.StatusNotFound},
+	})
+}
+
+func TestOrderRoutes(t *testing.T) {
+	s := newTestServer(t)
+	userID, token := s.loginAsUser("alice")
+	otherID, otherToken := s.loginAsUser("bob")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(userID)
+	otherAddress := s.seedAddress(otherID)
+
+	orderID := s.seedOrder(token, address.ID, product.ID, 2)
+
+	s.run([]routeCase{
+		{name: "stock reserved by order", method: http.MethodGet, path: "/products", want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assertStock(t, s, product.ID, 8)
+			}},
+		{name: "create order invalid request", method: http.MethodPost, path: "/orders", token: token,
+			body: map[string]interface{}{"address_id": address.ID}, want: http.StatusBadRequest},
+		{name: "create order with other user's address", method: http.MethodPost, path: "/orders", token: token,
+			body: map[string]interface{}{
+				"address_id": otherAddress.ID,
+				"items":      []map[string]interface{}{{"product_id": product.ID, "quantity": 1}},
+			}, want: http.StatusForbidden},
+		{name: "create order with unknown product", method: http.MethodPost, path: "/orders", token: token,
+			body: map[string]interface{}{
+				"address_id": address.ID,
+				"items":      []map[string]interface{}{{"product_id": 999, "quantity": 1}},
+			}, want: http.StatusBadRequest},
+		{name: "create order over stock", method: http.MethodPost, path: "/orders", token: token,
+			body: map[string]interface{}{
+				"address_id": address.ID,
+				"items":      []map[string]interface{}{{"product_id": product.ID, "quantity": 100}},
+			}, want: http.StatusBadRequest,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assertStock(t, s, product.ID, 8)
+			}},
+		{name: "list orders", method: http.MethodGet, path: "/orders", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Items []models.Order `json:"items"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Items) != 1 {
+					t.Errorf("期望 1 个订单，实际 %d", len(resp.Items))
+				}
+			}},
+		{name: "get order", method: http.MethodGet, path: idPath("/orders/%d", orderID), token: token,
+			want: http.StatusOK},
+		{name: "get missing order", method: http.MethodGet, path: "/orders/999", token: token,
+			want: http.StatusNotFound},
+		{name: "get other user's order", method: http.MethodGet, path: idPath("/orders/%d", orderID),
+			token: otherToken, want: http.StatusNotFound},
+		{name: "update order remark", method: http.MethodPut, path: idPath("/orders/%d", orderID), token: token,
+			body: map[string]interface{}{"remark": "尽快发货"}, want: http.StatusOK},
+		{name: "update order with other user's address", method: http.MethodPut,
+			path: idPath("/orders/%d", orderID), token: token,
+			body: map[string]interface{}{"address_id": otherAddress.ID}, want: http.StatusForbidden},
+		{name: "update other user's order", method: http.MethodPut, path: idPath("/orders/%d", orderID),
+			token: otherToken, body: map[string]interface{}{"remark": "x"}, want: http.StatusNotFound},
+		{name: "cancel other user's order", method: http.MethodPost, path: idPath("/orders/%d/cancel", orderID),
+			token: otherToken, want: http.StatusNotFound},
+		{name: "cancel order restores stock", method: http.MethodPost, path: idPath("/orders/%d/cancel", orderID),
+			token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assertStock(t, s, product.ID, 10)
+			}},
+		{name: "cancel cancelled order", method: http.MethodPost, path: idPath("/orders/%d/cancel", orderID),
+			token: token, want: http.StatusBadRequest},
+		{name: "update cancelled order", method: http.MethodPut, path: idPath("/orders/%d", orderID),
+			token: token, body: map[string]interface{}{"remark": "x"}, want: http.StatusBadRequest},
+	})
+}
+
+func TestPaymentRoutes(t *testing.T) {
+	s := newTestServer(t)
+	userID, token := s.loginAsUser("alice")
+	product := s.seedProduct("键盘", 199, 10)
+	address := s.seedAddress(userID)
+	orderID := s.seedOrder(token, address.ID, product.ID, 1)
+	wechatOrderID := s.seedOrder(token, address.ID, product.ID, 1)
+	bobID, bobToken := s.loginAsUser("bob")
+
+	s.run([]routeCase{
+		{name: "no payments yet", method: http.MethodGet, path: "/payments/1", token: token,
+			want: http.StatusNotFound},
+		{name: "charge unknown order", method: http.MethodPost, path: "/payments", token: token,
+			body: map[string]interface{}{"order_id": 999, "user_id": userID, "amount": 199,
+				"payment_method": string(models.PaymentMethodAlipay)},
+			want: http.StatusBadRequest},
+		{name: "charge other user's order", method: http.MethodPost, path: "/payments", token: bobToken,
+			body: map[string]interface{}{"order_id": orderID, "user_id": bobID, "amount": 199,
+				"payment_method": string(models.PaymentMethodAlipay)},
+			want: http.StatusBadRequest},
+		// 支付用户和金额取自订单，忽略请求中的 user_id 和 amount
+		{name: "charge with alipay", method: http.MethodPost, path: "/payments", token: token,
+			body: map[string]interface{}{"order_id": orderID, "user_id": bobID, "amount": 0.01,
+				"payment_method": string(models.PaymentMethodAlipay)},
+			want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					URL string `json:"url"`
+				}
+				decode(t, w, &resp)
+				if !strings.Contains(resp.URL, "alipay") {
+					t.Errorf("期望返回支付宝支付链接，实际 %q", resp.URL)
+				}
+				var payment models.Payment
+				if err := s.db.Where("order_id = ?", orderID).First(&payment).Error; err != nil {
+					t.Fatalf("查询支付记录失败: %v", err)
+				}
+				if payment.UserID != userID || payment.Amount != 199 {
+					t.Errorf("支付记录应属于下单用户且金额为订单金额，实际用户 %d 金额 %v", payment.UserID, payment.Amount)
+				}
+			}},
+		{name: "charge again reuses pending payment", method: http.MethodPost, path: "/payments", token: token,
+			body: map[string]interface{}{"order_id": orderID, "user_id": userID, "amount": 199,
+				"payment_method": string(models.PaymentMethodAlipay)},
+			want: http.StatusOK},
+		{name: "wechat pay disabled", method: http.MethodPost, path: "/payments", token: token,
+			body: map[string]interface{}{"order_id": wechatOrderID, "user_id": userID, "amount": 199,
+				"payment_method": string(models.PaymentMethodWechat)},
+			want: http.StatusBadRequest},
+		{name: "list payments", method: http.MethodGet, path: "/payments/1", token: token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Payments []models.Payment `json:"payments"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Payments) != 2 {
+					t.Fatalf("期望 2 条支付记录，实际 %d", len(resp.Payments))
+				}
+				for _, payment := range resp.Payments {
+					if payment.Status != models.PaymentStatusPending {
+						t.Errorf("支付记录 %s 状态为 %s，期望待支付", payment.PaymentNumber, payment.Status)
+					}
+				}
+			}},
+		{name: "list payments by status", method: http.MethodGet, path: "/payments/1?status=paid", token: token,
+			want: http.StatusNotFound},
+		{name: "payments require auth", method: http.MethodPost, path: "/payments",
+			body: map[string]interface{}{"order_id": orderID}, want: http.StatusUnauthorized},
+		{name: "alipay callback with invalid signature", method: http.MethodPost, path: "/payments/callback",
+			body: url.Values{"out_trade_no": {"1"}, "trade_status": {"TRADE_SUCCESS"}, "sign": {"invalid"}}, want: http.StatusBadRequest},
+		{name: "wechat callback with invalid xml", method: http.MethodPost, path: "/payments/wechat/callback",
+			body: "not xml", want: http.StatusBadRequest},
+	})
+}
+
+func TestAdminProductRoutes(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.loginAsAdmin("admin1")
+	_, userToken := s.loginAsUser("alice")
+
+	product := map[string]interface{}{"name": "鼠标", "price": 99, "stock": 5, "is_on_sale": true}
+
+	s.run([]routeCase{
+		{name: "user cannot create product", method: http.MethodPost, path: "/admin/products", token: userToken,
+			body: product, want: http.StatusForbidden},
+		{name: "anonymous cannot create product", method: http.MethodPost, path: "/admin/products",
+			body: product, want: http.StatusUnauthorized},
+		{name: "create product", method: http.MethodPost, path: "/admin/products", token: adminToken,
+			body: product, want: http.StatusCreated},
+		{name: "create product invalid json", method: http.MethodPost, path: "/admin/products", token: adminToken,
+			body: "{", want: http.StatusBadRequest},
+		{name: "list products", method: http.MethodGet, path: "/products?page=1&pageSize=10", want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Total int64            `json:"total"`
+					Items []models.Product `json:"items"`
+				}
+				decode(t, w, &resp)
+				if resp.Total != 1 || len(resp.Items) != 1 || resp.Items[0].Name != "鼠标" {
+					t.Errorf("商品列表不符合预期: %+v", resp)
+				}
+			}},
+		{name: "update product", method: http.MethodPut, path: "/admin/products/1", token: adminToken,
+			body: map[string]interface{}{"price": 89}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var got models.Product
+				decode(t, w, &got)
+				if got.Price != 89 || got.Name != "鼠标" {
+					t.Errorf("商品更新不符合预期: %+v", got)
+				}
+			}},
+		{name: "user cannot update product", method: http.MethodPut, path: "/admin/products/1", token: userToken,
+			body: map[string]interface{}{"price": 1}, want: http.StatusForbidden},
+		{name: "update missing product", method: http.MethodPut, path: "/admin/products/999", token: adminToken,
+			body: map[string]interface{}{"price": 1}, want: http.StatusNotFound},
+		{name: "user cannot delete product", method: http.MethodDelete, path: "/admin/products/1",
+			token: userToken, want: http.StatusForbidden},
+		{name: "delete product", method: http.MethodDelete, path: "/admin/products/1", token: adminToken,
+			want: http.StatusOK},
+		{name: "delete missing product", method: http.MethodDelete, path: "/admin/products/1", token: adminToken,
+			want: http.StatusNotFound},
+		{name: "deleted product not listed", method: http.MethodGet, path: "/products", want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Total int64 `json:"total"`
+				}
+				decode(t, w, &resp)
+				if resp.Total != 0 {
+					t.Errorf("期望 0 个商品，实际 %d", resp.Total)
+				}
+			}},
+	})
+}
+
+func TestAIQueryRoutes(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+	s.seedProduct("键盘", 199, 10)
+
+	s.run([]routeCase{
+		{name: "query requires auth", method: http.MethodPost, path: "/ai/query",
+			body: map[string]string{"query": "有什么商品"}, want: http.StatusUnauthorized},
+		{name: "query missing text", method: http.MethodPost, path: "/ai/query", token: token,
+			body: map[string]string{}, want: http.StatusBadRequest},
+		{name: "query", method: http.MethodPost, path: "/ai/query", token: token,
+			body: map[string]string{"query": "有什么商品"}, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Answer string `json:"answer"`
+				}
+				decode(t, w, &resp)
+				if resp.Answer != fakeLLMAnswer {
+					t.Errorf("期望回答 %q，实际 %q", fakeLLMAnswer, resp.Answer)
+				}
+				if len(s.llmRequests) != 1 {
+					t.Fatalf("期望 LLM 收到 1 个请求，实际 %d", len(s.llmRequests))
+				}
+				if !strings.Contains(fmt.Sprint(s.llmRequests[0]["messages"]), "键盘") {
+					t.Error("发送给 LLM 的上下文中缺少商品信息")
+				}
+			}},
+	})
+}
+
+func TestAIQueryNotConfigured(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+	s.cfg.OpenAI.APIKey = ""
+
+	s.run([]routeCase{
+		{name: "query without api key", method: http.MethodPost, path: "/ai/query", token: token,
+			body: map[string]string{"query": "有什么商品"}, want: http.StatusServiceUnavailable},
+	})
+}
+
+// assertStock 断言商品当前库存
+func assertStock(t *testing.T, s *testServer, productID uint64, want int) {
+	t.Helper()
+	var product models.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		t.Fatalf("查询商品失败: %v", err)
+	}
+	if product.Stock != want {
+		t.Errorf("期望库存 %d，实际 %d", want, product.Stock)
+	}
+}
@@ -0,0 +1,217 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"qaqmall/config"
+	"qaqmall/handlers"
+	"qaqmall/internal/search"
+	"qaqmall/models"
+)
+
+// searchResponse 商品搜索接口的响应
+type searchResponse struct {
+	Items  []handlers.SearchItem `json:"items"`
+	Total  int64                 `json:"total"`
+	Facets search.Facets         `json:"facets"`
+}
+
+// names 返回搜索结果中的商品名称
+func (r searchResponse) names() []string {
+	names := make([]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+// search 调用商品搜索接口
+func (s *testServer) search(query url.Values) searchResponse {
+	s.t.Helper()
+	w := s.do(http.MethodGet, "/products/search?"+query.Encode(), "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("搜索商品失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data searchResponse `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data
+}
+
+// createProduct 通过管理员接口创建商品，使搜索索引同步更新
+func (s *testServer) createProduct(token string, product map[string]interface{}) models.Product {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/admin/products", token, product)
+	if w.Code != http.StatusCreated {
+		s.t.Fatalf("创建商品失败: %d %s", w.Code, w.Body.String())
+	}
+	var created models.Product
+	decode(s.t, w, &created)
+	return created
+}
+
+func TestSearchIndexRefreshJob(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Search.Backend = "index"
+		cfg.Search.RefreshInterval = 20 * time.Millisecond
+	})
+
+	// 直接写入数据库的商品由定期重建索引的任务收录，不需要调用重建接口
+	s.seedProduct("机械键盘", 399, 5)
+	deadline := time.Now().Add(2 * time.Second)
+	for s.search(url.Values{"q": {"键盘"}}).Total != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("定期重建索引后应能搜到新商品")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 重建任务由生命周期管理器调度，心跳纳入定时任务的就绪检查
+	details, err := s.app.CheckJobs(context.Background())
+	if err != nil {
+		t.Fatalf("定时任务检查失败: %v", err)
+	}
+	if _, ok := details["refresh-search-index"]; !ok {
+		t.Errorf("定时任务中缺少 refresh-search-index: %v", details)
+	}
+}
+
+func TestProductSearch(t *testing.T) {
+	for _, backend := range []string{"sql", "index"} {
+		t.Run(backend, func(t *testing.T) {
+			testProductSearch(t, newTestServer(t, func(cfg *config.Config) { cfg.Search.Backend = backend }))
+		})
+	}
+}
+
+func testProductSearch(t *testing.T, s *testServer) {
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, adminToken := s.loginAsAdmin("admin1")
+
+	digital := s.createCategory(adminToken, "数码", 0)
+	phones := s.createCategory(adminToken, "手机", digital.ID)
+	accessories := s.createCategory(adminToken, "配件", digital.ID)
+	books := s.createCategory(adminToken, "图书", 0)
+
+	iphone := s.createProduct(adminToken, map[string]interface{}{"name": "Apple iPhone 15 手机", "description": "旗舰手机，A16 芯片",
+		"price": 5999, "stock": 10, "is_on_sale": true, "category_ids": []uint64{phones.ID}})
+	s.createProduct(adminToken, map[string]interface{}{"name": "小米手机 14", "description": "徕卡影像",
+		"price": 3999, "stock": 0, "is_on_sale": true, "category_ids": []uint64{phones.ID}})
+	phoneCase := s.createProduct(adminToken, map[string]interface{}{"name": "手机壳 透明", "description": "适用于 iPhone 15 的保护壳",
+		"price": 29, "stock": 100, "is_on_sale": true, "category_ids": []uint64{accessories.ID}})
+	book := s.createProduct(adminToken, map[string]interface{}{"name": "Go 语言编程", "description": "<b>经典</b>教材",
+		"price": 89, "stock": 5, "is_on_sale": true, "category_ids": []uint64{books.ID}})
+	s.createProduct(adminToken, map[string]interface{}{"name": "旧款手机", "price": 999, "stock": 3, "is_on_sale": false,
+		"category_ids": []uint64{phones.ID}})
+
+	// 关键词匹配名称和描述，默认只返回在售商品
+	result := s.search(url.Values{"q": {"手机"}})
+	if result.Total != 3 || len(result.Items) != 3 {
+		t.Fatalf("期望搜到 3 个在售的手机相关商品，实际 %d: %v", result.Total, result.names())
+	}
+	wantCategories := map[string]int64{"手机": 2, "配件": 1}
+	if len(result.Facets.Categories) != len(wantCategories) {
+		t.Errorf("分类分面不正确: %+v", result.Facets.Categories)
+	}
+	for _, facet := range result.Facets.Categories {
+		if wantCategories[facet.Name] != facet.Count {
+			t.Errorf("分类分面 %s(%d) 数量为 %d", facet.Name, facet.ID, facet.Count)
+		}
+	}
+	var prices []int64
+	for _, bucket := range result.Facets.Prices {
+		prices = append(prices, bucket.Count)
+	}
+	if fmt.Sprint(prices) != "[1 0 0 1 1]" || result.Facets.Prices[4].Max != nil || result.Facets.Prices[4].Min != 5000 {
+		t.Errorf("价格分面不正确: %+v", result.Facets.Prices)
+	}
+
+	// 不区分大小写，高亮名称和描述中的匹配，其余部分做 HTML 转义
+	result = s.search(url.Values{"q": {"iphone"}, "sort": {"price_asc"}})
+	if fmt.Sprint(result.names()) != "[手机壳 透明 Apple iPhone 15 手机]" {
+		t.Fatalf("搜索 iphone 的结果不正确: %v", result.names())
+	}
+	if got := result.Items[0].Highlight["description"]; got != "适用于 <em>iPhone</em> 15 的保护壳" {
+		t.Errorf("描述高亮不正确: %q", got)
+	}
+	if got := result.Items[1].Highlight["name"]; got != "Apple <em>iPhone</em> 15 手机" {
+		t.Errorf("名称高亮不正确: %q", got)
+	}
+	if got := s.search(url.Values{"q": {"经典"}}); len(got.Items) != 1 || got.Items[0].Highlight["description"] != "&lt;b&gt;<em>经典</em>&lt;/b&gt;教材" {
+		t.Errorf("高亮时应转义 HTML: %+v", got.Items)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query url.Values
+		want  string
+	}{
+		{"in stock", url.Values{"q": {"手机"}, "in_stock": {"true"}, "sort": {"price_asc"}}, "[手机壳 透明 Apple iPhone 15 手机]"},
+		{"price asc", url.Values{"q": {"手机"}, "sort": {"price_asc"}}, "[手机壳 透明 小米手机 14 Apple iPhone 15 手机]"},
+		{"price desc", url.Values{"q": {"手机"}, "sort": {"price_desc"}}, "[Apple iPhone 15 手机 小米手机 14 手机壳 透明]"},
+		{"price range newest", url.Values{"min_price": {"50"}, "max_price": {"4000"}}, "[Go 语言编程 小米手机 14]"},
+		{"category with descendants", url.Values{"category_id": {fmt.Sprint(digital.ID)}, "sort": {"price_asc"}},
+			"[手机壳 透明 小米手机 14 Apple iPhone 15 手机]"},
+		{"off sale", url.Values{"on_sale": {"false"}}, "[旧款手机]"},
+		{"all terms required", url.Values{"q": {"iphone 保护壳"}}, "[手机壳 透明]"},
+		{"no match", url.Values{"q": {"电视"}}, "[]"},
+		{"paging", url.Values{"q": {"手机"}, "sort": {"price_asc"}, "page": {"2"}, "pageSize": {"2"}}, "[Apple iPhone 15 手机]"},
+	} {
+		if got := s.search(tc.query); fmt.Sprint(got.names()) != tc.want {
+			t.Errorf("%s: 期望 %s，实际 %v", tc.name, tc.want, got.names())
+		}
+	}
+
+	// 按销量排序只统计已支付的订单，库存和销量的变化在重建索引后生效
+	address := s.seedAddress(aliceID)
+	paid := []uint64{s.seedOrder(aliceToken, address.ID, phoneCase.ID, 2), s.seedOrder(aliceToken, address.ID, book.ID, 1)}
+	s.seedOrder(aliceToken, address.ID, iphone.ID, 3)
+	s.db.Model(&models.Order{}).Where("id IN ?", paid).Update("status", models.OrderStatusPaid)
+	if w := s.do(http.MethodPost, "/admin/search/reindex", adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("重建搜索索引失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := s.search(url.Values{"sort": {"sales"}}); fmt.Sprint(got.names()) != "[手机壳 透明 Go 语言编程 小米手机 14 Apple iPhone 15 手机]" {
+		t.Errorf("按销量排序不正确: %v", got.names())
+	}
+
+	// 修改和删除商品后立即生效
+	if w := s.do(http.MethodPut, idPath("/admin/products/%d", book.ID), adminToken, map[string]interface{}{"name": "Rust 编程"}); w.Code != http.StatusOK {
+		t.Fatalf("修改商品失败: %d", w.Code)
+	}
+	if got := s.search(url.Values{"q": {"go"}}); got.Total != 0 {
+		t.Errorf("修改名称后不应再搜到旧名称: %v", got.names())
+	}
+	if got := s.search(url.Values{"q": {"rust"}}); got.Total != 1 {
+		t.Errorf("修改名称后应能搜到新名称: %v", got.names())
+	}
+	if w := s.do(http.MethodDelete, idPath("/admin/products/%d", phoneCase.ID), adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除商品失败: %d", w.Code)
+	}
+	if got := s.search(url.Values{"q": {"手机"}}); got.Total != 2 {
+		t.Errorf("删除后的商品不应再被搜到: %v", got.names())
+	}
+
+	// 直接写入数据库的商品在重建索引后可以搜到
+	s.seedProduct("机械键盘", 399, 5)
+	if w := s.do(http.MethodPost, "/admin/search/reindex", adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("重建搜索索引失败: %d", w.Code)
+	}
+	if got := s.search(url.Values{"q": {"键盘"}}); got.Total != 1 {
+		t.Errorf("重建索引后应能搜到新商品: %v", got.names())
+	}
+
+	s.run([]routeCase{
+		{name: "invalid price", method: http.MethodGet, path: "/products/search?min_price=abc", want: http.StatusBadRequest},
+		{name: "min greater than max", method: http.MethodGet, path: "/products/search?min_price=10&max_price=1", want: http.StatusBadRequest},
+		{name: "invalid on_sale", method: http.MethodGet, path: "/products/search?on_sale=maybe", want: http.StatusBadRequest},
+		{name: "invalid sort", method: http.MethodGet, path: "/products/search?sort=rating", want: http.StatusBadRequest},
+		{name: "missing category", method: http.MethodGet, path: "/products/search?category_id=999", want: http.StatusNotFound},
+		{name: "user cannot reindex", method: http.MethodPost, path: "/admin/search/reindex", token: aliceToken, want: http.StatusForbidden},
+	})
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"qaqmall/models"
+)
+
+// skuList 商品规格接口的响应
+type skuList struct {
+	Options []models.ProductOption `json:"options"`
+	SKUs    []models.ProductSKU    `json:"skus"`
+}
+
+// bySpec 按规格名称（如 红色 / M）索引 SKU
+func (l skuList) bySpec() map[string]models.ProductSKU {
+	skus := make(map[string]models.ProductSKU, len(l.SKUs))
+	for _, sku := range l.SKUs {
+		skus[sku.Name] = sku
+	}
+	return skus
+}
+
+// setOptions 通过管理员接口设置商品规格项并生成 SKU
+func (s *testServer) setOptions(token string, productID uint64, body map[string]interface{}) skuList {
+	s.t.Helper()
+	w := s.do(http.MethodPut, idPath("/admin/products/%d/options", productID), token, body)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("设置商品规格失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data skuList `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data
+}
+
+// skus 获取商品的规格项和启用的 SKU
+func (s *testServer) skus(productID uint64) skuList {
+	s.t.Helper()
+	w := s.do(http.MethodGet, idPath("/products/%d/skus", productID), "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("获取商品规格失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data skuList `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Data
+}
+
+// stocks 返回商品库存和各 SKU（含已停用）的库存
+func (s *testServer) stocks(productID uint64) (int, map[string]int) {
+	s.t.Helper()
+	var product models.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		s.t.Fatalf("查询商品失败: %v", err)
+	}
+	var skus []models.ProductSKU
+	if err := s.db.Where("product_id = ?", productID).Find(&skus).Error; err != nil {
+		s.t.Fatalf("查询SKU失败: %v", err)
+	}
+	stocks := make(map[string]int, len(skus))
+	for _, sku := range skus {
+		stocks[sku.Name] = sku.Stock
+	}
+	return product.Stock, stocks
+}
+
+func TestProductSKUs(t *testing.T) {
+	s := newTestServer(t)
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, adminToken := s.loginAsAdmin("admin1")
+	address := s.seedAddress(aliceID)
+
+	shirt := s.createProduct(adminToken, map[string]interface{}{"name": "T恤", "price": 99, "stock": 5, "is_on_sale": true})
+	other := s.seedProduct("袜子", 9.9, 100)
+
+	// 按规格项的全部组合生成 SKU，商品库存为 SKU 库存之和
+	list := s.setOptions(adminToken, shirt.ID, map[string]interface{}{
+		"options": []map[string]interface{}{{"name": "颜色", "values": []string{"红色", "蓝色"}}, {"name": "尺码", "values": []string{"S", "M"}}},
+		"stock":   10,
+	})
+	var names []string
+	for _, sku := range list.SKUs {
+		names = append(names, sku.Name)
+	}
+	if fmt.Sprint(names) != "[红色 / S 红色 / M 蓝色 / S 蓝色 / M]" {
+		t.Fatalf("生成的 SKU 不正确: %v", names)
+	}
+	if list.SKUs[0].Price != 99 || list.SKUs[0].SpecKey != "颜色:红色;尺码:S" {
+		t.Errorf("新 SKU 应使用商品价格: %+v", list.SKUs[0])
+	}
+	if stock, _ := s.stocks(shirt.ID); stock != 40 {
+		t.Errorf("商品库存应为 SKU 库存之和 40，实际 %d", stock)
+	}
+	list = s.skus(shirt.ID)
+	if len(list.Options) != 2 || fmt.Sprint(list.Options[1].Values) != "[S M]" || len(list.SKUs) != 4 {
+		t.Fatalf("获取的商品规格不正确: %+v", list)
+	}
+	redS, blueM := list.bySpec()["红色 / S"], list.bySpec()["蓝色 / M"]
+
+	// 修改 SKU 后同步商品库存
+	w := s.do(http.MethodPut, fmt.Sprintf("/admin/products/%d/skus/%d", shirt.ID, redS.ID), adminToken,
+		map[string]interface{}{"price": 120, "stock": 3, "barcode": "6901234567890", "image_url": "https://img.example.com/red.png"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("修改 SKU 失败: %d %s", w.Code, w.Body.String())
+	}
+	if stock, _ := s.stocks(shirt.ID); stock != 33 {
+		t.Errorf("修改 SKU 库存后商品库存应为 33，实际 %d", stock)
+	}
+	// 有 SKU 的商品忽略直接修改的库存
+	if w := s.do(http.MethodPut, idPath("/admin/products/%d", shirt.ID), adminToken, map[string]interface{}{"stock": 1000}); w.Code != http.StatusOK {
+		t.Fatalf("修改商品失败: %d", w.Code)
+	}
+	if stock, _ := s.stocks(shirt.ID); stock != 33 {
+		t.Errorf("有 SKU 的商品库存应由 SKU 决定，实际 %d", stock)
+	}
+
+	// 加购按 SKU 记录价格和规格，同一 SKU 合并数量
+	for _, quantity := range []int{1, 2} {
+		if w := s.do(http.MethodPost, "/cart/items", aliceToken, map[string]interface{}{"product_id": shirt.ID, "sku_id": redS.ID, "quantity": quantity}); w.Code != http.StatusOK {
+			t.Fatalf("加入购物车失败: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w := s.do(http.MethodPost, "/cart/items", aliceToken, map[string]interface{}{"product_id": shirt.ID, "sku_id": blueM.ID, "quantity": 1}); w.Code != http.StatusOK {
+		t.Fatalf("加入购物车失败: %d %s", w.Code, w.Body.String())
+	}
+	var cart []models.CartItem
+	s.db.Where("user_id = ?", aliceID).Order("id").Find(&cart)
+	if len(cart) != 2 || cart[0].Quantity != 3 || cart[0].Price != 120 || cart[0].SKUName != "红色 / S" ||
+		cart[0].ProductImage != "https://img.example.com/red.png" || cart[1].SKUID == nil || *cart[1].SKUID != blueM.ID {
+		t.Errorf("购物车项不正确: %+v", cart)
+	}
+
+	// 下单按 SKU 计价并扣减 SKU 库存，取消订单后恢复
+	w = s.do(http.MethodPost, "/orders", aliceToken, map[string]interface{}{
+		"address_id": address.ID,
+		"items":      []map[string]interface{}{{"product_id": shirt.ID, "sku_id": redS.ID, "quantity": 2}, {"product_id": other.ID, "quantity": 1}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("创建订单失败: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			OrderID     uint64  `json:"order_id"`
+			TotalAmount float64 `json:"total_amount"`
+		} `json:"data"`
+	}
+	decode(t, w, &created)
+	if created.Data.TotalAmount != 249.9 {
+		t.Errorf("订单金额应为 249.9，实际 %v", created.Data.TotalAmount)
+	}
+	var items []models.OrderItem
+	s.db.Where("order_id = ?", created.Data.OrderID).Order("id").Find(&items)
+	if len(items) != 2 || items[0].SKUID == nil || *items[0].SKUID != redS.ID || items[0].SKUName != "红色 / S" || items[1].SKUID != nil {
+		t.Errorf("订单项不正确: %+v", items)
+	}
+	if stock, skus := s.stocks(shirt.ID); stock != 31 || skus["红色 / S"] != 1 {
+		t.Errorf("下单后 SKU 库存应为 1、商品库存应为 31，实际 %d %v", stock, skus)
+	}
+	if w := s.do(http.MethodPost, "/orders", aliceToken, map[string]interface{}{
+		"address_id": address.ID,
+		"items":      []map[string]interface{}{{"product_id": shirt.ID, "sku_id": redS.ID, "quantity": 2}},
+	}); w.Code != http.StatusBadRequest {
+		t.Errorf("SKU 库存不足时应返回 400，实际 %d", w.Code)
+	}
+	if w := s.do(http.MethodPost, idPath("/orders/%d/cancel", created.Data.OrderID), aliceToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("取消订单失败: %d %s", w.Code, w.Body.String())
+	}
+	if stock, skus := s.stocks(shirt.ID); stock != 33 || skus["红色 / S"] != 3 {
+		t.Errorf("取消订单后应恢复 SKU 库存，实际 %d %v", stock, skus)
+	}
+
+	// 重新生成时保留已有组合的价格和库存，不再存在的组合停用
+	list = s.setOptions(adminToken, shirt.ID, map[string]interface{}{
+		"options": []map[string]interface{}{{"name": "颜色", "values": []string{"红色", "绿色"}}, {"name": "尺码", "values": []string{"S", "M"}}},
+		"price":   109,
+	})
+	skus := list.bySpec()
+	if len(list.SKUs) != 4 || skus["红色 / S"].ID != redS.ID || skus["红色 / S"].Price != 120 || skus["红色 / S"].Barcode != "6901234567890" ||
+		skus["绿色 / M"].Price != 109 || skus["绿色 / M"].Stock != 0 {
+		t.Errorf("重新生成的 SKU 不正确: %+v", list.SKUs)
+	}
+	if stock, _ := s.stocks(shirt.ID); stock != 13 {
+		t.Errorf("停用的 SKU 不计入商品库存，期望 13，实际 %d", stock)
+	}
+
+	s.run([]routeCase{
+		{name: "cart requires sku", method: http.MethodPost, path: "/cart/items", token: aliceToken,
+			body: map[string]interface{}{"product_id": shirt.ID, "quantity": 1}, want: http.StatusBadRequest},
+		{name: "order requires sku", method: http.MethodPost, path: "/orders", token: aliceToken,
+			body: map[string]interface{}{"address_id": address.ID, "items": []map[string]interface{}{{"product_id": shirt.ID, "quantity": 1}}}, want: http.StatusBadRequest},
+		{name: "inactive sku", method: http.MethodPost, path: "/orders", token: aliceToken,
+			body: map[string]interface{}{"address_id": address.ID, "items": []map[string]interface{}{{"product_id": shirt.ID, "sku_id": blueM.ID, "quantity": 1}}}, want: http.StatusBadRequest},
+		{name: "sku of other product", method: http.MethodPost, path: "/cart/items", token: aliceToken,
+			body: map[string]interface{}{"product_id": other.ID, "sku_id": redS.ID, "quantity": 1}, want: http.StatusBadRequest},
+		{name: "duplicate values", method: http.MethodPut, path: idPath("/admin/products/%d/options", shirt.ID), token: adminToken,
+			body: map[string]interface{}{"options": []map[string]interface{}{{"name": "颜色", "values": []string{"红色", "红色"}}}}, want: http.StatusBadRequest},
+		{name: "reserved character", method: http.MethodPut, path: idPath("/admin/products/%d/options", shirt.ID), token: adminToken,
+			body: map[string]interface{}{"options": []map[string]interface{}{{"name": "颜色", "values": []string{"红:色"}}}}, want: http.StatusBadRequest},
+		{name: "too many combinations", method: http.MethodPut, path: idPath("/admin/products/%d/options", shirt.ID), token: adminToken,
+			body: map[string]interface{}{"options": []map[string]interface{}{
+				{"name": "a", "values": []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}},
+				{"name": "b", "values": []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}},
+				{"name": "c", "values": []string{"1", "2", "3"}},
+			}}, want: http.StatusBadRequest},
+		{name: "invalid sku stock", method: http.MethodPut, path: fmt.Sprintf("/admin/products/%d/skus/%d", shirt.ID, redS.ID), token: adminToken,
+			body: map[string]interface{}{"stock": -1}, want: http.StatusBadRequest},
+		{name: "sku not found", method: http.MethodPut, path: fmt.Sprintf("/admin/products/%d/skus/%d", other.ID, redS.ID), token: adminToken,
+			body: map[string]interface{}{"stock": 1}, want: http.StatusNotFound},
+		{name: "user cannot set options", method: http.MethodPut, path: idPath("/admin/products/%d/options", shirt.ID), token: aliceToken,
+			body: map[string]interface{}{"options": []interface{}{}}, want: http.StatusForbidden},
+		{name: "missing product", method: http.MethodGet, path: "/products/999/skus", want: http.StatusNotFound},
+	})
+
+	// 清空规格项后商品恢复为无规格，按商品库存下单
+	if list := s.setOptions(adminToken, shirt.ID, map[string]interface{}{"options": []interface{}{}}); len(list.SKUs) != 0 || len(list.Options) != 0 {
+		t.Errorf("清空规格项后不应再有启用的 SKU: %+v", list)
+	}
+	s.seedOrder(aliceToken, address.ID, shirt.ID, 1)
+	if stock, _ := s.stocks(shirt.ID); stock != 12 {
+		t.Errorf("无规格商品下单后库存应为 12，实际 %d", stock)
+	}
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"qaqmall/config"
+	"qaqmall/internal/tracing"
+)
+
+// captureSpans 把全局 TracerProvider 替换为同步写入内存的实现
+func captureSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	if _, err := tracing.Init(context.Background(), config.TracingConfig{Exporter: "none"}); err != nil {
+		t.Fatalf("初始化链路追踪失败: %v", err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestTracing(t *testing.T) {
+	spans := captureSpans(t)
+	logs := captureLogs(t)
+	s := newTestServer(t)
+	_, token := s.loginAsUser("alice")
+	spans.Reset()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/ai/query", strings.NewReader(`{"query":"有什么商品"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("AI 查询失败: %d %s", w.Code, w.Body.String())
+	}
+
+	// 请求的 span 沿用上游的 traceparent
+	var server tracetest.SpanStub
+	for _, span := range spans.GetSpans() {
+		if span.SpanKind == trace.SpanKindServer {
+			server = span
+		}
+	}
+	if server.Name != "POST /ai/query" {
+		t.Fatalf("没有找到请求的 span: %+v", spans.GetSpans())
+	}
+	if server.SpanContext.TraceID().String() != traceID || server.Parent.SpanID().String() != parentID {
+		t.Errorf("请求的 span 没有沿用 traceparent: trace=%s parent=%s", server.SpanContext.TraceID(), server.Parent.SpanID())
+	}
+
+	// SQL 和对 LLM 的调用都是请求 span 的子 span
+	var dbSpans, httpSpans int
+	for _, span := range spans.GetSpans() {
+		if span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("span %s 不在同一条链路中", span.Name)
+		}
+		switch {
+		case strings.HasPrefix(span.Name, "db."):
+			dbSpans++
+			if span.Parent.SpanID() != server.SpanContext.SpanID() {
+				t.Errorf("SQL span %s 的父 span 不是请求的 span", span.Name)
+			}
+		case span.SpanKind == trace.SpanKindClient && strings.HasPrefix(span.Name, "HTTP "):
+			httpSpans++
+		}
+	}
+	if dbSpans == 0 || httpSpans != 1 {
+		t.Errorf("期望有 SQL span 和 1 个 LLM 调用的 span，实际 SQL %d 个、HTTP %d 个", dbSpans, httpSpans)
+	}
+
+	// 对 LLM 的请求带上 traceparent
+	if len(s.llmHeaders) != 1 || !strings.Contains(s.llmHeaders[0].Get("traceparent"), traceID) {
+		t.Errorf("LLM 请求没有带上 traceparent: %v", s.llmHeaders)
+	}
+
+	// 访问日志带上 trace_id
+	if entry := logs.accessLog(t, w.Header().Get("X-Request-ID")); entry["trace_id"] != traceID {
+		t.Errorf("访问日志的 trace_id 不正确: %v", entry["trace_id"])
+	}
+
+	// 5xx 响应的 span 标记为失败
+	spans.Reset()
+	s.cfg.OpenAI.APIURL = "http://127.0.0.1:0"
+	if w := s.do(http.MethodPost, "/ai/query", token, map[string]string{"query": "有什么商品"}); w.Code != http.StatusInternalServerError {
+		t.Fatalf("期望调用 LLM 失败，实际 %d", w.Code)
+	}
+	for _, span := range spans.GetSpans() {
+		if span.SpanKind == trace.SpanKindServer && span.Status.Code != codes.Error {
+			t.Errorf("5xx 响应的 span 状态应为 Error，实际 %v", span.Status.Code)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+// fakeWechat 假的微信登录接口
+// code 的格式为 "openid" 或 "openid:unionid"，code 为 "bad" 时返回 code 无效
+func fakeWechat(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var appID, secret, code string
+	switch r.URL.Path {
+	case "/sns/jscode2session":
+		appID, secret, code = "wx-test-mini", "wx-test-mini-secret", query.Get("js_code")
+	case "/sns/oauth2/access_token":
+		appID, secret, code = "wx-test-app", "wx-test-secret", query.Get("code")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if query.Get("appid") != appID || query.Get("secret") != secret {
+		json.NewEncoder(w).Encode(map[string]interface{}{"errcode": 40125, "errmsg": "invalid appsecret"})
+		return
+	}
+	if code == "" || code == "bad" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"errcode": 40029, "errmsg": "invalid code"})
+		return
+	}
+	openID, unionID, _ := strings.Cut(code, ":")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"openid":       openID,
+		"unionid":      unionID,
+		"session_key":  "fake-session-key",
+		"access_token": "fake-access-token",
+		"expires_in":   7200,
+	})
+}
+
+type loginResult struct {
+	Data struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		UserID       uint64 `json:"user_id"`
+		Username     string `json:"username"`
+		MFARequired  bool   `json:"mfa_required"`
+		MFAToken     string `json:"mfa_token"`
+	} `json:"data"`
+}
+
+// wechatState 获取网页授权地址，返回其中的 state 和写入的 state cookie
+func (s *testServer) wechatState() (string, *http.Cookie) {
+	s.t.Helper()
+	w := s.do(http.MethodGet, "/login/wechat/authorize?redirect_uri="+url.QueryEscape("https://shop.example.com/wx/callback"), "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("获取授权地址失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	decode(s.t, w, &resp)
+	authorizeURL, err := url.Parse(resp.Data.URL)
+	if err != nil {
+		s.t.Fatalf("解析授权地址失败: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "wechat_oauth_state" {
+		s.t.Fatalf("授权地址应写入 state cookie: %v", cookies)
+	}
+	return authorizeURL.Query().Get("state"), cookies[0]
+}
+
+// doWithCookie 与 do 相同，但带上 cookie，body 编码为 JSON
+func (s *testServer) doWithCookie(method, path, token string, body interface{}, cookie *http.Cookie) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	if err != nil {
+		s.t.Fatalf("编码请求体失败: %v", err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// wechatLogin 使用微信登录并返回登录结果，网页授权登录先获取授权地址再带着 state 提交
+func (s *testServer) wechatLogin(kind, code string) loginResult {
+	s.t.Helper()
+	var w *httptest.ResponseRecorder
+	if kind == "web" {
+		state, cookie := s.wechatState()
+		w = s.doWithCookie(http.MethodPost, "/login/wechat/web", "", map[string]string{"code": code, "state": state}, cookie)
+	} else {
+		w = s.do(http.MethodPost, "/login/wechat/"+kind, "", map[string]string{"code": code})
+	}
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("微信登录失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp loginResult
+	decode(s.t, w, &resp)
+	return resp
+}
+
+// identities 返回用户绑定的第三方身份
+func (s *testServer) identities(userID uint64) []models.UserIdentity {
+	s.t.Helper()
+	var identities []models.UserIdentity
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		s.t.Fatalf("查询绑定失败: %v", err)
+	}
+	return identities
+}
+
+func TestWechatLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	first := s.wechatLogin("mini", "o-mini-1")
+	if first.Data.Token == "" || !strings.HasPrefix(first.Data.Username, "wx_") {
+		t.Fatalf("首次微信登录应注册新用户并签发 token: %+v", first.Data)
+	}
+	if again := s.wechatLogin("mini", "o-mini-1"); again.Data.UserID != first.Data.UserID {
+		t.Fatalf("同一个 openid 应登录同一个用户，实际 %d / %d", first.Data.UserID, again.Data.UserID)
+	}
+
+	// unionid 相同的小程序和网页授权身份属于同一个用户
+	web := s.wechatLogin("web", "o-web-1:u-1")
+	mini := s.wechatLogin("mini", "o-mini-2:u-1")
+	if web.Data.UserID == first.Data.UserID || mini.Data.UserID != web.Data.UserID {
+		t.Fatalf("unionid 关联错误: first=%d web=%d mini=%d", first.Data.UserID, web.Data.UserID, mini.Data.UserID)
+	}
+	if identities := s.identities(web.Data.UserID); len(identities) != 2 {
+		t.Fatalf("期望绑定 2 个身份，实际 %d", len(identities))
+	}
+
+	s.run([]routeCase{
+		{name: "token works", method: http.MethodGet, path: "/user/info", token: mini.Data.Token, want: http.StatusOK},
+		{name: "invalid code", method: http.MethodPost, path: "/login/wechat/mini", body: map[string]string{"code": "bad"}, want: http.StatusUnauthorized},
+		{name: "missing code", method: http.MethodPost, path: "/login/wechat/web", body: map[string]string{}, want: http.StatusBadRequest},
+		{name: "password login impossible", method: http.MethodPost, path: "/login",
+			body: loginBody(first.Data.Username, "password"), want: http.StatusUnauthorized},
+		{name: "list identities", method: http.MethodGet, path: "/user/identities", token: mini.Data.Token, want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						Items []models.UserIdentity `json:"items"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				if len(resp.Data.Items) != 2 || resp.Data.Items[0].Provider != models.IdentityWechatWeb {
+					t.Errorf("绑定列表不正确: %+v", resp.Data.Items)
+				}
+				if strings.Contains(w.Body.String(), "o-web-1") {
+					t.Errorf("绑定列表不应返回 openid: %s", w.Body.String())
+				}
+			}},
+	})
+}
+
+func TestWechatAuthorizeURL(t *testing.T) {
+	s := newTestServer(t)
+
+	s.run([]routeCase{
+		{name: "authorize url", method: http.MethodGet,
+			path: "/login/wechat/authorize?redirect_uri=" + url.QueryEscape("https://shop.example.com/wx/callback"),
+			want: http.StatusOK,
+			check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resp struct {
+					Data struct {
+						URL string `json:"url"`
+					} `json:"data"`
+				}
+				decode(t, w, &resp)
+				for _, part := range []string{"appid=wx-test-app", "redirect_uri=" + url.QueryEscape("https://shop.example.com/wx/callback"), "scope=snsapi_base", "state="} {
+					if !strings.Contains(resp.Data.URL, part) {
+						t.Errorf("授权地址缺少 %s: %s", part, resp.Data.URL)
+					}
+				}
+				cookie := w.Result().Cookies()
+				if len(cookie) != 1 || !cookie[0].HttpOnly || cookie[0].SameSite != http.SameSiteLaxMode {
+					t.Errorf("state cookie 不正确: %v", cookie)
+				}
+			}},
+		{name: "redirect uri required", method: http.MethodGet, path: "/login/wechat/authorize", want: http.StatusBadRequest},
+		{name: "invalid scope", method: http.MethodGet,
+			path: "/login/wechat/authorize?redirect_uri=https://shop.example.com&scope=snsapi_all", want: http.StatusBadRequest},
+	})
+}
+
+func TestWechatLoginAMR(t *testing.T) {
+	s := newTestServer(t)
+	login := s.wechatLogin("web", "o-web-1")
+	if amr := tokenAMR(t, login.Data.Token); strings.Join(amr, ",") != "wechat" {
+		t.Fatalf("微信登录签发的 token amr 应为 wechat，实际 %v", amr)
+	}
+
+	w := s.do(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": login.Data.RefreshToken})
+	var refreshed loginResult
+	decode(t, w, &refreshed)
+	if amr := tokenAMR(t, refreshed.Data.Token); strings.Join(amr, ",") != "wechat" {
+		t.Fatalf("刷新后 token amr 应保持 wechat，实际 %v", amr)
+	}
+
+	// 两步登录完成后保留第一步的认证方式
+	secret, _ := s.enableMFA(login.Data.Token)
+	challenge := s.wechatLogin("web", "o-web-1")
+	if !challenge.Data.MFARequired {
+		t.Fatalf("开启两步验证后微信登录应要求动态码: %+v", challenge.Data)
+	}
+	w = s.do(http.MethodPost, "/login/mfa", "", mfaLoginBody(challenge.Data.MFAToken, totpCode(t, secret, 1)))
+	var mfaLogin loginResult
+	decode(t, w, &mfaLogin)
+	if amr := tokenAMR(t, mfaLogin.Data.Token); strings.Join(amr, ",") != "wechat,otp" {
+		t.Fatalf("微信两步登录签发的 token amr 应为 wechat,otp，实际 %v", amr)
+	}
+}
+
+func TestWechatWebLoginState(t *testing.T) {
+	s := newTestServer(t)
+	state, cookie := s.wechatState()
+	otherState, otherCookie := s.wechatState()
+	if state == otherState {
+		t.Fatal("每次获取授权地址应生成不同的 state")
+	}
+	expired := *cookie
+	parts := strings.Split(cookie.Value, ".")
+	expired.Value = parts[0] + ".1." + parts[2]
+
+	login := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		return s.doWithCookie(http.MethodPost, "/login/wechat/web", "", map[string]string{"code": "o-web-1", "state": state}, cookie)
+	}
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"missing cookie":  login(state, nil),
+		"missing state":   login("", cookie),
+		"state mismatch":  login(otherState, cookie),
+		"forged expiry":   login(state, &expired),
+		"cookie mismatch": login(state, otherCookie),
+	} {
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: 期望 400，实际 %d %s", name, w.Code, w.Body.String())
+		}
+	}
+	if w := login(state, cookie); w.Code != http.StatusOK {
+		t.Fatalf("state 一致时应登录成功: %d %s", w.Code, w.Body.String())
+	}
+
+	// 绑定网页授权身份同样需要校验 state
+	_, token := s.loginAsUser("alice")
+	bind := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		return s.doWithCookie(http.MethodPost, "/user/identities/wechat", token, map[string]string{"type": "web", "code": "o-web-alice", "state": state}, cookie)
+	}
+	if w := bind(otherState, cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("state 不一致时绑定应返回 400，实际 %d %s", w.Code, w.Body.String())
+	}
+	if w := bind(otherState, otherCookie); w.Code != http.StatusOK {
+		t.Errorf("state 一致时应绑定成功: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWechatLoginDisabled(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Wechat.MiniAppID = ""
+		cfg.Wechat.AppSecret = ""
+	})
+
+	s.run([]routeCase{
+		{name: "mini disabled", method: http.MethodPost, path: "/login/wechat/mini", body: map[string]string{"code": "o-1"}, want: http.StatusServiceUnavailable},
+		{name: "web disabled", method: http.MethodPost, path: "/login/wechat/web", body: map[string]string{"code": "o-1"}, want: http.StatusServiceUnavailable},
+		{name: "authorize disabled", method: http.MethodGet, path: "/login/wechat/authorize?redirect_uri=https://shop.example.com", want: http.StatusServiceUnavailable},
+	})
+}
+
+func TestWechatBinding(t *testing.T) {
+	s := newTestServer(t)
+	aliceID, aliceToken := s.loginAsUser("alice")
+	_, bobToken := s.loginAsUser("bob")
+
+	s.run([]routeCase{
+		{name: "bind", method: http.MethodPost, path: "/user/identities/wechat", token: aliceToken,
+			body: map[string]string{"type": "mini", "code": "o-alice"}, want: http.StatusOK},
+		{name: "bind again is idempotent", method: http.MethodPost, path: "/user/identities/wechat", token: aliceToken,
+			body: map[string]string{"type": "mini", "code": "o-alice"}, want: http.StatusOK},
+		{name: "bind invalid type", method: http.MethodPost, path: "/user/identities/wechat", token: aliceToken,
+			body: map[string]string{"type": "qq", "code": "o-alice"}, want: http.StatusBadRequest},
+		{name: "taken by another user", method: http.MethodPost, path: "/user/identities/wechat", token: bobToken,
+			body: map[string]string{"type": "mini", "code": "o-alice"}, want: http.StatusConflict},
+	})
+	if login := s.wechatLogin("mini", "o-alice"); login.Data.UserID != aliceID {
+		t.Fatalf("绑定后微信登录应进入 alice 的账号，实际 %d", login.Data.UserID)
+	}
+
+	// 开启两步验证后微信登录同样需要动态码
+	s.enableMFA(aliceToken)
+	if login := s.wechatLogin("mini", "o-alice"); !login.Data.MFARequired || login.Data.Token != "" {
+		t.Fatalf("开启两步验证后微信登录应要求动态码: %+v", login.Data)
+	}
+
+	identity := s.identities(aliceID)[0]
+	s.run([]routeCase{
+		{name: "unbind other user's identity", method: http.MethodDelete, path: idPath("/user/identities/%d", identity.ID), token: bobToken, want: http.StatusNotFound},
+		{name: "unbind", method: http.MethodDelete, path: idPath("/user/identities/%d", identity.ID), token: aliceToken, want: http.StatusOK},
+	})
+	if login := s.wechatLogin("mini", "o-alice"); login.Data.UserID == aliceID {
+		t.Fatal("解绑后微信登录不应再进入 alice 的账号")
+	}
+}
+
+func TestWechatOnlyAccount(t *testing.T) {
+	s := newTestServer(t)
+	carol := s.wechatLogin("web", "o-carol")
+	identity := s.identities(carol.Data.UserID)[0]
+
+	s.run([]routeCase{
+		{name: "cannot unbind only login method", method: http.MethodDelete, path: idPath("/user/identities/%d", identity.ID),
+			token: carol.Data.Token, want: http.StatusBadRequest},
+		{name: "set password without old password", method: http.MethodPut, path: "/user/password", token: carol.Data.Token,
+			body: map[string]string{"new_password": "carol-password"}, want: http.StatusOK},
+		{name: "password login", method: http.MethodPost, path: "/login", body: loginBody(carol.Data.Username, "carol-password"), want: http.StatusOK},
+		{name: "old password now required", method: http.MethodPut, path: "/user/password", token: carol.Data.Token,
+			body: map[string]string{"new_password": "another-password"}, want: http.StatusBadRequest},
+		{name: "unbind after setting password", method: http.MethodDelete, path: idPath("/user/identities/%d", identity.ID),
+			token: carol.Data.Token, want: http.StatusOK},
+	})
+
+	// 注销账号后该微信号可以重新注册
+	dave := s.wechatLogin("web", "o-dave")
+	s.run([]routeCase{
+		{name: "delete account", method: http.MethodDelete, path: "/user", token: dave.Data.Token, want: http.StatusOK},
+	})
+	if again := s.wechatLogin("web", "o-dave"); again.Data.UserID == dave.Data.UserID {
+		t.Fatal("注销账号后微信登录应注册新用户")
+	}
+}
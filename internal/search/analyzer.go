@@ -0,0 +1,157 @@
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxTerms 关键词最多使用的词数，超出的部分忽略
+const maxTerms = 10
+
+// Terms 把关键词按空白拆分为小写的词，去掉重复的词
+func Terms(keyword string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Fields(strings.ToLower(keyword)) {
+		if seen[field] || len(terms) == maxTerms {
+			continue
+		}
+		seen[field] = true
+		terms = append(terms, field)
+	}
+	return terms
+}
+
+// tokenize 把文本切分为索引词：字母和数字组成的连续片段作为一个词，统一为小写；
+// 中日韩文字没有分隔符，按相邻两个字切分（bigram）。建立索引时同时保留单字，
+// 使单字的查询也能命中；查询时两个字以上只使用 bigram，要求相邻的字同时出现
+func tokenize(text string, query bool) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 0:
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		default:
+			for i := 0; i < len(cjk); i++ {
+				if !query {
+					tokens = append(tokens, string(cjk[i]))
+				}
+				if i+1 < len(cjk) {
+					tokens = append(tokens, string(cjk[i:i+2]))
+				}
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Highlight 把文本中与关键词匹配的部分用 <em></em> 标出，其余部分做 HTML 转义，没有匹配时返回空字符串
+// maxRunes 大于0且文本超过该长度时，只返回第一个匹配附近的片段，省略的部分用 … 表示
+func Highlight(text, keyword string, maxRunes int) string {
+	needles := append(Terms(keyword), tokenize(keyword, true)...)
+	// 长的词优先，避免只标出较长匹配的一部分
+	sort.Slice(needles, func(i, j int) bool { return len([]rune(needles[i])) > len([]rune(needles[j])) })
+
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, needle := range needles {
+		pattern := []rune(needle)
+		if len(pattern) == 0 {
+			continue
+		}
+		for i := 0; i+len(pattern) <= len(lower); i++ {
+			if !equalRunes(lower[i:i+len(pattern)], pattern) {
+				continue
+			}
+			for j := i; j < i+len(pattern); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start, end := 0, len(runes)
+	if maxRunes > 0 && len(runes) > maxRunes {
+		start = first - maxRunes/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + maxRunes
+		if end > len(runes) {
+			end = len(runes)
+			start = end - maxRunes
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			segment = "<em>" + segment + "</em>"
+		}
+		b.WriteString(segment)
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func equalRunes(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,287 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/models"
+)
+
+// 名称和描述中的词在相关度中的权重
+const (
+	nameWeight        = 3
+	descriptionWeight = 1
+)
+
+// document 索引中的一个商品，只保存过滤、排序和分面需要的字段，商品详情仍从数据库读取
+type document struct {
+	id         uint64
+	price      float64
+	stock      int
+	onSale     bool
+	createdAt  time.Time
+	sales      int64
+	views      int64
+	categories []uint64
+	// terms 商品的索引词及权重，删除商品时据此从倒排表中移除
+	terms map[string]float64
+}
+
+// IndexEngine 进程内的倒排索引，不依赖外部搜索服务
+// 关键词按词匹配（中日韩文字按相邻两个字），全部词都出现才算命中，名称中的词权重更高；
+// 商品增删改时由处理器调用 Refresh 立即更新，库存、销量和浏览次数的变化在定期全量重建后生效。
+// 每个实例各自维护索引，多实例部署时其他实例上的修改同样在全量重建后生效
+type IndexEngine struct {
+	db      *gorm.DB
+	buckets []float64
+
+	mu       sync.RWMutex
+	docs     map[uint64]*document
+	postings map[string]map[uint64]float64
+}
+
+func NewIndex(db *gorm.DB, buckets []float64) *IndexEngine {
+	return &IndexEngine{
+		db:       db,
+		buckets:  buckets,
+		docs:     make(map[uint64]*document),
+		postings: make(map[string]map[uint64]float64),
+	}
+}
+
+// Refresh 从数据库重新读取商品并更新索引，ids 为空时全量重建，已删除的商品从索引中移除
+func (e *IndexEngine) Refresh(ctx context.Context, ids ...uint64) error {
+	db := e.db.WithContext(ctx)
+
+	var products []models.Product
+	query := db.Preload("Categories", func(db *gorm.DB) *gorm.DB { return db.Select("id") })
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if err := query.Find(&products).Error; err != nil {
+		return err
+	}
+
+	var sales []struct {
+		ProductID uint64
+		Sales     int64
+	}
+	sold := salesQuery(db)
+	if len(ids) > 0 {
+		sold = sold.Where("order_items.product_id IN ?", ids)
+	}
+	if err := sold.Scan(&sales).Error; err != nil {
+		return err
+	}
+	salesByID := make(map[uint64]int64, len(sales))
+	for _, s := range sales {
+		salesByID[s.ProductID] = s.Sales
+	}
+
+	docs := make([]*document, 0, len(products))
+	for _, product := range products {
+		docs = append(docs, newDocument(product, salesByID[product.ID]))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(ids) == 0 {
+		e.docs = make(map[uint64]*document, len(docs))
+		e.postings = make(map[string]map[uint64]float64)
+	}
+	for _, id := range ids {
+		e.remove(id)
+	}
+	for _, doc := range docs {
+		e.docs[doc.id] = doc
+		for term, weight := range doc.terms {
+			if e.postings[term] == nil {
+				e.postings[term] = make(map[uint64]float64)
+			}
+			e.postings[term][doc.id] = weight
+		}
+	}
+	return nil
+}
+
+// remove 从索引中移除商品，调用方需要持有写锁
+func (e *IndexEngine) remove(id uint64) {
+	doc, ok := e.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(e.postings[term], id)
+		if len(e.postings[term]) == 0 {
+			delete(e.postings, term)
+		}
+	}
+	delete(e.docs, id)
+}
+
+func (e *IndexEngine) Search(ctx context.Context, q Query) (*Result, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	scores, matchAll := e.match(q.Keyword)
+	categories := make(map[uint64]bool, len(q.CategoryIDs))
+	for _, id := range q.CategoryIDs {
+		categories[id] = true
+	}
+
+	var hits []*document
+	consider := func(doc *document) {
+		if q.matches(doc, categories) {
+			hits = append(hits, doc)
+		}
+	}
+	if matchAll {
+		for _, doc := range e.docs {
+			consider(doc)
+		}
+	} else {
+		for id := range scores {
+			consider(e.docs[id])
+		}
+	}
+
+	result := &Result{Total: int64(len(hits)), Facets: e.facets(hits)}
+	sort.Slice(hits, less(hits, q.Sort, scores, matchAll))
+	for i := q.Offset; i < len(hits) && i < q.Offset+q.Limit; i++ {
+		result.IDs = append(result.IDs, hits[i].id)
+	}
+	return result, nil
+}
+
+// match 返回包含关键词全部索引词的商品及相关度，没有关键词时 all 为 true，表示不按关键词过滤
+func (e *IndexEngine) match(keyword string) (scores map[uint64]float64, all bool) {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, token := range tokenize(keyword, true) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, true
+	}
+
+	// 从命中商品最少的词开始求交集
+	sort.Slice(tokens, func(i, j int) bool { return len(e.postings[tokens[i]]) < len(e.postings[tokens[j]]) })
+	scores = make(map[uint64]float64, len(e.postings[tokens[0]]))
+	for id, weight := range e.postings[tokens[0]] {
+		scores[id] = weight
+	}
+	for _, token := range tokens[1:] {
+		postings := e.postings[token]
+		for id := range scores {
+			weight, ok := postings[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += weight
+		}
+	}
+	return scores, false
+}
+
+func (e *IndexEngine) facets(hits []*document) Facets {
+	facets := Facets{Categories: []CategoryCount{}, Prices: newPriceBuckets(e.buckets)}
+	counts := make(map[uint64]int64)
+	for _, doc := range hits {
+		for _, id := range doc.categories {
+			counts[id]++
+		}
+		facets.Prices[bucketOf(e.buckets, doc.price)].Count++
+	}
+	for id, count := range counts {
+		facets.Categories = append(facets.Categories, CategoryCount{ID: id, Count: count})
+	}
+	sort.Slice(facets.Categories, func(i, j int) bool {
+		a, b := facets.Categories[i], facets.Categories[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ID < b.ID
+	})
+	return facets
+}
+
+// matches 判断商品是否符合关键词以外的条件
+func (q Query) matches(doc *document, categories map[uint64]bool) bool {
+	if q.MinPrice != nil && doc.price < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && doc.price > *q.MaxPrice {
+		return false
+	}
+	if q.OnSale != nil && doc.onSale != *q.OnSale {
+		return false
+	}
+	if q.InStock && doc.stock <= 0 {
+		return false
+	}
+	if len(categories) == 0 {
+		return true
+	}
+	for _, id := range doc.categories {
+		if categories[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// less 返回与 SQL 后端一致的排序规则，相同时按ID倒序，保证分页稳定
+func less(hits []*document, order string, scores map[uint64]float64, matchAll bool) func(i, j int) bool {
+	return func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		switch {
+		case order == SortRelevance && !matchAll && scores[a.id] != scores[b.id]:
+			return scores[a.id] > scores[b.id]
+		case order == SortPriceAsc:
+			if a.price != b.price {
+				return a.price < b.price
+			}
+			return a.id < b.id
+		case order == SortPriceDesc && a.price != b.price:
+			return a.price > b.price
+		case order == SortSales && a.sales != b.sales:
+			return a.sales > b.sales
+		case order == SortPopular && a.views != b.views:
+			return a.views > b.views
+		case (order == SortNewest || order == SortRelevance && matchAll) && !a.createdAt.Equal(b.createdAt):
+			return a.createdAt.After(b.createdAt)
+		}
+		return a.id > b.id
+	}
+}
+
+func newDocument(product models.Product, sales int64) *document {
+	doc := &document{
+		id:        product.ID,
+		price:     product.Price,
+		stock:     product.Stock,
+		onSale:    product.IsOnSale,
+		createdAt: product.CreatedAt,
+		sales:     sales,
+		views:     product.ViewCount,
+		terms:     make(map[string]float64),
+	}
+	for _, category := range product.Categories {
+		doc.categories = append(doc.categories, category.ID)
+	}
+	for _, token := range tokenize(product.Name, false) {
+		doc.terms[token] += nameWeight
+	}
+	for _, token := range tokenize(product.Description, false) {
+		doc.terms[token] += descriptionWeight
+	}
+	return doc
+}
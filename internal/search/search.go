@@ -0,0 +1,122 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"qaqmall/config"
+	"qaqmall/models"
+)
+
+// 排序方式
+const (
+	SortRelevance = "relevance" // 按关键词匹配程度，没有关键词时等同于 newest
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortNewest    = "newest"
+	SortSales     = "sales"   // 按已支付订单中的销量
+	SortPopular   = "popular" // 按浏览次数
+)
+
+// Sorts 支持的排序方式
+var Sorts = []string{SortRelevance, SortPriceAsc, SortPriceDesc, SortNewest, SortSales, SortPopular}
+
+// salesStatuses 计入销量的订单状态
+var salesStatuses = []models.OrderStatus{models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusCompleted}
+
+// Engine 商品搜索后端
+type Engine interface {
+	// Search 按条件搜索商品，返回当前页的商品ID、总数和分面统计
+	Search(ctx context.Context, q Query) (*Result, error)
+	// Refresh 商品变化后通知后端更新，ids 为空时全量重建
+	Refresh(ctx context.Context, ids ...uint64) error
+}
+
+// Query 搜索条件，零值的条件不生效
+type Query struct {
+	Keyword     string
+	MinPrice    *float64
+	MaxPrice    *float64
+	OnSale      *bool
+	InStock     bool
+	CategoryIDs []uint64 // 调用方负责展开子孙分类
+	Sort        string
+	Offset      int
+	Limit       int
+}
+
+// Result 搜索结果
+type Result struct {
+	IDs    []uint64 // 当前页的商品ID，按排序方式排列
+	Total  int64
+	Facets Facets
+}
+
+// Facets 符合全部条件的商品按分类和价格区间的数量
+type Facets struct {
+	Categories []CategoryCount `json:"categories"`
+	Prices     []PriceBucket   `json:"prices"`
+}
+
+// CategoryCount 直接属于该分类的商品数量，Name 由调用方填充
+type CategoryCount struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// PriceBucket 价格在 [Min, Max) 之间的商品数量，Max 为 nil 表示没有上限
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int64    `json:"count"`
+}
+
+// New 按配置创建搜索后端
+// index 后端会先全量建立索引；定期重建由调用方按 refresh_interval 调用 Refresh
+func New(ctx context.Context, db *gorm.DB, cfg config.SearchConfig) (Engine, error) {
+	switch cfg.Backend {
+	case "sql":
+		return NewSQL(db, cfg.PriceBuckets), nil
+	case "index":
+		engine := NewIndex(db, cfg.PriceBuckets)
+		if err := engine.Refresh(ctx); err != nil {
+			return nil, fmt.Errorf("建立搜索索引失败: %v", err)
+		}
+		return engine, nil
+	default:
+		return nil, fmt.Errorf("不支持的搜索后端: %s", cfg.Backend)
+	}
+}
+
+// salesQuery 按商品汇总销量的子查询，字段为 product_id 和 sales
+func salesQuery(db *gorm.DB) *gorm.DB {
+	return db.Table("order_items").
+		Select("order_items.product_id, SUM(order_items.quantity) AS sales").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.status IN ? AND orders.deleted_at IS NULL", salesStatuses).
+		Group("order_items.product_id")
+}
+
+// newPriceBuckets 按分界点生成价格区间，bounds 为 [100, 500] 时为 [0,100)、[100,500)、[500,∞)
+func newPriceBuckets(bounds []float64) []PriceBucket {
+	buckets := make([]PriceBucket, len(bounds)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			max := bounds[i]
+			buckets[i].Max = &max
+		}
+	}
+	return buckets
+}
+
+// bucketOf 返回价格所在区间的下标
+func bucketOf(bounds []float64, price float64) int {
+	return sort.Search(len(bounds), func(i int) bool { return bounds[i] > price })
+}
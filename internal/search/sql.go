@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"qaqmall/models"
+)
+
+// likeEscaper 转义 LIKE 中的通配符，使用 ! 作为转义字符，在 MySQL、PostgreSQL、SQLite 中写法一致
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// SQLEngine 直接查询数据库的搜索后端，关键词按子串匹配名称和描述，不区分大小写
+// 不需要额外维护索引，但关键词查询无法使用数据库索引，适合商品数量不多的场景
+type SQLEngine struct {
+	db      *gorm.DB
+	buckets []float64
+}
+
+func NewSQL(db *gorm.DB, buckets []float64) *SQLEngine {
+	return &SQLEngine{db: db, buckets: buckets}
+}
+
+// Refresh 数据直接来自数据库，不需要更新
+func (e *SQLEngine) Refresh(ctx context.Context, ids ...uint64) error {
+	return nil
+}
+
+func (e *SQLEngine) Search(ctx context.Context, q Query) (*Result, error) {
+	result := &Result{}
+	if err := e.filter(ctx, q).Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	query := e.filter(ctx, q)
+	terms := Terms(q.Keyword)
+	switch {
+	case q.Sort == SortRelevance && len(terms) > 0:
+		// 名称中匹配的词越多越靠前
+		parts := make([]string, len(terms))
+		vars := make([]interface{}, len(terms))
+		for i, term := range terms {
+			parts[i] = "CASE WHEN LOWER(products.name) LIKE ? ESCAPE '!' THEN 1 ELSE 0 END"
+			vars[i] = likePattern(term)
+		}
+		query = query.Order(clause.OrderBy{Expression: clause.Expr{SQL: "(" + strings.Join(parts, " + ") + ") DESC", Vars: vars, WithoutParentheses: true}}).
+			Order("products.id DESC")
+	case q.Sort == SortPriceAsc:
+		query = query.Order("products.price, products.id")
+	case q.Sort == SortPriceDesc:
+		query = query.Order("products.price DESC, products.id DESC")
+	case q.Sort == SortSales:
+		query = query.Joins("LEFT JOIN (?) AS sales ON sales.product_id = products.id", salesQuery(e.db)).
+			Order("COALESCE(sales.sales, 0) DESC, products.id DESC")
+	case q.Sort == SortPopular:
+		query = query.Order("products.view_count DESC, products.id DESC")
+	default:
+		query = query.Order("products.created_at DESC, products.id DESC")
+	}
+	if err := query.Offset(q.Offset).Limit(q.Limit).Pluck("products.id", &result.IDs).Error; err != nil {
+		return nil, err
+	}
+
+	facets, err := e.facets(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	result.Facets = facets
+	return result, nil
+}
+
+// filter 返回符合全部条件的商品查询，每次调用返回新的查询，避免 GORM 语句在多次查询间共享
+func (e *SQLEngine) filter(ctx context.Context, q Query) *gorm.DB {
+	db := e.db.WithContext(ctx)
+	query := db.Model(&models.Product{})
+	for _, term := range Terms(q.Keyword) {
+		pattern := likePattern(term)
+		query = query.Where("(LOWER(products.name) LIKE ? ESCAPE '!' OR LOWER(products.description) LIKE ? ESCAPE '!')", pattern, pattern)
+	}
+	if q.MinPrice != nil {
+		query = query.Where("products.price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		query = query.Where("products.price <= ?", *q.MaxPrice)
+	}
+	if q.OnSale != nil {
+		query = query.Where("products.is_on_sale = ?", *q.OnSale)
+	}
+	if q.InStock {
+		query = query.Where("products.stock > 0")
+	}
+	if len(q.CategoryIDs) > 0 {
+		query = query.Where("products.id IN (?)", db.Table("product_categories").Select("product_id").Where("category_id IN ?", q.CategoryIDs))
+	}
+	return query
+}
+
+func (e *SQLEngine) facets(ctx context.Context, q Query) (Facets, error) {
+	facets := Facets{Categories: []CategoryCount{}, Prices: newPriceBuckets(e.buckets)}
+
+	var categories []struct {
+		CategoryID uint64
+		Count      int64
+	}
+	if err := e.db.WithContext(ctx).Table("product_categories").
+		Select("category_id, COUNT(*) AS count").
+		Where("product_id IN (?)", e.filter(ctx, q).Select("products.id")).
+		Group("category_id").Order("count DESC, category_id").
+		Scan(&categories).Error; err != nil {
+		return facets, err
+	}
+	for _, category := range categories {
+		facets.Categories = append(facets.Categories, CategoryCount{ID: category.CategoryID, Count: category.Count})
+	}
+
+	// CASE WHEN price < b0 THEN 0 WHEN price < b1 THEN 1 ... ELSE n END
+	var bucket strings.Builder
+	vars := make([]interface{}, 0, len(e.buckets))
+	bucket.WriteString("CASE")
+	for i, bound := range e.buckets {
+		bucket.WriteString(" WHEN products.price < ? THEN " + strconv.Itoa(i))
+		vars = append(vars, bound)
+	}
+	bucket.WriteString(" ELSE " + strconv.Itoa(len(e.buckets)) + " END")
+
+	var prices []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := e.filter(ctx, q).
+		Select(bucket.String()+" AS bucket, COUNT(*) AS count", vars...).
+		Group("bucket").Scan(&prices).Error; err != nil {
+		return facets, err
+	}
+	for _, price := range prices {
+		if price.Bucket >= 0 && price.Bucket < len(facets.Prices) {
+			facets.Prices[price.Bucket].Count = price.Count
+		}
+	}
+	return facets, nil
+}
+
+func likePattern(term string) string {
+	return "%" + likeEscaper.Replace(term) + "%"
+}
@@ -0,0 +1 @@
+package ai_query
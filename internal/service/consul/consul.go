@@ -2,7 +2,7 @@ package consul
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 
 	consulapi "github.com/hashicorp/consul/api"
 )
@@ -22,6 +22,7 @@ func NewConsulService(address string) (*ConsulService, error) {
 }
 
 // RegisterService 注册服务到 Consul
+// 健康检查使用 /readyz，依赖故障或开始优雅关闭后 Consul 不再把流量路由到该实例
 func (c *ConsulService) RegisterService(name string, id string, address string, port int, tags []string) error {
 	registration := &consulapi.AgentServiceRegistration{
 		ID:      id,
@@ -30,7 +31,7 @@ func (c *ConsulService) RegisterService(name string, id string, address string,
 		Address: address,
 		Tags:    tags,
 		Check: &consulapi.AgentServiceCheck{
-			HTTP:     fmt.Sprintf("http://%s:%d/health", address, port),
+			HTTP:     fmt.Sprintf("http://%s:%d/readyz", address, port),
 			Interval: "10s",
 			Timeout:  "5s",
 		},
@@ -40,7 +41,7 @@ func (c *ConsulService) RegisterService(name string, id string, address string,
 		return fmt.Errorf("注册服务失败: %v", err)
 	}
 
-	log.Printf("服务 %s 已注册到 Consul", name)
+	slog.Info("服务已注册到 Consul", "service", name, "id", id)
 	return nil
 }
 
@@ -49,7 +50,7 @@ func (c *ConsulService) DeregisterService(id string) error {
 	if err := c.client.Agent().ServiceDeregister(id); err != nil {
 		return fmt.Errorf("注销服务失败: %v", err)
 	}
-	log.Printf("服务 %s 已从 Consul 注销", id)
+	slog.Info("服务已从 Consul 注销", "id", id)
 	return nil
 }
 
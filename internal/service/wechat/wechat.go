@@ -0,0 +1,116 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	miniauth "github.com/silenceper/wechat/v2/miniprogram/auth"
+	"github.com/silenceper/wechat/v2/officialaccount/config"
+	oacontext "github.com/silenceper/wechat/v2/officialaccount/context"
+	"github.com/silenceper/wechat/v2/officialaccount/oauth"
+	"github.com/silenceper/wechat/v2/util"
+
+	"qaqmall/internal/tracing"
+)
+
+// 网页授权的 scope
+const (
+	ScopeBase     = "snsapi_base"     // 静默授权，只能获取 openid
+	ScopeUserInfo = "snsapi_userinfo" // 需要用户确认，可以获取昵称头像
+)
+
+// APIError 微信接口返回的业务错误，通常是 code 无效或已使用
+type APIError struct {
+	util.CommonError
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("微信接口错误: errcode=%d, errmsg=%s", e.ErrCode, e.ErrMsg)
+}
+
+// Client 微信登录接口客户端
+// 请求参数和响应结构沿用 silenceper/wechat SDK 的定义。SDK 中接口地址固定为 api.weixin.qq.com，
+// 且使用没有超时的 http.DefaultClient，因此由这里发送请求，接口地址可以通过配置替换
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: timeout, Transport: tracing.Transport(nil)},
+	}
+}
+
+// Code2Session 小程序登录，用 wx.login 获取的 code 换取 openid 和 unionid
+func (c *Client) Code2Session(ctx context.Context, appID, secret, code string) (*miniauth.ResCode2Session, error) {
+	query := url.Values{}
+	query.Set("appid", appID)
+	query.Set("secret", secret)
+	query.Set("js_code", code)
+	query.Set("grant_type", "authorization_code")
+
+	var result miniauth.ResCode2Session
+	if err := c.get(ctx, "/sns/jscode2session", query, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrCode != 0 {
+		return nil, &APIError{result.CommonError}
+	}
+	return &result, nil
+}
+
+// OAuthAccessToken 网页授权登录，用授权回调中的 code 换取 openid 和 unionid
+func (c *Client) OAuthAccessToken(ctx context.Context, appID, secret, code string) (*oauth.ResAccessToken, error) {
+	query := url.Values{}
+	query.Set("appid", appID)
+	query.Set("secret", secret)
+	query.Set("code", code)
+	query.Set("grant_type", "authorization_code")
+
+	var result oauth.ResAccessToken
+	if err := c.get(ctx, "/sns/oauth2/access_token", query, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrCode != 0 {
+		return nil, &APIError{result.CommonError}
+	}
+	return &result, nil
+}
+
+// AuthorizeURL 返回网页授权页面的地址，用户同意后微信带着 code 和 state 跳转到 redirectURI
+func AuthorizeURL(appID, redirectURI, scope, state string) (string, error) {
+	ctx := &oacontext.Context{Config: &config.Config{AppID: appID}}
+	return oauth.NewOauth(ctx).GetRedirectURL(redirectURI, scope, state)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求微信接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("读取微信接口响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("微信接口返回状态码 %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("解析微信接口响应失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package views
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/logging"
+	"qaqmall/models"
+)
+
+// Counter 商品浏览计数器，浏览次数先在内存中累加，定期批量写入 products.view_count，
+// 避免每次浏览都写数据库。每个实例各自计数，写入时累加，多实例部署时不会互相覆盖；
+// 进程异常退出时最多丢失一个写入间隔内的计数
+type Counter struct {
+	db *gorm.DB
+
+	// flushMu 保证同一时间只有一次写入，ViewCount 不需要等待它
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]int64
+	// inflight 最近一次写入的批次，ViewCount 据此计入已移出 pending 但尚未写入数据库的计数
+	inflight map[uint64]*flight
+}
+
+// flight 写入批次中单个商品的计数，done 表示已写入数据库或已放回 pending
+type flight struct {
+	count int64
+	done  bool
+}
+
+// New 创建浏览计数器，调用方需要用 FlushEvery 定期写入数据库
+func New(db *gorm.DB) *Counter {
+	return &Counter{db: db, pending: make(map[uint64]int64)}
+}
+
+// Record 记录一次商品浏览
+func (c *Counter) Record(productID uint64) {
+	c.mu.Lock()
+	c.pending[productID]++
+	c.mu.Unlock()
+}
+
+// ViewCount 返回商品的浏览次数，包括数据库中的次数和本实例尚未写入的次数
+func (c *Counter) ViewCount(ctx context.Context, productID uint64) (int64, error) {
+	for {
+		c.mu.Lock()
+		before := c.inflight[productID]
+		doneBefore := before != nil && before.done
+		c.mu.Unlock()
+
+		var count int64
+		if err := c.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", productID).
+			Select("view_count").Scan(&count).Error; err != nil {
+			return 0, err
+		}
+
+		c.mu.Lock()
+		current := c.inflight[productID]
+		// 查询期间该商品的计数刚写入数据库，无法确定查到的值是否已包含这部分，重新查询
+		if current != nil && current.done && (current != before || !doneBefore) {
+			c.mu.Unlock()
+			continue
+		}
+		count += c.pending[productID]
+		if current != nil && !current.done {
+			count += current.count
+		}
+		c.mu.Unlock()
+		return count, nil
+	}
+}
+
+// Flush 把内存中的浏览次数累加到数据库，写入失败的计数放回内存，下次再写
+func (c *Counter) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	batch := make(map[uint64]*flight, len(c.pending))
+	ids := make([]uint64, 0, len(c.pending))
+	for id, n := range c.pending {
+		batch[id] = &flight{count: n}
+		ids = append(ids, id)
+	}
+	c.pending = make(map[uint64]int64)
+	c.inflight = batch
+	c.mu.Unlock()
+
+	// 按ID顺序更新，多实例同时写入时加锁顺序一致
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	db := c.db.WithContext(ctx)
+	for i, id := range ids {
+		err := db.Model(&models.Product{}).Where("id = ?", id).
+			UpdateColumn("view_count", gorm.Expr("view_count + ?", batch[id].count)).Error
+		c.mu.Lock()
+		if err != nil {
+			for _, id := range ids[i:] {
+				c.pending[id] += batch[id].count
+				batch[id].done = true
+			}
+			c.mu.Unlock()
+			return err
+		}
+		batch[id].done = true
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// FlushEvery 每隔 interval 写入一次，阻塞到 ctx 取消，返回前用不会被取消的上下文最后写入一次；
+// 应作为受管理的后台任务运行，使最后一次写入在关闭数据库之前完成
+func (c *Counter) FlushEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.Flush(context.WithoutCancel(ctx)); err != nil {
+				logging.FromContext(ctx).Error("写入商品浏览次数失败", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil && ctx.Err() == nil {
+				logging.FromContext(ctx).Error("写入商品浏览次数失败", "error", err)
+			}
+		}
+	}
+}
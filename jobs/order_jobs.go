@@ -1,60 +1,89 @@
 package jobs
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 
+	"qaqmall/internal/audit"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/metrics"
 	"qaqmall/models"
 )
 
 // OrderJobs 订单相关的定时任务
 type OrderJobs struct {
-	db *gorm.DB
+	db    *gorm.DB
+	audit *audit.Logger
 }
 
 func NewOrderJobs(db *gorm.DB) *OrderJobs {
-	return &OrderJobs{db: db}
+	return &OrderJobs{db: db, audit: audit.New(db)}
 }
 
-// CancelExpiredOrders 取消过期订单
-func (j *OrderJobs) CancelExpiredOrders() {
+// CancelExpiredOrders 取消过期订单，单个订单取消失败时继续处理其他订单，最后返回错误
+// ctx 取消后不再处理新的订单，正在处理的订单会在同一事务内完成，并照常写入审计日志
+func (j *OrderJobs) CancelExpiredOrders(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+
 	// 查找过期的待支付订单
 	var orders []models.Order
-	if err := j.db.Where("status = ? AND expired_at < ?", models.OrderStatusPending, time.Now()).
+	if err := j.db.WithContext(ctx).Where("status = ? AND expired_at < ?", models.OrderStatusPending, time.Now()).
 		Preload("Items").Find(&orders).Error; err != nil {
-		log.Printf("查询过期订单失败: %v", err)
-		return
+		return fmt.Errorf("查询过期订单失败: %v", err)
 	}
 
+	failed := 0
 	for _, order := range orders {
-		// 开始事务
-		tx := j.db.Begin()
+		if ctx.Err() != nil {
+			logger.Warn("服务关闭中，剩余过期订单将在下次启动后处理")
+			break
+		}
 
-		// 更新订单状态为已取消
-		if err := tx.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
-			tx.Rollback()
-			log.Printf("取消订单 %s 失败: %v", order.OrderNumber, err)
+		cancelled, err := j.cancelOrder(ctx, order)
+		if err != nil {
+			logger.Error("取消过期订单失败", "order_number", order.OrderNumber, "error", err)
+			failed++
 			continue
 		}
+		if cancelled {
+			metrics.OrdersExpired.Inc()
+			j.audit.Record(context.WithoutCancel(ctx), &order.UserID, "", audit.ActionOrderCancelled,
+				fmt.Sprintf("订单 %s(%d) 超时未支付，自动取消，金额 %.2f", order.OrderNumber, order.ID, order.TotalAmount))
+			logger.Info("成功取消过期订单", "order_number", order.OrderNumber)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个过期订单取消失败", failed)
+	}
+	return nil
+}
+
+// cancelOrder 在一个事务内更新订单状态并恢复库存，订单已不是待支付状态时返回 false
+// 事务不随 ctx 取消而回滚，服务关闭时已开始的订单仍会处理完，关闭流程会等任务结束后再关闭数据库
+func (j *OrderJobs) cancelOrder(ctx context.Context, order models.Order) (bool, error) {
+	cancelled := false
+	err := j.db.WithContext(context.WithoutCancel(ctx)).Transaction(func(tx *gorm.DB) error {
+		// 只取消仍处于待支付状态的订单，避免与用户操作并发时重复恢复库存
+		result := tx.Model(&order).Where("status = ?", models.OrderStatusPending).
+			Update("status", models.OrderStatusCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
 
 		// 恢复商品库存
 		for _, item := range order.Items {
-			if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
-				UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
-				tx.Rollback()
-				log.Printf("恢复订单 %s 商品库存失败: %v", order.OrderNumber, err)
-				continue
+			if err := models.AdjustItemStock(tx, item.ProductID, item.SKUID, item.Quantity); err != nil {
+				return err
 			}
 		}
-
-		// 提交事务
-		if err := tx.Commit().Error; err != nil {
-			log.Printf("提交订单 %s 取消事务失败: %v", order.OrderNumber, err)
-			continue
-		}
-
-		log.Printf("成功取消过期订单: %s", order.OrderNumber)
-	}
+		cancelled = true
+		return nil
+	})
+	return cancelled && err == nil, err
 }
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"qaqmall/internal/audit"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/metrics"
+	"qaqmall/models"
+)
+
+// PaymentTimeout 支付记录创建后未支付的超时时间
+const PaymentTimeout = 15 * time.Minute
+
+// PaymentJobs 支付相关的定时任务
+type PaymentJobs struct {
+	db    *gorm.DB
+	audit *audit.Logger
+}
+
+func NewPaymentJobs(db *gorm.DB) *PaymentJobs {
+	return &PaymentJobs{db: db, audit: audit.New(db)}
+}
+
+// CancelExpiredPayments 取消超时未支付的支付记录，每条记录的状态变化都写入审计日志
+// 以数据库中的创建时间为准，服务重启后仍能正确处理
+func (j *PaymentJobs) CancelExpiredPayments(ctx context.Context) error {
+	var payments []models.Payment
+	if err := j.db.WithContext(ctx).
+		Where("status = ? AND created_at < ?", models.PaymentStatusPending, time.Now().Add(-PaymentTimeout)).
+		Find(&payments).Error; err != nil {
+		return fmt.Errorf("查询超时支付记录失败: %v", err)
+	}
+
+	cancelled := 0
+	for _, payment := range payments {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// 只取消仍处于待支付状态的记录，避免覆盖同时到达的支付回调
+		result := j.db.WithContext(ctx).Model(&models.Payment{}).
+			Where("id = ? AND status = ?", payment.ID, models.PaymentStatusPending).
+			Updates(map[string]interface{}{
+				"status":     models.PaymentStatusCancelled,
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("取消超时支付记录失败: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		cancelled++
+		payment.Status = models.PaymentStatusCancelled
+		metrics.RecordPayments(payment.PaymentMethod, payment.Status, 1)
+		j.audit.PaymentStatusChanged(ctx, payment, models.PaymentStatusPending, "", "超时未支付")
+	}
+	if cancelled > 0 {
+		logging.FromContext(ctx).Info("成功取消超时支付记录", "count", cancelled)
+	}
+	return nil
+}
@@ -2,133 +2,97 @@ package main
 
 import (
 	"context"
-	"github.com/gin-gonic/gin"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
 	"time"
 
-	"qaqmall/handlers"
+	"qaqmall/config"
+	"qaqmall/internal/auth"
+	"qaqmall/internal/database"
+	"qaqmall/internal/health"
+	"qaqmall/internal/lifecycle"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/router"
+	"qaqmall/internal/tracing"
 	"qaqmall/jobs"
-	"qaqmall/middleware"
 )
 
 func main() {
+	// 数据库迁移子命令：qaqmall migrate <up|down|status|check> [flags]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	// 加载配置
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
+	// 结构化日志，之后标准库 log 的输出也会转到这里
+	logger, err := logging.New(cfg.Log, os.Stdout)
+	if err != nil {
+		log.Fatal("Failed to initialize logger:", err)
+	}
+	slog.SetDefault(logger)
+
 	// 连接数据库
-	dsn := "root:123456@tcp(127.0.0.1:3306)/qaqmall?charset=utf8mb4&parseTime=True&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := database.Open(cfg.Database)
 	if err != nil {
 		log.Fatal("Failed to connect database:", err)
 	}
 
-	// 初始化 Casbin
-	if err := middleware.InitCasbin(db); err != nil {
-		log.Fatal("Failed to initialize Casbin:", err)
+	// 链路追踪，退出前把缓存的 span 发送完
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
 	}
 
-	// 创建Gin引擎
-	r := gin.New()
-
-	// 添加中间件
-	r.Use(middleware.Logger())
-	r.Use(gin.Recovery())
-	r.Use(middleware.CORS())
+	// 创建Gin引擎并注册路由
+	// 生命周期管理：负责 HTTP 服务、定时任务和数据库连接池的优雅关闭
+	server := &http.Server{
+		Addr: cfg.Server.Addr,
+	}
+	app := lifecycle.New(server, db, cfg.Server.ShutdownTimeout, cfg.Server.DrainDelay)
 
-	// 健康检查
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-		})
-	})
+	// 就绪检查，开始关闭时立即返回未就绪
+	checker := health.New(cfg.Health.Timeout)
+	checker.Register("jobs", app.CheckJobs)
+	app.OnShutdown(checker.SetShuttingDown)
 
-	// 初始化处理器
-	userHandler := handlers.NewUserHandler(db)
-	productHandler := handlers.NewProductHandler(db)
-	cartHandler := handlers.NewCartHandler(db)
-	addressHandler := handlers.NewAddressHandler(db)
-	orderHandler := handlers.NewOrderHandler(db)
+	// JWT 签名密钥
+	keys, err := auth.NewKeyRing(db, cfg.JWT)
+	if err != nil {
+		log.Fatal("Failed to initialize JWT keys:", err)
+	}
 
-	// 定义 context.Context 变量
-	ctx := context.Background()
-	paymentHandler := handlers.NewPayHandler(db, ctx)
-	aiQueryHandler := handlers.NewAIQueryHandler(db)
+	r, err := router.New(app, db, cfg, keys, checker)
+	if err != nil {
+		log.Fatal("Failed to initialize router:", err)
+	}
+	server.Handler = r
 
 	// 初始化定时任务
 	orderJobs := jobs.NewOrderJobs(db)
+	paymentJobs := jobs.NewPaymentJobs(db)
 
 	// 启动定时任务
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		for range ticker.C {
-			orderJobs.CancelExpiredOrders()
-		}
-	}()
-
-	// 用户相关路由
-	r.POST("/register", userHandler.Register)
-	r.POST("/login", userHandler.Login)
-
-	// 需要认证的路由组
-	auth := r.Group("/")
-	auth.Use(middleware.Auth(db))
-	{
-		// 用户管理
-		auth.POST("/logout", userHandler.Logout)
-		auth.GET("/user/info", userHandler.GetUserInfo)
-		auth.PUT("/user/info", userHandler.UpdateUserInfo)
-		auth.DELETE("/user", userHandler.DeleteUser)
-
-		// 购物车管理
-		auth.GET("/cart/items", cartHandler.ListCart)
-		auth.POST("/cart/items", cartHandler.AddToCart)
-		auth.PUT("/cart/items/:id", cartHandler.UpdateCartItem)
-		auth.DELETE("/cart/items/:id", cartHandler.RemoveFromCart)
-		auth.DELETE("/cart/items", cartHandler.EmptyCart)
-
-		// 地址管理
-		auth.GET("/addresses", addressHandler.ListAddresses)
-		auth.POST("/addresses", addressHandler.CreateAddress)
-		auth.PUT("/addresses/:id", addressHandler.UpdateAddress)
-		auth.DELETE("/addresses/:id", addressHandler.DeleteAddress)
+	app.Every("cancel-expired-orders", time.Minute, orderJobs.CancelExpiredOrders)
+	app.Every("cancel-expired-payments", time.Minute, paymentJobs.CancelExpiredPayments)
+	app.Every("rotate-jwt-keys", time.Hour, keys.Rotate)
 
-		// 订单管理
-		auth.POST("/orders", orderHandler.CreateOrder)
-		auth.GET("/orders", orderHandler.GetOrders)
-		auth.GET("/orders/:id", orderHandler.GetOrder)
-		auth.PUT("/orders/:id", orderHandler.UpdateOrder)
-		auth.POST("/orders/:id/cancel", orderHandler.CancelOrder)
+	// 启动服务器，收到 SIGINT/SIGTERM 后优雅关闭
+	runErr := app.Run()
 
-		// 支付管理
-		auth.POST("/payments", paymentHandler.Charge)        // 支付接口
-		auth.GET("/payments/:id", paymentHandler.GetPayment) // 更具用户id和支付状态查询记录
-
-		// AI 查询
-		auth.POST("/ai/query", aiQueryHandler.Query)
-	}
-
-	// 需要管理员权限的路由组
-	admin := auth.Group("/admin")
-	admin.Use(middleware.RBACMiddleware())
-	{
-		// 商品管理
-		admin.POST("/products", productHandler.CreateProduct)
-		admin.PUT("/products/:id", productHandler.UpdateProduct)
-		admin.DELETE("/products/:id", productHandler.DeleteProduct)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("关闭链路追踪失败", "error", err)
 	}
-
-	// 不需要认证的路由
-	r.GET("/products", productHandler.ListProducts)
-
-	// 支付回调接口（不需要认证）
-	r.POST("/payments/callback", func(c *gin.Context) {
-		paymentHandler.AlipayNotify(c.Writer, c.Request)
-	}) // 支付宝回调接口
-	r.POST("/payments/wechat/callback", func(c *gin.Context) {
-		handlers.WxPayNotify(c.Writer, c.Request)
-	}) // 微信支付回调接口
-
-	// 启动服务器
-	if err := r.Run(":8888"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if runErr != nil {
+		log.Fatal("Server exited with error:", runErr)
 	}
 }
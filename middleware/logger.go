@@ -1,46 +1,94 @@
 package middleware
 
 import (
-	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"qaqmall/internal/logging"
 )
 
-// Logger 日志中间件
-func Logger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 开始时间
-		startTime := time.Now()
+// RequestIDHeader 请求ID的请求头和响应头
+const RequestIDHeader = "X-Request-ID"
 
-		// 处理请求
-		c.Next()
+// requestIDPattern 接受调用方传入的请求ID的格式，不符合时重新生成，避免日志被注入任意内容
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
 
-		// 结束时间
-		endTime := time.Now()
-
-		// 获取用户ID
-		userID := "anonymous"
-		if value, exists := c.Get("user_id"); exists {
-			userID = fmt.Sprintf("%v", value)
+// RequestID 沿用请求头中的 X-Request-ID，没有时生成一个，并在响应头中返回
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = logging.NewRequestID()
 		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
 
-		// 计算延迟
-		latency := endTime.Sub(startTime)
-
-		// 打印日志
-		fmt.Printf("[GIN] %v | %3d | %13v | %15s | %-7s | %-10s | %s\n",
-			endTime.Format("2006/01/02 - 15:04:05"),
-			c.Writer.Status(),
-			latency,
-			c.ClientIP(),
-			c.Request.Method,
-			userID,
-			c.Request.URL.Path,
+// Logger 为每个请求创建带有 request_id、route、trace_id 和 latency 的 logger 放入请求的 context，
+// handler 通过 logging.FromContext(c) 获取；请求结束后输出一行访问日志
+func Logger(base *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		logger := logging.WithElapsed(base, start).With(
+			"request_id", c.GetString("request_id"),
+			"method", c.Request.Method,
+			"route", route,
 		)
+		// 请求被采样或带有上游的 traceparent 时，日志带上 trace_id 和 span_id 便于和链路关联
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+		}
+		c.Request = c.Request.WithContext(logging.WithContext(c.Request.Context(), logger))
+
+		c.Next()
 
+		// 认证中间件会追加 user_id，重新从 context 中获取
+		attrs := []any{
+			"status", c.Writer.Status(),
+			"path", c.Request.URL.Path,
+			"ip", c.ClientIP(),
+			"size", c.Writer.Size(),
+		}
+		if query := c.Request.URL.Query(); len(query) > 0 {
+			// 查询参数逐个输出，便于按字段名脱敏
+			params := make([]any, 0, len(query))
+			for key, values := range query {
+				params = append(params, slog.String(key, strings.Join(values, ",")))
+			}
+			attrs = append(attrs, slog.Group("query", params...))
+		}
 		if len(c.Errors) > 0 {
-			fmt.Printf("[GIN] Errors: %v\n", c.Errors)
+			attrs = append(attrs, "errors", c.Errors.String())
 		}
+
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case c.Writer.Status() >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(c).Log(c.Request.Context(), level, "请求完成", attrs...)
 	}
 }
+
+// Recovery 捕获 handler 中的 panic，记录到请求的 logger 后返回 500
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		logging.FromContext(c).Error("处理请求时发生 panic", "error", err, "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
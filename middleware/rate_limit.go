@@ -1,69 +1,60 @@
 package middleware
 
 import (
-	"sync"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-)
-
-type IPRateLimiter struct {
-	sync.Mutex
-	requests map[string][]time.Time
-	window   time.Duration
-	limit    int
-}
 
-func NewIPRateLimiter(window time.Duration, limit int) *IPRateLimiter {
-	return &IPRateLimiter{
-		requests: make(map[string][]time.Time),
-		window:   window,
-		limit:    limit,
-	}
-}
+	"qaqmall/config"
+	"qaqmall/internal/logging"
+	"qaqmall/internal/ratelimit"
+)
 
-func (rl *IPRateLimiter) cleanOld(now time.Time) {
-	for ip, times := range rl.requests {
-		var valid []time.Time
-		for _, t := range times {
-			if now.Sub(t) <= rl.window {
-				valid = append(valid, t)
-			}
-		}
-		if len(valid) == 0 {
-			delete(rl.requests, ip)
-		} else {
-			rl.requests[ip] = valid
+// RateLimit 按令牌桶限流，name 为路由分组名称，各分组单独计数
+// 登录后按用户ID计数，未登录按 IP 计数，因此需要登录的分组应放在 Auth 之后
+// store 为 nil 或 rule.Requests 为 0 时不限流；存储不可用时放行，避免限流服务故障影响正常请求
+func RateLimit(store ratelimit.Store, name string, rule config.RateLimitRule) gin.HandlerFunc {
+	if store == nil || rule.Requests <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
 		}
 	}
-}
-
-func (rl *IPRateLimiter) isAllowed(ip string) bool {
-	rl.Lock()
-	defer rl.Unlock()
-
-	now := time.Now()
-	rl.cleanOld(now)
-
-	times := rl.requests[ip]
-	if len(times) < rl.limit {
-		rl.requests[ip] = append(times, now)
-		return true
-	}
 
-	return false
-}
+	policy := fmt.Sprintf("%d;w=%d;burst=%d", rule.Requests, seconds(rule.Period), rule.Capacity())
+	return func(c *gin.Context) {
+		key := name + ":ip:" + c.ClientIP()
+		if userID, ok := c.Get("user_id"); ok {
+			key = fmt.Sprintf("%s:user:%d", name, userID)
+		}
 
-func RateLimitMiddleware(requestsPerMinute int) gin.HandlerFunc {
-	limiter := NewIPRateLimiter(time.Minute, requestsPerMinute)
+		result, err := store.Take(c.Request.Context(), key, rule)
+		if err != nil {
+			logging.FromContext(c).Error("限流计数失败", "key", key, "error", err)
+			c.Next()
+			return
+		}
 
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !limiter.isAllowed(ip) {
-			c.JSON(429, gin.H{"error": "请求过于频繁，请稍后再试"})
-			c.Abort()
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"code":  429,
+				"error": "请求过于频繁，请稍后再试",
+			})
 			return
 		}
 		c.Next()
 	}
 }
+
+// seconds 向上取整到秒，响应头中的时间以秒为单位
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -1,66 +1,160 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"qaqmall/config"
 )
 
-var enforcer *casbin.Enforcer
+var enforcer *casbin.SyncedEnforcer
+
+// defaultPolicies 策略表为空（首次启动）时写入的默认策略，之后通过 /admin/policies 管理
+// 订单、购物车、地址等属于用户的资源本人总是可以访问，这里的规则决定哪些角色可以访问其他用户的资源
+// 已有部署的策略表不为空，这里新增的规则不会写入，需要同时添加迁移补上（见迁移 0014_ownership_policies）
+var defaultPolicies = [][]string{
+	{"admin", "/admin/*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{"admin", "/products*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{"user", "/products*", "GET"},
+	{"admin", "/users*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{"admin", "/orders*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{"admin", "/cart/items*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{"admin", "/addresses*", "(GET)|(POST)|(PUT)|(DELETE)"},
+	{"support", "/orders*", "GET"},
+}
 
-func InitCasbin(db *gorm.DB) error {
+// InitCasbin 加载权限策略
+// reloadInterval 大于 0 时定期从数据库重新加载策略，使其他实例上的修改生效，ctx 取消时停止
+func InitCasbin(ctx context.Context, db *gorm.DB, reloadInterval time.Duration) (*casbin.SyncedEnforcer, error) {
 	adapter, err := gormadapter.NewAdapterByDB(db)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	m, err := model.NewModelFromString(config.RBACModel)
+	if err != nil {
+		return nil, err
 	}
 
-	enforcer, err = casbin.NewEnforcer("config/rbac_model.conf", adapter)
+	e, err := casbin.NewSyncedEnforcer(m, adapter)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 加载策略
-	if err := enforcer.LoadPolicy(); err != nil {
-		return err
+	if err := e.LoadPolicy(); err != nil {
+		return nil, err
 	}
 
-	// 添加默认策略
-	_, err = enforcer.AddPolicy("admin", "/admin/*", "(GET)|(POST)|(PUT)|(DELETE)")
+	// 只在没有任何策略时写入默认策略，管理员删除的策略不会在重启后恢复
+	policies, err := e.GetPolicy()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(policies) == 0 {
+		if _, err := e.AddPolicies(defaultPolicies); err != nil {
+			return nil, err
+		}
 	}
 
-	_, err = enforcer.AddPolicy("admin", "/products*", "(GET)|(POST)|(PUT)|(DELETE)")
-	if err != nil {
-		return err
+	if reloadInterval > 0 {
+		e.StartAutoLoadPolicy(reloadInterval)
+		go func() {
+			<-ctx.Done()
+			e.StopAutoLoadPolicy()
+		}()
 	}
 
-	_, err = enforcer.AddPolicy("user", "/products*", "GET")
-	if err != nil {
-		return err
+	enforcer = e
+	return e, nil
+}
+
+// UserSubject 用户在角色分配（g 规则）中的主体，为用户ID的十进制字符串
+func UserSubject(userID uint64) string {
+	return strconv.FormatUint(userID, 10)
+}
+
+// DeleteUserRoles 删除用户的角色分配，用于注销账号
+func DeleteUserRoles(userID uint64) error {
+	_, err := enforcer.DeleteRolesForUser(UserSubject(userID))
+	return err
+}
+
+// currentRole 返回用户当前的角色
+// 通过管理接口分配过角色的用户以 Casbin 中的分配为准，修改后立即生效；其余用户使用 token 中的角色
+func currentRole(c *gin.Context) (string, error) {
+	if userID, ok := c.Get("user_id"); ok {
+		roles, err := enforcer.GetRolesForUser(UserSubject(userID.(uint64)))
+		if err != nil {
+			return "", err
+		}
+		if len(roles) > 0 {
+			return roles[0], nil
+		}
 	}
+	return c.GetString("role"), nil
+}
 
-	_, err = enforcer.AddPolicy("admin", "/users*", "(GET)|(POST)|(PUT)|(DELETE)")
+// privileged 角色（包括继承的角色）在权限策略中能否访问管理接口（/admin/ 下的任一路径）
+func privileged(roleName string) (bool, error) {
+	permissions, err := enforcer.GetImplicitPermissionsForUser(roleName)
 	if err != nil {
-		return err
+		return false, err
+	}
+	for _, p := range permissions {
+		if len(p) > 1 && (strings.HasPrefix(p[1], "/admin/") || util.KeyMatch("/admin/", p[1])) {
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	return nil
+// requireMFA 开启 require_for_admin 时，能访问管理接口的角色必须使用通过两步验证登录的 token
+func requireMFA(c *gin.Context, enabled bool, roleName string) (bool, error) {
+	if !enabled || c.GetBool("mfa") {
+		return false, nil
+	}
+	return privileged(roleName)
 }
 
-func RBACMiddleware() gin.HandlerFunc {
+// RBACMiddleware 按角色检查接口权限
+// requireMFAForAdmin 为 true 时，权限策略允许访问管理接口的角色必须使用通过两步验证登录的 token
+func RBACMiddleware(requireMFAForAdmin bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
+		if _, exists := c.Get("role"); !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户角色信息"})
 			c.Abort()
 			return
 		}
 
-		roleName := role.(string)
+		roleName, err := currentRole(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "权限检查失败"})
+			c.Abort()
+			return
+		}
+		mfaRequired, err := requireMFA(c, requireMFAForAdmin, roleName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "权限检查失败"})
+			c.Abort()
+			return
+		}
+		if mfaRequired {
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "error": "管理员操作需要先开启并通过两步验证"})
+			c.Abort()
+			return
+		}
+
 		path := c.Request.URL.Path
 		method := c.Request.Method
 
@@ -81,19 +175,3 @@ func RBACMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-func UpdateUserRole(userID uint64, newRole string) error {
-	// 删除旧的角色
-	_, err := enforcer.DeleteRolesForUser(string(userID))
-	if err != nil {
-		return err
-	}
-
-	// 添加新的角色
-	_, err = enforcer.AddRoleForUser(string(userID), newRole)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
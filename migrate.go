@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"qaqmall/config"
+	"qaqmall/internal/database"
+	"qaqmall/internal/migrate"
+	"qaqmall/models"
+)
+
+const migrateUsage = `用法: qaqmall migrate <command> [flags]
+
+命令:
+  up          执行所有未执行的迁移
+  down [n]    回滚最近 n 个迁移，默认 1
+  status      查看迁移执行情况
+  check       对比数据库表结构与 models 定义
+
+flags 与启动服务时相同，例如 -config config/config.yaml -dsn ...`
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+	command, args := args[0], args[1:]
+
+	steps := 1
+	if command == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				log.Fatal("回滚数量必须大于0")
+			}
+			steps = n
+			args = args[1:]
+		}
+	}
+
+	cfg, err := config.Parse(args)
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+	if cfg.Database.DSN == "" {
+		log.Fatal("database.dsn 不能为空")
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to connect database:", err)
+	}
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch command {
+	case "up":
+		done, err := migrator.Up()
+		for _, m := range done {
+			fmt.Printf("已执行 %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+	case "down":
+		done, err := migrator.Down(steps)
+		for _, m := range done {
+			fmt.Printf("已回滚 %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("没有可回滚的迁移")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			appliedAt := "未执行"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, appliedAt)
+		}
+	case "check":
+		problems, err := migrate.Check(db, models.All()...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(problems) == 0 {
+			fmt.Println("数据库表结构与模型一致")
+			return
+		}
+		for _, p := range problems {
+			fmt.Println("- " + p)
+		}
+		os.Exit(1)
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -1,20 +1,27 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // CartItem 购物车商品模型
 type CartItem struct {
-	ID           uint64     `json:"id" gorm:"primaryKey"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	DeletedAt    *time.Time `json:"deleted_at,omitempty" gorm:"index"`
-	UserID       uint64     `gorm:"not null;index" json:"user_id"`
-	ProductID    uint64     `gorm:"not null;index" json:"product_id"`
-	Quantity     int        `gorm:"not null;default:1" json:"quantity"`
-	Price        float64    `gorm:"type:decimal(10,2);not null" json:"price"`
-	ProductName  string     `gorm:"size:255;not null" json:"product_name"`
-	ProductImage string     `gorm:"size:1024" json:"product_image"`
-	Selected     bool       `gorm:"not null;default:true" json:"selected"`
+	ID           uint64         `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	UserID       uint64         `gorm:"not null;index" json:"user_id"`
+	ProductID    uint64         `gorm:"not null;index" json:"product_id"`
+	Quantity     int            `gorm:"not null;default:1" json:"quantity"`
+	Price        float64        `gorm:"type:decimal(10,2);not null" json:"price"`
+	ProductName  string         `gorm:"size:255;not null" json:"product_name"`
+	ProductImage string         `gorm:"size:1024" json:"product_image"`
+	Selected     bool           `gorm:"not null;default:true" json:"selected"`
+	// SKUID 选择的商品规格，商品没有规格时为 nil
+	SKUID   *uint64 `gorm:"column:sku_id" json:"sku_id"`
+	SKUName string  `gorm:"size:255" json:"sku_name"`
 
 	// 关联
 	User    User    `gorm:"foreignKey:UserID" json:"-"`
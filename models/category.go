@@ -0,0 +1,130 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCategoryNotFound 分类不存在
+	ErrCategoryNotFound = errors.New("分类不存在")
+	// ErrCategoryCycle 不能把分类移动到自身或其子分类下
+	ErrCategoryCycle = errors.New("不能把分类移动到自身或其子分类下")
+)
+
+// CategoryTree 返回完整的分类树，同级分类按 sort_order、id 排序
+// 分类数量有限，一次查出全部分类在内存中组装，不依赖各数据库对递归查询的支持
+func CategoryTree(db *gorm.DB) ([]*Category, error) {
+	var categories []*Category
+	if err := db.Order("sort_order, id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint64]*Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	roots := make([]*Category, 0)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			if parent, ok := byID[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, category)
+				continue
+			}
+		}
+		// 父分类已不存在的按根分类处理，避免分类从树中消失
+		roots = append(roots, category)
+	}
+	return roots, nil
+}
+
+// CategoryDescendantIDs 返回分类自身及其全部子孙分类的ID，分类不存在时返回 ErrCategoryNotFound
+func CategoryDescendantIDs(db *gorm.DB, id uint64) ([]uint64, error) {
+	var categories []Category
+	if err := db.Select("id", "parent_id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint64][]uint64, len(categories))
+	found := false
+	for _, category := range categories {
+		if category.ID == id {
+			found = true
+		}
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+	if !found {
+		return nil, ErrCategoryNotFound
+	}
+
+	ids := []uint64{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// MoveCategory 把分类移动到 parentID 下（nil 表示根分类），并排在同级分类的第 position 位（从0开始）
+// position 为 nil 或超出范围时排在最后；移动后重新为新的同级分类编号，父分类不变时即为调整顺序
+func MoveCategory(db *gorm.DB, id uint64, parentID *uint64, position *int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if parentID != nil {
+			descendants, err := CategoryDescendantIDs(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, descendant := range descendants {
+				if descendant == *parentID {
+					return ErrCategoryCycle
+				}
+			}
+			var count int64
+			if err := tx.Model(&Category{}).Where("id = ?", *parentID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrCategoryNotFound
+			}
+		}
+
+		var siblings []Category
+		query := tx.Select("id", "sort_order").Where("id <> ?", id).Order("sort_order, id")
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+		if err := query.Find(&siblings).Error; err != nil {
+			return err
+		}
+
+		index := len(siblings)
+		if position != nil && *position >= 0 && *position < index {
+			index = *position
+		}
+		result := tx.Model(&Category{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"parent_id": parentID, "sort_order": index})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCategoryNotFound
+		}
+		for i, sibling := range siblings {
+			order := i
+			if i >= index {
+				order = i + 1
+			}
+			if sibling.SortOrder == order {
+				continue
+			}
+			if err := tx.Model(&Category{}).Where("id = ?", sibling.ID).UpdateColumn("sort_order", order).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
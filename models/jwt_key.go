@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// JWTKey JWT 签名密钥，RetiredAt 为空的是当前签名密钥
+// 退役的密钥只用于验证，保留到用它签发的令牌全部过期后删除
+type JWTKey struct {
+	ID         uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	KID        string     `json:"kid" gorm:"column:kid;size:36;not null;unique"`
+	Algorithm  string     `json:"algorithm" gorm:"size:10;not null"`
+	PrivateKey string     `json:"-" gorm:"type:text;not null"` // PKCS#8 PEM
+	RetiredAt  *time.Time `json:"retired_at" gorm:"index"`
+}
+
+func (JWTKey) TableName() string {
+	return "jwt_keys"
+}
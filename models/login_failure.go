@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// 登录失败计数的维度
+const (
+	LoginFailureByUsername = "username"
+	LoginFailureByIP       = "ip"
+)
+
+// LoginFailure 按用户名或 IP 统计的连续登录失败次数
+// 超过阈值后 LockedUntil 之前的登录请求都会被拒绝
+type LoginFailure struct {
+	Kind         string     `json:"kind" gorm:"primaryKey;size:10"`  // username 或 ip
+	Value        string     `json:"value" gorm:"primaryKey;size:64"` // 用户名或 IP 地址
+	Failures     int        `json:"failures" gorm:"not null"`        // 连续失败次数
+	LastFailedAt time.Time  `json:"last_failed_at" gorm:"not null"`  // 最近一次失败的时间
+	LockedUntil  *time.Time `json:"locked_until" gorm:"index"`       // 锁定截止时间，为空表示未锁定
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (LoginFailure) TableName() string {
+	return "login_failures"
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// UserTOTP 用户的 TOTP 两步验证密钥
+// 生成后需要用验证码确认才会启用，ConfirmedAt 为空表示尚未启用
+type UserTOTP struct {
+	UserID      uint64     `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Secret      string     `json:"-" gorm:"size:64;not null"` // base32 编码的密钥
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	LastStep    int64      `json:"-" gorm:"not null;default:0"` // 最近一次使用的时间步，防止验证码重放
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// MFARecoveryCode 两步验证的恢复码，只保存 SHA-256 摘要，每个只能使用一次
+type MFARecoveryCode struct {
+	ID        uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint64     `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;unique"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
@@ -0,0 +1,27 @@
+package models
+
+// All 返回所有需要持久化的模型，供迁移校验等场景使用
+func All() []interface{} {
+	return []interface{}{
+		&User{},
+		&Session{},
+		&UserTOTP{},
+		&MFARecoveryCode{},
+		&UserIdentity{},
+		&RefreshToken{},
+		&JWTKey{},
+		&LoginFailure{},
+		&SystemLog{},
+		&Category{},
+		&Product{},
+		&ProductOption{},
+		&ProductSKU{},
+		&ProductImage{},
+		&ProductReview{},
+		&CartItem{},
+		&Address{},
+		&Order{},
+		&OrderItem{},
+		&Payment{},
+	}
+}
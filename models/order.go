@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // OrderStatus 订单状态
@@ -18,17 +20,17 @@ const (
 
 // Order 订单模型
 type Order struct {
-	ID          uint64      `json:"id" gorm:"primaryKey"`
-	OrderNumber string      `json:"order_number" gorm:"unique;not null"`
-	UserID      uint64      `json:"user_id" gorm:"not null"`
-	Status      OrderStatus `json:"status" gorm:"not null;default:pending"`
-	TotalAmount float64     `json:"total_amount" gorm:"type:decimal(10,2);not null"`
-	AddressID   uint64      `json:"address_id" gorm:"not null"`
-	Remark      string      `json:"remark" gorm:"type:text"`
-	ExpiredAt   time.Time   `json:"expired_at" gorm:"not null"`
-	CreatedAt   time.Time   `json:"created_at" gorm:"not null"`
-	UpdatedAt   time.Time   `json:"updated_at" gorm:"not null"`
-	DeletedAt   *time.Time  `json:"deleted_at,omitempty" gorm:"index"`
+	ID          uint64         `json:"id" gorm:"primaryKey"`
+	OrderNumber string         `json:"order_number" gorm:"unique;not null"`
+	UserID      uint64         `json:"user_id" gorm:"not null"`
+	Status      OrderStatus    `json:"status" gorm:"not null;default:pending"`
+	TotalAmount float64        `json:"total_amount" gorm:"type:decimal(10,2);not null"`
+	AddressID   uint64         `json:"address_id" gorm:"not null"`
+	Remark      string         `json:"remark" gorm:"type:text"`
+	ExpiredAt   time.Time      `json:"expired_at" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"not null"`
+	UpdatedAt   time.Time      `json:"updated_at" gorm:"not null"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 
 	// 关联
 	User    User        `json:"user" gorm:"foreignKey:UserID"`
@@ -45,6 +47,8 @@ type OrderItem struct {
 	ProductImage string    `json:"product_image"`
 	Price        float64   `json:"price" gorm:"type:decimal(10,2);not null"`
 	Quantity     int       `json:"quantity" gorm:"not null"`
+	SKUID        *uint64   `json:"sku_id" gorm:"column:sku_id;index"`
+	SKUName      string    `json:"sku_name" gorm:"size:255"`
 	CreatedAt    time.Time `json:"created_at" gorm:"not null"`
 	UpdatedAt    time.Time `json:"updated_at" gorm:"not null"`
 
@@ -1,29 +1,61 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInsufficientStock 库存不足
+var ErrInsufficientStock = errors.New("库存不足")
 
 // Product 商品模型
 type Product struct {
-	ID          uint64     `gorm:"primaryKey" json:"id"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   *time.Time `gorm:"index" json:"deleted_at,omitempty"`
-	Name        string     `gorm:"size:255;not null" json:"name"`
-	Description string     `gorm:"type:text" json:"description"`
-	Price       float64    `gorm:"type:decimal(10,2);not null" json:"price"`
-	Stock       int        `gorm:"not null" json:"stock"`
-	ImageURL    string     `gorm:"size:255" json:"image_url"`
-	IsOnSale    bool       `gorm:"not null;default:true" json:"is_on_sale"`
-	Categories  []Category `gorm:"many2many:product_categories;" json:"categories"`
+	ID          uint64         `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	Name        string         `gorm:"size:255;not null" json:"name"`
+	Description string         `gorm:"type:text" json:"description"`
+	Price       float64        `gorm:"type:decimal(10,2);not null" json:"price"`
+	Stock       int            `gorm:"not null" json:"stock"`
+	ImageURL    string         `gorm:"size:255" json:"image_url"`
+	IsOnSale    bool           `gorm:"not null;default:true" json:"is_on_sale"`
+	// ViewCount 浏览次数，只由 views.Counter 累加，创建和修改商品时不写入
+	ViewCount  int64      `gorm:"not null;default:0" json:"view_count"`
+	Categories []Category `gorm:"many2many:product_categories;" json:"categories"`
 }
 
 // Category 商品分类模型
 type Category struct {
-	ID          uint64     `gorm:"primaryKey" json:"id"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   *time.Time `gorm:"index" json:"deleted_at,omitempty"`
-	Name        string     `gorm:"size:50;not null;unique" json:"name"`
-	Description string     `gorm:"size:200" json:"description"`
-	Products    []Product  `gorm:"many2many:product_categories;" json:"products"`
+	ID          uint64         `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	Name        string         `gorm:"size:50;not null;unique" json:"name"`
+	Description string         `gorm:"size:200" json:"description"`
+	ParentID    *uint64        `gorm:"index" json:"parent_id"`
+	SortOrder   int            `gorm:"not null;default:0" json:"sort_order"`
+	Products    []Product      `gorm:"many2many:product_categories;" json:"products,omitempty"`
+	// Children 子分类，由 CategoryTree 填充，不对应数据库字段
+	Children []*Category `gorm:"-" json:"children,omitempty"`
+}
+
+// AdjustStock 原子地调整商品库存，delta 为负数表示扣减，扣减后库存不能小于0
+// 使用带条件的 UPDATE 代替先查询再写回，不依赖 SELECT ... FOR UPDATE，在 MySQL、PostgreSQL、SQLite 上行为一致
+func AdjustStock(db *gorm.DB, productID uint64, delta int) error {
+	query := db.Model(&Product{}).Where("id = ?", productID)
+	if delta < 0 {
+		query = query.Where("stock >= ?", -delta)
+	}
+
+	result := query.UpdateColumn("stock", gorm.Expr("stock + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
 }
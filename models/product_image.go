@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductImage 商品图片，同一商品的图片按 position 排序，排在第一位的作为主图写入 Product.ImageURL
+type ProductImage struct {
+	ID           uint64    `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ProductID    uint64    `gorm:"not null;index:idx_product_images_product_position" json:"product_id"`
+	URL          string    `gorm:"size:255;not null" json:"url"`
+	ThumbnailURL string    `gorm:"size:255;not null" json:"thumbnail_url"`
+	// StorageKey、ThumbnailKey 原图和缩略图在存储中的 key，删除图片时据此删除文件
+	StorageKey   string `gorm:"size:255;not null" json:"-"`
+	ThumbnailKey string `gorm:"size:255;not null" json:"-"`
+	ContentType  string `gorm:"size:50;not null" json:"content_type"`
+	Size         int64  `gorm:"not null" json:"size"`
+	Width        int    `gorm:"not null" json:"width"`
+	Height       int    `gorm:"not null" json:"height"`
+	Position     int    `gorm:"not null;default:0;index:idx_product_images_product_position" json:"position"`
+}
+
+// ProductImages 按顺序返回商品的图片
+func ProductImages(db *gorm.DB, productID uint64) ([]ProductImage, error) {
+	images := []ProductImage{}
+	err := db.Where("product_id = ?", productID).Order("position, id").Find(&images).Error
+	return images, err
+}
+
+// SyncProductImage 把商品的主图更新为排在第一位的图片
+// 商品已没有上传的图片时，只有主图仍是刚删除的图片 removedURL 才清空，不影响直接填写的外部图片地址
+func SyncProductImage(db *gorm.DB, productID uint64, removedURL string) error {
+	var first ProductImage
+	err := db.Where("product_id = ?", productID).Order("position, id").Limit(1).Find(&first).Error
+	if err != nil {
+		return err
+	}
+	if first.ID != 0 {
+		return db.Model(&Product{}).Where("id = ?", productID).UpdateColumn("image_url", first.URL).Error
+	}
+	if removedURL == "" {
+		return nil
+	}
+	return db.Model(&Product{}).Where("id = ? AND image_url = ?", productID, removedURL).UpdateColumn("image_url", "").Error
+}
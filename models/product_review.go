@@ -0,0 +1,40 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductReview 商品评价，rating 为 1~5 分，每个订单中的每个商品只能评价一次
+type ProductReview struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ProductID uint64    `gorm:"not null;index;uniqueIndex:idx_product_reviews_order_product,priority:2" json:"product_id"`
+	UserID    uint64    `gorm:"not null" json:"user_id"`
+	OrderID   uint64    `gorm:"not null;uniqueIndex:idx_product_reviews_order_product,priority:1" json:"order_id"`
+	Rating    int       `gorm:"not null" json:"rating"`
+	Content   string    `gorm:"type:text" json:"content"`
+}
+
+// RatingSummary 商品评分汇总，average 为平均分，保留一位小数；没有评价时都为 0
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int64   `json:"count"`
+}
+
+// ProductRating 汇总商品的评价
+func ProductRating(db *gorm.DB, productID uint64) (RatingSummary, error) {
+	var row struct {
+		Total int64
+		Count int64
+	}
+	err := db.Model(&ProductReview{}).Select("COALESCE(SUM(rating), 0) AS total, COUNT(*) AS count").
+		Where("product_id = ?", productID).Scan(&row).Error
+	if err != nil || row.Count == 0 {
+		return RatingSummary{}, err
+	}
+	return RatingSummary{Average: math.Round(float64(row.Total)*10/float64(row.Count)) / 10, Count: row.Count}, nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新令牌，只保存令牌的 SHA-256 摘要
+// 同一次登录轮换出的令牌属于同一个 FamilyID，检测到重放时整个 family 一起吊销
+type RefreshToken struct {
+	ID        uint64     `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UserID    uint64     `json:"user_id" gorm:"not null;index"`
+	FamilyID  string     `json:"family_id" gorm:"size:36;not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;unique"`
+	ExpiredAt time.Time  `json:"expired_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`    // 已轮换为新令牌的时间
+	RevokedAt *time.Time `json:"revoked_at"` // 被吊销的时间
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
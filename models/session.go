@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Session 登录会话，ID 即 access token 的 jti，同时也是该次登录的 refresh token family
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:36"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	UserID     uint64     `json:"user_id" gorm:"not null;index"`
+	Device     string     `json:"device" gorm:"size:100"`
+	IP         string     `json:"ip" gorm:"size:45"`
+	UserAgent  string     `json:"user_agent" gorm:"size:255"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiredAt  time.Time  `json:"expired_at" gorm:"not null"` // 随 refresh token 轮换延长
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// AuthMethod 本次登录的认证方式，pwd 为密码登录，wechat 为微信登录
+	AuthMethod string `json:"auth_method" gorm:"size:20;not null;default:pwd"`
+	// MFAVerifiedAt 本次登录通过两步验证的时间，为空表示只验证了第一步
+	MFAVerifiedAt *time.Time `json:"mfa_verified_at,omitempty"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
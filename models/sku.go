@@ -0,0 +1,226 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSKURequired 商品有规格时必须指定 SKU
+	ErrSKURequired = errors.New("请选择商品规格")
+	// ErrSKUNotFound SKU 不存在、不属于该商品或已停用
+	ErrSKUNotFound = errors.New("商品规格不存在或已停用")
+)
+
+// ProductOption 商品规格项，如 颜色: [红色, 蓝色]，同一商品的规格项按 position 排序
+type ProductOption struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ProductID uint64    `gorm:"not null;index" json:"product_id"`
+	Name      string    `gorm:"size:20;not null" json:"name"`
+	Values    []string  `gorm:"column:option_values;type:text;not null;serializer:json" json:"values"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+}
+
+// SKUSpec SKU 在一个规格项上的取值
+type SKUSpec struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ProductSKU 商品 SKU，对应规格项的一个组合，有自己的价格、库存、图片和条码
+// 商品有启用的 SKU 时，商品的库存为启用 SKU 的库存之和，由 SyncSKUStock 维护
+type ProductSKU struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ProductID uint64    `gorm:"not null;uniqueIndex:idx_product_skus_product_spec" json:"product_id"`
+	// SpecKey 规格组合的规范写法，如 颜色:红色;尺码:M，重新生成 SKU 时据此保留原有的价格和库存
+	SpecKey  string    `gorm:"size:255;not null;uniqueIndex:idx_product_skus_product_spec" json:"spec_key"`
+	Name     string    `gorm:"size:255;not null" json:"name"`
+	Specs    []SKUSpec `gorm:"type:text;not null;serializer:json" json:"specs"`
+	Price    float64   `gorm:"type:decimal(10,2);not null" json:"price"`
+	Stock    int       `gorm:"not null;default:0" json:"stock"`
+	ImageURL string    `gorm:"size:255" json:"image_url"`
+	Barcode  string    `gorm:"size:64;index" json:"barcode"`
+	IsActive bool      `gorm:"not null;default:true" json:"is_active"`
+	Position int       `gorm:"not null;default:0" json:"position"`
+}
+
+func (ProductSKU) TableName() string {
+	return "product_skus"
+}
+
+// SKUDefaults 生成 SKU 时新规格组合使用的价格和库存
+type SKUDefaults struct {
+	Price float64
+	Stock int
+}
+
+// GenerateSKUs 用 options 替换商品的规格项，并按规格项的全部组合生成 SKU，返回启用的 SKU
+// 已有的规格组合保留原来的价格、库存、图片和条码并重新启用，新组合使用 defaults，
+// 不再存在的组合只停用不删除，购物车和历史订单仍然可以引用；options 为空时停用全部 SKU
+func GenerateSKUs(db *gorm.DB, productID uint64, options []ProductOption, defaults SKUDefaults) ([]ProductSKU, error) {
+	var skus []ProductSKU
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", productID).Delete(&ProductOption{}).Error; err != nil {
+			return err
+		}
+		for i := range options {
+			options[i].ID = 0
+			options[i].ProductID = productID
+			options[i].Position = i
+		}
+		if len(options) > 0 {
+			if err := tx.Create(&options).Error; err != nil {
+				return err
+			}
+		}
+
+		var existing []ProductSKU
+		if err := tx.Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+			return err
+		}
+		byKey := make(map[string]*ProductSKU, len(existing))
+		for i := range existing {
+			byKey[existing[i].SpecKey] = &existing[i]
+		}
+
+		active := make(map[string]bool)
+		for i, specs := range combinations(options) {
+			key, name := specKey(specs)
+			active[key] = true
+			if sku, ok := byKey[key]; ok {
+				if err := tx.Model(sku).Updates(map[string]interface{}{
+					"name": name, "position": i, "is_active": true,
+				}).Error; err != nil {
+					return err
+				}
+				sku.Name, sku.Specs, sku.Position, sku.IsActive = name, specs, i, true
+				skus = append(skus, *sku)
+				continue
+			}
+			sku := ProductSKU{ProductID: productID, SpecKey: key, Name: name, Specs: specs,
+				Price: defaults.Price, Stock: defaults.Stock, IsActive: true, Position: i}
+			if err := tx.Create(&sku).Error; err != nil {
+				return err
+			}
+			skus = append(skus, sku)
+		}
+
+		for _, sku := range existing {
+			if !active[sku.SpecKey] && sku.IsActive {
+				if err := tx.Model(&sku).UpdateColumn("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return SyncSKUStock(tx, productID)
+	})
+	return skus, err
+}
+
+// combinations 返回规格项取值的全部组合，第一个规格项变化最慢
+func combinations(options []ProductOption) [][]SKUSpec {
+	if len(options) == 0 {
+		return nil
+	}
+	result := [][]SKUSpec{{}}
+	for _, option := range options {
+		next := make([][]SKUSpec, 0, len(result)*len(option.Values))
+		for _, prefix := range result {
+			for _, value := range option.Values {
+				specs := make([]SKUSpec, len(prefix), len(prefix)+1)
+				copy(specs, prefix)
+				next = append(next, append(specs, SKUSpec{Name: option.Name, Value: value}))
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// specKey 返回规格组合的规范写法和展示名称，如 颜色:红色;尺码:M 和 红色 / M
+func specKey(specs []SKUSpec) (key, name string) {
+	keys := make([]string, len(specs))
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		keys[i] = spec.Name + ":" + spec.Value
+		names[i] = spec.Value
+	}
+	return strings.Join(keys, ";"), strings.Join(names, " / ")
+}
+
+// SyncSKUStock 把商品库存设为启用 SKU 的库存之和，商品没有启用的 SKU 时不修改
+// 使用单条 UPDATE 在数据库中求和，不会覆盖并发扣减的结果
+func SyncSKUStock(db *gorm.DB, productID uint64) error {
+	active := func() *gorm.DB {
+		return db.Model(&ProductSKU{}).Where("product_id = ? AND is_active = ?", productID, true)
+	}
+	return db.Model(&Product{}).
+		Where("id = ? AND EXISTS (?)", productID, active().Select("1")).
+		UpdateColumn("stock", active().Select("COALESCE(SUM(stock), 0)")).Error
+}
+
+// ActiveSKUs 返回商品启用的 SKU，按 position 排序
+func ActiveSKUs(db *gorm.DB, productID uint64) ([]ProductSKU, error) {
+	var skus []ProductSKU
+	err := db.Where("product_id = ? AND is_active = ?", productID, true).Order("position, id").Find(&skus).Error
+	return skus, err
+}
+
+// ResolveSKU 校验下单或加购时选择的 SKU，商品没有启用的 SKU 且未指定时返回 nil
+// 商品有启用的 SKU 但未指定时返回 ErrSKURequired，SKU 不属于该商品或已停用时返回 ErrSKUNotFound
+func ResolveSKU(db *gorm.DB, productID uint64, skuID *uint64) (*ProductSKU, error) {
+	if skuID == nil {
+		var count int64
+		if err := db.Model(&ProductSKU{}).Where("product_id = ? AND is_active = ?", productID, true).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrSKURequired
+		}
+		return nil, nil
+	}
+
+	var sku ProductSKU
+	err := db.Where("id = ? AND product_id = ? AND is_active = ?", *skuID, productID, true).First(&sku).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSKUNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sku, nil
+}
+
+// AdjustItemStock 调整订单项或购物车项对应的库存，skuID 为 nil 时调整商品库存，
+// 否则调整 SKU 库存并同步商品库存，delta 为负数表示扣减
+func AdjustItemStock(db *gorm.DB, productID uint64, skuID *uint64, delta int) error {
+	if skuID == nil {
+		return AdjustStock(db, productID, delta)
+	}
+	return AdjustSKUStock(db, productID, *skuID, delta)
+}
+
+// AdjustSKUStock 原子地调整 SKU 库存并同步商品库存，扣减后库存不能小于0
+// 只能从启用的 SKU 扣减；恢复库存（取消订单）时 SKU 即使已停用也照常加回
+func AdjustSKUStock(db *gorm.DB, productID, skuID uint64, delta int) error {
+	query := db.Model(&ProductSKU{}).Where("id = ? AND product_id = ?", skuID, productID)
+	if delta < 0 {
+		query = query.Where("is_active = ? AND stock >= ?", true, -delta)
+	}
+
+	result := query.UpdateColumn("stock", gorm.Expr("stock + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return SyncSKUStock(db, productID)
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// SystemLog 审计日志，记录安全和资金相关的操作，由 audit.Logger 写入
+type SystemLog struct {
+	ID          uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+	UserID      *uint64   `json:"user_id" gorm:"index"` // 操作涉及的用户，可能为空
+	Action      string    `json:"action" gorm:"size:50;not null;index"`
+	Description string    `json:"description" gorm:"type:text"`
+	IPAddress   string    `json:"ip_address" gorm:"size:50"`
+}
+
+func (SystemLog) TableName() string {
+	return "system_logs"
+}
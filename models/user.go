@@ -1,17 +1,24 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
-	ID        uint64     `json:"id" gorm:"primaryKey"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
-	Username  string     `json:"username" gorm:"size:20;not null;unique"`
-	Password  string     `json:"password" gorm:"size:60;not null"`
-	Role      string     `json:"role" gorm:"size:10;not null;default:'user'"`
-	Email     string     `json:"email" gorm:"size:128"`
-	Phone     string     `json:"phone" gorm:"size:20"`
+	ID        uint64         `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	Username  string         `json:"username" gorm:"size:20;not null;unique"`
+	Password  string         `json:"password" gorm:"size:60;not null"`
+	Role      string         `json:"role" gorm:"size:10;not null;default:'user'"`
+	Email     string         `json:"email" gorm:"size:128"`
+	Phone     string         `json:"phone" gorm:"size:20"`
+
+	// EmailVerifiedAt 邮箱验证时间，为空表示邮箱未验证
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 }
 
 func (User) TableName() string {
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// 第三方登录身份的来源
+const (
+	IdentityWechatMini = "wechat_mini" // 微信小程序
+	IdentityWechatWeb  = "wechat_web"  // 微信网页授权
+)
+
+// UserIdentity 用户绑定的第三方登录身份
+// Subject 为第三方平台的用户标识（微信为 openid），同一来源下唯一；
+// 微信的 UnionID 在同一开放平台下的小程序和公众号之间相同，用于关联同一个用户
+type UserIdentity struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint64    `json:"user_id" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"size:20;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject   string    `json:"-" gorm:"size:64;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	UnionID   string    `json:"-" gorm:"size:64;index"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}